@@ -0,0 +1,100 @@
+// Package abi 描述各平台的调用约定, 并据此生成函数的序言和尾声
+package abi
+
+import "fmt"
+
+// Convention 调用约定
+// 寄存器使用所属架构虚拟寄存器表中的物理编号
+type Convention struct {
+	Name        string
+	Arch        string // 适用的架构
+	WordSize    int    // 字长(字节), 也是栈槽的大小
+	StackAlign  int    // 调用其它函数时栈指针的对齐
+	ShadowSpace int    // 调用者为被调用者预留的参数保存区
+	LinkReg     bool   // 返回地址在链接寄存器中, 否则由CALL压栈
+	CalleePops  bool   // 被调用者负责弹出栈上的参数
+	ArgRegs     []int  // 依次传递参数的寄存器
+	CalleeSaved []int  // 被调用者保存的寄存器, 不含栈指针和帧指针
+}
+
+var conventions = map[string]*Convention{
+	"sysv": {
+		Name: "sysv", Arch: "x86", WordSize: 8, StackAlign: 16,
+		ArgRegs:     []int{7, 6, 2, 1, 8, 9},  // rdi rsi rdx rcx r8 r9
+		CalleeSaved: []int{3, 12, 13, 14, 15}, // rbx r12-r15
+	},
+	"win64": {
+		Name: "win64", Arch: "x86", WordSize: 8, StackAlign: 16, ShadowSpace: 32,
+		ArgRegs:     []int{1, 2, 8, 9},              // rcx rdx r8 r9
+		CalleeSaved: []int{3, 6, 7, 12, 13, 14, 15}, // rbx rsi rdi r12-r15
+	},
+	"cdecl": {
+		Name: "cdecl", Arch: "x86", WordSize: 4, StackAlign: 16,
+		CalleeSaved: []int{3, 6, 7}, // ebx esi edi
+	},
+	"stdcall": {
+		Name: "stdcall", Arch: "x86", WordSize: 4, StackAlign: 4, CalleePops: true,
+		CalleeSaved: []int{3, 6, 7}, // ebx esi edi
+	},
+	"riscv": {
+		Name: "riscv", Arch: "riscv64", WordSize: 8, StackAlign: 16, LinkReg: true,
+		ArgRegs:     []int{10, 11, 12, 13, 14, 15, 16, 17},            // a0-a7
+		CalleeSaved: []int{9, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27}, // s1-s11
+	},
+	"o32": {
+		Name: "o32", Arch: "mips", WordSize: 4, StackAlign: 8, ShadowSpace: 16, LinkReg: true,
+		ArgRegs:     []int{4, 5, 6, 7},                     // a0-a3
+		CalleeSaved: []int{16, 17, 18, 19, 20, 21, 22, 23}, // s0-s7
+	},
+	"n64": {
+		Name: "n64", Arch: "mips64", WordSize: 8, StackAlign: 16, LinkReg: true,
+		ArgRegs:     []int{4, 5, 6, 7, 8, 9, 10, 11},       // a0-a7
+		CalleeSaved: []int{16, 17, 18, 19, 20, 21, 22, 23}, // s0-s7
+	},
+	"lp64d": {
+		Name: "lp64d", Arch: "loongarch64", WordSize: 8, StackAlign: 16, LinkReg: true,
+		ArgRegs:     []int{4, 5, 6, 7, 8, 9, 10, 11},           // a0-a7
+		CalleeSaved: []int{23, 24, 25, 26, 27, 28, 29, 30, 31}, // s0-s8
+	},
+}
+
+// 各目标默认的调用约定
+// arm64还没有后端, Go汇编固定使用ABI0, 所以没有AAPCS64
+var defaults = map[string]string{
+	"x86":         "cdecl",
+	"x86_64":      "sysv",
+	"mips":        "o32",
+	"mipsel":      "o32",
+	"mips64":      "n64",
+	"mips64el":    "n64",
+	"riscv":       "riscv",
+	"riscv64":     "riscv",
+	"loongarch":   "lp64d",
+	"loongarch64": "lp64d",
+}
+
+// Lookup 按名称查找调用约定, "default"表示目标的默认约定
+func Lookup(name, target string) (*Convention, error) {
+	if name == "default" {
+		tmp, ok := defaults[target]
+		if !ok {
+			return nil, fmt.Errorf("no default calling convention for %s", target)
+		}
+		name = tmp
+	}
+	conv, ok := conventions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown calling convention %s", name)
+	}
+	return conv, nil
+}
+
+// IsCalleeSaved 判断物理寄存器是否需要由被调用者保存
+func (c *Convention) IsCalleeSaved(num int) bool {
+	for _, n := range c.CalleeSaved {
+		if n == num {
+			return true
+		}
+	}
+	return false
+}
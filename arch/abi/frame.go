@@ -0,0 +1,340 @@
+package abi
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"sort"
+)
+
+// Frame 函数的栈帧布局
+//
+// 建立栈帧后帧指针指向保存旧帧指针的槽位, 返回地址在它上方。
+// 局部变量从帧指针向下排列, 其后是被调用者保存的寄存器,
+// 最底部是调用其它函数时预留的参数保存区。
+type Frame struct {
+	Name     string
+	Locals   int   // 局部变量的字节数
+	ArgBytes int   // 栈上参数的字节数
+	Saved    []int // 需要保存的虚拟寄存器
+	Leaf     bool  // 函数体中没有CALL
+	Size     int   // 返回地址和旧帧指针之外再分配的字节数
+
+	Args   map[*parser.ArgBlock]int // 参数和结果相对帧指针的偏移
+	Spills []Spill                  // 序言中写回home槽的寄存器参数
+	Result *parser.ArgBlock         // 尾声读入返回值寄存器的结果
+}
+
+// Spill 把寄存器传递的参数写回它的home槽
+type Spill struct {
+	Reg    int // 虚拟寄存器
+	Disp   int // 相对帧指针的偏移
+	Length int
+}
+
+// NewFrame 分析函数体, 计算栈帧布局
+func (c *Convention) NewFrame(fn *parser.Node, regs *types.RegTable) *Frame {
+	label := fn.Value.(*parser.LabelBlock)
+	f := &Frame{Name: label.Name, Locals: label.StackRoom, Leaf: true, Args: map[*parser.ArgBlock]int{}}
+	for _, arg := range label.Args {
+		f.ArgBytes += alignUp(arg.Length, c.WordSize)
+	}
+	saved := map[int]bool{}
+	refs := map[*parser.ArgBlock]bool{}
+	use := func(r *parser.Reg) {
+		if r == nil || r.Name != "" {
+			return
+		}
+		phys, err := regs.Lookup(r.Num, 0)
+		if err == nil && c.IsCalleeSaved(phys.Num) {
+			saved[r.Num] = true
+		}
+	}
+	walk(fn, func(n *parser.Node) {
+		i, ok := n.Value.(*parser.Instruction)
+		if !ok {
+			return
+		}
+		if i.Instruction == "CALL" {
+			f.Leaf = false
+		}
+		for _, arg := range i.Args {
+			switch arg.Type {
+			case parser.REG:
+				use(arg.Reg)
+			case parser.ADDR:
+				use(arg.Addr.BaseReg)
+				use(arg.Addr.IndexReg)
+				if arg.Addr.Arg != nil {
+					refs[arg.Addr.Arg] = true
+				}
+			}
+		}
+	})
+	for num := range saved {
+		f.Saved = append(f.Saved, num)
+	}
+	sort.Ints(f.Saved)
+
+	raw := alignUp(f.Locals, c.WordSize) + c.WordSize*len(f.Saved)
+	raw += c.placeArgs(f, label, refs, regs, raw)
+	raw += c.placeResults(f, label, raw)
+	if !f.Leaf {
+		raw += c.ShadowSpace
+	}
+	f.Size = alignUp(2*c.WordSize+raw, c.StackAlign) - 2*c.WordSize
+	return f
+}
+
+// placeArgs 计算参数的位置, 返回为home槽额外分配的字节数
+//
+// 栈上的参数从帧指针+2个字长处开始。有参数保存区的约定(Win64、o32)由调用者
+// 为寄存器参数预留栈槽, 其余约定的home槽分配在被调用者的栈帧中, 位于
+// 被保存的寄存器之下。只有在函数体中被引用的寄存器参数才会写回内存。
+func (c *Convention) placeArgs(f *Frame, label *parser.LabelBlock, refs map[*parser.ArgBlock]bool, regs *types.RegTable, used int) int {
+	w := c.WordSize
+	homeInCaller := c.ShadowSpace > 0
+	next, stack, homes := 0, 0, 0
+	for _, arg := range label.Args {
+		size := alignUp(arg.Length, w)
+		slots := size / w
+		disp := 2*w + stack
+		if next+slots > len(c.ArgRegs) {
+			// 寄存器用完, 通过栈传递
+			stack += size
+			f.Args[arg] = disp
+			continue
+		}
+		first := next
+		next += slots
+		if homeInCaller {
+			stack += size
+		} else {
+			homes += size
+			disp = -(used + homes)
+		}
+		f.Args[arg] = disp
+		if !refs[arg] {
+			continue
+		}
+		for k := 0; k < slots; k++ {
+			num, ok := virtual(regs, c.ArgRegs[first+k])
+			if !ok {
+				continue
+			}
+			length := w
+			if slots == 1 {
+				length = arg.Length
+			}
+			f.Spills = append(f.Spills, Spill{Reg: num, Disp: disp + k*w, Length: length})
+		}
+	}
+	if homeInCaller {
+		return 0
+	}
+	return homes
+}
+
+// placeResults 计算结果槽的位置, 返回额外分配的字节数
+// 结果通过返回值寄存器传递, 结果槽分配在被调用者的栈帧中, 尾声把第一个结果读入%r0
+func (c *Convention) placeResults(f *Frame, label *parser.LabelBlock, used int) int {
+	size := 0
+	for _, res := range label.Results {
+		size += alignUp(res.Length, c.WordSize)
+		f.Args[res] = -(used + size)
+	}
+	if len(label.Results) != 0 {
+		f.Result = label.Results[0]
+	}
+	return size
+}
+
+// virtual 查找物理寄存器对应的虚拟寄存器
+func virtual(regs *types.RegTable, phys int) (int, bool) {
+	for i, reg := range regs.Regs {
+		if reg.Num == phys {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Prologue 函数序言
+func (c *Convention) Prologue(f *Frame) []*parser.Instruction {
+	w := c.WordSize
+	var out []*parser.Instruction
+	if c.LinkReg {
+		total := f.Size + 2*w
+		out = append(out,
+			inst("SUB", c.reg("sp"), imm(total)),
+			inst("MOV", c.mem("sp", total-w, w), c.reg("ra")),
+			inst("MOV", c.mem("sp", total-2*w, w), c.reg("bp")),
+			inst("MOV", c.reg("bp"), c.reg("sp")),
+		)
+		if f.Size != 0 {
+			out = append(out, inst("ADD", c.reg("bp"), imm(f.Size)))
+		}
+	} else {
+		out = append(out,
+			inst("PUSH", c.reg("bp")),
+			inst("MOV", c.reg("bp"), c.reg("sp")),
+		)
+		if f.Size != 0 {
+			out = append(out, inst("SUB", c.reg("sp"), imm(f.Size)))
+		}
+	}
+	for n, num := range f.Saved {
+		out = append(out, inst("MOV", c.mem("bp", -c.savedOffset(f, n), w), c.vreg(num, w)))
+	}
+	for _, spill := range f.Spills {
+		out = append(out, inst("MOV", c.mem("bp", spill.Disp, spill.Length), c.vreg(spill.Reg, spill.Length)))
+	}
+	return out
+}
+
+// Epilogue 函数尾声, 以RET结束
+func (c *Convention) Epilogue(f *Frame) []*parser.Instruction {
+	w := c.WordSize
+	var out []*parser.Instruction
+	if res := f.Result; res != nil {
+		out = append(out, inst("MOV", c.vreg(0, res.Length), c.mem("bp", f.Args[res], res.Length)))
+	}
+	for n, num := range f.Saved {
+		out = append(out, inst("MOV", c.vreg(num, w), c.mem("bp", -c.savedOffset(f, n), w)))
+	}
+	out = append(out, inst("MOV", c.reg("sp"), c.reg("bp")))
+	if c.LinkReg {
+		out = append(out,
+			inst("MOV", c.reg("bp"), c.mem("sp", 0, w)),
+			inst("MOV", c.reg("ra"), c.mem("sp", w, w)),
+			inst("ADD", c.reg("sp"), imm(2*w)),
+		)
+	} else {
+		out = append(out, inst("POP", c.reg("bp")))
+	}
+	if c.CalleePops && f.ArgBytes != 0 {
+		return append(out, inst("RET", imm(f.ArgBytes)))
+	}
+	return append(out, inst("RET"))
+}
+
+// Lower 为函数插入序言和尾声
+// 尾声放在函数末尾的标签 <函数名>.ret 下, 函数体中的RET都改为跳转到这里,
+// 最后一条指令是RET时直接落入尾声
+func (c *Convention) Lower(fn *parser.Node, regs *types.RegTable) {
+	f := c.NewFrame(fn, regs)
+	exit := f.Name + ".ret"
+
+	var last *parser.Node
+	walk(fn, func(n *parser.Node) {
+		if _, ok := n.Value.(*parser.Instruction); ok {
+			last = n
+		}
+	})
+	walk(fn, func(n *parser.Node) {
+		i, ok := n.Value.(*parser.Instruction)
+		if !ok {
+			return
+		}
+		for _, arg := range i.Args {
+			if arg.Type != parser.ADDR || arg.Addr.Arg == nil {
+				continue
+			}
+			if disp, ok := f.Args[arg.Addr.Arg]; ok {
+				arg.Addr.BaseReg = c.reg("bp").Reg
+				arg.Addr.Displacement = int64(disp)
+			}
+		}
+		if i.Instruction != "RET" {
+			return
+		}
+		if n == last {
+			remove(n)
+			return
+		}
+		n.Value = inst("JMP", &parser.Value{Type: parser.LABEL, String: exit})
+	})
+
+	prologue := make([]*parser.Node, 0, len(fn.Children)+8)
+	for _, i := range c.Prologue(f) {
+		prologue = append(prologue, &parser.Node{Value: i, Father: fn})
+	}
+	fn.Children = append(prologue, fn.Children...)
+
+	epilogue := &parser.Node{Value: &parser.LabelBlock{Name: exit}}
+	for _, i := range c.Epilogue(f) {
+		epilogue.AddChild(&parser.Node{Value: i})
+	}
+	fn.AddChild(epilogue)
+}
+
+// 第n个被保存的寄存器相对帧指针的偏移
+func (c *Convention) savedOffset(f *Frame, n int) int {
+	return alignUp(f.Locals, c.WordSize) + c.WordSize*(n+1)
+}
+
+// regType 宽度对应的寄存器类型
+func regType(length int) int {
+	switch length {
+	case 1:
+		return types.Reg8
+	case 2:
+		return types.Reg16
+	case 4:
+		return types.Reg32
+	}
+	return types.Reg64
+}
+
+// reg 按名称引用的字长寄存器: sp、bp、ra
+func (c *Convention) reg(name string) *parser.Value {
+	return &parser.Value{Type: parser.REG, Reg: &parser.Reg{Name: name, Type: regType(c.WordSize)}}
+}
+
+// vreg 指定宽度的虚拟寄存器
+func (c *Convention) vreg(num, length int) *parser.Value {
+	return &parser.Value{Type: parser.REG, Reg: &parser.Reg{Num: num, Type: regType(length)}}
+}
+
+// mem 内存操作数 [base+disp]
+func (c *Convention) mem(base string, disp, length int) *parser.Value {
+	return &parser.Value{Type: parser.ADDR, Addr: &parser.MemoryAddr{
+		BaseReg:      &parser.Reg{Name: base, Type: regType(c.WordSize)},
+		Displacement: int64(disp),
+		Length:       length,
+	}}
+}
+
+func imm(n int) *parser.Value {
+	return &parser.Value{Type: parser.NUMBER, Num: int64(n)}
+}
+
+func inst(name string, args ...*parser.Value) *parser.Instruction {
+	return &parser.Instruction{Instruction: types.Instruction(name), Args: args}
+}
+
+// walk 按源码顺序遍历子树, 遍历期间允许修改当前节点
+func walk(node *parser.Node, f func(n *parser.Node)) {
+	children := append([]*parser.Node(nil), node.Children...)
+	for _, n := range children {
+		f(n)
+		walk(n, f)
+	}
+}
+
+// remove 从父节点中删除
+func remove(n *parser.Node) {
+	father := n.Father
+	for i, child := range father.Children {
+		if child == n {
+			father.Children = append(father.Children[:i], father.Children[i+1:]...)
+			return
+		}
+	}
+}
+
+func alignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,40 @@
+package arch
+
+import (
+	"CuteASM/parser"
+	"bytes"
+	"strconv"
+)
+
+// GASAlign 按GNU as的写法输出对齐, 代码段中未指定填充时由汇编器填充NOP
+func GASAlign(a *parser.AlignBlock) string {
+	line := ".p2align " + strconv.Itoa(a.Log2())
+	limited := a.Max >= 0 && a.Max < a.Align-1
+	switch {
+	case a.HasFill && limited:
+		line += ", " + strconv.Itoa(int(a.Fill)) + ", " + strconv.Itoa(a.Max)
+	case a.HasFill:
+		line += ", " + strconv.Itoa(int(a.Fill))
+	case limited:
+		line += ",, " + strconv.Itoa(a.Max)
+	}
+	return line
+}
+
+// Padding 定长指令的架构在pc处对齐需要的填充
+// 代码中未指定填充时先用0补齐到指令边界, 其余填充nop
+func Padding(a *parser.AlignBlock, pc uint64, nop []byte) []byte {
+	n := a.Padding(pc)
+	if !a.Code || a.HasFill {
+		return bytes.Repeat([]byte{a.Fill}, n)
+	}
+	head := int(-pc % uint64(len(nop)))
+	if head > n {
+		head = n
+	}
+	code := make([]byte, head, n)
+	for len(code)+len(nop) <= n {
+		code = append(code, nop...)
+	}
+	return append(code, make([]byte, n-len(code))...)
+}
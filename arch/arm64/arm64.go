@@ -0,0 +1,64 @@
+// Package arm64 描述AArch64架构
+package arm64
+
+import (
+	"CuteASM/arch/types"
+	"encoding/binary"
+	"strconv"
+)
+
+// 常用寄存器编号
+const (
+	regFP = 29
+	regLR = 30
+	regSP = 31
+)
+
+// RegLookup 寄存器名称到编号的映射
+var RegLookup = map[string]types.Register{
+	"fp": regFP,
+	"lr": regLR,
+	"sp": regSP,
+}
+
+func init() {
+	for i := 0; i < 31; i++ {
+		RegLookup["x"+strconv.Itoa(i)] = types.Register(i)
+		RegLookup["w"+strconv.Itoa(i)] = types.Register(i)
+	}
+}
+
+// New 创建AArch64架构实例
+func New() *types.Architecture {
+	return &types.Architecture{
+		Name:         "arm64",
+		RegisterList: RegLookup,
+		WordSize:     64,
+		ByteOrder:    binary.LittleEndian,
+		Registers:    regTable(),
+	}
+}
+
+// regTable 虚拟寄存器表(AAPCS64)
+// x8(间接返回)、x16-x17(过程间临时)和x18(平台保留)不参与分配
+func regTable() *types.RegTable {
+	t := &types.RegTable{
+		Arch: "arm64",
+		Bits: 64,
+		Named: map[string]types.PhysReg{
+			"sp": {Num: regSP, Name: "sp", Class: types.RegSaved},
+			"bp": {Num: regFP, Name: "x29", Class: types.RegSaved},
+			"ra": {Num: regLR, Name: "x30", Class: types.RegScratch},
+		},
+	}
+	add := func(class types.RegClass, from, to int) {
+		for i := from; i <= to; i++ {
+			t.Regs = append(t.Regs, types.PhysReg{Num: i, Name: "x" + strconv.Itoa(i), Class: class})
+		}
+	}
+	add(types.RegReturn, 0, 0)
+	add(types.RegArg, 1, 7)
+	add(types.RegScratch, 9, 15)
+	add(types.RegSaved, 19, 28)
+	return t
+}
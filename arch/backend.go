@@ -0,0 +1,67 @@
+package arch
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+)
+
+// Backend 目标架构后端
+//
+// 编译器按源码顺序把段、标签和指令交给后端, 后端把可移植的CuteASM指令
+// 翻译成目标指令, 输出文本汇编; 实现Assembler的后端还可以编码成机器码。
+type Backend interface {
+	// Arch 返回架构描述
+	Arch() *types.Architecture
+	// Prepare 在翻译之前扫描整棵语法树
+	Prepare(root *parser.Node)
+	// Section 切换当前段
+	Section(name string)
+	// Label 定义标签, 调用前需要先Flush当前基本块
+	Label(name string)
+	// Emit 翻译一条指令, 结果缓存在后端中
+	Emit(i *parser.Instruction) error
+	// Data 输出初始化数据, 调用前需要先Flush当前基本块
+	Data(d *parser.DataBlock) error
+	// Align 对齐当前位置, 调用前需要先Flush当前基本块
+	Align(a *parser.AlignBlock) error
+	// Flush 结束当前基本块, 返回自上次调用以来生成的文本汇编
+	Flush() []string
+}
+
+// Assembler 能编码机器码的后端
+// 未实现时只输出文本汇编, 如Go汇编交给go工具链汇编
+type Assembler interface {
+	// Assemble 把已翻译的全部指令编码为机器码
+	Assemble() ([]byte, error)
+}
+
+// Syntax 文本汇编的写法, 后端可以选择实现
+// 未实现时段、标签和注释使用NASM的写法
+type Syntax interface {
+	// Comment 注释行
+	Comment(text string) string
+	// SectionLine 切换段的伪指令
+	SectionLine(name string) string
+	// LabelLine 定义标签, 为空时不输出
+	LabelLine(name string) string
+	// Header 文件开头的伪指令
+	Header() []string
+	// Footer 文件末尾的伪指令
+	Footer() []string
+}
+
+// Equ 依赖标签地址的常量, 后端可以选择实现
+// 这样的常量交给目标汇编器计算, 未实现时无法使用
+type Equ interface {
+	// EquLine 定义符号常量
+	EquLine(name string, e *parser.Expr) (string, error)
+}
+
+// Symbols 符号的可见性和属性, 后端可以选择实现
+// 未实现时使用NASM的global和extern
+type Symbols interface {
+	// SymbolLines 文件开头声明符号的伪指令
+	SymbolLines(t *parser.SymbolTable) []string
+	// SymbolEnd 函数结束处的伪指令
+	SymbolEnd(s *parser.Symbol) []string
+}
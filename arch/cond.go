@@ -0,0 +1,28 @@
+package arch
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+)
+
+// UnsignedCmps 找出之后的条件跳转按无符号比较的CMP
+// 没有标志位的后端提前保存CMP的结果时, 据此选择有符号或无符号比较
+func UnsignedCmps(root *parser.Node) map[*parser.Instruction]bool {
+	cmps := map[*parser.Instruction]bool{}
+	var last *parser.Instruction
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			if i.Instruction == "CMP" {
+				last = i
+			} else if cond, ok := types.BranchCond(i.Instruction); ok && last != nil && types.CondUnsigned(cond) {
+				cmps[last] = true
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+	return cmps
+}
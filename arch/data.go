@@ -0,0 +1,49 @@
+package arch
+
+import (
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GASData 按GNU as的写法输出初始化数据, directives为各宽度对应的伪指令
+// 字符串使用.ascii, 重复的项使用.rept
+func GASData(d *parser.DataBlock, order binary.ByteOrder, directives map[int]string) []string {
+	var lines []string
+	for _, line := range d.Lines(order, ".") {
+		var text string
+		if line.Width == 0 {
+			if len(line.Str) == 0 {
+				continue
+			}
+			text = ".ascii " + GASString(line.Str)
+		} else {
+			text = directives[line.Width] + " " + strings.Join(line.Values, ", ")
+		}
+		switch line.Count {
+		case 0:
+		case 1:
+			lines = append(lines, text)
+		default:
+			lines = append(lines, ".rept "+strconv.Itoa(line.Count), "    "+text, ".endr")
+		}
+	}
+	return lines
+}
+
+// GASString GNU as的字符串字面量, 不可打印的字符使用八进制转义
+func GASString(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			fmt.Fprintf(&sb, "\\%03o", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
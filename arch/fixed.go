@@ -0,0 +1,227 @@
+package arch
+
+import (
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+)
+
+// Reloc 编码时无法解析的符号引用, 由链接器填写
+type Reloc struct {
+	Offset int
+	Sym    string
+	Type   int // 架构的重定位类型
+	Addend int64
+}
+
+// FixedInst 定长4字节的指令
+type FixedInst interface {
+	// Encode 编码地址pc处的指令, syms为本文件内符号的地址, 引用其它符号时返回重定位
+	Encode(pc uint64, syms map[string]uint64) (uint32, *Reloc, error)
+	// Uncond 无条件跳转, 之后的代码不可达
+	Uncond() bool
+}
+
+// FallsThrough 基本块的末尾可以执行到下一个基本块, 需要保存CMP的结果
+func FallsThrough[I FixedInst](block []I) bool {
+	n := len(block)
+	return n == 0 || !block[n-1].Uncond()
+}
+
+type fixedItem[I FixedInst] struct {
+	label string
+	inst  I
+	data  *parser.DataBlock
+	align *parser.AlignBlock
+	equ   *parser.Expr // 依赖标签地址的常量label的值
+}
+
+// 各宽度数据的伪指令
+var gasDirectives = map[int]string{1: ".byte", 2: ".half", 4: ".word", 8: ".dword"}
+
+// Fixed 定长指令架构(MIPS、RISC-V、LoongArch)共用的GNU as文本和两遍汇编
+// 后端嵌入Fixed, 按顺序记录标签、指令、数据、对齐和常量, Assemble时先排布地址再编码
+type Fixed[I FixedInst] struct {
+	Relocs []Reloc           // 最近一次Assemble留下的外部符号引用
+	Labels map[string]uint64 // 最近一次Assemble得到的标签地址和常量的值, 地址从0开始
+
+	name         string // 报错的前缀
+	order        binary.ByteOrder
+	nop          I   // 代码对齐时填充的指令
+	abs32, abs64 int // 数据中4字节、8字节地址的重定位类型
+	prog         []fixedItem[I]
+	text         []string // 还未返回的数据
+}
+
+// NewFixed 创建定长指令的程序
+func NewFixed[I FixedInst](name string, order binary.ByteOrder, nop I, abs32, abs64 int) Fixed[I] {
+	return Fixed[I]{name: name, order: order, nop: nop, abs32: abs32, abs64: abs64}
+}
+
+// Label 定义标签
+func (f *Fixed[I]) Label(name string) {
+	f.prog = append(f.prog, fixedItem[I]{label: name})
+}
+
+// Data 输出初始化数据
+func (f *Fixed[I]) Data(d *parser.DataBlock) error {
+	f.prog = append(f.prog, fixedItem[I]{data: d})
+	f.text = append(f.text, GASData(d, f.order, gasDirectives)...)
+	return nil
+}
+
+// Align 对齐当前位置
+func (f *Fixed[I]) Align(a *parser.AlignBlock) error {
+	f.prog = append(f.prog, fixedItem[I]{align: a})
+	f.text = append(f.text, GASAlign(a))
+	return nil
+}
+
+// EquLine 定义依赖标签地址的常量, Assemble在确定地址后计算它的值
+func (f *Fixed[I]) EquLine(name string, e *parser.Expr) (string, error) {
+	f.prog = append(f.prog, fixedItem[I]{label: name, equ: e})
+	return ".set " + name + ", " + e.Format("."), nil
+}
+
+// Comment GNU as的注释行
+func (f *Fixed[I]) Comment(text string) string {
+	return "# " + text
+}
+
+// SectionLine 切换段
+func (f *Fixed[I]) SectionLine(name string) string {
+	return ".section " + name
+}
+
+// LabelLine 定义标签
+func (f *Fixed[I]) LabelLine(name string) string {
+	return name + ":"
+}
+
+// Header 文件开头的伪指令
+func (f *Fixed[I]) Header() []string {
+	return nil
+}
+
+// Footer 文件末尾的伪指令
+func (f *Fixed[I]) Footer() []string {
+	return nil
+}
+
+// SymbolLines 按GNU as的写法声明符号
+func (f *Fixed[I]) SymbolLines(t *parser.SymbolTable) []string {
+	return GASSymbols(t)
+}
+
+// SymbolEnd 在函数结束处记录函数的大小
+func (f *Fixed[I]) SymbolEnd(s *parser.Symbol) []string {
+	return GASSymbolEnd(s)
+}
+
+// Flush 把一个基本块的指令加入程序, 返回缓存的数据和这些指令的文本
+func (f *Fixed[I]) Flush(block []I, text func(I) string) []string {
+	lines := f.text
+	f.text = nil
+	for _, in := range block {
+		f.prog = append(f.prog, fixedItem[I]{inst: in})
+		lines = append(lines, text(in))
+	}
+	return lines
+}
+
+// Assemble 编码全部指令
+// 本文件内定义的标签直接解析, 其余符号记录在Relocs中
+func (f *Fixed[I]) Assemble() ([]byte, error) {
+	syms := map[string]uint64{}
+	equs := map[string]uint64{} // 常量定义处的地址, 即表达式中的$
+	pc := uint64(0)
+	for _, it := range f.prog {
+		switch {
+		case it.data != nil:
+			pc += uint64(it.data.Len())
+		case it.align != nil:
+			pc += uint64(it.align.Padding(pc))
+		case it.equ != nil:
+			equs[it.label] = pc
+		case it.label != "":
+			syms[it.label] = pc
+		default:
+			pc += 4
+		}
+	}
+	// 常量按定义的顺序计算, 可以引用前面的常量
+	for _, it := range f.prog {
+		if it.equ == nil {
+			continue
+		}
+		v, err := it.equ.Eval(func(name string) (int64, error) {
+			if name == "$" {
+				return int64(equs[it.label]), nil
+			}
+			if addr, ok := syms[name]; ok {
+				return int64(addr), nil
+			}
+			return 0, fmt.Errorf("%s is not defined in this file", name)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: constant %s: %v", f.name, it.label, err)
+		}
+		syms[it.label] = uint64(v)
+	}
+	f.Labels = syms
+	nop, _, err := f.nop.Encode(0, nil)
+	if err != nil {
+		return nil, err
+	}
+	nopBytes := make([]byte, 4)
+	f.order.PutUint32(nopBytes, nop)
+	f.Relocs = nil
+	code := make([]byte, 0, pc)
+	word := make([]byte, 4)
+	for _, it := range f.prog {
+		pc := uint64(len(code))
+		switch {
+		case it.align != nil:
+			code = append(code, Padding(it.align, pc, nopBytes)...)
+		case it.data != nil:
+			bin, err := f.data(it.data, pc)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, bin...)
+		case it.label == "":
+			w, reloc, err := it.inst.Encode(pc, syms)
+			if err != nil {
+				return nil, err
+			}
+			if reloc != nil {
+				reloc.Offset = int(pc)
+				f.Relocs = append(f.Relocs, *reloc)
+			}
+			f.order.PutUint32(word, w)
+			code = append(code, word...)
+		}
+	}
+	return code, nil
+}
+
+// data 编码初始化数据, 标签的地址留给链接器填写
+func (f *Fixed[I]) data(d *parser.DataBlock, pc uint64) ([]byte, error) {
+	bin, refs, err := d.Bytes(f.order)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", f.name, err)
+	}
+	for _, ref := range refs {
+		reloc := Reloc{Offset: int(pc) + ref.Offset, Sym: ref.Sym, Addend: ref.Addend}
+		switch ref.Size {
+		case 4:
+			reloc.Type = f.abs32
+		case 8:
+			reloc.Type = f.abs64
+		default:
+			return nil, fmt.Errorf("%s: the address of %s does not fit in %d bytes", f.name, ref.Sym, ref.Size)
+		}
+		f.Relocs = append(f.Relocs, reloc)
+	}
+	return bin, nil
+}
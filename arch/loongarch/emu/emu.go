@@ -0,0 +1,461 @@
+// Package emu 纯Go实现的LoongArch64用户态模拟器
+//
+// 模拟器解码并执行LoongArch后端使用的整数指令, 用来在没有目标机器时检查后端的输出:
+// 用后端汇编一段代码, 放在地址0执行, 再检查寄存器和内存。
+// 解码按指令集手册进行, 不使用后端的编码表, 编码错误会表现为结果不一致。
+//
+// 机器模型:
+//   - 32个64位通用寄存器和PC, $zero恒为0。
+//   - 平坦的小端序内存从地址0开始, 共Config.MemSize字节, 越界访问是错误。
+//     栈从内存顶端向下增长。
+//   - BREAK停止执行, 不支持系统调用、浮点和特权指令。
+package emu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// StopAddr Call设置的返回地址, 返回到这里时停止执行
+const StopAddr = 0x7ffff000
+
+const (
+	regRA = 1
+	regSP = 3
+)
+
+// Config 模拟器的设置, 为0的项使用默认值
+type Config struct {
+	MemSize  int // 内存的字节数, 默认1M
+	MaxSteps int // 最多执行的指令数, 默认100万, 用于发现死循环
+}
+
+// CPU 模拟器的状态
+type CPU struct {
+	Regs [32]uint64
+	PC   uint64
+	Mem  []byte
+
+	Steps  int  // 已经执行的指令数
+	Halted bool // 因BREAK停止
+
+	cfg  Config
+	next uint64 // 下一条指令的地址
+}
+
+// Fault 执行时的错误
+type Fault struct {
+	PC   uint64 // 出错指令的地址
+	Word uint32 // 出错的指令
+	Err  string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("emu: %#x [%08x]: %s", f.PC, f.Word, f.Err)
+}
+
+// fault 执行中的错误, 由Step恢复为*Fault
+type fault string
+
+// New 创建模拟器, 栈指针指向内存顶端
+func New(cfg Config) *CPU {
+	if cfg.MemSize == 0 {
+		cfg.MemSize = 1 << 20
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = 1000000
+	}
+	c := &CPU{Mem: make([]byte, cfg.MemSize), cfg: cfg}
+	c.Regs[regSP] = uint64(len(c.Mem)) &^ 15
+	return c
+}
+
+// Load 把code复制到addr
+func (c *CPU) Load(addr uint64, code []byte) error {
+	if addr > uint64(len(c.Mem)) || uint64(len(code)) > uint64(len(c.Mem))-addr {
+		return fmt.Errorf("emu: %d bytes at %#x do not fit in memory", len(code), addr)
+	}
+	copy(c.Mem[addr:], code)
+	return nil
+}
+
+// Call 把$ra设为StopAddr并从addr执行, 直到返回或BREAK
+func (c *CPU) Call(addr uint64) error {
+	c.Regs[regRA] = StopAddr
+	c.PC = addr
+	return c.Run()
+}
+
+// Run 从PC执行到BREAK或返回到StopAddr
+func (c *CPU) Run() error {
+	for !c.Halted && c.PC != StopAddr {
+		if c.Steps >= c.cfg.MaxSteps {
+			return &Fault{PC: c.PC, Err: fmt.Sprintf("step limit %d exceeded", c.cfg.MaxSteps)}
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 执行一条指令
+func (c *CPU) Step() (err error) {
+	var w uint32
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(fault)
+			if !ok {
+				panic(r)
+			}
+			err = &Fault{PC: c.PC, Word: w, Err: string(f)}
+		}
+	}()
+	w = uint32(c.read(c.PC, 4))
+	c.Steps++
+	c.next = c.PC + 4
+	c.exec(w)
+	c.Regs[0] = 0
+	if !c.Halted {
+		c.PC = c.next
+	}
+	return nil
+}
+
+// Read 读取内存中size字节的无符号数
+func (c *CPU) Read(addr uint64, size int) (v uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("emu: %s", r)
+		}
+	}()
+	return c.read(addr, size), nil
+}
+
+// Dump 输出寄存器
+func (c *CPU) Dump() string {
+	s := ""
+	for n, v := range c.Regs {
+		s += fmt.Sprintf("$r%-2d = %#x\n", n, v)
+	}
+	return s + fmt.Sprintf("pc   = %#x\n", c.PC)
+}
+
+func (c *CPU) read(addr uint64, size int) uint64 {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b))
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (c *CPU) write(addr uint64, size int, v uint64) {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, v)
+	}
+}
+
+func (c *CPU) check(addr uint64, size int) {
+	if addr > uint64(len(c.Mem)) || uint64(size) > uint64(len(c.Mem))-addr {
+		panic(fault(fmt.Sprintf("%d-byte access at %#x is outside memory", size, addr)))
+	}
+}
+
+// sext 把低n位符号扩展
+func sext(v uint64, n uint) uint64 {
+	return uint64(int64(v<<(64-n)) >> (64 - n))
+}
+
+// 按操作码的长度依次匹配: 3R和ui5移位为17位, ui6移位为16位, 12位立即数为10位,
+// 20位立即数为7位, 跳转为6位
+func (c *CPU) exec(w uint32) {
+	rd, rj, rk := w&31, w>>5&31, w>>10&31
+	if c.exec3R(w>>15, rd, rj, rk) {
+		return
+	}
+	j, d := c.Regs[rj], c.Regs[rd]
+	set := func(v uint64) { c.Regs[rd] = v }
+	switch w >> 17 {
+	case 0x02: // alsl.w
+		set(sext(j<<(w>>15&3+1)+c.Regs[rk], 32))
+		return
+	case 0x16: // alsl.d
+		set(j<<(w>>15&3+1) + c.Regs[rk])
+		return
+	}
+	switch w >> 16 {
+	case 0x41: // slli.d
+		set(j << (w >> 10 & 63))
+		return
+	case 0x45: // srli.d
+		set(j >> (w >> 10 & 63))
+		return
+	case 0x49: // srai.d
+		set(uint64(int64(j) >> (w >> 10 & 63)))
+		return
+	}
+	si12, ui12 := sext(uint64(w>>10), 12), uint64(w>>10&0xfff)
+	switch w >> 22 {
+	case 0x08: // slti
+		set(b2u(int64(j) < int64(si12)))
+	case 0x09: // sltui
+		set(b2u(j < si12))
+	case 0x0a: // addi.w
+		set(sext(j+si12, 32))
+	case 0x0b: // addi.d
+		set(j + si12)
+	case 0x0c: // lu52i.d
+		set(j&(1<<52-1) | si12<<52)
+	case 0x0d: // andi
+		set(j & ui12)
+	case 0x0e: // ori
+		set(j | ui12)
+	case 0x0f: // xori
+		set(j ^ ui12)
+	case 0xa0: // ld.b
+		set(sext(c.read(j+si12, 1), 8))
+	case 0xa1: // ld.h
+		set(sext(c.read(j+si12, 2), 16))
+	case 0xa2: // ld.w
+		set(sext(c.read(j+si12, 4), 32))
+	case 0xa3: // ld.d
+		set(c.read(j+si12, 8))
+	case 0xa4: // st.b
+		c.write(j+si12, 1, d)
+	case 0xa5: // st.h
+		c.write(j+si12, 2, d)
+	case 0xa6: // st.w
+		c.write(j+si12, 4, d)
+	case 0xa7: // st.d
+		c.write(j+si12, 8, d)
+	case 0xa8: // ld.bu
+		set(c.read(j+si12, 1))
+	case 0xa9: // ld.hu
+		set(c.read(j+si12, 2))
+	case 0xaa: // ld.wu
+		set(c.read(j+si12, 4))
+	default:
+		c.exec20(w, rd, j, d)
+	}
+}
+
+// exec3R 执行三寄存器的运算、ui5移位和BREAK, 不是这些指令时返回false
+func (c *CPU) exec3R(op, rd, rj, rk uint32) bool {
+	j, k := c.Regs[rj], c.Regs[rk]
+	x, y := int32(j), int32(k)
+	var v uint64
+	switch op {
+	case 0x20: // add.w
+		v = sext(j+k, 32)
+	case 0x21: // add.d
+		v = j + k
+	case 0x22: // sub.w
+		v = sext(j-k, 32)
+	case 0x23: // sub.d
+		v = j - k
+	case 0x24: // slt
+		v = b2u(int64(j) < int64(k))
+	case 0x25: // sltu
+		v = b2u(j < k)
+	case 0x26: // maskeqz
+		if k != 0 {
+			v = j
+		}
+	case 0x27: // masknez
+		if k == 0 {
+			v = j
+		}
+	case 0x28: // nor
+		v = ^(j | k)
+	case 0x29: // and
+		v = j & k
+	case 0x2a: // or
+		v = j | k
+	case 0x2b: // xor
+		v = j ^ k
+	case 0x2c: // orn
+		v = j | ^k
+	case 0x2d: // andn
+		v = j &^ k
+	case 0x2e: // sll.w
+		v = sext(uint64(uint32(x)<<(k&31)), 32)
+	case 0x2f: // srl.w
+		v = sext(uint64(uint32(x)>>(k&31)), 32)
+	case 0x30: // sra.w
+		v = uint64(int64(x >> (k & 31)))
+	case 0x31: // sll.d
+		v = j << (k & 63)
+	case 0x32: // srl.d
+		v = j >> (k & 63)
+	case 0x33: // sra.d
+		v = uint64(int64(j) >> (k & 63))
+	case 0x36: // rotr.w
+		v = sext(uint64(bits.RotateLeft32(uint32(x), -int(k&31))), 32)
+	case 0x37: // rotr.d
+		v = bits.RotateLeft64(j, -int(k&63))
+	case 0x38: // mul.w
+		v = sext(uint64(x*y), 32)
+	case 0x39: // mulh.w
+		v = uint64(int64(x) * int64(y) >> 32)
+	case 0x3a: // mulh.wu
+		v = sext(uint64(uint32(x))*uint64(uint32(y))>>32, 32)
+	case 0x3b: // mul.d
+		v = j * k
+	case 0x3c: // mulh.d
+		hi, _ := bits.Mul64(j, k)
+		if int64(j) < 0 {
+			hi -= k
+		}
+		if int64(k) < 0 {
+			hi -= j
+		}
+		v = hi
+	case 0x3d: // mulh.du
+		v, _ = bits.Mul64(j, k)
+	case 0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47:
+		v = c.div(op, j, k)
+	case 0x54: // break
+		c.Halted = true
+		return true
+	case 0x81: // slli.w
+		v = sext(uint64(uint32(x)<<rk), 32)
+	case 0x89: // srli.w
+		v = sext(uint64(uint32(x)>>rk), 32)
+	case 0x91: // srai.w
+		v = uint64(int64(x >> rk))
+	default:
+		return false
+	}
+	c.Regs[rd] = v
+	return true
+}
+
+// div 除法和取余, 除数为0时结果不确定, 这里取0
+func (c *CPU) div(op uint32, j, k uint64) uint64 {
+	x, y := int32(j), int32(k)
+	switch {
+	case op < 0x44 && y == 0, op >= 0x44 && k == 0:
+		return 0
+	}
+	switch op {
+	case 0x40: // div.w
+		if y == -1 {
+			return sext(uint64(-x), 32)
+		}
+		return sext(uint64(x/y), 32)
+	case 0x41: // mod.w
+		if y == -1 {
+			return 0
+		}
+		return sext(uint64(x%y), 32)
+	case 0x42: // div.wu
+		return sext(uint64(uint32(x)/uint32(y)), 32)
+	case 0x43: // mod.wu
+		return sext(uint64(uint32(x)%uint32(y)), 32)
+	case 0x44: // div.d
+		if int64(k) == -1 {
+			return -j
+		}
+		return uint64(int64(j) / int64(k))
+	case 0x45: // mod.d
+		if int64(k) == -1 {
+			return 0
+		}
+		return uint64(int64(j) % int64(k))
+	case 0x46: // div.du
+		return j / k
+	}
+	return j % k // mod.du
+}
+
+// exec20 执行20位立即数和跳转指令
+func (c *CPU) exec20(w, rd uint32, j, d uint64) {
+	si20 := sext(uint64(w>>5), 20)
+	switch w >> 25 {
+	case 0x0a: // lu12i.w
+		c.Regs[rd] = sext(si20<<12, 32)
+		return
+	case 0x0b: // lu32i.d
+		c.Regs[rd] = uint64(uint32(d)) | si20<<32
+		return
+	case 0x0c: // pcaddi
+		c.Regs[rd] = c.PC + si20<<2
+		return
+	case 0x0d: // pcalau12i
+		c.Regs[rd] = (c.PC + si20<<12) &^ 0xfff
+		return
+	case 0x0e: // pcaddu12i
+		c.Regs[rd] = c.PC + si20<<12
+		return
+	case 0x0f: // pcaddu18i
+		c.Regs[rd] = c.PC + si20<<18
+		return
+	}
+	offs16 := sext(uint64(w>>10), 16) << 2
+	offs21 := sext(uint64(w>>10&0xffff|(w&31)<<16), 21) << 2
+	offs26 := sext(uint64(w>>10&0xffff|(w&0x3ff)<<16), 26) << 2
+	taken := false
+	switch w >> 26 {
+	case 0x10: // beqz
+		if j == 0 {
+			c.next = c.PC + offs21
+		}
+		return
+	case 0x11: // bnez
+		if j != 0 {
+			c.next = c.PC + offs21
+		}
+		return
+	case 0x13: // jirl
+		c.Regs[rd] = c.PC + 4
+		c.next = j + offs16
+		return
+	case 0x14: // b
+		c.next = c.PC + offs26
+		return
+	case 0x15: // bl
+		c.Regs[regRA] = c.PC + 4
+		c.next = c.PC + offs26
+		return
+	case 0x16: // beq
+		taken = j == d
+	case 0x17: // bne
+		taken = j != d
+	case 0x18: // blt
+		taken = int64(j) < int64(d)
+	case 0x19: // bge
+		taken = int64(j) >= int64(d)
+	case 0x1a: // bltu
+		taken = j < d
+	case 0x1b: // bgeu
+		taken = j >= d
+	default:
+		panic(fault("reserved instruction"))
+	}
+	if taken {
+		c.next = c.PC + offs16
+	}
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
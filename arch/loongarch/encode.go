@@ -0,0 +1,214 @@
+package loongarch
+
+import (
+	"CuteASM/arch"
+	"fmt"
+	"strconv"
+)
+
+// 重定位类型
+const (
+	relNone      = iota
+	relPCHi20    // %pc_hi20(sym), 配合pcalau12i
+	relPCLo12    // %pc_lo12(sym), 符号地址的低12位
+	relPCAddHi20 // %pcadd_hi20(sym), 配合pcaddu12i
+	relPCAddLo12 // %pcadd_lo12(sym), 相对前一条pcaddu12i的低12位
+	relAbsHi20   // %abs_hi20(sym), 配合lu12i.w的绝对值高20位
+	relAbsLo12   // %abs_lo12(sym), 配合ori的绝对值低12位
+	relBranch16  // 16位PC相对分支
+	relBranch21  // 21位PC相对分支
+	relBranch26  // 26位PC相对跳转
+	relAbs32     // 数据中的32位绝对地址
+	relAbs64     // 数据中的64位绝对地址
+)
+
+// Inst 一条LoongArch机器指令
+type Inst struct {
+	Op    string
+	Rd    int
+	Rj    int
+	Rk    int
+	Imm   int64
+	Sym   string // 引用的符号(标签), 配合Reloc使用
+	Reloc int
+}
+
+// 符号加偏移的文本形式
+func symText(sym string, addend int64) string {
+	if addend == 0 {
+		return sym
+	}
+	if addend > 0 {
+		return sym + "+" + strconv.FormatInt(addend, 10)
+	}
+	return sym + strconv.FormatInt(addend, 10)
+}
+
+// 立即数部分的文本形式
+func (in *Inst) immText() string {
+	switch in.Reloc {
+	case relPCHi20:
+		return "%pc_hi20(" + symText(in.Sym, in.Imm) + ")"
+	case relPCLo12:
+		return "%pc_lo12(" + symText(in.Sym, in.Imm) + ")"
+	case relPCAddHi20:
+		return "%pcadd_hi20(" + symText(in.Sym, in.Imm) + ")"
+	case relPCAddLo12:
+		return "%pcadd_lo12(" + symText(in.Sym, in.Imm) + ")"
+	case relAbsHi20:
+		return "%abs_hi20(" + symText(in.Sym, in.Imm) + ")"
+	case relAbsLo12:
+		return "%abs_lo12(" + symText(in.Sym, in.Imm) + ")"
+	case relBranch16, relBranch21, relBranch26:
+		return symText(in.Sym, in.Imm)
+	}
+	return strconv.FormatInt(in.Imm, 10)
+}
+
+// Text 把指令格式化为GNU as语法
+func (in *Inst) Text() string {
+	info := instructions[in.Op]
+	r := func(kind byte, n int) string {
+		switch kind {
+		case 'f':
+			return "$" + fregNames[n]
+		case 'c':
+			return "$fcc" + strconv.Itoa(n)
+		}
+		return "$" + regNames[n]
+	}
+	kind := func(i int) byte {
+		if i < len(info.Regs) {
+			return info.Regs[i]
+		}
+		return 'r'
+	}
+	rd, rj, rk := r(kind(0), in.Rd), r(kind(1), in.Rj), r(kind(2), in.Rk)
+	switch info.Format {
+	case fmt3R:
+		if in.Op == "or" && in.Rk == regZero {
+			return "move " + rd + ", " + rj
+		}
+		return in.Op + " " + rd + ", " + rj + ", " + rk
+	case fmt2R:
+		return in.Op + " " + rd + ", " + rj
+	case fmtALSL:
+		return in.Op + " " + rd + ", " + rj + ", " + rk + ", " + in.immText()
+	case fmt2RI5, fmt2RI6, fmt2RI12:
+		return in.Op + " " + rd + ", " + rj + ", " + in.immText()
+	case fmt1RI20:
+		return in.Op + " " + rd + ", " + in.immText()
+	case fmt2RI16:
+		// 条件分支的第一个操作数是rj
+		return in.Op + " " + r('r', in.Rj) + ", " + r('r', in.Rd) + ", " + in.immText()
+	case fmtJIRL:
+		if in.Rd == regZero && in.Reloc == relNone && in.Imm == 0 {
+			return "jr " + rj
+		}
+		return in.Op + " " + rd + ", " + rj + ", " + in.immText()
+	case fmt1RI21:
+		return in.Op + " " + r('r', in.Rj) + ", " + in.immText()
+	case fmtBc:
+		return in.Op + " " + r('c', in.Rj) + ", " + in.immText()
+	case fmtI26:
+		return in.Op + " " + in.immText()
+	case fmtCode:
+		return in.Op + " " + strconv.FormatInt(in.Imm, 10)
+	case fmtFcmp:
+		return in.Op + " " + rd + ", " + rj + ", " + rk
+	}
+	return in.Op
+}
+
+// 检查有符号立即数的范围
+func checkSigned(in *Inst, imm int64, bits uint) error {
+	if imm < -1<<(bits-1) || imm >= 1<<(bits-1) {
+		if in.Sym != "" {
+			return fmt.Errorf("loongarch: %s to %s out of range", in.Op, in.Sym)
+		}
+		return fmt.Errorf("loongarch: immediate %d of %s out of range", imm, in.Op)
+	}
+	return nil
+}
+
+// Encode 编码一条指令
+// pc为指令地址, syms为已知符号的地址, 无法解析的符号引用通过reloc返回
+func (in *Inst) Encode(pc uint64, syms map[string]uint64) (code uint32, reloc *arch.Reloc, err error) {
+	info, ok := instructions[in.Op]
+	if !ok {
+		return 0, nil, fmt.Errorf("loongarch: unknown instruction %s", in.Op)
+	}
+	imm := in.Imm
+	if in.Reloc != relNone {
+		addr, ok := syms[in.Sym]
+		if !ok {
+			// 外部符号, 留给链接器处理
+			reloc = &arch.Reloc{Sym: in.Sym, Type: in.Reloc, Addend: in.Imm}
+			imm = 0
+		} else {
+			target := int64(addr) + in.Imm
+			switch in.Reloc {
+			case relPCHi20:
+				imm = (target+0x800)>>12 - int64(pc>>12)
+			case relPCLo12:
+				imm = int64(int32(target<<20) >> 20)
+			case relPCAddHi20:
+				imm = (target - int64(pc) + 0x800) >> 12
+			case relPCAddLo12:
+				// jirl紧跟在pcaddu12i之后
+				imm = int64(int32((target-int64(pc)+4)<<20)>>20) >> 2
+			case relAbsHi20:
+				imm = target >> 12
+			case relAbsLo12:
+				imm = target & 0xfff
+			case relBranch16, relBranch21, relBranch26:
+				imm = (target - int64(pc)) >> 2
+			}
+		}
+	}
+	rd, rj, rk := uint32(in.Rd)&0x1f, uint32(in.Rj)&0x1f, uint32(in.Rk)&0x1f
+	switch info.Format {
+	case fmt3R:
+		code = info.Code | rk<<10 | rj<<5 | rd
+	case fmt2R:
+		code = info.Code | rj<<5 | rd
+	case fmtALSL:
+		code = info.Code | uint32(imm-1)&0x3<<15 | rk<<10 | rj<<5 | rd
+	case fmt2RI5:
+		code = info.Code | uint32(imm&0x1f)<<10 | rj<<5 | rd
+	case fmt2RI6:
+		code = info.Code | uint32(imm&0x3f)<<10 | rj<<5 | rd
+	case fmt2RI12:
+		code = info.Code | uint32(imm&0xfff)<<10 | rj<<5 | rd
+	case fmt1RI20:
+		if in.Reloc != relNone {
+			if err := checkSigned(in, imm, 20); err != nil {
+				return 0, nil, err
+			}
+		}
+		code = info.Code | uint32(imm&0xfffff)<<5 | rd
+	case fmt2RI16, fmtJIRL:
+		if err := checkSigned(in, imm, 16); err != nil {
+			return 0, nil, err
+		}
+		code = info.Code | uint32(imm&0xffff)<<10 | rj<<5 | rd
+	case fmt1RI21, fmtBc:
+		if err := checkSigned(in, imm, 21); err != nil {
+			return 0, nil, err
+		}
+		if info.Format == fmtBc {
+			rj &= 0x7
+		}
+		code = info.Code | uint32(imm&0xffff)<<10 | rj<<5 | uint32(imm>>16)&0x1f
+	case fmtI26:
+		if err := checkSigned(in, imm, 26); err != nil {
+			return 0, nil, err
+		}
+		code = info.Code | uint32(imm&0xffff)<<10 | uint32(imm>>16)&0x3ff
+	case fmtCode:
+		code = info.Code | uint32(imm&0x7fff)
+	case fmtFcmp:
+		code = info.Code | rk<<10 | rj<<5 | rd&0x7
+	}
+	return code, reloc, nil
+}
@@ -0,0 +1,173 @@
+package loongarch
+
+// 指令格式
+const (
+	fmt3R    = iota // op rd, rj, rk
+	fmt2R           // op rd, rj
+	fmtALSL         // op rd, rj, rk, sa2 (sa2为移位量减1)
+	fmt2RI5         // op rd, rj, ui5
+	fmt2RI6         // op rd, rj, ui6
+	fmt2RI12        // op rd, rj, si12/ui12
+	fmt1RI20        // op rd, si20
+	fmt2RI16        // op rj, rd, offs16 (条件分支)
+	fmtJIRL         // jirl rd, rj, offs16
+	fmt1RI21        // op rj, offs21
+	fmtI26          // op offs26
+	fmtCode         // op code15
+	fmtFcmp         // fcmp.cond.fmt cd, fj, fk
+	fmtBc           // op cj, offs21
+)
+
+type opInfo struct {
+	Format int
+	Code   uint32 // 操作数字段为0时的指令编码
+	Regs   string // rd、rj、rk依次是通用寄存器(r)、浮点寄存器(f)还是条件标志(c)
+}
+
+var instructions = map[string]opInfo{
+	// 整数运算
+	"add.w":   {fmt3R, 0x00100000, "rrr"},
+	"add.d":   {fmt3R, 0x00108000, "rrr"},
+	"alsl.w":  {fmtALSL, 0x00040000, "rrr"},
+	"alsl.d":  {fmtALSL, 0x002c0000, "rrr"},
+	"sub.w":   {fmt3R, 0x00110000, "rrr"},
+	"sub.d":   {fmt3R, 0x00118000, "rrr"},
+	"slt":     {fmt3R, 0x00120000, "rrr"},
+	"sltu":    {fmt3R, 0x00128000, "rrr"},
+	"maskeqz": {fmt3R, 0x00130000, "rrr"},
+	"masknez": {fmt3R, 0x00138000, "rrr"},
+	"nor":     {fmt3R, 0x00140000, "rrr"},
+	"and":     {fmt3R, 0x00148000, "rrr"},
+	"or":      {fmt3R, 0x00150000, "rrr"},
+	"xor":     {fmt3R, 0x00158000, "rrr"},
+	"orn":     {fmt3R, 0x00160000, "rrr"},
+	"andn":    {fmt3R, 0x00168000, "rrr"},
+	"sll.w":   {fmt3R, 0x00170000, "rrr"},
+	"srl.w":   {fmt3R, 0x00178000, "rrr"},
+	"sra.w":   {fmt3R, 0x00180000, "rrr"},
+	"sll.d":   {fmt3R, 0x00188000, "rrr"},
+	"srl.d":   {fmt3R, 0x00190000, "rrr"},
+	"sra.d":   {fmt3R, 0x00198000, "rrr"},
+	"rotr.w":  {fmt3R, 0x001b0000, "rrr"},
+	"rotr.d":  {fmt3R, 0x001b8000, "rrr"},
+	"mul.w":   {fmt3R, 0x001c0000, "rrr"},
+	"mulh.w":  {fmt3R, 0x001c8000, "rrr"},
+	"mulh.wu": {fmt3R, 0x001d0000, "rrr"},
+	"mul.d":   {fmt3R, 0x001d8000, "rrr"},
+	"mulh.d":  {fmt3R, 0x001e0000, "rrr"},
+	"mulh.du": {fmt3R, 0x001e8000, "rrr"},
+	"div.w":   {fmt3R, 0x00200000, "rrr"},
+	"mod.w":   {fmt3R, 0x00208000, "rrr"},
+	"div.wu":  {fmt3R, 0x00210000, "rrr"},
+	"mod.wu":  {fmt3R, 0x00218000, "rrr"},
+	"div.d":   {fmt3R, 0x00220000, "rrr"},
+	"mod.d":   {fmt3R, 0x00228000, "rrr"},
+	"div.du":  {fmt3R, 0x00230000, "rrr"},
+	"mod.du":  {fmt3R, 0x00238000, "rrr"},
+	"break":   {fmtCode, 0x002a0000, ""},
+	"syscall": {fmtCode, 0x002b0000, ""},
+
+	// 立即数移位
+	"slli.w": {fmt2RI5, 0x00408000, "rr"},
+	"srli.w": {fmt2RI5, 0x00448000, "rr"},
+	"srai.w": {fmt2RI5, 0x00488000, "rr"},
+	"slli.d": {fmt2RI6, 0x00410000, "rr"},
+	"srli.d": {fmt2RI6, 0x00450000, "rr"},
+	"srai.d": {fmt2RI6, 0x00490000, "rr"},
+
+	// 12位立即数
+	"slti":    {fmt2RI12, 0x02000000, "rr"},
+	"sltui":   {fmt2RI12, 0x02400000, "rr"},
+	"addi.w":  {fmt2RI12, 0x02800000, "rr"},
+	"addi.d":  {fmt2RI12, 0x02c00000, "rr"},
+	"lu52i.d": {fmt2RI12, 0x03000000, "rr"},
+	"andi":    {fmt2RI12, 0x03400000, "rr"},
+	"ori":     {fmt2RI12, 0x03800000, "rr"},
+	"xori":    {fmt2RI12, 0x03c00000, "rr"},
+
+	// 20位立即数
+	"lu12i.w":   {fmt1RI20, 0x14000000, "r"},
+	"lu32i.d":   {fmt1RI20, 0x16000000, "r"},
+	"pcaddi":    {fmt1RI20, 0x18000000, "r"},
+	"pcalau12i": {fmt1RI20, 0x1a000000, "r"},
+	"pcaddu12i": {fmt1RI20, 0x1c000000, "r"},
+	"pcaddu18i": {fmt1RI20, 0x1e000000, "r"},
+
+	// 访存
+	"ld.b":  {fmt2RI12, 0x28000000, "rr"},
+	"ld.h":  {fmt2RI12, 0x28400000, "rr"},
+	"ld.w":  {fmt2RI12, 0x28800000, "rr"},
+	"ld.d":  {fmt2RI12, 0x28c00000, "rr"},
+	"st.b":  {fmt2RI12, 0x29000000, "rr"},
+	"st.h":  {fmt2RI12, 0x29400000, "rr"},
+	"st.w":  {fmt2RI12, 0x29800000, "rr"},
+	"st.d":  {fmt2RI12, 0x29c00000, "rr"},
+	"ld.bu": {fmt2RI12, 0x2a000000, "rr"},
+	"ld.hu": {fmt2RI12, 0x2a400000, "rr"},
+	"ld.wu": {fmt2RI12, 0x2a800000, "rr"},
+	"fld.s": {fmt2RI12, 0x2b000000, "fr"},
+	"fst.s": {fmt2RI12, 0x2b400000, "fr"},
+	"fld.d": {fmt2RI12, 0x2b800000, "fr"},
+	"fst.d": {fmt2RI12, 0x2bc00000, "fr"},
+
+	// 跳转
+	"beqz":  {fmt1RI21, 0x40000000, "r"},
+	"bnez":  {fmt1RI21, 0x44000000, "r"},
+	"bceqz": {fmtBc, 0x48000000, "c"},
+	"bcnez": {fmtBc, 0x48000100, "c"},
+	"jirl":  {fmtJIRL, 0x4c000000, "rr"},
+	"b":     {fmtI26, 0x50000000, ""},
+	"bl":    {fmtI26, 0x54000000, ""},
+	"beq":   {fmt2RI16, 0x58000000, "rr"},
+	"bne":   {fmt2RI16, 0x5c000000, "rr"},
+	"blt":   {fmt2RI16, 0x60000000, "rr"},
+	"bge":   {fmt2RI16, 0x64000000, "rr"},
+	"bltu":  {fmt2RI16, 0x68000000, "rr"},
+	"bgeu":  {fmt2RI16, 0x6c000000, "rr"},
+
+	// 浮点运算
+	"fadd.s":  {fmt3R, 0x01008000, "fff"},
+	"fadd.d":  {fmt3R, 0x01010000, "fff"},
+	"fsub.s":  {fmt3R, 0x01028000, "fff"},
+	"fsub.d":  {fmt3R, 0x01030000, "fff"},
+	"fmul.s":  {fmt3R, 0x01048000, "fff"},
+	"fmul.d":  {fmt3R, 0x01050000, "fff"},
+	"fdiv.s":  {fmt3R, 0x01068000, "fff"},
+	"fdiv.d":  {fmt3R, 0x01070000, "fff"},
+	"fmax.s":  {fmt3R, 0x01088000, "fff"},
+	"fmax.d":  {fmt3R, 0x01090000, "fff"},
+	"fmin.s":  {fmt3R, 0x010a8000, "fff"},
+	"fmin.d":  {fmt3R, 0x010b0000, "fff"},
+	"fabs.s":  {fmt2R, 0x01140400, "ff"},
+	"fabs.d":  {fmt2R, 0x01140800, "ff"},
+	"fneg.s":  {fmt2R, 0x01141400, "ff"},
+	"fneg.d":  {fmt2R, 0x01141800, "ff"},
+	"fsqrt.s": {fmt2R, 0x01144400, "ff"},
+	"fsqrt.d": {fmt2R, 0x01144800, "ff"},
+	"fmov.s":  {fmt2R, 0x01149400, "ff"},
+	"fmov.d":  {fmt2R, 0x01149800, "ff"},
+
+	// 浮点传送与转换
+	"movgr2fr.w":  {fmt2R, 0x0114a400, "fr"},
+	"movgr2fr.d":  {fmt2R, 0x0114a800, "fr"},
+	"movfr2gr.s":  {fmt2R, 0x0114b400, "rf"},
+	"movfr2gr.d":  {fmt2R, 0x0114b800, "rf"},
+	"fcvt.s.d":    {fmt2R, 0x01191800, "ff"},
+	"fcvt.d.s":    {fmt2R, 0x01192400, "ff"},
+	"ftintrz.w.s": {fmt2R, 0x011a8400, "ff"},
+	"ftintrz.w.d": {fmt2R, 0x011a8800, "ff"},
+	"ftintrz.l.s": {fmt2R, 0x011aa400, "ff"},
+	"ftintrz.l.d": {fmt2R, 0x011aa800, "ff"},
+	"ffint.s.w":   {fmt2R, 0x011d1000, "ff"},
+	"ffint.s.l":   {fmt2R, 0x011d1800, "ff"},
+	"ffint.d.w":   {fmt2R, 0x011d2000, "ff"},
+	"ffint.d.l":   {fmt2R, 0x011d2800, "ff"},
+
+	// 浮点比较, 条件写在编码的19:15位
+	"fcmp.clt.s": {fmtFcmp, 0x0c110000, "cff"},
+	"fcmp.ceq.s": {fmtFcmp, 0x0c120000, "cff"},
+	"fcmp.cle.s": {fmtFcmp, 0x0c130000, "cff"},
+	"fcmp.clt.d": {fmtFcmp, 0x0c210000, "cff"},
+	"fcmp.ceq.d": {fmtFcmp, 0x0c220000, "cff"},
+	"fcmp.cle.d": {fmtFcmp, 0x0c230000, "cff"},
+}
@@ -0,0 +1,151 @@
+// Package loongarch 实现LoongArch64后端
+package loongarch
+
+import (
+	"CuteASM/arch"
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"encoding/binary"
+)
+
+// New 创建LoongArch64架构实例
+func New() *types.Architecture {
+	return &types.Architecture{
+		Name:         "loongarch64",
+		RegisterList: RegLookup,
+		WordSize:     64,
+		ByteOrder:    binary.LittleEndian,
+		Registers:    regTable(),
+	}
+}
+
+// CMP的结果
+// CMP本身不生成代码, 紧跟的条件跳转直接用beq、blt等比较两个操作数;
+// 遇到其它指令或基本块结束时, 把两个操作数保存到$t5、$t6
+type cmpState struct {
+	a, b *parser.Value
+	done bool // 已经保存到$t5、$t6
+}
+
+// Backend LoongArch64后端
+type Backend struct {
+	arch.Fixed[*Inst]
+
+	arch    *types.Architecture
+	section string
+	local   map[string]bool // 本文件内定义的标签, 可以用bl直接调用
+	cmp     *cmpState
+	buf     []*Inst // 当前基本块
+}
+
+// NewBackend 创建LoongArch64后端
+func NewBackend() *Backend {
+	a := New()
+	return &Backend{
+		// 代码对齐填充nop, 即andi $zero, $zero, 0
+		Fixed: arch.NewFixed("loongarch", a.ByteOrder, &Inst{Op: "andi"}, relAbs32, relAbs64),
+		arch:  a,
+		local: map[string]bool{},
+	}
+}
+
+// Arch 返回架构描述
+func (b *Backend) Arch() *types.Architecture {
+	return b.arch
+}
+
+// Prepare 收集本文件内定义的标签
+// 其余符号的位置未知, 调用时使用pcaddu12i+jirl
+func (b *Backend) Prepare(root *parser.Node) {
+	for _, n := range root.Children {
+		if label, ok := n.Value.(*parser.LabelBlock); ok {
+			b.local[label.Name] = true
+		}
+		b.Prepare(n)
+	}
+}
+
+// Section 切换当前段
+func (b *Backend) Section(name string) {
+	b.section = name
+}
+
+// Flush 结束当前基本块并返回文本汇编
+func (b *Backend) Flush() []string {
+	if arch.FallsThrough(b.buf) {
+		b.settle()
+	}
+	lines := b.Fixed.Flush(b.buf, (*Inst).Text)
+	b.buf = nil
+	return lines
+}
+
+// Assemble 编码全部指令
+func (b *Backend) Assemble() ([]byte, error) {
+	b.Flush()
+	return b.Fixed.Assemble()
+}
+
+// Uncond 无条件跳转, 之后的代码不可达
+func (in *Inst) Uncond() bool {
+	switch in.Op {
+	case "b":
+		return true
+	case "jirl":
+		return in.Rd == regZero
+	}
+	return false
+}
+
+func (b *Backend) emit(in *Inst) {
+	b.buf = append(b.buf, in)
+}
+
+func (b *Backend) emit3(op string, rd, rj, rk int) {
+	b.emit(&Inst{Op: op, Rd: rd, Rj: rj, Rk: rk})
+}
+
+func (b *Backend) emitI(op string, rd, rj int, imm int64) {
+	b.emit(&Inst{Op: op, Rd: rd, Rj: rj, Imm: imm})
+}
+
+// move 寄存器间传送
+func (b *Backend) move(rd, rj int) {
+	if rd != rj {
+		b.emit3("or", rd, rj, regZero)
+	}
+}
+
+// reg 把CuteASM寄存器映射为物理寄存器
+func (b *Backend) reg(r *parser.Reg) (int, error) {
+	phys, err := b.arch.Registers.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	return phys.Num, err
+}
+
+// width 操作数宽度(字节)
+func width(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		switch v.Reg.Type {
+		case types.Reg8:
+			return 1
+		case types.Reg16:
+			return 2
+		case types.Reg32:
+			return 4
+		}
+	case parser.ADDR:
+		if v.Addr.Length != 0 {
+			return v.Addr.Length
+		}
+	}
+	return 8
+}
+
+// op 根据运算宽度选择.w或.d指令
+func op(name string, v *parser.Value) string {
+	if width(v) == 8 {
+		return name + ".d"
+	}
+	return name + ".w"
+}
@@ -0,0 +1,607 @@
+package loongarch
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"math"
+)
+
+// Emit 把一条CuteASM指令翻译为LoongArch指令
+func (b *Backend) Emit(i *parser.Instruction) error {
+	if _, jcc := types.BranchCond(i.Instruction); !jcc && i.Instruction != "CMP" {
+		b.settle()
+	}
+	// 出错时丢弃已经生成的半条指令
+	n := len(b.buf)
+	err := b.lower(i)
+	if err != nil {
+		b.buf = b.buf[:n]
+	}
+	return err
+}
+
+func (b *Backend) lower(i *parser.Instruction) error {
+	switch i.Instruction {
+	case "MOV", "LOAD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[0], i.Args[1])
+	case "STORE":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[1], i.Args[0])
+	case "ADD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("add", i.Args[0]), op("addi", i.Args[0]), false)
+	case "SUB":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		if i.Args[1].Type == parser.NUMBER {
+			// 减立即数等于加它的相反数
+			neg := *i.Args[1]
+			neg.Num = -neg.Num
+			return b.alu(i.Args[0], &neg, op("add", i.Args[0]), op("addi", i.Args[0]), false)
+		}
+		return b.alu(i.Args[0], i.Args[1], op("sub", i.Args[0]), "", false)
+	case "AND":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "and", "andi", true)
+	case "OR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "or", "ori", true)
+	case "XOR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "xor", "xori", true)
+	case "MUL":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("mul", i.Args[0]), "", false)
+	case "DIV":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("div", i.Args[0])+"u", "", false)
+	case "NEG":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		name := op("sub", i.Args[0])
+		return b.modify(i.Args[0], func(rd int) error {
+			b.emit3(name, rd, regZero, rd)
+			return nil
+		})
+	case "NOT":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.modify(i.Args[0], func(rd int) error {
+			b.emit3("nor", rd, rd, regZero)
+			return nil
+		})
+	case "SHIFTL":
+		return b.shift(i, "sll")
+	case "SHIFTR":
+		return b.shift(i, "srl")
+	case "XCHG":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.xchg(i.Args[0], i.Args[1])
+	case "CMP":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		for _, arg := range i.Args {
+			if arg.Type == parser.REG {
+				if _, err := b.reg(arg.Reg); err != nil {
+					return err
+				}
+			}
+		}
+		b.cmp = &cmpState{a: i.Args[0], b: i.Args[1]}
+		if !isSimple(i.Args[0]) || !isSimple(i.Args[1]) {
+			// 内存操作数可能在跳转前被修改, 立即求值
+			if err := b.settleErr(); err != nil {
+				b.cmp = nil // 丢弃无法求值的比较
+				return err
+			}
+		}
+		return nil
+	case "JMP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], false)
+	case "CALL":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], true)
+	case "RET":
+		b.emitI("jirl", regZero, regRA, 0)
+		return nil
+	case "PUSH":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.push(i.Args[0])
+	case "POP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.pop(i.Args[0])
+	case "HALT":
+		b.emit(&Inst{Op: "break"})
+		return nil
+	}
+	if cond, ok := types.BranchCond(i.Instruction); ok {
+		return b.jcc(i, cond)
+	}
+	return fmt.Errorf("loongarch: unsupported instruction %s", i.Instruction)
+}
+
+func need(i *parser.Instruction, n int) error {
+	if len(i.Args) != n {
+		return fmt.Errorf("loongarch: %s needs %d operands, got %d", i.Instruction, n, len(i.Args))
+	}
+	return nil
+}
+
+// isSimple 寄存器和立即数可以推迟到跳转时再比较
+func isSimple(v *parser.Value) bool {
+	return v.Type == parser.REG || v.Type == parser.NUMBER
+}
+
+// fits12 立即数能否放进12位立即数字段
+func fits12(imm int64, unsigned bool) bool {
+	if unsigned {
+		return imm >= 0 && imm <= 0xfff
+	}
+	return imm >= -0x800 && imm <= 0x7ff
+}
+
+// 把低bits位按有符号数扩展
+func sext(v int64, bits uint) int64 {
+	return v << (64 - bits) >> (64 - bits)
+}
+
+// li 把立即数装入寄存器
+func (b *Backend) li(rd int, imm int64) {
+	switch {
+	case fits12(imm, false):
+		b.emitI("addi.d", rd, regZero, imm)
+		return
+	case fits12(imm, true):
+		b.emitI("ori", rd, regZero, imm)
+		return
+	}
+	b.emitI("lu12i.w", rd, 0, sext(imm>>12, 20))
+	if imm&0xfff != 0 {
+		b.emitI("ori", rd, rd, imm&0xfff)
+	}
+	if imm < math.MinInt32 || imm > math.MaxInt32 {
+		b.emitI("lu32i.d", rd, 0, sext(imm>>32, 20))
+		b.emitI("lu52i.d", rd, rd, sext(imm>>52, 12))
+	}
+}
+
+// la 把符号地址装入寄存器
+func (b *Backend) la(rd int, sym string, addend int64) {
+	b.emit(&Inst{Op: "pcalau12i", Rd: rd, Sym: sym, Imm: addend, Reloc: relPCHi20})
+	b.emit(&Inst{Op: "addi.d", Rd: rd, Rj: rd, Sym: sym, Imm: addend, Reloc: relPCLo12})
+}
+
+// lc 装入依赖标签地址的常量, 值在Assemble时才能确定, 按32位绝对值装入
+func (b *Backend) lc(rd int, sym string) {
+	b.emit(&Inst{Op: "lu12i.w", Rd: rd, Sym: sym, Reloc: relAbsHi20})
+	b.emit(&Inst{Op: "ori", Rd: rd, Rj: rd, Sym: sym, Reloc: relAbsLo12})
+}
+
+// use 取得操作数所在的寄存器
+// 寄存器操作数直接返回, 其它操作数装入tmp
+func (b *Backend) use(v *parser.Value, tmp int) (int, error) {
+	switch v.Type {
+	case parser.REG:
+		return b.reg(v.Reg)
+	case parser.NUMBER:
+		if v.Num == 0 {
+			return regZero, nil
+		}
+		b.li(tmp, v.Num)
+		return tmp, nil
+	case parser.ADDR:
+		return tmp, b.load(tmp, v.Addr)
+	case parser.LABEL:
+		b.la(tmp, v.String, 0)
+		return tmp, nil
+	case parser.EXPR:
+		if sym, off, ok := v.Expr.Offset(); ok {
+			b.la(tmp, sym, off)
+			return tmp, nil
+		}
+		if v.Expr.Op == "" && v.Expr.Equ {
+			b.lc(tmp, v.Expr.Sym)
+			return tmp, nil
+		}
+	}
+	return 0, fmt.Errorf("loongarch: unsupported operand")
+}
+
+// mem 计算内存操作数的基址和偏移, 需要时借助$t7
+// 返回的指令模板中Rj、Imm、Sym和Reloc已经设置好, 没有基址寄存器时是绝对地址
+func (b *Backend) mem(a *parser.MemoryAddr) (*Inst, error) {
+	in := &Inst{Rj: regZero, Imm: a.Displacement}
+	if a.BaseReg != nil {
+		base, err := b.reg(a.BaseReg)
+		if err != nil {
+			return nil, err
+		}
+		in.Rj = base
+	}
+	if a.LabelRef != "" {
+		b.emit(&Inst{Op: "pcalau12i", Rd: regT7, Sym: a.LabelRef, Imm: in.Imm, Reloc: relPCHi20})
+		if a.BaseReg != nil {
+			b.emit3("add.d", regT7, regT7, in.Rj)
+		}
+		in.Rj = regT7
+		in.Sym = a.LabelRef
+		in.Reloc = relPCLo12
+	}
+	if a.IndexReg != nil {
+		index, err := b.reg(a.IndexReg)
+		if err != nil {
+			return nil, err
+		}
+		switch a.Scale {
+		case 0, 1:
+			b.emit3("add.d", regT7, index, in.Rj)
+		case 2, 4, 8:
+			// alsl.d: rd = (rj << sa) + rk
+			shift := map[int]int64{2: 1, 4: 2, 8: 3}[a.Scale]
+			b.emit(&Inst{Op: "alsl.d", Rd: regT7, Rj: index, Rk: in.Rj, Imm: shift})
+		default:
+			return nil, fmt.Errorf("loongarch: invalid scale %d", a.Scale)
+		}
+		in.Rj = regT7
+	}
+	if in.Reloc == relNone && !fits12(in.Imm, false) {
+		if in.Rj == regT7 {
+			return nil, fmt.Errorf("loongarch: displacement %d out of range", in.Imm)
+		}
+		b.li(regT7, in.Imm)
+		if in.Rj != regZero {
+			b.emit3("add.d", regT7, regT7, in.Rj)
+		}
+		in.Rj = regT7
+		in.Imm = 0
+	}
+	return in, nil
+}
+
+// memOp 根据访问宽度选择读写指令
+func memOp(a *parser.MemoryAddr, store bool) (string, error) {
+	length := a.Length
+	if length == 0 {
+		length = 8
+	}
+	suffix := map[int]string{1: ".b", 2: ".h", 4: ".w", 8: ".d"}[length]
+	if suffix == "" {
+		return "", fmt.Errorf("loongarch: %d-byte memory operand is not supported", length)
+	}
+	if store {
+		return "st" + suffix, nil
+	}
+	if a.Sign == parser.UNSIGNED && length < 8 {
+		// 无符号变量零扩展
+		return "ld" + suffix + "u", nil
+	}
+	return "ld" + suffix, nil
+}
+
+// load 从内存读取到寄存器
+func (b *Backend) load(rd int, a *parser.MemoryAddr) error {
+	name, err := memOp(a, false)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rd = name, rd
+	b.emit(in)
+	return nil
+}
+
+// store 把寄存器写入内存
+func (b *Backend) store(rd int, a *parser.MemoryAddr) error {
+	name, err := memOp(a, true)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rd = name, rd
+	b.emit(in)
+	return nil
+}
+
+// mov dst = src
+func (b *Backend) mov(dst, src *parser.Value) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		rj, err := b.use(src, rd)
+		if err != nil {
+			return err
+		}
+		b.move(rd, rj)
+		return nil
+	case parser.ADDR:
+		rj, err := b.use(src, regT8)
+		if err != nil {
+			return err
+		}
+		return b.store(rj, dst.Addr)
+	}
+	return fmt.Errorf("loongarch: invalid destination operand")
+}
+
+// modify 读出目标操作数, 交给f修改后写回
+func (b *Backend) modify(dst *parser.Value, f func(rd int) error) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		return f(rd)
+	case parser.ADDR:
+		if err := b.load(regT8, dst.Addr); err != nil {
+			return err
+		}
+		if err := f(regT8); err != nil {
+			return err
+		}
+		return b.store(regT8, dst.Addr)
+	}
+	return fmt.Errorf("loongarch: invalid destination operand")
+}
+
+// alu 双操作数运算 dst = dst op src
+// iop为对应的立即数指令, unsigned表示立即数按零扩展处理
+func (b *Backend) alu(dst, src *parser.Value, rop, iop string, unsigned bool) error {
+	return b.modify(dst, func(rd int) error {
+		if src.Type == parser.NUMBER && iop != "" && fits12(src.Num, unsigned) {
+			b.emitI(iop, rd, rd, src.Num)
+			return nil
+		}
+		rk, err := b.use(src, regT7)
+		if err != nil {
+			return err
+		}
+		b.emit3(rop, rd, rd, rk)
+		return nil
+	})
+}
+
+// shift 移位, 省略位数时移动1位
+func (b *Backend) shift(i *parser.Instruction, name string) error {
+	if len(i.Args) != 1 && len(i.Args) != 2 {
+		return fmt.Errorf("loongarch: %s needs 1 or 2 operands, got %d", i.Instruction, len(i.Args))
+	}
+	dst := i.Args[0]
+	return b.modify(dst, func(rd int) error {
+		if len(i.Args) == 1 || i.Args[1].Type == parser.NUMBER {
+			sa := int64(1)
+			if len(i.Args) == 2 {
+				sa = i.Args[1].Num
+			}
+			b.emitI(op(name+"i", dst), rd, rd, sa)
+			return nil
+		}
+		rk, err := b.use(i.Args[1], regT7)
+		if err != nil {
+			return err
+		}
+		b.emit3(op(name, dst), rd, rd, rk)
+		return nil
+	})
+}
+
+// xchg 交换两个操作数
+func (b *Backend) xchg(x, y *parser.Value) error {
+	if x.Type == parser.ADDR {
+		x, y = y, x
+	}
+	if x.Type != parser.REG {
+		return fmt.Errorf("loongarch: XCHG needs a register operand")
+	}
+	rx, err := b.reg(x.Reg)
+	if err != nil {
+		return err
+	}
+	switch y.Type {
+	case parser.REG:
+		ry, err := b.reg(y.Reg)
+		if err != nil {
+			return err
+		}
+		b.move(regT7, rx)
+		b.move(rx, ry)
+		b.move(ry, regT7)
+		return nil
+	case parser.ADDR:
+		if err := b.load(regT8, y.Addr); err != nil {
+			return err
+		}
+		if err := b.store(rx, y.Addr); err != nil {
+			return err
+		}
+		b.move(rx, regT8)
+		return nil
+	}
+	return fmt.Errorf("loongarch: invalid XCHG operand")
+}
+
+// settle 把挂起的CMP操作数保存到$t5、$t6
+func (b *Backend) settle() {
+	if err := b.settleErr(); err != nil {
+		// CMP时已经检查过操作数, 这里不会出错
+		panic(err)
+	}
+}
+
+func (b *Backend) settleErr() error {
+	if b.cmp == nil || b.cmp.done {
+		return nil
+	}
+	ra, err := b.use(b.cmp.a, regT5)
+	if err != nil {
+		return err
+	}
+	b.move(regT5, ra)
+	rb, err := b.use(b.cmp.b, regT6)
+	if err != nil {
+		return err
+	}
+	b.move(regT6, rb)
+	b.cmp.done = true
+	return nil
+}
+
+// 各条件码对应的跳转指令, swap为真时交换两个操作数
+var branches = map[string]struct {
+	op   string
+	swap bool
+}{
+	"EQ": {"beq", false}, "NE": {"bne", false},
+	"LT": {"blt", false}, "GE": {"bge", false}, "GT": {"blt", true}, "LE": {"bge", true},
+	"CS": {"bltu", false}, "CC": {"bgeu", false}, "HI": {"bltu", true}, "LS": {"bgeu", true},
+}
+
+// jcc 条件跳转, cond为Go汇编的条件码
+func (b *Backend) jcc(i *parser.Instruction, cond string) error {
+	if err := need(i, 1); err != nil {
+		return err
+	}
+	if i.Args[0].Type != parser.LABEL {
+		return fmt.Errorf("loongarch: %s needs a label", i.Instruction)
+	}
+	target := i.Args[0].String
+	c := b.cmp
+	if c == nil {
+		return fmt.Errorf("loongarch: %s without CMP", i.Instruction)
+	}
+	if c.a.Type == parser.NUMBER && c.b.Type == parser.NUMBER && !c.done {
+		// 两个常数, 直接决定是否跳转
+		if types.CondHolds(cond, c.a.Num, c.b.Num) {
+			b.emit(&Inst{Op: "b", Sym: target, Reloc: relBranch26})
+		}
+		return nil
+	}
+	ra, rb := regT5, regT6
+	if !c.done {
+		var err error
+		if ra, err = b.use(c.a, regT5); err != nil {
+			return err
+		}
+		if rb, err = b.use(c.b, regT6); err != nil {
+			return err
+		}
+	}
+	br := branches[cond]
+	if (cond == "EQ" || cond == "NE") && rb == regZero {
+		b.emit(&Inst{Op: br.op + "z", Rj: ra, Sym: target, Reloc: relBranch21})
+		return nil
+	}
+	if br.swap {
+		ra, rb = rb, ra
+	}
+	b.emit(&Inst{Op: br.op, Rj: ra, Rd: rb, Sym: target, Reloc: relBranch16})
+	return nil
+}
+
+// jump 无条件跳转或调用
+// 本文件内的标签用b/bl, 其它符号用pcaddu12i+jirl覆盖±2GB
+func (b *Backend) jump(v *parser.Value, link bool) error {
+	rd := regZero
+	if link {
+		rd = regRA
+	}
+	switch v.Type {
+	case parser.LABEL:
+		if b.local[v.String] {
+			name := "b"
+			if link {
+				name = "bl"
+			}
+			b.emit(&Inst{Op: name, Sym: v.String, Reloc: relBranch26})
+			return nil
+		}
+		tmp := regT7
+		if link {
+			tmp = regRA
+		}
+		b.emit(&Inst{Op: "pcaddu12i", Rd: tmp, Sym: v.String, Reloc: relPCAddHi20})
+		b.emit(&Inst{Op: "jirl", Rd: rd, Rj: tmp, Sym: v.String, Reloc: relPCAddLo12})
+		return nil
+	case parser.REG, parser.ADDR:
+		rj, err := b.use(v, regT7)
+		if err != nil {
+			return err
+		}
+		b.emitI("jirl", rd, rj, 0)
+		return nil
+	}
+	return fmt.Errorf("loongarch: invalid jump target")
+}
+
+// push 压栈, 每个槽位占8字节
+func (b *Backend) push(v *parser.Value) error {
+	rj, err := b.use(v, regT8)
+	if err != nil {
+		return err
+	}
+	b.emitI("addi.d", regSP, regSP, -8)
+	b.emitI("st.d", rj, regSP, 0)
+	return nil
+}
+
+// pop 出栈
+func (b *Backend) pop(v *parser.Value) error {
+	rd := regT8
+	if v.Type == parser.REG {
+		tmp, err := b.reg(v.Reg)
+		if err != nil {
+			return err
+		}
+		rd = tmp
+	} else if v.Type != parser.ADDR {
+		return fmt.Errorf("loongarch: invalid POP operand")
+	}
+	b.emitI("ld.d", rd, regSP, 0)
+	b.emitI("addi.d", regSP, regSP, 8)
+	if v.Type == parser.ADDR {
+		return b.store(rd, v.Addr)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package loongarch
+
+import (
+	"CuteASM/arch/types"
+	"strconv"
+)
+
+// 常用寄存器编号
+const (
+	regZero = 0
+	regRA   = 1
+	regSP   = 3
+	regA0   = 4
+	regT5   = 17 // 保存CMP的左操作数(模拟标志位)
+	regT6   = 18 // 保存CMP的右操作数(模拟标志位)
+	regT7   = 19 // 翻译时的临时寄存器, 用于地址和立即数
+	regT8   = 20 // 翻译内存操作数时的临时寄存器
+	regFP   = 22
+)
+
+// LP64 ABI通用寄存器名称, 下标即寄存器编号
+var regNames = [32]string{
+	"zero", "ra", "tp", "sp", "a0", "a1", "a2", "a3",
+	"a4", "a5", "a6", "a7", "t0", "t1", "t2", "t3",
+	"t4", "t5", "t6", "t7", "t8", "r21", "fp", "s0",
+	"s1", "s2", "s3", "s4", "s5", "s6", "s7", "s8",
+}
+
+// LP64 ABI浮点寄存器名称
+var fregNames = [32]string{
+	"fa0", "fa1", "fa2", "fa3", "fa4", "fa5", "fa6", "fa7",
+	"ft0", "ft1", "ft2", "ft3", "ft4", "ft5", "ft6", "ft7",
+	"ft8", "ft9", "ft10", "ft11", "ft12", "ft13", "ft14", "ft15",
+	"fs0", "fs1", "fs2", "fs3", "fs4", "fs5", "fs6", "fs7",
+}
+
+// RegLookup 寄存器名称到编号的映射, 浮点寄存器同样从0开始编号
+var RegLookup = map[string]types.Register{}
+
+func init() {
+	for i := 0; i < 32; i++ {
+		RegLookup[regNames[i]] = types.Register(i)
+		RegLookup["r"+strconv.Itoa(i)] = types.Register(i)
+		RegLookup[fregNames[i]] = types.Register(i)
+		RegLookup["f"+strconv.Itoa(i)] = types.Register(i)
+	}
+	RegLookup["v0"] = regA0
+	RegLookup["v1"] = regA0 + 1
+	RegLookup["s9"] = regFP
+}
+
+// regTable 虚拟寄存器表
+// t5-t8保留给指令翻译使用
+func regTable() *types.RegTable {
+	t := &types.RegTable{
+		Arch: "loongarch",
+		Bits: 64,
+		Named: map[string]types.PhysReg{
+			"sp": {Num: regSP, Name: "sp", Class: types.RegSaved},
+			"bp": {Num: regFP, Name: "fp", Class: types.RegSaved},
+			"ra": {Num: regRA, Name: "ra", Class: types.RegScratch},
+		},
+	}
+	add := func(class types.RegClass, from, to int) {
+		for i := from; i <= to; i++ {
+			t.Regs = append(t.Regs, types.PhysReg{Num: i, Name: regNames[i], Class: class})
+		}
+	}
+	add(types.RegReturn, 4, 5)    // a0-a1
+	add(types.RegArg, 6, 11)      // a2-a7
+	add(types.RegScratch, 12, 16) // t0-t4
+	add(types.RegSaved, 23, 31)   // s0-s8
+	return t
+}
@@ -0,0 +1,443 @@
+// Package emu 纯Go实现的MIPS用户态模拟器
+//
+// 模拟器解码并执行MIPS后端使用的整数指令, 用来在没有目标机器时检查后端的输出:
+// 用后端汇编一段代码, 放在地址0执行, 再检查寄存器和内存。
+// 解码按指令集手册进行, 不使用后端的编码表, 编码错误会表现为结果不一致。
+//
+// 机器模型:
+//   - 32个通用寄存器、HI、LO和PC, 分支和跳转之后有一条延迟槽。
+//     寄存器按MIPS64保存, 32位运算的结果符号扩展, MIPS32下不能执行64位指令。
+//   - 平坦内存从地址0开始, 共Config.MemSize字节, 越界访问是错误。
+//     栈从内存顶端向下增长。
+//   - BREAK停止执行, 不支持系统调用、浮点和特权指令。
+package emu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// StopAddr Call设置的返回地址, 返回到这里时停止执行
+const StopAddr = 0x7ffff000
+
+const (
+	regSP = 29
+	regRA = 31
+)
+
+// Config 模拟器的设置, 为0的项使用默认值
+type Config struct {
+	Bits      int  // 32或64, 默认32
+	BigEndian bool // 字节序
+	MemSize   int  // 内存的字节数, 默认1M
+	MaxSteps  int  // 最多执行的指令数, 默认100万, 用于发现死循环
+}
+
+// CPU 模拟器的状态
+type CPU struct {
+	Regs   [32]uint64
+	HI, LO uint64
+	PC     uint64
+	Mem    []byte
+
+	Steps  int  // 已经执行的指令数
+	Halted bool // 因BREAK停止
+
+	cfg   Config
+	order binary.ByteOrder
+
+	// 延迟槽
+	jump   bool   // 当前指令是分支, 下一条指令在延迟槽中
+	slot   bool   // 当前指令在延迟槽中, 执行后转到target
+	target uint64 // 分支的目标
+}
+
+// Fault 执行时的错误
+type Fault struct {
+	PC   uint64 // 出错指令的地址
+	Word uint32 // 出错的指令
+	Err  string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("emu: %#x [%08x]: %s", f.PC, f.Word, f.Err)
+}
+
+// fault 执行中的错误, 由Step恢复为*Fault
+type fault string
+
+// New 创建模拟器, 栈指针指向内存顶端
+func New(cfg Config) *CPU {
+	if cfg.Bits == 0 {
+		cfg.Bits = 32
+	}
+	if cfg.MemSize == 0 {
+		cfg.MemSize = 1 << 20
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = 1000000
+	}
+	c := &CPU{Mem: make([]byte, cfg.MemSize), cfg: cfg, order: binary.LittleEndian}
+	if cfg.BigEndian {
+		c.order = binary.BigEndian
+	}
+	c.Regs[regSP] = uint64(len(c.Mem)) &^ 15
+	return c
+}
+
+// Load 把code复制到addr
+func (c *CPU) Load(addr uint64, code []byte) error {
+	if addr > uint64(len(c.Mem)) || uint64(len(code)) > uint64(len(c.Mem))-addr {
+		return fmt.Errorf("emu: %d bytes at %#x do not fit in memory", len(code), addr)
+	}
+	copy(c.Mem[addr:], code)
+	return nil
+}
+
+// Call 把$ra设为StopAddr并从addr执行, 直到返回或BREAK
+func (c *CPU) Call(addr uint64) error {
+	c.Regs[regRA] = StopAddr
+	c.PC = addr
+	return c.Run()
+}
+
+// Run 从PC执行到BREAK或返回到StopAddr
+func (c *CPU) Run() error {
+	for !c.Halted && c.PC != StopAddr {
+		if c.Steps >= c.cfg.MaxSteps {
+			return &Fault{PC: c.PC, Err: fmt.Sprintf("step limit %d exceeded", c.cfg.MaxSteps)}
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 执行一条指令
+func (c *CPU) Step() (err error) {
+	var w uint32
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(fault)
+			if !ok {
+				panic(r)
+			}
+			err = &Fault{PC: c.PC, Word: w, Err: string(f)}
+		}
+	}()
+	w = uint32(c.read(c.PC, 4))
+	c.Steps++
+	next := c.PC + 4
+	if c.slot {
+		next = c.target
+	}
+	c.exec(w)
+	c.Regs[0] = 0
+	c.slot, c.jump = c.jump, false
+	if !c.Halted {
+		c.PC = next
+	}
+	return nil
+}
+
+// Read 读取内存中size字节的无符号数
+func (c *CPU) Read(addr uint64, size int) (v uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("emu: %s", r)
+		}
+	}()
+	return c.read(addr, size), nil
+}
+
+// Dump 输出寄存器
+func (c *CPU) Dump() string {
+	s := ""
+	for n, v := range c.Regs {
+		s += fmt.Sprintf("$%-2d = %#x\n", n, v)
+	}
+	return s + fmt.Sprintf("hi = %#x\nlo = %#x\npc = %#x\n", c.HI, c.LO, c.PC)
+}
+
+func (c *CPU) read(addr uint64, size int) uint64 {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(c.order.Uint16(b))
+	case 4:
+		return uint64(c.order.Uint32(b))
+	}
+	return c.order.Uint64(b)
+}
+
+func (c *CPU) write(addr uint64, size int, v uint64) {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		c.order.PutUint16(b, uint16(v))
+	case 4:
+		c.order.PutUint32(b, uint32(v))
+	default:
+		c.order.PutUint64(b, v)
+	}
+}
+
+func (c *CPU) check(addr uint64, size int) {
+	if addr%uint64(size) != 0 {
+		panic(fault(fmt.Sprintf("unaligned %d-byte access at %#x", size, addr)))
+	}
+	if addr > uint64(len(c.Mem)) || uint64(size) > uint64(len(c.Mem))-addr {
+		panic(fault(fmt.Sprintf("%d-byte access at %#x is outside memory", size, addr)))
+	}
+}
+
+// branch 在延迟槽之后转到target
+func (c *CPU) branch(target uint64) {
+	if c.slot {
+		panic(fault("branch in a delay slot"))
+	}
+	c.jump, c.target = true, target
+}
+
+// need64 64位指令只能在MIPS64上执行
+func (c *CPU) need64() {
+	if c.cfg.Bits != 64 {
+		panic(fault("64-bit instruction on MIPS32"))
+	}
+}
+
+// addr 访存地址, MIPS32只使用低32位
+func (c *CPU) addr(base uint64, off int64) uint64 {
+	a := base + uint64(off)
+	if c.cfg.Bits == 32 {
+		a = uint64(uint32(a))
+	}
+	return a
+}
+
+func sext32(v uint64) uint64 {
+	return uint64(int64(int32(v)))
+}
+
+func (c *CPU) exec(w uint32) {
+	op, rs, rt := w>>26, w>>21&31, w>>16&31
+	rd, sa, imm := w>>11&31, w>>6&31, int64(int16(w))
+	s, t := c.Regs[rs], c.Regs[rt]
+	set := func(r uint32, v uint64) { c.Regs[r] = v }
+	switch op {
+	case 0x00:
+		c.special(w, rs, rt, rd, sa)
+	case 0x01:
+		target := c.PC + 4 + uint64(imm<<2)
+		switch rt {
+		case 0x00: // bltz
+			if int64(s) < 0 {
+				c.branch(target)
+			}
+		case 0x01: // bgez
+			if int64(s) >= 0 {
+				c.branch(target)
+			}
+		default:
+			panic(fault("reserved instruction"))
+		}
+	case 0x02, 0x03: // j, jal
+		if op == 0x03 {
+			c.Regs[regRA] = c.PC + 8
+		}
+		c.branch((c.PC+4)&^0x0fffffff | uint64(w&0x3ffffff)<<2)
+	case 0x04, 0x05, 0x06, 0x07:
+		taken := false
+		switch op {
+		case 0x04: // beq
+			taken = s == t
+		case 0x05: // bne
+			taken = s != t
+		case 0x06: // blez
+			taken = int64(s) <= 0
+		case 0x07: // bgtz
+			taken = int64(s) > 0
+		}
+		if taken {
+			c.branch(c.PC + 4 + uint64(imm<<2))
+		}
+	case 0x09: // addiu
+		set(rt, sext32(s+uint64(imm)))
+	case 0x0a: // slti
+		set(rt, b2u(int64(s) < imm))
+	case 0x0b: // sltiu
+		set(rt, b2u(s < uint64(imm)))
+	case 0x0c: // andi
+		set(rt, s&uint64(w&0xffff))
+	case 0x0d: // ori
+		set(rt, s|uint64(w&0xffff))
+	case 0x0e: // xori
+		set(rt, s^uint64(w&0xffff))
+	case 0x0f: // lui
+		set(rt, uint64(imm<<16))
+	case 0x19: // daddiu
+		c.need64()
+		set(rt, s+uint64(imm))
+	case 0x20: // lb
+		set(rt, uint64(int8(c.read(c.addr(s, imm), 1))))
+	case 0x21: // lh
+		set(rt, uint64(int16(c.read(c.addr(s, imm), 2))))
+	case 0x23: // lw
+		set(rt, sext32(c.read(c.addr(s, imm), 4)))
+	case 0x24: // lbu
+		set(rt, c.read(c.addr(s, imm), 1))
+	case 0x25: // lhu
+		set(rt, c.read(c.addr(s, imm), 2))
+	case 0x27: // lwu
+		c.need64()
+		set(rt, c.read(c.addr(s, imm), 4))
+	case 0x37: // ld
+		c.need64()
+		set(rt, c.read(c.addr(s, imm), 8))
+	case 0x28: // sb
+		c.write(c.addr(s, imm), 1, t)
+	case 0x29: // sh
+		c.write(c.addr(s, imm), 2, t)
+	case 0x2b: // sw
+		c.write(c.addr(s, imm), 4, t)
+	case 0x3f: // sd
+		c.need64()
+		c.write(c.addr(s, imm), 8, t)
+	default:
+		panic(fault("reserved instruction"))
+	}
+}
+
+// special 执行SPECIAL(opcode为0)的指令
+func (c *CPU) special(w, rs, rt, rd, sa uint32) {
+	s, t := c.Regs[rs], c.Regs[rt]
+	set := func(v uint64) { c.Regs[rd] = v }
+	funct := w & 0x3f
+	switch funct {
+	case 0x14, 0x16, 0x17, 0x1c, 0x1d, 0x1e, 0x1f, 0x2d, 0x2f, 0x38, 0x3a, 0x3b, 0x3c, 0x3e, 0x3f:
+		c.need64()
+	}
+	switch funct {
+	case 0x00: // sll, 包括nop
+		set(sext32(t << sa))
+	case 0x02: // srl
+		set(sext32(uint64(uint32(t) >> sa)))
+	case 0x03: // sra
+		set(uint64(int64(int32(t) >> sa)))
+	case 0x04: // sllv
+		set(sext32(t << (s & 31)))
+	case 0x06: // srlv
+		set(sext32(uint64(uint32(t) >> (s & 31))))
+	case 0x07: // srav
+		set(uint64(int64(int32(t) >> (s & 31))))
+	case 0x08: // jr
+		c.branch(s)
+	case 0x09: // jalr
+		set(c.PC + 8)
+		c.branch(s)
+	case 0x0d: // break
+		c.Halted = true
+	case 0x10: // mfhi
+		set(c.HI)
+	case 0x12: // mflo
+		set(c.LO)
+	case 0x14: // dsllv
+		set(t << (s & 63))
+	case 0x16: // dsrlv
+		set(t >> (s & 63))
+	case 0x17: // dsrav
+		set(uint64(int64(t) >> (s & 63)))
+	case 0x18: // mult
+		p := int64(int32(s)) * int64(int32(t))
+		c.LO, c.HI = sext32(uint64(p)), sext32(uint64(p>>32))
+	case 0x19: // multu
+		p := uint64(uint32(s)) * uint64(uint32(t))
+		c.LO, c.HI = sext32(p), sext32(p>>32)
+	case 0x1a: // div, 除数为0时结果不确定, 保持不变
+		if int32(t) != 0 {
+			a, b := int32(s), int32(t)
+			if b == -1 {
+				c.LO, c.HI = sext32(uint64(-a)), 0
+			} else {
+				c.LO, c.HI = sext32(uint64(a/b)), sext32(uint64(a%b))
+			}
+		}
+	case 0x1b: // divu
+		if uint32(t) != 0 {
+			c.LO, c.HI = sext32(uint64(uint32(s)/uint32(t))), sext32(uint64(uint32(s)%uint32(t)))
+		}
+	case 0x1c: // dmult
+		hi, lo := bits.Mul64(s, t)
+		// 有符号乘积的高64位
+		if int64(s) < 0 {
+			hi -= t
+		}
+		if int64(t) < 0 {
+			hi -= s
+		}
+		c.LO, c.HI = lo, hi
+	case 0x1d: // dmultu
+		c.HI, c.LO = bits.Mul64(s, t)
+	case 0x1e: // ddiv
+		if t != 0 {
+			if int64(t) == -1 {
+				c.LO, c.HI = -s, 0
+			} else {
+				c.LO, c.HI = uint64(int64(s)/int64(t)), uint64(int64(s)%int64(t))
+			}
+		}
+	case 0x1f: // ddivu
+		if t != 0 {
+			c.LO, c.HI = s/t, s%t
+		}
+	case 0x20, 0x21: // add, addu
+		set(sext32(s + t))
+	case 0x22, 0x23: // sub, subu
+		set(sext32(s - t))
+	case 0x24: // and
+		set(s & t)
+	case 0x25: // or
+		set(s | t)
+	case 0x26: // xor
+		set(s ^ t)
+	case 0x27: // nor
+		set(^(s | t))
+	case 0x2a: // slt
+		set(b2u(int64(s) < int64(t)))
+	case 0x2b: // sltu
+		set(b2u(s < t))
+	case 0x2d: // daddu
+		set(s + t)
+	case 0x2f: // dsubu
+		set(s - t)
+	case 0x38: // dsll
+		set(t << sa)
+	case 0x3a: // dsrl
+		set(t >> sa)
+	case 0x3b: // dsra
+		set(uint64(int64(t) >> sa))
+	case 0x3c: // dsll32
+		set(t << (sa + 32))
+	case 0x3e: // dsrl32
+		set(t >> (sa + 32))
+	case 0x3f: // dsra32
+		set(uint64(int64(t) >> (sa + 32)))
+	default:
+		panic(fault("reserved instruction"))
+	}
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,206 @@
+package mips
+
+import (
+	"CuteASM/arch"
+	"fmt"
+	"strconv"
+)
+
+// 重定位类型
+const (
+	relNone   = iota
+	relHi     // %hi(sym), 高16位(按低16位符号扩展调整)
+	relLo     // %lo(sym)
+	relGPRel  // %gp_rel(sym), 相对$gp的16位偏移
+	relBranch // 16位PC相对分支
+	relJump   // 26位跳转
+	relAbs32  // 数据中的32位绝对地址
+	relAbs64  // 数据中的64位绝对地址
+)
+
+// Inst 一条MIPS机器指令
+type Inst struct {
+	Op    string
+	Rd    int
+	Rs    int
+	Rt    int
+	Sa    int
+	Imm   int64
+	Sym   string // 引用的符号(标签), 配合Reloc使用
+	Reloc int
+	slot  bool // 已经被放进延迟槽
+}
+
+// IsBranch 判断指令是否带有延迟槽
+func (in *Inst) IsBranch() bool {
+	switch instructions[in.Op].Syntax {
+	case synJR, synJALR, synBr1, synBr2, synJ:
+		return true
+	}
+	return false
+}
+
+// reads/writes 返回指令读写的寄存器集合(位图), 用于延迟槽调度
+func (in *Inst) reads() uint64 {
+	if in.Op == "nop" {
+		return 0
+	}
+	switch instructions[in.Op].Syntax {
+	case synRRR, synShiftV, synRR, synBr2, synStore:
+		return 1<<in.Rs | 1<<in.Rt
+	case synShift:
+		return 1 << in.Rt
+	case synJR, synJALR, synImm, synLoad, synBr1:
+		return 1 << in.Rs
+	case synRd:
+		return 1 << regHILO
+	case synNone:
+		return ^uint64(0)
+	}
+	return 0
+}
+
+func (in *Inst) writes() uint64 {
+	if in.Op == "nop" {
+		return 0
+	}
+	switch instructions[in.Op].Syntax {
+	case synRRR, synShift, synShiftV, synRd, synJALR:
+		return 1 << in.Rd
+	case synImm, synLUI, synLoad:
+		return 1 << in.Rt
+	case synRR:
+		return 1 << regHILO
+	case synJ:
+		if in.Op == "jal" {
+			return 1 << regRA
+		}
+	case synNone:
+		return ^uint64(0)
+	}
+	return 0
+}
+
+// 符号加偏移的文本形式
+func symText(sym string, addend int64) string {
+	if addend == 0 {
+		return sym
+	}
+	if addend > 0 {
+		return sym + "+" + strconv.FormatInt(addend, 10)
+	}
+	return sym + strconv.FormatInt(addend, 10)
+}
+
+// 立即数部分的文本形式
+func (in *Inst) immText() string {
+	switch in.Reloc {
+	case relHi:
+		return "%hi(" + symText(in.Sym, in.Imm) + ")"
+	case relLo:
+		return "%lo(" + symText(in.Sym, in.Imm) + ")"
+	case relGPRel:
+		return "%gp_rel(" + symText(in.Sym, in.Imm) + ")"
+	}
+	return strconv.FormatInt(in.Imm, 10)
+}
+
+// Text 把指令格式化为GNU as语法
+func (in *Inst) Text(names *[32]string) string {
+	r := func(n int) string {
+		return "$" + names[n]
+	}
+	if in.Op == "nop" {
+		return "nop"
+	}
+	switch instructions[in.Op].Syntax {
+	case synRRR:
+		if (in.Op == "addu" || in.Op == "daddu") && in.Rt == regZero {
+			return "move " + r(in.Rd) + ", " + r(in.Rs)
+		}
+		return in.Op + " " + r(in.Rd) + ", " + r(in.Rs) + ", " + r(in.Rt)
+	case synShift:
+		return in.Op + " " + r(in.Rd) + ", " + r(in.Rt) + ", " + strconv.Itoa(in.Sa)
+	case synShiftV:
+		return in.Op + " " + r(in.Rd) + ", " + r(in.Rt) + ", " + r(in.Rs)
+	case synJR:
+		return in.Op + " " + r(in.Rs)
+	case synJALR:
+		if in.Rd == regRA {
+			return in.Op + " " + r(in.Rs)
+		}
+		return in.Op + " " + r(in.Rd) + ", " + r(in.Rs)
+	case synRR:
+		return in.Op + " " + r(in.Rs) + ", " + r(in.Rt)
+	case synRd:
+		return in.Op + " " + r(in.Rd)
+	case synImm:
+		return in.Op + " " + r(in.Rt) + ", " + r(in.Rs) + ", " + in.immText()
+	case synLUI:
+		return in.Op + " " + r(in.Rt) + ", " + in.immText()
+	case synLoad, synStore:
+		return in.Op + " " + r(in.Rt) + ", " + in.immText() + "(" + r(in.Rs) + ")"
+	case synBr2:
+		if in.Op == "beq" && in.Rs == regZero && in.Rt == regZero {
+			return "b " + in.Sym
+		}
+		return in.Op + " " + r(in.Rs) + ", " + r(in.Rt) + ", " + in.Sym
+	case synBr1:
+		return in.Op + " " + r(in.Rs) + ", " + in.Sym
+	case synJ:
+		return in.Op + " " + in.Sym
+	}
+	return in.Op
+}
+
+// Encode 编码一条指令
+// pc为指令地址, syms为已知符号的地址, 无法解析的符号引用通过reloc返回
+func (in *Inst) Encode(pc uint64, syms map[string]uint64) (code uint32, reloc *arch.Reloc, err error) {
+	if in.Op == "nop" {
+		return 0, nil, nil
+	}
+	info, ok := instructions[in.Op]
+	if !ok {
+		return 0, nil, fmt.Errorf("mips: unknown instruction %s", in.Op)
+	}
+	imm := in.Imm
+	if in.Reloc != relNone {
+		addr, ok := syms[in.Sym]
+		if !ok {
+			// 外部符号, 留给链接器处理
+			reloc = &arch.Reloc{Sym: in.Sym, Type: in.Reloc, Addend: in.Imm}
+			addr = 0
+			if in.Reloc == relBranch {
+				addr = pc + 4
+			}
+		}
+		switch in.Reloc {
+		case relHi:
+			imm = int64((addr + uint64(in.Imm) + 0x8000) >> 16)
+		case relLo:
+			imm = int64(int16(addr + uint64(in.Imm)))
+		case relGPRel:
+			imm = int64(addr+uint64(in.Imm)) - int64(syms["_gp"])
+		case relBranch:
+			imm = (int64(addr) - int64(pc+4)) >> 2
+			if imm < -0x8000 || imm > 0x7fff {
+				return 0, nil, fmt.Errorf("mips: branch to %s out of range", in.Sym)
+			}
+		case relJump:
+			imm = int64(addr >> 2)
+		}
+	}
+	switch info.Format {
+	case fmtR:
+		code = info.Op<<26 | uint32(in.Rs)<<21 | uint32(in.Rt)<<16 | uint32(in.Rd)<<11 | uint32(in.Sa&0x1f)<<6 | info.Funct
+	case fmtI:
+		rt := uint32(in.Rt)
+		if info.Op == opRegimm {
+			rt = info.Funct
+		}
+		code = info.Op<<26 | uint32(in.Rs)<<21 | rt<<16 | uint32(imm)&0xffff
+	case fmtJ:
+		code = info.Op<<26 | uint32(imm)&0x3ffffff
+	}
+	return code, reloc, nil
+}
@@ -0,0 +1,119 @@
+package mips
+
+// 指令格式
+const (
+	fmtR = iota // op rs rt rd sa funct
+	fmtI        // op rs rt imm16
+	fmtJ        // op target26
+)
+
+// 操作数书写形式
+const (
+	synNone   = iota // syscall
+	synRRR           // op rd, rs, rt
+	synShift         // op rd, rt, sa
+	synShiftV        // op rd, rt, rs
+	synJR            // jr rs
+	synJALR          // jalr rd, rs
+	synRR            // mult rs, rt
+	synRd            // mflo rd
+	synImm           // op rt, rs, imm
+	synLUI           // lui rt, imm
+	synLoad          // lw rt, imm(rs)
+	synStore         // sw rt, imm(rs)
+	synBr2           // beq rs, rt, label
+	synBr1           // bltz rs, label
+	synJ             // j label
+)
+
+type opInfo struct {
+	Format int
+	Op     uint32 // 主操作码
+	Funct  uint32 // R型的功能码, REGIMM分支的rt字段
+	Syntax int
+	Bits64 bool // 仅MIPS64可用
+}
+
+// 主操作码
+const (
+	opSpecial = 0x00
+	opRegimm  = 0x01
+)
+
+var instructions = map[string]opInfo{
+	// R型
+	"sll":     {fmtR, opSpecial, 0x00, synShift, false},
+	"srl":     {fmtR, opSpecial, 0x02, synShift, false},
+	"sra":     {fmtR, opSpecial, 0x03, synShift, false},
+	"sllv":    {fmtR, opSpecial, 0x04, synShiftV, false},
+	"srlv":    {fmtR, opSpecial, 0x06, synShiftV, false},
+	"srav":    {fmtR, opSpecial, 0x07, synShiftV, false},
+	"jr":      {fmtR, opSpecial, 0x08, synJR, false},
+	"jalr":    {fmtR, opSpecial, 0x09, synJALR, false},
+	"syscall": {fmtR, opSpecial, 0x0c, synNone, false},
+	"break":   {fmtR, opSpecial, 0x0d, synNone, false},
+	"mfhi":    {fmtR, opSpecial, 0x10, synRd, false},
+	"mflo":    {fmtR, opSpecial, 0x12, synRd, false},
+	"dsllv":   {fmtR, opSpecial, 0x14, synShiftV, true},
+	"dsrlv":   {fmtR, opSpecial, 0x16, synShiftV, true},
+	"dsrav":   {fmtR, opSpecial, 0x17, synShiftV, true},
+	"mult":    {fmtR, opSpecial, 0x18, synRR, false},
+	"multu":   {fmtR, opSpecial, 0x19, synRR, false},
+	"div":     {fmtR, opSpecial, 0x1a, synRR, false},
+	"divu":    {fmtR, opSpecial, 0x1b, synRR, false},
+	"dmult":   {fmtR, opSpecial, 0x1c, synRR, true},
+	"dmultu":  {fmtR, opSpecial, 0x1d, synRR, true},
+	"ddiv":    {fmtR, opSpecial, 0x1e, synRR, true},
+	"ddivu":   {fmtR, opSpecial, 0x1f, synRR, true},
+	"add":     {fmtR, opSpecial, 0x20, synRRR, false},
+	"addu":    {fmtR, opSpecial, 0x21, synRRR, false},
+	"sub":     {fmtR, opSpecial, 0x22, synRRR, false},
+	"subu":    {fmtR, opSpecial, 0x23, synRRR, false},
+	"and":     {fmtR, opSpecial, 0x24, synRRR, false},
+	"or":      {fmtR, opSpecial, 0x25, synRRR, false},
+	"xor":     {fmtR, opSpecial, 0x26, synRRR, false},
+	"nor":     {fmtR, opSpecial, 0x27, synRRR, false},
+	"slt":     {fmtR, opSpecial, 0x2a, synRRR, false},
+	"sltu":    {fmtR, opSpecial, 0x2b, synRRR, false},
+	"daddu":   {fmtR, opSpecial, 0x2d, synRRR, true},
+	"dsubu":   {fmtR, opSpecial, 0x2f, synRRR, true},
+	"dsll":    {fmtR, opSpecial, 0x38, synShift, true},
+	"dsrl":    {fmtR, opSpecial, 0x3a, synShift, true},
+	"dsra":    {fmtR, opSpecial, 0x3b, synShift, true},
+	"dsll32":  {fmtR, opSpecial, 0x3c, synShift, true},
+	"dsrl32":  {fmtR, opSpecial, 0x3e, synShift, true},
+	"dsra32":  {fmtR, opSpecial, 0x3f, synShift, true},
+
+	// REGIMM分支
+	"bltz": {fmtI, opRegimm, 0x00, synBr1, false},
+	"bgez": {fmtI, opRegimm, 0x01, synBr1, false},
+
+	// J型
+	"j":   {fmtJ, 0x02, 0, synJ, false},
+	"jal": {fmtJ, 0x03, 0, synJ, false},
+
+	// I型
+	"beq":    {fmtI, 0x04, 0, synBr2, false},
+	"bne":    {fmtI, 0x05, 0, synBr2, false},
+	"blez":   {fmtI, 0x06, 0, synBr1, false},
+	"bgtz":   {fmtI, 0x07, 0, synBr1, false},
+	"addiu":  {fmtI, 0x09, 0, synImm, false},
+	"slti":   {fmtI, 0x0a, 0, synImm, false},
+	"sltiu":  {fmtI, 0x0b, 0, synImm, false},
+	"andi":   {fmtI, 0x0c, 0, synImm, false},
+	"ori":    {fmtI, 0x0d, 0, synImm, false},
+	"xori":   {fmtI, 0x0e, 0, synImm, false},
+	"lui":    {fmtI, 0x0f, 0, synLUI, false},
+	"daddiu": {fmtI, 0x19, 0, synImm, true},
+	"lb":     {fmtI, 0x20, 0, synLoad, false},
+	"lh":     {fmtI, 0x21, 0, synLoad, false},
+	"lw":     {fmtI, 0x23, 0, synLoad, false},
+	"lbu":    {fmtI, 0x24, 0, synLoad, false},
+	"lhu":    {fmtI, 0x25, 0, synLoad, false},
+	"lwu":    {fmtI, 0x27, 0, synLoad, true},
+	"sb":     {fmtI, 0x28, 0, synStore, false},
+	"sh":     {fmtI, 0x29, 0, synStore, false},
+	"sw":     {fmtI, 0x2b, 0, synStore, false},
+	"ld":     {fmtI, 0x37, 0, synLoad, true},
+	"sd":     {fmtI, 0x3f, 0, synStore, true},
+}
@@ -0,0 +1,691 @@
+package mips
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"math"
+)
+
+// Emit 把一条CuteASM指令翻译为MIPS指令
+func (b *Backend) Emit(i *parser.Instruction) error {
+	if _, jcc := types.BranchCond(i.Instruction); !jcc && i.Instruction != "CMP" {
+		b.settle()
+	}
+	// 出错时丢弃已经生成的半条指令
+	n := len(b.buf)
+	err := b.lower(i)
+	if err != nil {
+		b.buf = b.buf[:n]
+	}
+	return err
+}
+
+func (b *Backend) lower(i *parser.Instruction) error {
+	switch i.Instruction {
+	case "MOV", "LOAD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[0], i.Args[1])
+	case "STORE":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[1], i.Args[0])
+	case "ADD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "addu", "addiu", false)
+	case "SUB":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		if i.Args[1].Type == parser.NUMBER {
+			// 减立即数等于加它的相反数
+			neg := *i.Args[1]
+			neg.Num = -neg.Num
+			return b.alu(i.Args[0], &neg, "addu", "addiu", false)
+		}
+		return b.alu(i.Args[0], i.Args[1], "subu", "", false)
+	case "AND":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "and", "andi", true)
+	case "OR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "or", "ori", true)
+	case "XOR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "xor", "xori", true)
+	case "MUL":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.hilo(i.Args[0], i.Args[1], "mult")
+	case "DIV":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.hilo(i.Args[0], i.Args[1], "divu")
+	case "NEG":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.unary(i.Args[0], func(rd int, wide bool) {
+			b.emitR(b.op("subu", wide), rd, regZero, rd)
+		})
+	case "NOT":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.unary(i.Args[0], func(rd int, wide bool) {
+			b.emitR("nor", rd, rd, regZero)
+		})
+	case "SHIFTL":
+		return b.shift(i, "sll", "sllv")
+	case "SHIFTR":
+		return b.shift(i, "srl", "srlv")
+	case "XCHG":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.xchg(i.Args[0], i.Args[1])
+	case "CMP":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		for _, arg := range i.Args {
+			if arg.Type == parser.REG {
+				if _, err := b.reg(arg.Reg); err != nil {
+					return err
+				}
+			}
+		}
+		b.cmp = &cmpState{a: i.Args[0], b: i.Args[1], unsigned: b.cmps[i]}
+		if !isSimple(i.Args[0]) || !isSimple(i.Args[1]) {
+			// 内存操作数可能在跳转前被修改, 立即求值
+			if err := b.settleErr(); err != nil {
+				b.cmp = nil // 丢弃无法求值的比较
+				return err
+			}
+		}
+		return nil
+	case "JMP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], false)
+	case "CALL":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], true)
+	case "RET":
+		b.emit(&Inst{Op: "jr", Rs: regRA})
+		return nil
+	case "PUSH":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.push(i.Args[0])
+	case "POP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.pop(i.Args[0])
+	case "HALT":
+		b.emit(&Inst{Op: "break"})
+		return nil
+	}
+	if cond, ok := types.BranchCond(i.Instruction); ok {
+		return b.jcc(i, cond)
+	}
+	return fmt.Errorf("mips: unsupported instruction %s", i.Instruction)
+}
+
+func need(i *parser.Instruction, n int) error {
+	if len(i.Args) != n {
+		return fmt.Errorf("mips: %s needs %d operands, got %d", i.Instruction, n, len(i.Args))
+	}
+	return nil
+}
+
+// isSimple 寄存器和立即数可以推迟到跳转时再比较
+func isSimple(v *parser.Value) bool {
+	return v.Type == parser.REG || v.Type == parser.NUMBER
+}
+
+// fits16 立即数能否放进I型指令
+func fits16(imm int64, unsigned bool) bool {
+	if unsigned {
+		return imm >= 0 && imm <= 0xffff
+	}
+	return imm >= -0x8000 && imm <= 0x7fff
+}
+
+// li 把立即数装入寄存器
+func (b *Backend) li(rd int, imm int64) error {
+	if b.cfg.Bits == 32 && imm > math.MaxInt32 && imm <= math.MaxUint32 {
+		imm = int64(int32(imm))
+	}
+	switch {
+	case fits16(imm, false):
+		b.emitI("addiu", rd, regZero, imm)
+	case fits16(imm, true):
+		b.emitI("ori", rd, regZero, imm)
+	case imm >= math.MinInt32 && imm <= math.MaxInt32:
+		b.emitI("lui", rd, regZero, (imm>>16)&0xffff)
+		if imm&0xffff != 0 {
+			b.emitI("ori", rd, rd, imm&0xffff)
+		}
+	case b.cfg.Bits == 64:
+		if err := b.li(rd, imm>>32); err != nil {
+			return err
+		}
+		b.emit(&Inst{Op: "dsll", Rd: rd, Rt: rd, Sa: 16})
+		b.emitI("ori", rd, rd, (imm>>16)&0xffff)
+		b.emit(&Inst{Op: "dsll", Rd: rd, Rt: rd, Sa: 16})
+		b.emitI("ori", rd, rd, imm&0xffff)
+	default:
+		return fmt.Errorf("mips: immediate %d out of range", imm)
+	}
+	return nil
+}
+
+// la 把符号地址加偏移off装入寄存器
+func (b *Backend) la(rd int, sym string, off int64) {
+	if b.small[sym] {
+		b.emit(&Inst{Op: b.op("addiu", b.cfg.Bits == 64), Rt: rd, Rs: regGP, Sym: sym, Imm: off, Reloc: relGPRel})
+		return
+	}
+	b.emit(&Inst{Op: "lui", Rt: rd, Sym: sym, Imm: off, Reloc: relHi})
+	b.emit(&Inst{Op: b.op("addiu", b.cfg.Bits == 64), Rt: rd, Rs: rd, Sym: sym, Imm: off, Reloc: relLo})
+}
+
+// use 取得操作数所在的寄存器
+// 寄存器操作数直接返回, 其它操作数装入tmp
+func (b *Backend) use(v *parser.Value, tmp int) (int, error) {
+	switch v.Type {
+	case parser.REG:
+		return b.reg(v.Reg)
+	case parser.NUMBER:
+		if v.Num == 0 {
+			return regZero, nil
+		}
+		return tmp, b.li(tmp, v.Num)
+	case parser.ADDR:
+		return tmp, b.load(tmp, v.Addr)
+	case parser.LABEL:
+		b.la(tmp, v.String, 0)
+		return tmp, nil
+	case parser.EXPR:
+		// 标签±常量, 或在Assemble时才能确定值的常量, 都按%hi/%lo装入
+		if sym, off, ok := v.Expr.Offset(); ok {
+			b.la(tmp, sym, off)
+			return tmp, nil
+		}
+		if v.Expr.Op == "" && v.Expr.Equ {
+			b.la(tmp, v.Expr.Sym, 0)
+			return tmp, nil
+		}
+	}
+	return 0, fmt.Errorf("mips: unsupported operand")
+}
+
+// mem 计算内存操作数的基址和偏移, 需要时借助$at
+// 返回的指令模板中Rs、Imm、Sym和Reloc已经设置好, 没有基址寄存器时是绝对地址
+func (b *Backend) mem(a *parser.MemoryAddr) (*Inst, error) {
+	in := &Inst{Rs: regZero, Imm: a.Displacement}
+	addu := b.op("addu", b.cfg.Bits == 64)
+	if a.BaseReg != nil {
+		base, err := b.reg(a.BaseReg)
+		if err != nil {
+			return nil, err
+		}
+		in.Rs = base
+	}
+	if a.LabelRef != "" {
+		in.Sym = a.LabelRef
+		if b.small[a.LabelRef] && a.BaseReg == nil && a.IndexReg == nil {
+			in.Rs = regGP
+			in.Reloc = relGPRel
+			return in, nil
+		}
+		b.emit(&Inst{Op: "lui", Rt: regAT, Sym: a.LabelRef, Imm: in.Imm, Reloc: relHi})
+		if a.BaseReg != nil {
+			b.emitR(addu, regAT, regAT, in.Rs)
+		}
+		in.Rs = regAT
+		in.Reloc = relLo
+	}
+	if a.IndexReg != nil {
+		index, err := b.reg(a.IndexReg)
+		if err != nil {
+			return nil, err
+		}
+		shift := 0
+		switch a.Scale {
+		case 0, 1:
+		case 2:
+			shift = 1
+		case 4:
+			shift = 2
+		case 8:
+			shift = 3
+		default:
+			return nil, fmt.Errorf("mips: invalid scale %d", a.Scale)
+		}
+		if shift != 0 {
+			if in.Rs == regAT {
+				return nil, fmt.Errorf("mips: scaled index with symbol %s is not supported", a.LabelRef)
+			}
+			b.emit(&Inst{Op: b.op("sll", b.cfg.Bits == 64), Rd: regAT, Rt: index, Sa: shift})
+			index = regAT
+		}
+		b.emitR(addu, regAT, index, in.Rs)
+		in.Rs = regAT
+	}
+	if in.Reloc == relNone && !fits16(in.Imm, false) {
+		if in.Rs == regAT {
+			return nil, fmt.Errorf("mips: displacement %d out of range", in.Imm)
+		}
+		b.emitI("lui", regAT, regZero, ((in.Imm+0x8000)>>16)&0xffff)
+		if in.Rs != regZero {
+			b.emitR(addu, regAT, regAT, in.Rs)
+		}
+		in.Rs = regAT
+		in.Imm = int64(int16(in.Imm))
+	}
+	return in, nil
+}
+
+// memOp 根据访问宽度选择读写指令
+func (b *Backend) memOp(a *parser.MemoryAddr, store bool) (string, error) {
+	length := a.Length
+	if length == 0 {
+		length = b.cfg.Bits / 8
+	}
+	ops := map[int][2]string{1: {"lb", "sb"}, 2: {"lh", "sh"}, 4: {"lw", "sw"}, 8: {"ld", "sd"}}
+	op, ok := ops[length]
+	if !ok || (length == 8 && b.cfg.Bits != 64) {
+		return "", fmt.Errorf("mips: %d-byte memory operand is not supported", length)
+	}
+	if store {
+		return op[1], nil
+	}
+	if a.Sign == parser.UNSIGNED && (length < 4 || length == 4 && b.cfg.Bits == 64) {
+		// 无符号变量零扩展
+		return op[0] + "u", nil
+	}
+	return op[0], nil
+}
+
+// load 从内存读取到寄存器
+func (b *Backend) load(rt int, a *parser.MemoryAddr) error {
+	op, err := b.memOp(a, false)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rt = op, rt
+	b.emit(in)
+	return nil
+}
+
+// store 把寄存器写入内存
+func (b *Backend) store(rt int, a *parser.MemoryAddr) error {
+	op, err := b.memOp(a, true)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rt = op, rt
+	b.emit(in)
+	return nil
+}
+
+// mov dst = src
+func (b *Backend) mov(dst, src *parser.Value) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		rs, err := b.use(src, rd)
+		if err != nil {
+			return err
+		}
+		b.move(rd, rs)
+		return nil
+	case parser.ADDR:
+		rs, err := b.use(src, regT9)
+		if err != nil {
+			return err
+		}
+		return b.store(rs, dst.Addr)
+	}
+	return fmt.Errorf("mips: invalid destination operand")
+}
+
+// modify 读出目标操作数, 交给f修改后写回
+func (b *Backend) modify(dst *parser.Value, f func(rd int) error) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		return f(rd)
+	case parser.ADDR:
+		if err := b.load(regT9, dst.Addr); err != nil {
+			return err
+		}
+		if err := f(regT9); err != nil {
+			return err
+		}
+		return b.store(regT9, dst.Addr)
+	}
+	return fmt.Errorf("mips: invalid destination operand")
+}
+
+// alu 双操作数运算 dst = dst op src
+// iop为对应的立即数指令, unsigned表示立即数按零扩展处理
+func (b *Backend) alu(dst, src *parser.Value, rop, iop string, unsigned bool) error {
+	wide := b.wide(dst)
+	return b.modify(dst, func(rd int) error {
+		if src.Type == parser.NUMBER && iop != "" && fits16(src.Num, unsigned) {
+			b.emitI(b.op(iop, wide), rd, rd, src.Num)
+			return nil
+		}
+		rs, err := b.use(src, regAT)
+		if err != nil {
+			return err
+		}
+		b.emitR(b.op(rop, wide), rd, rd, rs)
+		return nil
+	})
+}
+
+// hilo 乘除法, 结果从LO取回
+func (b *Backend) hilo(dst, src *parser.Value, op string) error {
+	wide := b.wide(dst)
+	return b.modify(dst, func(rd int) error {
+		rs, err := b.use(src, regAT)
+		if err != nil {
+			return err
+		}
+		b.emit(&Inst{Op: b.op(op, wide), Rs: rd, Rt: rs})
+		b.emit(&Inst{Op: "mflo", Rd: rd})
+		return nil
+	})
+}
+
+// unary 单操作数运算
+func (b *Backend) unary(dst *parser.Value, f func(rd int, wide bool)) error {
+	wide := b.wide(dst)
+	return b.modify(dst, func(rd int) error {
+		f(rd, wide)
+		return nil
+	})
+}
+
+// shift 移位, 省略位数时移动1位
+func (b *Backend) shift(i *parser.Instruction, op, vop string) error {
+	if len(i.Args) != 1 && len(i.Args) != 2 {
+		return fmt.Errorf("mips: %s needs 1 or 2 operands, got %d", i.Instruction, len(i.Args))
+	}
+	dst := i.Args[0]
+	wide := b.wide(dst)
+	return b.modify(dst, func(rd int) error {
+		if len(i.Args) == 1 || i.Args[1].Type == parser.NUMBER {
+			sa := 1
+			if len(i.Args) == 2 {
+				sa = int(i.Args[1].Num)
+			}
+			name := b.op(op, wide)
+			if wide && sa >= 32 {
+				name += "32"
+				sa -= 32
+			}
+			b.emit(&Inst{Op: name, Rd: rd, Rt: rd, Sa: sa})
+			return nil
+		}
+		rs, err := b.use(i.Args[1], regAT)
+		if err != nil {
+			return err
+		}
+		b.emit(&Inst{Op: b.op(vop, wide), Rd: rd, Rt: rd, Rs: rs})
+		return nil
+	})
+}
+
+// xchg 交换两个操作数
+func (b *Backend) xchg(x, y *parser.Value) error {
+	if x.Type == parser.ADDR {
+		x, y = y, x
+	}
+	if x.Type != parser.REG {
+		return fmt.Errorf("mips: XCHG needs a register operand")
+	}
+	rx, err := b.reg(x.Reg)
+	if err != nil {
+		return err
+	}
+	switch y.Type {
+	case parser.REG:
+		ry, err := b.reg(y.Reg)
+		if err != nil {
+			return err
+		}
+		b.move(regAT, rx)
+		b.move(rx, ry)
+		b.move(ry, regAT)
+		return nil
+	case parser.ADDR:
+		if err := b.load(regT9, y.Addr); err != nil {
+			return err
+		}
+		if err := b.store(rx, y.Addr); err != nil {
+			return err
+		}
+		b.move(rx, regT9)
+		return nil
+	}
+	return fmt.Errorf("mips: invalid XCHG operand")
+}
+
+// settle 把挂起的CMP结果物化到$t8
+func (b *Backend) settle() {
+	if err := b.settleErr(); err != nil {
+		// CMP时已经检查过操作数, 这里不会出错
+		panic(err)
+	}
+}
+
+func (b *Backend) settleErr() error {
+	if b.cmp == nil || b.cmp.done {
+		return nil
+	}
+	ra, err := b.use(b.cmp.a, regT9)
+	if err != nil {
+		return err
+	}
+	rb, err := b.use(b.cmp.b, regAT)
+	if err != nil {
+		return err
+	}
+	slt := "slt"
+	if b.cmp.unsigned {
+		slt = "sltu"
+	}
+	b.emitR(slt, regT8, ra, rb)
+	b.emitR(slt, regAT, rb, ra)
+	b.emitR("subu", regT8, regAT, regT8)
+	b.cmp.done = true
+	return nil
+}
+
+// $t8保存的比较结果与0比较的跳转指令, 下标为条件码
+var settledBranch = map[string]string{
+	"EQ": "beq", "NE": "bne",
+	"LT": "bltz", "GE": "bgez", "LE": "blez", "GT": "bgtz",
+	"CS": "bltz", "CC": "bgez", "LS": "blez", "HI": "bgtz",
+}
+
+// jcc 条件跳转, cond为Go汇编的条件码
+// 相等用beq、bne; 大小用slt、sltu判断, GT、LE交换两个操作数
+func (b *Backend) jcc(i *parser.Instruction, cond string) error {
+	if err := need(i, 1); err != nil {
+		return err
+	}
+	if i.Args[0].Type != parser.LABEL {
+		return fmt.Errorf("mips: %s needs a label", i.Instruction)
+	}
+	target := i.Args[0].String
+	c := b.cmp
+	if c == nil {
+		return fmt.Errorf("mips: %s without CMP", i.Instruction)
+	}
+	unsigned := types.CondUnsigned(cond)
+	if c.done {
+		if unsigned != c.unsigned {
+			return fmt.Errorf("mips: %s mixes signed and unsigned jumps after one CMP", i.Instruction)
+		}
+		b.emit(&Inst{Op: settledBranch[cond], Rs: regT8, Rt: regZero, Sym: target, Reloc: relBranch})
+		return nil
+	}
+	if c.a.Type == parser.NUMBER && c.b.Type == parser.NUMBER {
+		// 两个常数, 直接决定是否跳转
+		if types.CondHolds(cond, c.a.Num, c.b.Num) {
+			b.emit(&Inst{Op: "beq", Rs: regZero, Rt: regZero, Sym: target, Reloc: relBranch})
+		}
+		return nil
+	}
+	ra, err := b.use(c.a, regT9)
+	if err != nil {
+		return err
+	}
+	if cond == "EQ" || cond == "NE" {
+		rb, err := b.use(c.b, regAT)
+		if err != nil {
+			return err
+		}
+		b.emit(&Inst{Op: settledBranch[cond], Rs: ra, Rt: rb, Sym: target, Reloc: relBranch})
+		return nil
+	}
+	if !unsigned && c.b.Type == parser.NUMBER && c.b.Num == 0 {
+		b.emit(&Inst{Op: settledBranch[cond], Rs: ra, Sym: target, Reloc: relBranch})
+		return nil
+	}
+	slt := "slt"
+	if unsigned {
+		slt = "sltu"
+	}
+	// LT、GE判断a<b, GT、LE判断b<a; LT、GT在成立时跳转
+	swap := cond == "GT" || cond == "LE" || cond == "HI" || cond == "LS"
+	switch {
+	case !swap && c.b.Type == parser.NUMBER && fits16(c.b.Num, false):
+		// sltiu的立即数同样符号扩展, 再按无符号比较
+		op := "slti"
+		if unsigned {
+			op = "sltiu"
+		}
+		b.emitI(op, regAT, ra, c.b.Num)
+	default:
+		rb, err := b.use(c.b, regAT)
+		if err != nil {
+			return err
+		}
+		if swap {
+			ra, rb = rb, ra
+		}
+		b.emitR(slt, regAT, ra, rb)
+	}
+	branch := "bne"
+	if cond == "GE" || cond == "LE" || cond == "CC" || cond == "LS" {
+		branch = "beq"
+	}
+	b.emit(&Inst{Op: branch, Rs: regAT, Rt: regZero, Sym: target, Reloc: relBranch})
+	return nil
+}
+
+// jump 无条件跳转或调用
+func (b *Backend) jump(v *parser.Value, link bool) error {
+	switch v.Type {
+	case parser.LABEL:
+		op := "j"
+		if link {
+			op = "jal"
+		}
+		b.emit(&Inst{Op: op, Sym: v.String, Reloc: relJump})
+		return nil
+	case parser.REG, parser.ADDR:
+		// 间接调用按PIC约定通过$t9
+		rs, err := b.use(v, regT9)
+		if err != nil {
+			return err
+		}
+		if link {
+			b.emit(&Inst{Op: "jalr", Rd: regRA, Rs: rs})
+		} else {
+			b.emit(&Inst{Op: "jr", Rs: rs})
+		}
+		return nil
+	}
+	return fmt.Errorf("mips: invalid jump target")
+}
+
+// push 压栈, 每个槽位占一个字长
+func (b *Backend) push(v *parser.Value) error {
+	rs, err := b.use(v, regT9)
+	if err != nil {
+		return err
+	}
+	size := int64(b.cfg.Bits / 8)
+	b.emitI(b.op("addiu", b.cfg.Bits == 64), regSP, regSP, -size)
+	op := "sw"
+	if size == 8 {
+		op = "sd"
+	}
+	b.emit(&Inst{Op: op, Rt: rs, Rs: regSP})
+	return nil
+}
+
+// pop 出栈
+func (b *Backend) pop(v *parser.Value) error {
+	size := int64(b.cfg.Bits / 8)
+	op := "lw"
+	if size == 8 {
+		op = "ld"
+	}
+	rd := regT9
+	if v.Type == parser.REG {
+		tmp, err := b.reg(v.Reg)
+		if err != nil {
+			return err
+		}
+		rd = tmp
+	} else if v.Type != parser.ADDR {
+		return fmt.Errorf("mips: invalid POP operand")
+	}
+	b.emit(&Inst{Op: op, Rt: rd, Rs: regSP})
+	b.emitI(b.op("addiu", b.cfg.Bits == 64), regSP, regSP, size)
+	if v.Type == parser.ADDR {
+		return b.store(rd, v.Addr)
+	}
+	return nil
+}
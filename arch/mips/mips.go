@@ -0,0 +1,263 @@
+// Package mips 实现MIPS32/MIPS64后端
+package mips
+
+import (
+	"CuteASM/arch"
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"encoding/binary"
+)
+
+// Config MIPS后端配置
+type Config struct {
+	Bits      int  // 32或64
+	BigEndian bool // 字节序
+	GPOpt     bool // .sdata/.sbss中的符号使用$gp相对寻址
+	NoReorder bool // 不调度延迟槽, 一律填充nop
+}
+
+// ConfigFor 根据架构名称返回默认配置
+// 支持 mips、mipsel、mips64、mips64el
+func ConfigFor(name string) Config {
+	cfg := Config{Bits: 32, BigEndian: true, GPOpt: true}
+	switch name {
+	case "mipsel":
+		cfg.BigEndian = false
+	case "mips64":
+		cfg.Bits = 64
+	case "mips64el":
+		cfg.Bits = 64
+		cfg.BigEndian = false
+	}
+	return cfg
+}
+
+// New 创建MIPS架构实例(MIPS32大端)
+func New() *types.Architecture {
+	return newArch(ConfigFor("mips"))
+}
+
+func newArch(cfg Config) *types.Architecture {
+	names := &regNames32
+	if cfg.Bits == 64 {
+		names = &regNames64
+	}
+	arch := &types.Architecture{
+		Name:         "mips",
+		RegisterList: RegLookup,
+		WordSize:     cfg.Bits,
+		ByteOrder:    binary.LittleEndian,
+		Registers:    regTable(cfg, names),
+	}
+	if cfg.Bits == 64 {
+		arch.Name = "mips64"
+	}
+	if cfg.BigEndian {
+		arch.ByteOrder = binary.BigEndian
+	}
+	return arch
+}
+
+// CMP的结果
+// CMP本身不生成代码, 紧跟的条件跳转直接比较两个操作数;
+// 遇到其它指令或基本块结束时, 把比较结果物化到$t8: a<b为-1, a==b为0, a>b为1
+type cmpState struct {
+	a, b     *parser.Value
+	done     bool // 已经物化到$t8
+	unsigned bool // 之后的条件跳转按无符号比较, 物化时使用sltu
+}
+
+// Backend MIPS后端
+type Backend struct {
+	arch.Fixed[*Inst]
+
+	cfg     Config
+	arch    *types.Architecture
+	names   *[32]string
+	section string
+	small   map[string]bool              // $gp相对寻址的符号
+	cmps    map[*parser.Instruction]bool // 之后按无符号比较的CMP
+	cmp     *cmpState
+	buf     []*Inst // 当前基本块
+}
+
+// NewBackend 创建MIPS后端
+func NewBackend(cfg Config) *Backend {
+	a := newArch(cfg)
+	b := &Backend{
+		Fixed: arch.NewFixed("mips", a.ByteOrder, &Inst{Op: "nop"}, relAbs32, relAbs64),
+		cfg:   cfg,
+		arch:  a,
+		names: &regNames32,
+		small: map[string]bool{},
+	}
+	if cfg.Bits == 64 {
+		b.names = &regNames64
+	}
+	return b
+}
+
+// Arch 返回架构描述
+func (b *Backend) Arch() *types.Architecture {
+	return b.arch
+}
+
+// Prepare 找出按无符号比较的CMP, 收集小数据区中的符号
+func (b *Backend) Prepare(root *parser.Node) {
+	b.cmps = arch.UnsignedCmps(root)
+	if !b.cfg.GPOpt {
+		return
+	}
+	for _, n := range root.Children {
+		if s, ok := n.Value.(*parser.SECTION); ok && (s.Name == ".sdata" || s.Name == ".sbss") {
+			b.markSmall(n)
+		}
+	}
+}
+
+func (b *Backend) markSmall(node *parser.Node) {
+	for _, n := range node.Children {
+		if label, ok := n.Value.(*parser.LabelBlock); ok {
+			b.small[label.Name] = true
+		}
+		b.markSmall(n)
+	}
+}
+
+// Section 切换当前段
+func (b *Backend) Section(name string) {
+	b.section = name
+}
+
+// Header 延迟槽和$at由后端自己安排, 汇编器不能再调整
+func (b *Backend) Header() []string {
+	return []string{".set noreorder", ".set noat"}
+}
+
+// Flush 结束当前基本块, 填充延迟槽并返回文本汇编
+func (b *Backend) Flush() []string {
+	if arch.FallsThrough(b.buf) {
+		b.settle()
+	}
+	insts := b.fillDelaySlots(b.buf)
+	b.buf = nil
+	return b.Fixed.Flush(insts, func(in *Inst) string { return in.Text(b.names) })
+}
+
+// Assemble 编码全部指令
+func (b *Backend) Assemble() ([]byte, error) {
+	b.Flush()
+	return b.Fixed.Assemble()
+}
+
+// fillDelaySlots 为分支指令填充延迟槽
+// 前一条指令与分支没有寄存器依赖时把它移进延迟槽, 否则填充nop
+func (b *Backend) fillDelaySlots(insts []*Inst) []*Inst {
+	out := make([]*Inst, 0, len(insts)+2)
+	for _, in := range insts {
+		if !in.IsBranch() {
+			out = append(out, in)
+			continue
+		}
+		if !b.cfg.NoReorder && len(out) > 0 {
+			prev := out[len(out)-1]
+			if !prev.IsBranch() && !prev.slot &&
+				prev.writes()&(in.reads()|in.writes()) == 0 && prev.reads()&in.writes() == 0 {
+				prev.slot = true
+				out[len(out)-1] = in
+				out = append(out, prev)
+				continue
+			}
+		}
+		out = append(out, in, &Inst{Op: "nop", slot: true})
+	}
+	return out
+}
+
+// Uncond 无条件跳转, 之后的代码不可达
+func (in *Inst) Uncond() bool {
+	switch in.Op {
+	case "j", "jr":
+		return true
+	case "beq":
+		return in.Rs == regZero && in.Rt == regZero
+	}
+	return false
+}
+
+// 64位运算对应的指令
+var ops64 = map[string]string{
+	"addu":  "daddu",
+	"addiu": "daddiu",
+	"subu":  "dsubu",
+	"sll":   "dsll",
+	"srl":   "dsrl",
+	"sra":   "dsra",
+	"sllv":  "dsllv",
+	"srlv":  "dsrlv",
+	"srav":  "dsrav",
+	"mult":  "dmult",
+	"multu": "dmultu",
+	"div":   "ddiv",
+	"divu":  "ddivu",
+}
+
+// op 根据运算宽度选择指令
+func (b *Backend) op(name string, wide bool) string {
+	if wide {
+		if tmp, ok := ops64[name]; ok {
+			return tmp
+		}
+	}
+	return name
+}
+
+func (b *Backend) emit(in *Inst) {
+	b.buf = append(b.buf, in)
+}
+
+func (b *Backend) emitR(op string, rd, rs, rt int) {
+	b.emit(&Inst{Op: op, Rd: rd, Rs: rs, Rt: rt})
+}
+
+func (b *Backend) emitI(op string, rt, rs int, imm int64) {
+	b.emit(&Inst{Op: op, Rt: rt, Rs: rs, Imm: imm})
+}
+
+// move 寄存器间传送
+func (b *Backend) move(rd, rs int) {
+	if rd != rs {
+		b.emitR(b.op("addu", b.cfg.Bits == 64), rd, rs, regZero)
+	}
+}
+
+// reg 把CuteASM寄存器映射为物理寄存器
+func (b *Backend) reg(r *parser.Reg) (int, error) {
+	phys, err := b.arch.Registers.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	return phys.Num, err
+}
+
+// width 操作数宽度(字节)
+func (b *Backend) width(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		switch v.Reg.Type {
+		case types.Reg8:
+			return 1
+		case types.Reg16:
+			return 2
+		case types.Reg32:
+			return 4
+		}
+	case parser.ADDR:
+		if v.Addr.Length != 0 {
+			return v.Addr.Length
+		}
+	}
+	return b.cfg.Bits / 8
+}
+
+// wide 是否需要64位运算
+func (b *Backend) wide(v *parser.Value) bool {
+	return b.cfg.Bits == 64 && b.width(v) == 8
+}
@@ -0,0 +1,76 @@
+package mips
+
+import "CuteASM/arch/types"
+
+// 常用寄存器编号
+const (
+	regZero = 0
+	regAT   = 1 // 汇编器临时寄存器, 用于地址和立即数
+	regV0   = 2
+	regT8   = 24 // 保存CMP结果(模拟标志位)
+	regT9   = 25 // 翻译内存操作数时的临时寄存器
+	regGP   = 28
+	regSP   = 29
+	regFP   = 30
+	regRA   = 31
+	regHILO = 32 // HI/LO, 只用于延迟槽的依赖分析
+)
+
+// o32 ABI寄存器名称, 下标即寄存器编号
+var regNames32 = [32]string{
+	"zero", "at", "v0", "v1", "a0", "a1", "a2", "a3",
+	"t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7",
+	"s0", "s1", "s2", "s3", "s4", "s5", "s6", "s7",
+	"t8", "t9", "k0", "k1", "gp", "sp", "fp", "ra",
+}
+
+// n64 ABI寄存器名称, 8-11号寄存器为a4-a7
+var regNames64 = [32]string{
+	"zero", "at", "v0", "v1", "a0", "a1", "a2", "a3",
+	"a4", "a5", "a6", "a7", "t0", "t1", "t2", "t3",
+	"s0", "s1", "s2", "s3", "s4", "s5", "s6", "s7",
+	"t8", "t9", "k0", "k1", "gp", "sp", "fp", "ra",
+}
+
+// RegLookup 寄存器名称到编号的映射
+var RegLookup = map[string]types.Register{}
+
+func init() {
+	for i, name := range regNames32 {
+		RegLookup[name] = types.Register(i)
+	}
+	for i, name := range regNames64 {
+		RegLookup[name] = types.Register(i)
+	}
+	RegLookup["s8"] = regFP
+}
+
+// regTable 虚拟寄存器表
+// at、t8、t9保留给指令翻译使用
+func regTable(cfg Config, names *[32]string) *types.RegTable {
+	t := &types.RegTable{
+		Arch: "mips",
+		Bits: cfg.Bits,
+		Named: map[string]types.PhysReg{
+			"sp": {Num: regSP, Name: "sp", Class: types.RegSaved},
+			"bp": {Num: regFP, Name: "fp", Class: types.RegSaved},
+			"ra": {Num: regRA, Name: "ra", Class: types.RegScratch},
+		},
+	}
+	add := func(class types.RegClass, from, to int) {
+		for i := from; i <= to; i++ {
+			t.Regs = append(t.Regs, types.PhysReg{Num: i, Name: names[i], Class: class})
+		}
+	}
+	add(types.RegReturn, 2, 3) // v0-v1
+	if cfg.Bits == 64 {
+		t.Arch = "mips64"
+		add(types.RegArg, 4, 11)      // a0-a7
+		add(types.RegScratch, 12, 15) // t0-t3
+	} else {
+		add(types.RegArg, 4, 7)      // a0-a3
+		add(types.RegScratch, 8, 15) // t0-t7
+	}
+	add(types.RegSaved, 16, 23) // s0-s7
+	return t
+}
@@ -0,0 +1,244 @@
+package plan9
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// amd64通用寄存器在Go汇编中的名称, 下标为硬件编号, 宽度由助记符后缀决定
+var amd64Regs = [16]string{
+	"AX", "CX", "DX", "BX", "SP", "BP", "SI", "DI",
+	"R8", "R9", "R10", "R11", "R12", "R13", "R14", "R15",
+}
+
+// amd64Ops CuteASM指令对应的Go助记符, 不含宽度后缀
+var amd64Ops = map[types.Instruction]string{
+	"MOV": "MOV", "LOAD": "MOV", "STORE": "MOV",
+	"ADD": "ADD", "SUB": "SUB", "MUL": "IMUL",
+	"AND": "AND", "OR": "OR", "XOR": "XOR", "NOT": "NOT", "NEG": "NEG",
+	"SHIFTL": "SHL", "SHIFTR": "SHR",
+	"CMP": "CMP", "XCHG": "XCHG", "PUSH": "PUSH", "POP": "POP",
+}
+
+// amd64Jumps 跳转指令
+var amd64Jumps = map[types.Instruction]string{
+	"JMP": "JMP", "JMPZ": "JEQ", "JMPN": "JLT", "CALL": "CALL",
+}
+
+// amd64Sized Go汇编中带宽度后缀的Intel助记符
+var amd64Sized = map[types.Instruction]bool{
+	"LEA": true, "INC": true, "DEC": true, "TEST": true, "ADC": true, "SBB": true,
+	"IDIV": true, "SAL": true, "SAR": true, "ROL": true, "ROR": true, "RCL": true, "RCR": true,
+	"SHLD": true, "SHRD": true, "BT": true, "BTC": true, "BTR": true, "BTS": true,
+	"BSF": true, "BSR": true, "BSWAP": true, "XADD": true, "CMPXCHG": true,
+}
+
+// amd64Jcc Intel的条件跳转, 如JNL即JGE
+func amd64Jcc(name types.Instruction) (string, bool) {
+	cond, ok := strings.CutPrefix(string(name), "J")
+	if !ok || types.IntelCond[cond] == "" {
+		return "", false
+	}
+	return "J" + types.IntelCond[cond], true
+}
+
+// amd64Intel 其它指令的Go助记符: Intel的写法加上宽度后缀和Go的条件码, 其余原样输出
+// 操作数已经是源操作数在前
+func amd64Intel(name types.Instruction, args []*parser.Value) string {
+	text := string(name)
+	switch {
+	case amd64Sized[name]:
+		return text + amd64Suffix(opWidth(args...))
+	case strings.HasPrefix(text, "SET") && types.IntelCond[text[3:]] != "":
+		return "SET" + types.IntelCond[text[3:]]
+	case strings.HasPrefix(text, "CMOV") && types.IntelCond[text[4:]] != "":
+		return "CMOV" + amd64Suffix(opWidth(args...)) + types.IntelCond[text[4:]]
+	case name == "MOVSXD" && len(args) == 2:
+		return "MOVLQSX"
+	case (name == "MOVZX" || name == "MOVSX") && len(args) == 2:
+		return "MOV" + amd64Suffix(width(args[0])) + amd64Suffix(width(args[1])) + text[3:]
+	}
+	return text
+}
+
+func amd64Suffix(width int) string {
+	switch width {
+	case 1:
+		return "B"
+	case 2:
+		return "W"
+	case 4:
+		return "L"
+	}
+	return "Q"
+}
+
+// amd64 翻译一条指令
+// Go汇编的源操作数在前, CMP除外; 其它指令和x86编码表一样已经是这个顺序
+func (b *Backend) amd64(i *parser.Instruction) error {
+	switch i.Instruction {
+	case "RET":
+		b.emit("RET")
+		return nil
+	case "HALT":
+		b.emit("HLT")
+		return nil
+	case "DIV":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		src, err := b.amd64Operand(i.Args[0])
+		if err != nil {
+			return err
+		}
+		b.emit("DIV%s %s", amd64Suffix(opWidth(i.Args...)), src)
+		return nil
+	}
+	name, ok := amd64Jumps[i.Instruction]
+	if !ok {
+		name, ok = amd64Jcc(i.Instruction)
+	}
+	if ok {
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		dst := i.Args[0]
+		if dst.Type == parser.LABEL {
+			b.emit("%s %s", name, b.target(dst.String))
+			return nil
+		}
+		tmp, err := b.amd64Operand(dst)
+		if err != nil {
+			return err
+		}
+		if dst.Type == parser.REG {
+			tmp = "(" + tmp + ")"
+		}
+		b.emit("%s %s", name, tmp)
+		return nil
+	}
+
+	if name := amd64Widen(i); name != "" {
+		src, err := b.amd64Operand(i.Args[1])
+		if err != nil {
+			return err
+		}
+		dst, err := b.amd64Operand(i.Args[0])
+		if err != nil {
+			return err
+		}
+		b.emit("%s %s, %s", name, src, dst)
+		return nil
+	}
+
+	args := i.Args
+	name, ok = amd64Ops[i.Instruction]
+	if ok {
+		switch i.Instruction {
+		case "STORE":
+			if err := need(i, 2); err != nil {
+				return err
+			}
+			args = []*parser.Value{args[1], args[0]}
+		}
+		name += amd64Suffix(opWidth(args...))
+	} else {
+		name = amd64Intel(i.Instruction, args)
+	}
+	ops := make([]string, len(args))
+	for n, arg := range args {
+		tmp, err := b.amd64Operand(arg)
+		if err != nil {
+			return err
+		}
+		ops[n] = tmp
+	}
+	if ok && i.Instruction != "CMP" {
+		for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+			ops[l], ops[r] = ops[r], ops[l]
+		}
+	}
+	if len(ops) == 0 {
+		b.emit("%s", name)
+		return nil
+	}
+	b.emit("%s %s", name, strings.Join(ops, ", "))
+	return nil
+}
+
+// amd64Widen LOAD把SIGNED或UNSIGNED变量读入更宽的寄存器, 如MOVBQSX、MOVLQZX
+func amd64Widen(i *parser.Instruction) string {
+	if i.Instruction != "LOAD" || len(i.Args) != 2 {
+		return ""
+	}
+	dst, src := i.Args[0], i.Args[1]
+	if dst.Type != parser.REG || src.Type != parser.ADDR || src.Addr.Sign == 0 {
+		return ""
+	}
+	width := types.RegWidth(dst.Reg.Type)
+	if width <= src.Addr.Length || src.Addr.Length == 0 {
+		return ""
+	}
+	ext := "ZX"
+	if src.Addr.Sign == parser.SIGNED {
+		ext = "SX"
+	}
+	return "MOV" + amd64Suffix(src.Addr.Length) + amd64Suffix(width) + ext
+}
+
+// amd64Operand 输出一个操作数
+func (b *Backend) amd64Operand(v *parser.Value) (string, error) {
+	switch v.Type {
+	case parser.REG:
+		return b.amd64Reg(v.Reg)
+	case parser.NUMBER:
+		return "$" + strconv.FormatInt(v.Num, 10), nil
+	case parser.LABEL:
+		// 标签的地址
+		return "$" + b.target(v.String), nil
+	case parser.ADDR:
+		return b.amd64Mem(v.Addr)
+	}
+	return "", fmt.Errorf("plan9: cannot use operand of type %d on amd64", v.Type)
+}
+
+func (b *Backend) amd64Reg(r *parser.Reg) (string, error) {
+	phys, err := b.arch.Registers.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	if err != nil {
+		return "", err
+	}
+	return amd64Regs[phys.Num], nil
+}
+
+// amd64Mem 内存操作数 disp(BASE)(INDEX*scale)
+func (b *Backend) amd64Mem(addr *parser.MemoryAddr) (string, error) {
+	if sym, ok := b.symbol(addr); ok {
+		return sym, nil
+	}
+	text := strconv.Itoa(int(addr.Displacement))
+	if addr.LabelRef != "" {
+		text = addr.LabelRef + offset(int(addr.Displacement)) + "(SB)"
+	}
+	if addr.BaseReg != nil {
+		base, err := b.amd64Reg(addr.BaseReg)
+		if err != nil {
+			return "", err
+		}
+		text += "(" + base + ")"
+	}
+	if addr.IndexReg != nil {
+		index, err := b.amd64Reg(addr.IndexReg)
+		if err != nil {
+			return "", err
+		}
+		scale := addr.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		text += "(" + index + "*" + strconv.Itoa(scale) + ")"
+	}
+	return text, nil
+}
@@ -0,0 +1,365 @@
+package plan9
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// arm64翻译时使用的临时寄存器, Go汇编器只占用R27(REGTMP)
+const (
+	arm64Tmp  = "R16" // 目标操作数在内存中时保存它的值
+	arm64Tmp2 = "R17" // 源操作数和计算地址
+)
+
+// arm64Alu 运算指令, 分别为64位和32位形式, imm表示可以直接使用立即数
+var arm64Alu = map[types.Instruction]struct {
+	x, w string
+	imm  bool
+}{
+	"ADD":    {"ADD", "ADDW", true},
+	"SUB":    {"SUB", "SUBW", true},
+	"AND":    {"AND", "ANDW", true},
+	"OR":     {"ORR", "ORRW", true},
+	"XOR":    {"EOR", "EORW", true},
+	"MUL":    {"MUL", "MULW", false},
+	"DIV":    {"UDIV", "UDIVW", false},
+	"SHIFTL": {"LSL", "LSLW", true},
+	"SHIFTR": {"LSR", "LSRW", true},
+}
+
+var arm64Jumps = map[types.Instruction]string{
+	"JMP": "JMP", "JMPZ": "BEQ", "JMPN": "BLT", "CALL": "CALL",
+}
+
+// arm64 翻译一条指令
+// 只有加载和存储指令可以访问内存, 内存操作数先读入临时寄存器
+func (b *Backend) arm64(i *parser.Instruction) error {
+	if alu, ok := arm64Alu[i.Instruction]; ok {
+		args := i.Args
+		if (i.Instruction == "SHIFTL" || i.Instruction == "SHIFTR") && len(args) == 1 {
+			args = append(args, &parser.Value{Type: parser.NUMBER, Num: 1})
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("plan9: %s needs 2 operands, got %d", i.Instruction, len(args))
+		}
+		name := alu.x
+		if opWidth(args...) <= 4 {
+			name = alu.w
+		}
+		return b.arm64Modify(args[0], func(rd string) error {
+			src, err := b.arm64Src(args[1], alu.imm)
+			if err != nil {
+				return err
+			}
+			b.emit("%s %s, %s", name, src, rd)
+			return nil
+		})
+	}
+	if name, ok := arm64Jumps[i.Instruction]; ok {
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		dst := i.Args[0]
+		if dst.Type == parser.LABEL {
+			b.emit("%s %s", name, b.target(dst.String))
+			return nil
+		}
+		if name != "JMP" && name != "CALL" {
+			return fmt.Errorf("plan9: %s needs a label", i.Instruction)
+		}
+		rd, err := b.arm64Src(dst, false)
+		if err != nil {
+			return err
+		}
+		b.emit("%s (%s)", name, rd)
+		return nil
+	}
+	switch i.Instruction {
+	case "MOV", "LOAD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.arm64Mov(i.Args[0], i.Args[1])
+	case "STORE":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.arm64Mov(i.Args[1], i.Args[0])
+	case "NOT", "NEG":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		name := map[types.Instruction]string{"NOT": "MVN", "NEG": "NEG"}[i.Instruction]
+		if opWidth(i.Args...) <= 4 {
+			name += "W"
+		}
+		return b.arm64Modify(i.Args[0], func(rd string) error {
+			b.emit("%s %s, %s", name, rd, rd)
+			return nil
+		})
+	case "CMP":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		name := "CMP"
+		if opWidth(i.Args...) <= 4 {
+			name = "CMPW"
+		}
+		rn, err := b.arm64Src(i.Args[0], false)
+		if err != nil {
+			return err
+		}
+		if rn == arm64Tmp2 {
+			b.emit("MOVD %s, %s", arm64Tmp2, arm64Tmp)
+			rn = arm64Tmp
+		}
+		rm, err := b.arm64Src(i.Args[1], true)
+		if err != nil {
+			return err
+		}
+		// Go汇编的CMP先写第二个操作数
+		b.emit("%s %s, %s", name, rm, rn)
+		return nil
+	case "XCHG":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		x, y := i.Args[0], i.Args[1]
+		if x.Type != parser.REG {
+			x, y = y, x
+		}
+		if x.Type != parser.REG {
+			return fmt.Errorf("plan9: XCHG needs a register operand")
+		}
+		rx, err := b.arm64Reg(x.Reg)
+		if err != nil {
+			return err
+		}
+		b.emit("MOVD %s, %s", rx, arm64Tmp)
+		if err := b.arm64Mov(x, y); err != nil {
+			return err
+		}
+		return b.arm64Mov(y, &parser.Value{Type: parser.REG, Reg: &parser.Reg{Name: arm64Tmp}})
+	case "PUSH":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		src, err := b.arm64Src(i.Args[0], false)
+		if err != nil {
+			return err
+		}
+		// 栈指针保持16字节对齐
+		b.emit("MOVD.W %s, -16(RSP)", src)
+		return nil
+	case "POP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.arm64Modify(i.Args[0], func(rd string) error {
+			b.emit("MOVD.P 16(RSP), %s", rd)
+			return nil
+		})
+	case "RET":
+		b.emit("RET")
+		return nil
+	case "HALT":
+		b.emit("UNDEF")
+		return nil
+	}
+	return fmt.Errorf("plan9: unsupported instruction %s on arm64", i.Instruction)
+}
+
+// arm64Reg 寄存器在Go汇编中的名称, R16和R17直接使用
+func (b *Backend) arm64Reg(r *parser.Reg) (string, error) {
+	if r.Name == arm64Tmp || r.Name == arm64Tmp2 {
+		return r.Name, nil
+	}
+	phys, err := b.arch.Registers.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	if err != nil {
+		return "", err
+	}
+	switch phys.Num {
+	case 31:
+		return "RSP", nil
+	case 18, 26, 27, 28:
+		return "", fmt.Errorf("plan9: R%d is reserved by the Go toolchain", phys.Num)
+	}
+	return "R" + strconv.Itoa(phys.Num), nil
+}
+
+// arm64Src 把源操作数放入寄存器, imm为真时立即数直接返回$n
+func (b *Backend) arm64Src(v *parser.Value, imm bool) (string, error) {
+	switch v.Type {
+	case parser.REG:
+		return b.arm64Reg(v.Reg)
+	case parser.NUMBER:
+		if v.Num == 0 && !imm {
+			return "ZR", nil
+		}
+		if imm {
+			return "$" + strconv.FormatInt(v.Num, 10), nil
+		}
+		b.emit("MOVD $%d, %s", v.Num, arm64Tmp2)
+		return arm64Tmp2, nil
+	case parser.LABEL:
+		b.emit("MOVD $%s, %s", b.target(v.String), arm64Tmp2)
+		return arm64Tmp2, nil
+	case parser.ADDR:
+		mem, err := b.arm64Mem(v.Addr)
+		if err != nil {
+			return "", err
+		}
+		b.emit("%s %s, %s", arm64Load(v.Addr), mem, arm64Tmp2)
+		return arm64Tmp2, nil
+	}
+	return "", fmt.Errorf("plan9: cannot use operand of type %d on arm64", v.Type)
+}
+
+// arm64Modify 读-改-写目标操作数, 内存中的目标先读入临时寄存器, 修改后写回
+func (b *Backend) arm64Modify(dst *parser.Value, f func(rd string) error) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.arm64Reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		return f(rd)
+	case parser.ADDR:
+		mem, err := b.arm64Mem(dst.Addr)
+		if err != nil {
+			return err
+		}
+		b.emit("%s %s, %s", arm64Load(dst.Addr), mem, arm64Tmp)
+		if err := f(arm64Tmp); err != nil {
+			return err
+		}
+		// 计算源操作数时可能覆盖了R17中的地址
+		mem, err = b.arm64Mem(dst.Addr)
+		if err != nil {
+			return err
+		}
+		b.emit("%s %s, %s", arm64Store(dst.Addr.Length), arm64Tmp, mem)
+		return nil
+	}
+	return fmt.Errorf("plan9: cannot modify operand of type %d", dst.Type)
+}
+
+// arm64Mov 数据传送
+func (b *Backend) arm64Mov(dst, src *parser.Value) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.arm64Reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		switch src.Type {
+		case parser.NUMBER:
+			b.emit("MOVD $%d, %s", src.Num, rd)
+		case parser.LABEL:
+			b.emit("MOVD $%s, %s", b.target(src.String), rd)
+		case parser.ADDR:
+			mem, err := b.arm64Mem(src.Addr)
+			if err != nil {
+				return err
+			}
+			b.emit("%s %s, %s", arm64Load(src.Addr), mem, rd)
+		default:
+			rs, err := b.arm64Src(src, false)
+			if err != nil {
+				return err
+			}
+			name := "MOVD"
+			if opWidth(dst) <= 4 {
+				// 32位寄存器写入时清零高位
+				name = "MOVWU"
+			}
+			b.emit("%s %s, %s", name, rs, rd)
+		}
+		return nil
+	case parser.ADDR:
+		rs, err := b.arm64Src(src, false)
+		if err != nil {
+			return err
+		}
+		if rs == arm64Tmp2 && dst.Addr.IndexReg != nil {
+			// 计算地址会覆盖R17
+			b.emit("MOVD %s, %s", arm64Tmp2, arm64Tmp)
+			rs = arm64Tmp
+		}
+		mem, err := b.arm64Mem(dst.Addr)
+		if err != nil {
+			return err
+		}
+		b.emit("%s %s, %s", arm64Store(dst.Addr.Length), rs, mem)
+		return nil
+	}
+	return fmt.Errorf("plan9: cannot move to operand of type %d", dst.Type)
+}
+
+// arm64Mem 内存操作数, 带变址寄存器时先把地址计算到R17
+func (b *Backend) arm64Mem(addr *parser.MemoryAddr) (string, error) {
+	if sym, ok := b.symbol(addr); ok {
+		return sym, nil
+	}
+	if addr.LabelRef != "" {
+		return "", fmt.Errorf("plan9: cannot combine symbol %s with registers on arm64", addr.LabelRef)
+	}
+	disp := int(addr.Displacement)
+	if addr.IndexReg == nil {
+		base, err := b.arm64Reg(addr.BaseReg)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d(%s)", disp, base), nil
+	}
+	index, err := b.arm64Reg(addr.IndexReg)
+	if err != nil {
+		return "", err
+	}
+	scale := addr.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	if scale&(scale-1) != 0 {
+		return "", fmt.Errorf("plan9: invalid scale %d", scale)
+	}
+	shift := bits.TrailingZeros(uint(scale))
+	if addr.BaseReg == nil {
+		b.emit("LSL $%d, %s, %s", shift, index, arm64Tmp2)
+	} else {
+		base, err := b.arm64Reg(addr.BaseReg)
+		if err != nil {
+			return "", err
+		}
+		b.emit("ADD %s<<%d, %s, %s", index, shift, base, arm64Tmp2)
+	}
+	return fmt.Sprintf("%d(%s)", disp, arm64Tmp2), nil
+}
+
+// arm64Load 按宽度选择加载指令, SIGNED变量符号扩展, 其它零扩展
+func arm64Load(addr *parser.MemoryAddr) string {
+	name := map[int]string{1: "MOVB", 2: "MOVH", 4: "MOVW"}[addr.Length]
+	if name == "" {
+		return "MOVD"
+	}
+	if addr.Sign != parser.SIGNED {
+		name += "U"
+	}
+	return name
+}
+
+// arm64Store 按宽度选择存储指令
+func arm64Store(length int) string {
+	switch length {
+	case 1:
+		return "MOVB"
+	case 2:
+		return "MOVH"
+	case 4:
+		return "MOVW"
+	}
+	return "MOVD"
+}
@@ -0,0 +1,142 @@
+package plan9
+
+import (
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// dataSym 数据符号, 由DATA逐段初始化, 由GLOBL声明大小
+type dataSym struct {
+	size   int
+	rodata bool // 位于.rodata, 只读
+	local  bool // 没有GLOBAL, 只在本文件内可见
+}
+
+// collectData 收集带有数据的标签
+func (b *Backend) collectData(node *parser.Node, section string) {
+	for _, n := range node.Children {
+		switch v := n.Value.(type) {
+		case *parser.SECTION:
+			b.collectData(n, v.Name)
+			continue
+		case *parser.LabelBlock:
+			if size := parser.DataLen(n); size != 0 && !v.IsFunc {
+				sym := &dataSym{size: size, rodata: section == ".rodata"}
+				if s := b.symbols.Lookup(v.Name); s != nil && s.Bind == parser.BindLocal {
+					sym.local = true
+				}
+				b.data[v.Name] = sym
+			}
+		}
+		b.collectData(n, section)
+	}
+}
+
+// Data 把初始化数据翻译为DATA, 全部数据输出后用GLOBL声明符号
+// 全为0的部分不需要DATA
+func (b *Backend) Data(d *parser.DataBlock) error {
+	sym, ok := b.data[b.label]
+	if !ok {
+		return fmt.Errorf("plan9: data needs a label, as in name: BB 1")
+	}
+	name := b.dataName(b.label)
+	for _, it := range d.Items {
+		for n := 0; n < it.Count; n++ {
+			if err := b.dataItem(name, it); err != nil {
+				return err
+			}
+		}
+	}
+	b.global(name, sym)
+	return nil
+}
+
+// global 数据全部输出后声明符号
+func (b *Backend) global(name string, sym *dataSym) {
+	if b.offset == sym.size {
+		flags := "NOPTR"
+		if sym.rodata {
+			flags = "RODATA|NOPTR"
+		}
+		b.emit("GLOBL %s(SB), %s, $%d", name, flags, sym.size)
+	}
+}
+
+// Align 代码使用PCALIGN; 数据符号中按符号的起始位置对齐,
+// 符号本身的对齐由Go的链接器决定
+func (b *Backend) Align(a *parser.AlignBlock) error {
+	if a.Code {
+		if a.HasFill || a.Max >= 0 && a.Max < a.Align-1 {
+			return fmt.Errorf("plan9: Go assembly only supports PCALIGN without a fill byte or a limit")
+		}
+		b.emit("PCALIGN $%d", a.Align)
+		return nil
+	}
+	sym, ok := b.data[b.label]
+	if !ok || b.offset == 0 || b.offset == sym.size {
+		b.emit("// ALIGN %d: the Go linker decides the alignment of data symbols", a.Align)
+		return nil
+	}
+	name := b.dataName(b.label)
+	for n := a.Padding(uint64(b.offset)); n > 0; n-- {
+		if a.Fill != 0 {
+			b.emit("DATA %s+%d(SB)/1, $%d", name, b.offset, a.Fill)
+		}
+		b.offset++
+	}
+	b.global(name, sym)
+	return nil
+}
+
+// dataName 数据符号的名称, 本文件内的符号为 name<>
+func (b *Backend) dataName(name string) string {
+	if b.data[name].local {
+		return Ident(name) + "<>"
+	}
+	return "·" + Ident(name)
+}
+
+// dataItem 输出一次重复的值
+func (b *Backend) dataItem(name string, it *parser.DataItem) error {
+	switch {
+	case it.Expr != nil:
+		sym, off, ok := it.Expr.Offset()
+		if !ok {
+			return fmt.Errorf("plan9: cannot encode data %s", it.Expr)
+		}
+		target := b.target(sym)
+		if target == Ident(sym) {
+			// 函数内的标签没有符号
+			return fmt.Errorf("plan9: cannot take the address of label %s", sym)
+		}
+		b.emit("DATA %s+%d(SB)/%d, $%s", name, b.offset, it.Unit, addOffset(target, off))
+		b.offset += it.Unit
+	case it.Unit == 0:
+		// 字符串每段最多8字节
+		for i := 0; i < len(it.Data); i += 8 {
+			chunk := it.Data[i:min(i+8, len(it.Data))]
+			b.emit("DATA %s+%d(SB)/%d, $%s", name, b.offset, len(chunk), strconv.Quote(string(chunk)))
+			b.offset += len(chunk)
+		}
+	default:
+		width, words := it.Words(binary.LittleEndian)
+		for _, w := range words {
+			if w != 0 {
+				b.emit("DATA %s+%d(SB)/%d, $%d", name, b.offset, width, w)
+			}
+			b.offset += width
+		}
+	}
+	return nil
+}
+
+// addOffset 在 sym(SB) 形式的符号中加上偏移
+func addOffset(target string, off int64) string {
+	if off == 0 {
+		return target
+	}
+	n := len(target) - len("(SB)")
+	return target[:n] + offset(int(off)) + target[n:]
+}
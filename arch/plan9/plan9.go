@@ -0,0 +1,333 @@
+// Package plan9 输出Go工具链使用的Plan 9风格汇编
+//
+// 每个函数生成 TEXT ·name(SB), NOSPLIT, $帧大小-参数大小 头部,
+// 参数通过伪寄存器FP引用, 局部变量通过伪寄存器SP引用,
+// 参数按Go ABI0的规则放在栈上, 并可以生成声明函数签名的Go文件。
+package plan9
+
+import (
+	"CuteASM/arch/arm64"
+	"CuteASM/arch/types"
+	"CuteASM/arch/x86"
+	"CuteASM/parser"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// function 函数的Go ABI0布局
+type function struct {
+	label *parser.LabelBlock
+	args  map[*parser.ArgBlock]int // 参数和结果相对FP的偏移
+	ret   int                      // 结果槽ret相对FP的偏移, 源码自己写结果时为-1
+	size  int                      // 参数和结果的总大小
+}
+
+// Backend Go汇编后端
+type Backend struct {
+	GOARCH string // amd64或arm64
+
+	arch    *types.Architecture
+	funcs   map[string]*function
+	order   []*function
+	labels  map[string]bool // 本文件内定义的标签
+	data    map[string]*dataSym
+	symbols *parser.SymbolTable
+	label   string    // 当前的标签
+	fn      *function // 当前的函数
+	offset  int       // 当前数据符号中已经初始化的字节数
+	lines   []string
+}
+
+// NewBackend 创建Go汇编后端, goarch为amd64或arm64
+func NewBackend(goarch string) *Backend {
+	b := &Backend{GOARCH: goarch, funcs: map[string]*function{}, labels: map[string]bool{}, data: map[string]*dataSym{}}
+	switch goarch {
+	case "arm64":
+		b.arch = arm64.New()
+	default:
+		b.arch = x86.NewMode(64)
+	}
+	return b
+}
+
+// Arch 返回架构描述
+func (b *Backend) Arch() *types.Architecture {
+	return b.arch
+}
+
+// Prepare 收集函数、标签和数据符号, 计算参数的偏移
+func (b *Backend) Prepare(root *parser.Node) {
+	if root.Father == nil {
+		b.symbols = parser.SymbolsOf(root)
+		b.collectData(root, "")
+	}
+	for _, n := range root.Children {
+		if label, ok := n.Value.(*parser.LabelBlock); ok {
+			b.labels[label.Name] = true
+			if label.IsFunc {
+				f := newFunction(label)
+				b.funcs[label.Name] = f
+				b.order = append(b.order, f)
+			}
+		}
+		b.Prepare(n)
+	}
+}
+
+// newFunction 按Go ABI0计算参数布局: 参数像结构体字段一样按自身大小对齐,
+// 结果从参数之后按字长对齐的位置开始。Go汇编源码自己写结果槽(ret+16(FP)),
+// 其它函数的返回值%r0放在结果槽ret中
+func newFunction(label *parser.LabelBlock) *function {
+	f := &function{label: label, args: map[*parser.ArgBlock]int{}, ret: -1}
+	for _, arg := range label.Args {
+		f.size = alignUp(f.size, argAlign(arg.Length))
+		f.args[arg] = f.size
+		f.size += arg.Length
+	}
+	f.size = alignUp(f.size, 8)
+	if len(label.Results) == 0 {
+		f.ret = f.size
+		f.size += 8
+	}
+	for _, res := range label.Results {
+		f.size = alignUp(f.size, argAlign(res.Length))
+		f.args[res] = f.size
+		f.size += res.Length
+	}
+	f.size = alignUp(f.size, 8)
+	return f
+}
+
+func argAlign(length int) int {
+	switch length {
+	case 1, 2, 4, 8:
+		return length
+	}
+	return 8
+}
+
+// Section Go汇编没有段的概念
+func (b *Backend) Section(name string) {}
+
+// Label 定义标签
+func (b *Backend) Label(name string) {
+	b.label, b.offset = name, 0
+	if f, ok := b.funcs[name]; ok {
+		b.fn = f
+	}
+}
+
+// Emit 翻译一条指令
+func (b *Backend) Emit(i *parser.Instruction) error {
+	n := len(b.lines)
+	err := b.translate(i)
+	if err != nil {
+		// 出错时丢弃已经生成的半条指令
+		b.lines = b.lines[:n]
+	}
+	return err
+}
+
+func (b *Backend) translate(i *parser.Instruction) error {
+	if i.Instruction == "RET" {
+		if err := b.result(); err != nil {
+			return err
+		}
+	}
+	if b.GOARCH == "arm64" {
+		return b.arm64(i)
+	}
+	insts, err := x86.Lower(i, b.arch.Registers, 64)
+	if err != nil {
+		return err
+	}
+	for _, in := range insts {
+		if err := b.amd64(in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// result 返回前把%r0写入结果槽
+func (b *Backend) result() error {
+	if b.fn == nil || b.fn.ret < 0 {
+		return nil
+	}
+	r0 := &parser.Reg{Num: 0, Type: types.Reg64}
+	slot := fmt.Sprintf("ret+%d(FP)", b.fn.ret)
+	if b.GOARCH == "arm64" {
+		reg, err := b.arm64Reg(r0)
+		if err != nil {
+			return err
+		}
+		b.emit("MOVD %s, %s", reg, slot)
+		return nil
+	}
+	reg, err := b.amd64Reg(r0)
+	if err != nil {
+		return err
+	}
+	b.emit("MOVQ %s, %s", reg, slot)
+	return nil
+}
+
+// Flush 返回缓存的文本汇编
+func (b *Backend) Flush() []string {
+	lines := b.lines
+	b.lines = nil
+	return lines
+}
+
+// Comment 注释行
+func (b *Backend) Comment(text string) string {
+	return "// " + text
+}
+
+// SectionLine Go汇编没有段, 只保留注释
+func (b *Backend) SectionLine(name string) string {
+	return "// section " + name
+}
+
+// LabelLine 函数输出TEXT头部, 其它标签在函数内部使用
+func (b *Backend) LabelLine(name string) string {
+	if f, ok := b.funcs[name]; ok {
+		return fmt.Sprintf("TEXT ·%s(SB), NOSPLIT, $%d-%d", Ident(name), alignUp(f.label.StackRoom, 8), f.size)
+	}
+	if _, ok := b.data[name]; ok {
+		// 数据符号由DATA和GLOBL定义
+		return ""
+	}
+	return Ident(name) + ":"
+}
+
+// Header 文件开头
+func (b *Backend) Header() []string {
+	return []string{`#include "textflag.h"`, ""}
+}
+
+// Footer 文件末尾
+func (b *Backend) Footer() []string {
+	return nil
+}
+
+func (b *Backend) emit(format string, args ...any) {
+	b.lines = append(b.lines, fmt.Sprintf(format, args...))
+}
+
+// target 跳转和调用的目标
+// 本文件的函数和数据为 ·name(SB), 函数内的标签直接使用名称, 其余为外部符号
+func (b *Backend) target(name string) string {
+	if _, ok := b.data[name]; ok {
+		return b.dataName(name) + "(SB)"
+	}
+	if _, ok := b.funcs[name]; ok {
+		return "·" + Ident(name) + "(SB)"
+	}
+	if b.labels[name] {
+		return Ident(name)
+	}
+	return name + "(SB)"
+}
+
+// symbol 符号化的内存操作数: 参数、局部变量或全局符号, ok为假时需要按寄存器寻址
+func (b *Backend) symbol(addr *parser.MemoryAddr) (string, bool) {
+	disp := int(addr.Displacement)
+	if addr.Arg != nil {
+		for _, f := range b.funcs {
+			if off, ok := f.args[addr.Arg]; ok {
+				return fmt.Sprintf("%s+%d(FP)", Ident(addr.Var), off), true
+			}
+		}
+	}
+	if addr.Var != "" && addr.IndexReg == nil && (addr.BaseReg == nil || addr.BaseReg.Name == "bp") {
+		// 局部变量相对帧指针, 位于伪寄存器SP之下
+		return fmt.Sprintf("%s%s(SP)", Ident(addr.Var), offset(disp)), true
+	}
+	if addr.BaseReg != nil || addr.IndexReg != nil {
+		return "", false
+	}
+	if addr.LabelRef != "" {
+		if _, ok := b.data[addr.LabelRef]; ok {
+			return b.dataName(addr.LabelRef) + offset(disp) + "(SB)", true
+		}
+		if b.labels[addr.LabelRef] {
+			return "·" + Ident(addr.LabelRef) + offset(disp) + "(SB)", true
+		}
+		return addr.LabelRef + offset(disp) + "(SB)", true
+	}
+	return strconv.Itoa(disp), true
+}
+
+// offset 带符号的偏移, 0时为空
+func offset(disp int) string {
+	switch {
+	case disp > 0:
+		return "+" + strconv.Itoa(disp)
+	case disp < 0:
+		return strconv.Itoa(disp)
+	}
+	return ""
+}
+
+// width 操作数宽度(字节), 立即数和标签为0
+func width(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		return types.RegWidth(v.Reg.Type)
+	case parser.ADDR:
+		return v.Addr.Length
+	}
+	return 0
+}
+
+// opWidth 指令的运算宽度, 取第一个有宽度的操作数, 默认为8
+func opWidth(args ...*parser.Value) int {
+	for _, arg := range args {
+		if w := width(arg); w != 0 {
+			return w
+		}
+	}
+	return 8
+}
+
+func need(i *parser.Instruction, n int) error {
+	if len(i.Args) != n {
+		return fmt.Errorf("plan9: %s needs %d operands, got %d", i.Instruction, n, len(i.Args))
+	}
+	return nil
+}
+
+// Ident 把CuteASM的名称转换为Go标识符
+func Ident(name string) string {
+	var sb strings.Builder
+	for n, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			sb.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if n == 0 {
+				sb.WriteRune('_')
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune('_')
+		}
+	}
+	return sb.String()
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
+
+// SymbolLines Go汇编的可见性由符号名决定, 不需要声明
+func (b *Backend) SymbolLines(t *parser.SymbolTable) []string {
+	return nil
+}
+
+// SymbolEnd Go汇编不需要记录函数的大小
+func (b *Backend) SymbolEnd(s *parser.Symbol) []string {
+	return nil
+}
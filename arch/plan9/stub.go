@@ -0,0 +1,45 @@
+package plan9
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Stub 生成声明汇编函数签名的Go文件
+// 参数类型按长度选择整数类型, 其它长度使用字节数组
+// Go汇编源码按引用的结果槽声明结果, 其它函数的结果ret是返回值%r0
+func (b *Backend) Stub(pkg string) string {
+	var sb strings.Builder
+	sb.WriteString("// Code generated by CuteASM. DO NOT EDIT.\n\n")
+	sb.WriteString("package " + pkg + "\n")
+	for _, f := range b.order {
+		params := make([]string, len(f.label.Args))
+		for n, arg := range f.label.Args {
+			params[n] = Ident(arg.Name) + " " + goType(arg.Length)
+		}
+		results := []string{"ret int64"}
+		if f.ret < 0 {
+			results = results[:0]
+			for _, res := range f.label.Results {
+				results = append(results, Ident(res.Name)+" "+goType(res.Length))
+			}
+		}
+		sb.WriteString("\n//go:noescape\n")
+		fmt.Fprintf(&sb, "func %s(%s) (%s)\n", Ident(f.label.Name), strings.Join(params, ", "), strings.Join(results, ", "))
+	}
+	return sb.String()
+}
+
+func goType(length int) string {
+	switch length {
+	case 1:
+		return "int8"
+	case 2:
+		return "int16"
+	case 4:
+		return "int32"
+	case 8:
+		return "int64"
+	}
+	return fmt.Sprintf("[%d]byte", length)
+}
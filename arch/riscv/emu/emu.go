@@ -0,0 +1,429 @@
+// Package emu 纯Go实现的RV64用户态模拟器
+//
+// 模拟器解码并执行RISC-V后端使用的RV64IM指令, 用来在没有目标机器时检查后端的输出:
+// 用后端汇编一段代码, 放在地址0执行, 再检查寄存器和内存。
+// 解码按指令集手册进行, 不使用后端的编码表, 编码错误会表现为结果不一致。
+//
+// 机器模型:
+//   - 32个64位通用寄存器和PC, x0恒为0。
+//   - 平坦的小端序内存从地址0开始, 共Config.MemSize字节, 越界访问是错误。
+//     栈从内存顶端向下增长。
+//   - EBREAK停止执行, 不支持系统调用、压缩指令、浮点和特权指令。
+package emu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// StopAddr Call设置的返回地址, 返回到这里时停止执行
+const StopAddr = 0x7ffff000
+
+const (
+	regRA = 1
+	regSP = 2
+)
+
+// Config 模拟器的设置, 为0的项使用默认值
+type Config struct {
+	MemSize  int // 内存的字节数, 默认1M
+	MaxSteps int // 最多执行的指令数, 默认100万, 用于发现死循环
+}
+
+// CPU 模拟器的状态
+type CPU struct {
+	Regs [32]uint64
+	PC   uint64
+	Mem  []byte
+
+	Steps  int  // 已经执行的指令数
+	Halted bool // 因EBREAK停止
+
+	cfg  Config
+	next uint64 // 下一条指令的地址
+}
+
+// Fault 执行时的错误
+type Fault struct {
+	PC   uint64 // 出错指令的地址
+	Word uint32 // 出错的指令
+	Err  string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("emu: %#x [%08x]: %s", f.PC, f.Word, f.Err)
+}
+
+// fault 执行中的错误, 由Step恢复为*Fault
+type fault string
+
+// New 创建模拟器, 栈指针指向内存顶端
+func New(cfg Config) *CPU {
+	if cfg.MemSize == 0 {
+		cfg.MemSize = 1 << 20
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = 1000000
+	}
+	c := &CPU{Mem: make([]byte, cfg.MemSize), cfg: cfg}
+	c.Regs[regSP] = uint64(len(c.Mem)) &^ 15
+	return c
+}
+
+// Load 把code复制到addr
+func (c *CPU) Load(addr uint64, code []byte) error {
+	if addr > uint64(len(c.Mem)) || uint64(len(code)) > uint64(len(c.Mem))-addr {
+		return fmt.Errorf("emu: %d bytes at %#x do not fit in memory", len(code), addr)
+	}
+	copy(c.Mem[addr:], code)
+	return nil
+}
+
+// Call 把ra设为StopAddr并从addr执行, 直到返回或EBREAK
+func (c *CPU) Call(addr uint64) error {
+	c.Regs[regRA] = StopAddr
+	c.PC = addr
+	return c.Run()
+}
+
+// Run 从PC执行到EBREAK或返回到StopAddr
+func (c *CPU) Run() error {
+	for !c.Halted && c.PC != StopAddr {
+		if c.Steps >= c.cfg.MaxSteps {
+			return &Fault{PC: c.PC, Err: fmt.Sprintf("step limit %d exceeded", c.cfg.MaxSteps)}
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 执行一条指令
+func (c *CPU) Step() (err error) {
+	var w uint32
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(fault)
+			if !ok {
+				panic(r)
+			}
+			err = &Fault{PC: c.PC, Word: w, Err: string(f)}
+		}
+	}()
+	w = uint32(c.read(c.PC, 4))
+	c.Steps++
+	c.next = c.PC + 4
+	c.exec(w)
+	c.Regs[0] = 0
+	if !c.Halted {
+		c.PC = c.next
+	}
+	return nil
+}
+
+// Read 读取内存中size字节的无符号数
+func (c *CPU) Read(addr uint64, size int) (v uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("emu: %s", r)
+		}
+	}()
+	return c.read(addr, size), nil
+}
+
+// Dump 输出寄存器
+func (c *CPU) Dump() string {
+	s := ""
+	for n, v := range c.Regs {
+		s += fmt.Sprintf("x%-2d = %#x\n", n, v)
+	}
+	return s + fmt.Sprintf("pc  = %#x\n", c.PC)
+}
+
+func (c *CPU) read(addr uint64, size int) uint64 {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b))
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (c *CPU) write(addr uint64, size int, v uint64) {
+	c.check(addr, size)
+	b := c.Mem[addr : addr+uint64(size)]
+	switch size {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, v)
+	}
+}
+
+func (c *CPU) check(addr uint64, size int) {
+	if addr > uint64(len(c.Mem)) || uint64(size) > uint64(len(c.Mem))-addr {
+		panic(fault(fmt.Sprintf("%d-byte access at %#x is outside memory", size, addr)))
+	}
+}
+
+// sext 把低n位符号扩展
+func sext(v uint64, n uint) uint64 {
+	return uint64(int64(v<<(64-n)) >> (64 - n))
+}
+
+func (c *CPU) exec(w uint32) {
+	rd, f3, rs1, rs2, f7 := w>>7&31, w>>12&7, w>>15&31, w>>20&31, w>>25
+	a, b := c.Regs[rs1], c.Regs[rs2]
+	immI := sext(uint64(w>>20), 12)
+	set := func(v uint64) { c.Regs[rd] = v }
+	switch w & 0x7f {
+	case 0x33: // OP
+		set(c.op(f3, f7, a, b))
+	case 0x3b: // OP-32
+		set(sext(c.op32(f3, f7, a, b), 32))
+	case 0x13: // OP-IMM
+		sh := uint(w >> 20 & 0x3f)
+		switch f3 {
+		case 0: // addi
+			set(a + immI)
+		case 1: // slli
+			set(a << sh)
+		case 2: // slti
+			set(b2u(int64(a) < int64(immI)))
+		case 3: // sltiu
+			set(b2u(a < immI))
+		case 4: // xori
+			set(a ^ immI)
+		case 5: // srli, srai
+			if w>>30&1 != 0 {
+				set(uint64(int64(a) >> sh))
+			} else {
+				set(a >> sh)
+			}
+		case 6: // ori
+			set(a | immI)
+		case 7: // andi
+			set(a & immI)
+		}
+	case 0x1b: // OP-IMM-32
+		sh := uint(w >> 20 & 0x1f)
+		switch f3 {
+		case 0: // addiw
+			set(sext(a+immI, 32))
+		case 1: // slliw
+			set(sext(a<<sh, 32))
+		case 5: // srliw, sraiw
+			if w>>30&1 != 0 {
+				set(uint64(int64(int32(a) >> sh)))
+			} else {
+				set(sext(uint64(uint32(a)>>sh), 32))
+			}
+		default:
+			panic(fault("illegal instruction"))
+		}
+	case 0x37: // lui
+		set(sext(uint64(w&0xfffff000), 32))
+	case 0x17: // auipc
+		set(c.PC + sext(uint64(w&0xfffff000), 32))
+	case 0x03: // 读内存
+		addr := a + immI
+		switch f3 {
+		case 0: // lb
+			set(sext(c.read(addr, 1), 8))
+		case 1: // lh
+			set(sext(c.read(addr, 2), 16))
+		case 2: // lw
+			set(sext(c.read(addr, 4), 32))
+		case 3: // ld
+			set(c.read(addr, 8))
+		case 4: // lbu
+			set(c.read(addr, 1))
+		case 5: // lhu
+			set(c.read(addr, 2))
+		case 6: // lwu
+			set(c.read(addr, 4))
+		default:
+			panic(fault("illegal instruction"))
+		}
+	case 0x23: // 写内存
+		if f3 > 3 {
+			panic(fault("illegal instruction"))
+		}
+		imm := sext(uint64(w>>25<<5|w>>7&31), 12)
+		c.write(a+imm, 1<<f3, b)
+	case 0x63: // 条件分支
+		imm := sext(uint64(w>>31<<12|w>>7&1<<11|w>>25&0x3f<<5|w>>8&0xf<<1), 13)
+		taken := false
+		switch f3 {
+		case 0: // beq
+			taken = a == b
+		case 1: // bne
+			taken = a != b
+		case 4: // blt
+			taken = int64(a) < int64(b)
+		case 5: // bge
+			taken = int64(a) >= int64(b)
+		case 6: // bltu
+			taken = a < b
+		case 7: // bgeu
+			taken = a >= b
+		default:
+			panic(fault("illegal instruction"))
+		}
+		if taken {
+			c.next = c.PC + imm
+		}
+	case 0x6f: // jal
+		imm := sext(uint64(w>>31<<20|w>>12&0xff<<12|w>>20&1<<11|w>>21&0x3ff<<1), 21)
+		set(c.PC + 4)
+		c.next = c.PC + imm
+	case 0x67: // jalr
+		set(c.PC + 4)
+		c.next = (a + immI) &^ 1
+	case 0x73:
+		if w != 0x00100073 {
+			panic(fault("unsupported system instruction"))
+		}
+		c.Halted = true // ebreak
+	default:
+		panic(fault("illegal instruction"))
+	}
+}
+
+// op 64位寄存器运算和M扩展
+func (c *CPU) op(f3, f7 uint32, a, b uint64) uint64 {
+	switch f7 {
+	case 0x00:
+		switch f3 {
+		case 0: // add
+			return a + b
+		case 1: // sll
+			return a << (b & 63)
+		case 2: // slt
+			return b2u(int64(a) < int64(b))
+		case 3: // sltu
+			return b2u(a < b)
+		case 4: // xor
+			return a ^ b
+		case 5: // srl
+			return a >> (b & 63)
+		case 6: // or
+			return a | b
+		case 7: // and
+			return a & b
+		}
+	case 0x20:
+		switch f3 {
+		case 0: // sub
+			return a - b
+		case 5: // sra
+			return uint64(int64(a) >> (b & 63))
+		}
+	case 0x01:
+		switch f3 {
+		case 0: // mul
+			return a * b
+		case 1: // mulh
+			hi, _ := bits.Mul64(a, b)
+			if int64(a) < 0 {
+				hi -= b
+			}
+			if int64(b) < 0 {
+				hi -= a
+			}
+			return hi
+		case 3: // mulhu
+			hi, _ := bits.Mul64(a, b)
+			return hi
+		case 4: // div
+			return uint64(div(int64(a), int64(b)))
+		case 5: // divu
+			if b == 0 {
+				return ^uint64(0)
+			}
+			return a / b
+		case 6: // rem
+			return uint64(rem(int64(a), int64(b)))
+		case 7: // remu
+			if b == 0 {
+				return a
+			}
+			return a % b
+		}
+	}
+	panic(fault("illegal instruction"))
+}
+
+// op32 32位寄存器运算, 结果由调用者符号扩展
+func (c *CPU) op32(f3, f7 uint32, a, b uint64) uint64 {
+	x, y := int32(a), int32(b)
+	switch {
+	case f7 == 0x00 && f3 == 0: // addw
+		return uint64(x + y)
+	case f7 == 0x20 && f3 == 0: // subw
+		return uint64(x - y)
+	case f7 == 0x00 && f3 == 1: // sllw
+		return uint64(uint32(x) << (b & 31))
+	case f7 == 0x00 && f3 == 5: // srlw
+		return uint64(uint32(x) >> (b & 31))
+	case f7 == 0x20 && f3 == 5: // sraw
+		return uint64(x >> (b & 31))
+	case f7 == 0x01 && f3 == 0: // mulw
+		return uint64(x * y)
+	case f7 == 0x01 && f3 == 4: // divw
+		return uint64(div(int64(x), int64(y)))
+	case f7 == 0x01 && f3 == 5: // divuw
+		if uint32(y) == 0 {
+			return ^uint64(0)
+		}
+		return uint64(uint32(x) / uint32(y))
+	case f7 == 0x01 && f3 == 6: // remw
+		return uint64(rem(int64(x), int64(y)))
+	case f7 == 0x01 && f3 == 7: // remuw
+		if uint32(y) == 0 {
+			return uint64(uint32(x))
+		}
+		return uint64(uint32(x) % uint32(y))
+	}
+	panic(fault("illegal instruction"))
+}
+
+// div 除数为0时结果为-1, 溢出时为被除数
+func div(a, b int64) int64 {
+	switch {
+	case b == 0:
+		return -1
+	case b == -1:
+		return -a
+	}
+	return a / b
+}
+
+// rem 除数为0时结果为被除数, 溢出时为0
+func rem(a, b int64) int64 {
+	switch {
+	case b == 0:
+		return a
+	case b == -1:
+		return 0
+	}
+	return a % b
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,190 @@
+package riscv
+
+import (
+	"CuteASM/arch"
+	"fmt"
+	"strconv"
+)
+
+// 重定位类型
+const (
+	relNone   = iota
+	relPCHi20 // %pcrel_hi(sym), 配合auipc
+	relPCLo12 // %pcrel_lo(1b), 相对前一条auipc的低12位
+	relHi20   // %hi(sym), 配合lui的绝对地址高20位
+	relLo12   // %lo(sym), 绝对地址的低12位
+	relBranch // 13位PC相对分支
+	relJal    // 21位PC相对跳转
+	relAbs32  // 数据中的32位绝对地址
+	relAbs64  // 数据中的64位绝对地址
+)
+
+// auipc所在的局部标签, %pcrel_lo通过它找到对应的auipc
+const relLoLabel = "1"
+
+// Inst 一条RISC-V机器指令
+type Inst struct {
+	Op    string
+	Rd    int
+	Rs1   int
+	Rs2   int
+	Imm   int64
+	Sym   string // 引用的符号(标签), 配合Reloc使用
+	Reloc int
+}
+
+// 符号加偏移的文本形式
+func symText(sym string, addend int64) string {
+	if addend == 0 {
+		return sym
+	}
+	if addend > 0 {
+		return sym + "+" + strconv.FormatInt(addend, 10)
+	}
+	return sym + strconv.FormatInt(addend, 10)
+}
+
+// 立即数部分的文本形式
+func (in *Inst) immText() string {
+	switch in.Reloc {
+	case relPCHi20:
+		return "%pcrel_hi(" + symText(in.Sym, in.Imm) + ")"
+	case relPCLo12:
+		return "%pcrel_lo(" + relLoLabel + "b)"
+	case relHi20:
+		return "%hi(" + symText(in.Sym, in.Imm) + ")"
+	case relLo12:
+		return "%lo(" + symText(in.Sym, in.Imm) + ")"
+	case relBranch, relJal:
+		return symText(in.Sym, in.Imm)
+	}
+	return strconv.FormatInt(in.Imm, 10)
+}
+
+// Text 把指令格式化为GNU as语法
+func (in *Inst) Text() string {
+	info := instructions[in.Op]
+	rd, rs1, rs2 := regNames[in.Rd], regNames[in.Rs1], regNames[in.Rs2]
+	switch info.Format {
+	case fmtR:
+		return in.Op + " " + rd + ", " + rs1 + ", " + rs2
+	case fmtI, fmtShift, fmtShiftW:
+		if in.Op == "addi" && in.Imm == 0 && in.Reloc == relNone {
+			return "mv " + rd + ", " + rs1
+		}
+		return in.Op + " " + rd + ", " + rs1 + ", " + in.immText()
+	case fmtLoad:
+		return in.Op + " " + rd + ", " + in.immText() + "(" + rs1 + ")"
+	case fmtS:
+		return in.Op + " " + rs2 + ", " + in.immText() + "(" + rs1 + ")"
+	case fmtB:
+		return in.Op + " " + rs1 + ", " + rs2 + ", " + in.immText()
+	case fmtU:
+		if in.Reloc == relPCHi20 {
+			// 后面的%pcrel_lo通过局部标签引用这条指令
+			return relLoLabel + ": " + in.Op + " " + rd + ", " + in.immText()
+		}
+		if in.Reloc == relHi20 {
+			return in.Op + " " + rd + ", " + in.immText()
+		}
+		// 汇编器要求写成无符号的20位数
+		return in.Op + " " + rd + ", " + strconv.FormatInt(in.Imm&0xfffff, 10)
+	case fmtJ:
+		if in.Rd == regZero {
+			return "j " + in.immText()
+		}
+		return in.Op + " " + rd + ", " + in.immText()
+	case fmtJALR:
+		if in.Rd == regZero && in.Rs1 == regRA && in.Imm == 0 && in.Reloc == relNone {
+			return "ret"
+		}
+		return in.Op + " " + rd + ", " + in.immText() + "(" + rs1 + ")"
+	}
+	return in.Op
+}
+
+// 检查有符号立即数的范围
+func checkSigned(in *Inst, imm int64, bits uint) error {
+	if imm < -1<<(bits-1) || imm >= 1<<(bits-1) {
+		if in.Sym != "" {
+			return fmt.Errorf("riscv: %s to %s out of range", in.Op, in.Sym)
+		}
+		return fmt.Errorf("riscv: immediate %d of %s out of range", imm, in.Op)
+	}
+	return nil
+}
+
+// Encode 编码一条指令
+// pc为指令地址, syms为已知符号的地址, 无法解析的符号引用通过reloc返回
+func (in *Inst) Encode(pc uint64, syms map[string]uint64) (code uint32, reloc *arch.Reloc, err error) {
+	info, ok := instructions[in.Op]
+	if !ok {
+		return 0, nil, fmt.Errorf("riscv: unknown instruction %s", in.Op)
+	}
+	imm := in.Imm
+	if in.Reloc != relNone {
+		addr, ok := syms[in.Sym]
+		if !ok {
+			// 外部符号, 留给链接器处理
+			reloc = &arch.Reloc{Sym: in.Sym, Type: in.Reloc, Addend: in.Imm}
+			imm = 0
+		} else {
+			target := int64(addr) + in.Imm
+			switch in.Reloc {
+			case relPCHi20:
+				imm = (target - int64(pc) + 0x800) >> 12
+			case relPCLo12:
+				// 紧跟在auipc之后
+				imm = sext(target-int64(pc)+4, 12)
+			case relHi20:
+				imm = (target + 0x800) >> 12
+			case relLo12:
+				imm = sext(target, 12)
+			case relBranch, relJal:
+				imm = target - int64(pc)
+			}
+		}
+	}
+	rd, rs1, rs2 := uint32(in.Rd)&0x1f, uint32(in.Rs1)&0x1f, uint32(in.Rs2)&0x1f
+	u := uint32(imm)
+	switch info.Format {
+	case fmtR:
+		code = info.Code | rs2<<20 | rs1<<15 | rd<<7
+	case fmtI, fmtLoad, fmtJALR:
+		if in.Reloc == relNone {
+			if err := checkSigned(in, imm, 12); err != nil {
+				return 0, nil, err
+			}
+		}
+		code = info.Code | (u&0xfff)<<20 | rs1<<15 | rd<<7
+	case fmtShift:
+		code = info.Code | (u&0x3f)<<20 | rs1<<15 | rd<<7
+	case fmtShiftW:
+		code = info.Code | (u&0x1f)<<20 | rs1<<15 | rd<<7
+	case fmtS:
+		if in.Reloc == relNone {
+			if err := checkSigned(in, imm, 12); err != nil {
+				return 0, nil, err
+			}
+		}
+		code = info.Code | (u>>5&0x7f)<<25 | rs2<<20 | rs1<<15 | (u&0x1f)<<7
+	case fmtB:
+		if err := checkSigned(in, imm, 13); err != nil {
+			return 0, nil, err
+		}
+		code = info.Code | (u>>12&1)<<31 | (u>>5&0x3f)<<25 | rs2<<20 | rs1<<15 | (u>>1&0xf)<<8 | (u>>11&1)<<7
+	case fmtU:
+		if err := checkSigned(in, imm, 20); err != nil {
+			return 0, nil, err
+		}
+		code = info.Code | (u&0xfffff)<<12 | rd<<7
+	case fmtJ:
+		if err := checkSigned(in, imm, 21); err != nil {
+			return 0, nil, err
+		}
+		code = info.Code | (u>>20&1)<<31 | (u>>1&0x3ff)<<21 | (u>>11&1)<<20 | (u>>12&0xff)<<12 | rd<<7
+	case fmtSys:
+		code = info.Code
+	}
+	return code, reloc, nil
+}
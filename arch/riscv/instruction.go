@@ -0,0 +1,102 @@
+package riscv
+
+// 指令格式
+const (
+	fmtR      = iota // op rd, rs1, rs2
+	fmtI             // op rd, rs1, imm12
+	fmtShift         // op rd, rs1, shamt6
+	fmtShiftW        // op rd, rs1, shamt5
+	fmtLoad          // op rd, imm12(rs1)
+	fmtS             // op rs2, imm12(rs1)
+	fmtB             // op rs1, rs2, offs13
+	fmtU             // op rd, imm20
+	fmtJ             // op rd, offs21
+	fmtJALR          // jalr rd, imm12(rs1)
+	fmtSys           // op
+)
+
+type opInfo struct {
+	Format int
+	Code   uint32 // 操作数字段为0时的指令编码
+}
+
+var instructions = map[string]opInfo{
+	// 整数运算(RV64I)
+	"add":  {fmtR, 0x00000033},
+	"sub":  {fmtR, 0x40000033},
+	"sll":  {fmtR, 0x00001033},
+	"slt":  {fmtR, 0x00002033},
+	"sltu": {fmtR, 0x00003033},
+	"xor":  {fmtR, 0x00004033},
+	"srl":  {fmtR, 0x00005033},
+	"sra":  {fmtR, 0x40005033},
+	"or":   {fmtR, 0x00006033},
+	"and":  {fmtR, 0x00007033},
+	"addw": {fmtR, 0x0000003b},
+	"subw": {fmtR, 0x4000003b},
+	"sllw": {fmtR, 0x0000103b},
+	"srlw": {fmtR, 0x0000503b},
+	"sraw": {fmtR, 0x4000503b},
+
+	// 乘除法(M扩展)
+	"mul":   {fmtR, 0x02000033},
+	"mulh":  {fmtR, 0x02001033},
+	"mulhu": {fmtR, 0x02003033},
+	"div":   {fmtR, 0x02004033},
+	"divu":  {fmtR, 0x02005033},
+	"rem":   {fmtR, 0x02006033},
+	"remu":  {fmtR, 0x02007033},
+	"mulw":  {fmtR, 0x0200003b},
+	"divw":  {fmtR, 0x0200403b},
+	"divuw": {fmtR, 0x0200503b},
+	"remw":  {fmtR, 0x0200603b},
+	"remuw": {fmtR, 0x0200703b},
+
+	// 12位立即数
+	"addi":  {fmtI, 0x00000013},
+	"slti":  {fmtI, 0x00002013},
+	"sltiu": {fmtI, 0x00003013},
+	"xori":  {fmtI, 0x00004013},
+	"ori":   {fmtI, 0x00006013},
+	"andi":  {fmtI, 0x00007013},
+	"addiw": {fmtI, 0x0000001b},
+
+	// 立即数移位
+	"slli":  {fmtShift, 0x00001013},
+	"srli":  {fmtShift, 0x00005013},
+	"srai":  {fmtShift, 0x40005013},
+	"slliw": {fmtShiftW, 0x0000101b},
+	"srliw": {fmtShiftW, 0x0000501b},
+	"sraiw": {fmtShiftW, 0x4000501b},
+
+	// 20位立即数
+	"lui":   {fmtU, 0x00000037},
+	"auipc": {fmtU, 0x00000017},
+
+	// 访存
+	"lb":  {fmtLoad, 0x00000003},
+	"lh":  {fmtLoad, 0x00001003},
+	"lw":  {fmtLoad, 0x00002003},
+	"ld":  {fmtLoad, 0x00003003},
+	"lbu": {fmtLoad, 0x00004003},
+	"lhu": {fmtLoad, 0x00005003},
+	"lwu": {fmtLoad, 0x00006003},
+	"sb":  {fmtS, 0x00000023},
+	"sh":  {fmtS, 0x00001023},
+	"sw":  {fmtS, 0x00002023},
+	"sd":  {fmtS, 0x00003023},
+
+	// 跳转
+	"beq":  {fmtB, 0x00000063},
+	"bne":  {fmtB, 0x00001063},
+	"blt":  {fmtB, 0x00004063},
+	"bge":  {fmtB, 0x00005063},
+	"bltu": {fmtB, 0x00006063},
+	"bgeu": {fmtB, 0x00007063},
+	"jal":  {fmtJ, 0x0000006f},
+	"jalr": {fmtJALR, 0x00000067},
+
+	// 系统
+	"ecall":  {fmtSys, 0x00000073},
+	"ebreak": {fmtSys, 0x00100073},
+}
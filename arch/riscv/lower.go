@@ -0,0 +1,629 @@
+package riscv
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Emit 把一条CuteASM指令翻译为RISC-V指令
+func (b *Backend) Emit(i *parser.Instruction) error {
+	if _, jcc := types.BranchCond(i.Instruction); !jcc && i.Instruction != "CMP" {
+		b.settle()
+	}
+	// 出错时丢弃已经生成的半条指令
+	n := len(b.buf)
+	err := b.lower(i)
+	if err != nil {
+		b.buf = b.buf[:n]
+	}
+	return err
+}
+
+func (b *Backend) lower(i *parser.Instruction) error {
+	switch i.Instruction {
+	case "MOV", "LOAD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[0], i.Args[1])
+	case "STORE":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.mov(i.Args[1], i.Args[0])
+	case "ADD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("add", i.Args[0]), op("addi", i.Args[0]))
+	case "SUB":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		if i.Args[1].Type == parser.NUMBER {
+			// 减立即数等于加它的相反数
+			neg := *i.Args[1]
+			neg.Num = -neg.Num
+			return b.alu(i.Args[0], &neg, op("add", i.Args[0]), op("addi", i.Args[0]))
+		}
+		return b.alu(i.Args[0], i.Args[1], op("sub", i.Args[0]), "")
+	case "AND":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "and", "andi")
+	case "OR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "or", "ori")
+	case "XOR":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], "xor", "xori")
+	case "MUL":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("mul", i.Args[0]), "")
+	case "DIV":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.alu(i.Args[0], i.Args[1], op("divu", i.Args[0]), "")
+	case "NEG":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		name := op("sub", i.Args[0])
+		return b.modify(i.Args[0], func(rd int) error {
+			b.emitR(name, rd, regZero, rd)
+			return nil
+		})
+	case "NOT":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.modify(i.Args[0], func(rd int) error {
+			b.emitI("xori", rd, rd, -1)
+			return nil
+		})
+	case "SHIFTL":
+		return b.shift(i, "sll")
+	case "SHIFTR":
+		return b.shift(i, "srl")
+	case "XCHG":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return b.xchg(i.Args[0], i.Args[1])
+	case "CMP":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		for _, arg := range i.Args {
+			if arg.Type == parser.REG {
+				if _, err := b.reg(arg.Reg); err != nil {
+					return err
+				}
+			}
+		}
+		b.cmp = &cmpState{a: i.Args[0], b: i.Args[1], unsigned: b.cmps[i]}
+		if !isSimple(i.Args[0]) || !isSimple(i.Args[1]) {
+			// 内存操作数可能在跳转前被修改, 立即求值
+			if err := b.settleErr(); err != nil {
+				b.cmp = nil // 丢弃无法求值的比较
+				return err
+			}
+		}
+		return nil
+	case "JMP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], false)
+	case "CALL":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.jump(i.Args[0], true)
+	case "RET":
+		b.emitI("jalr", regZero, regRA, 0)
+		return nil
+	case "PUSH":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.push(i.Args[0])
+	case "POP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return b.pop(i.Args[0])
+	case "HALT":
+		b.emit(&Inst{Op: "ebreak"})
+		return nil
+	}
+	if cond, ok := types.BranchCond(i.Instruction); ok {
+		return b.jcc(i, cond)
+	}
+	return fmt.Errorf("riscv: unsupported instruction %s", i.Instruction)
+}
+
+func need(i *parser.Instruction, n int) error {
+	if len(i.Args) != n {
+		return fmt.Errorf("riscv: %s needs %d operands, got %d", i.Instruction, n, len(i.Args))
+	}
+	return nil
+}
+
+// isSimple 寄存器和立即数可以推迟到跳转时再比较
+func isSimple(v *parser.Value) bool {
+	return v.Type == parser.REG || v.Type == parser.NUMBER
+}
+
+// fits12 立即数能否放进12位有符号立即数字段
+func fits12(imm int64) bool {
+	return imm >= -0x800 && imm <= 0x7ff
+}
+
+// 把低bits位按有符号数扩展
+func sext(v int64, bits uint) int64 {
+	return v << (64 - bits) >> (64 - bits)
+}
+
+// li 把立即数装入寄存器
+// 32位以内用lui+addiw, 更大的数先装入高位再逐段左移
+func (b *Backend) li(rd int, imm int64) {
+	if fits12(imm) {
+		b.emitI("addi", rd, regZero, imm)
+		return
+	}
+	lo := sext(imm, 12)
+	if imm >= math.MinInt32 && imm <= math.MaxInt32 {
+		b.emitI("lui", rd, 0, sext((imm-lo)>>12, 20))
+		if lo != 0 {
+			b.emitI("addiw", rd, rd, lo)
+		}
+		return
+	}
+	hi, shift := (imm-lo)>>12, int64(12)
+	for hi&1 == 0 {
+		hi >>= 1
+		shift++
+	}
+	b.li(rd, hi)
+	b.emitI("slli", rd, rd, shift)
+	if lo != 0 {
+		b.emitI("addi", rd, rd, lo)
+	}
+}
+
+// la 把符号地址装入寄存器
+func (b *Backend) la(rd int, sym string, addend int64) {
+	b.emit(&Inst{Op: "auipc", Rd: rd, Sym: sym, Imm: addend, Reloc: relPCHi20})
+	b.emit(&Inst{Op: "addi", Rd: rd, Rs1: rd, Sym: sym, Imm: addend, Reloc: relPCLo12})
+}
+
+// lc 装入依赖标签地址的常量, 值在Assemble时才能确定, 按绝对值的%hi/%lo装入
+func (b *Backend) lc(rd int, sym string) {
+	b.emit(&Inst{Op: "lui", Rd: rd, Sym: sym, Reloc: relHi20})
+	b.emit(&Inst{Op: "addi", Rd: rd, Rs1: rd, Sym: sym, Reloc: relLo12})
+}
+
+// use 取得操作数所在的寄存器
+// 寄存器操作数直接返回, 其它操作数装入tmp
+func (b *Backend) use(v *parser.Value, tmp int) (int, error) {
+	switch v.Type {
+	case parser.REG:
+		return b.reg(v.Reg)
+	case parser.NUMBER:
+		if v.Num == 0 {
+			return regZero, nil
+		}
+		b.li(tmp, v.Num)
+		return tmp, nil
+	case parser.ADDR:
+		return tmp, b.load(tmp, v.Addr)
+	case parser.LABEL:
+		b.la(tmp, v.String, 0)
+		return tmp, nil
+	case parser.EXPR:
+		if sym, off, ok := v.Expr.Offset(); ok {
+			b.la(tmp, sym, off)
+			return tmp, nil
+		}
+		if v.Expr.Op == "" && v.Expr.Equ {
+			b.lc(tmp, v.Expr.Sym)
+			return tmp, nil
+		}
+	}
+	return 0, fmt.Errorf("riscv: unsupported operand")
+}
+
+// mem 计算内存操作数的基址和偏移, 需要时借助t5
+// 返回的指令模板中Rs1、Imm、Sym和Reloc已经设置好
+// 只引用标签时用auipc和访存指令的%pcrel_lo, 两条指令必须相邻; 没有基址寄存器时是绝对地址
+func (b *Backend) mem(a *parser.MemoryAddr) (*Inst, error) {
+	in := &Inst{Rs1: regZero, Imm: a.Displacement}
+	if a.LabelRef != "" && a.BaseReg == nil && a.IndexReg == nil {
+		b.emit(&Inst{Op: "auipc", Rd: regT5, Sym: a.LabelRef, Imm: in.Imm, Reloc: relPCHi20})
+		in.Rs1, in.Sym, in.Reloc = regT5, a.LabelRef, relPCLo12
+		return in, nil
+	}
+	if a.BaseReg != nil {
+		base, err := b.reg(a.BaseReg)
+		if err != nil {
+			return nil, err
+		}
+		in.Rs1 = base
+	}
+	if a.LabelRef != "" {
+		b.la(regT5, a.LabelRef, in.Imm)
+		if a.BaseReg != nil {
+			b.emitR("add", regT5, regT5, in.Rs1)
+		}
+		in.Rs1, in.Imm = regT5, 0
+	}
+	if a.IndexReg != nil {
+		index, err := b.reg(a.IndexReg)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case a.Scale == 0 || a.Scale == 1:
+			b.emitR("add", regT5, index, in.Rs1)
+		case a.Scale != 2 && a.Scale != 4 && a.Scale != 8:
+			return nil, fmt.Errorf("riscv: invalid scale %d", a.Scale)
+		case in.Rs1 != regT5:
+			shift := map[int]int64{2: 1, 4: 2, 8: 3}[a.Scale]
+			b.emitI("slli", regT5, index, shift)
+			b.emitR("add", regT5, regT5, in.Rs1)
+		default:
+			// t5中已经是标签的地址, t6可能保存着操作数的值, 只能逐次累加
+			for n := 0; n < a.Scale; n++ {
+				b.emitR("add", regT5, regT5, index)
+			}
+		}
+		in.Rs1 = regT5
+	}
+	if !fits12(in.Imm) {
+		if in.Rs1 == regT5 {
+			return nil, fmt.Errorf("riscv: displacement %d out of range", in.Imm)
+		}
+		b.li(regT5, in.Imm)
+		if in.Rs1 != regZero {
+			b.emitR("add", regT5, regT5, in.Rs1)
+		}
+		in.Rs1 = regT5
+		in.Imm = 0
+	}
+	return in, nil
+}
+
+// memOp 根据访问宽度选择读写指令
+func memOp(a *parser.MemoryAddr, store bool) (string, error) {
+	length := a.Length
+	if length == 0 {
+		length = 8
+	}
+	suffix := map[int]string{1: "b", 2: "h", 4: "w", 8: "d"}[length]
+	if suffix == "" {
+		return "", fmt.Errorf("riscv: %d-byte memory operand is not supported", length)
+	}
+	if store {
+		return "s" + suffix, nil
+	}
+	if a.Sign == parser.UNSIGNED && length < 8 {
+		// 无符号变量零扩展
+		return "l" + suffix + "u", nil
+	}
+	return "l" + suffix, nil
+}
+
+// load 从内存读取到寄存器
+func (b *Backend) load(rd int, a *parser.MemoryAddr) error {
+	name, err := memOp(a, false)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rd = name, rd
+	b.emit(in)
+	return nil
+}
+
+// store 把寄存器写入内存
+func (b *Backend) store(rs int, a *parser.MemoryAddr) error {
+	name, err := memOp(a, true)
+	if err != nil {
+		return err
+	}
+	in, err := b.mem(a)
+	if err != nil {
+		return err
+	}
+	in.Op, in.Rs2 = name, rs
+	b.emit(in)
+	return nil
+}
+
+// mov dst = src
+func (b *Backend) mov(dst, src *parser.Value) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		rs, err := b.use(src, rd)
+		if err != nil {
+			return err
+		}
+		b.move(rd, rs)
+		return nil
+	case parser.ADDR:
+		rs, err := b.use(src, regT6)
+		if err != nil {
+			return err
+		}
+		return b.store(rs, dst.Addr)
+	}
+	return fmt.Errorf("riscv: invalid destination operand")
+}
+
+// modify 读出目标操作数, 交给f修改后写回
+func (b *Backend) modify(dst *parser.Value, f func(rd int) error) error {
+	switch dst.Type {
+	case parser.REG:
+		rd, err := b.reg(dst.Reg)
+		if err != nil {
+			return err
+		}
+		return f(rd)
+	case parser.ADDR:
+		if err := b.load(regT6, dst.Addr); err != nil {
+			return err
+		}
+		if err := f(regT6); err != nil {
+			return err
+		}
+		return b.store(regT6, dst.Addr)
+	}
+	return fmt.Errorf("riscv: invalid destination operand")
+}
+
+// alu 双操作数运算 dst = dst op src, iop为对应的立即数指令
+func (b *Backend) alu(dst, src *parser.Value, rop, iop string) error {
+	return b.modify(dst, func(rd int) error {
+		if src.Type == parser.NUMBER && iop != "" && fits12(src.Num) {
+			b.emitI(iop, rd, rd, src.Num)
+			return nil
+		}
+		rs, err := b.use(src, regT5)
+		if err != nil {
+			return err
+		}
+		b.emitR(rop, rd, rd, rs)
+		return nil
+	})
+}
+
+// shift 移位, 省略位数时移动1位
+func (b *Backend) shift(i *parser.Instruction, name string) error {
+	if len(i.Args) != 1 && len(i.Args) != 2 {
+		return fmt.Errorf("riscv: %s needs 1 or 2 operands, got %d", i.Instruction, len(i.Args))
+	}
+	dst := i.Args[0]
+	return b.modify(dst, func(rd int) error {
+		if len(i.Args) == 1 || i.Args[1].Type == parser.NUMBER {
+			sa := int64(1)
+			if len(i.Args) == 2 {
+				sa = i.Args[1].Num
+			}
+			b.emitI(op(name+"i", dst), rd, rd, sa)
+			return nil
+		}
+		rs, err := b.use(i.Args[1], regT5)
+		if err != nil {
+			return err
+		}
+		b.emitR(op(name, dst), rd, rd, rs)
+		return nil
+	})
+}
+
+// xchg 交换两个操作数
+func (b *Backend) xchg(x, y *parser.Value) error {
+	if x.Type == parser.ADDR {
+		x, y = y, x
+	}
+	if x.Type != parser.REG {
+		return fmt.Errorf("riscv: XCHG needs a register operand")
+	}
+	rx, err := b.reg(x.Reg)
+	if err != nil {
+		return err
+	}
+	switch y.Type {
+	case parser.REG:
+		ry, err := b.reg(y.Reg)
+		if err != nil {
+			return err
+		}
+		b.move(regT5, rx)
+		b.move(rx, ry)
+		b.move(ry, regT5)
+		return nil
+	case parser.ADDR:
+		if err := b.load(regT6, y.Addr); err != nil {
+			return err
+		}
+		if err := b.store(rx, y.Addr); err != nil {
+			return err
+		}
+		b.move(rx, regT6)
+		return nil
+	}
+	return fmt.Errorf("riscv: invalid XCHG operand")
+}
+
+// settle 把挂起的CMP结果保存到t4
+func (b *Backend) settle() {
+	if err := b.settleErr(); err != nil {
+		// CMP时已经检查过操作数, 这里不会出错
+		panic(err)
+	}
+}
+
+// settleErr t4 = (a > b) - (a < b)
+// b的地址和值都放在t5, 所以a放在t6
+func (b *Backend) settleErr() error {
+	if b.cmp == nil || b.cmp.done {
+		return nil
+	}
+	ra, err := b.use(b.cmp.a, regT6)
+	if err != nil {
+		return err
+	}
+	rb, err := b.use(b.cmp.b, regT5)
+	if err != nil {
+		return err
+	}
+	slt := "slt"
+	if b.cmp.unsigned {
+		slt = "sltu"
+	}
+	b.emitR(slt, regT4, ra, rb)
+	b.emitR(slt, regT5, rb, ra)
+	b.emitR("sub", regT4, regT5, regT4)
+	b.cmp.done = true
+	return nil
+}
+
+// 各条件码对应的跳转指令, swap为真时交换两个操作数
+var branches = map[string]struct {
+	op   string
+	swap bool
+}{
+	"EQ": {"beq", false}, "NE": {"bne", false},
+	"LT": {"blt", false}, "GE": {"bge", false}, "GT": {"blt", true}, "LE": {"bge", true},
+	"CS": {"bltu", false}, "CC": {"bgeu", false}, "HI": {"bltu", true}, "LS": {"bgeu", true},
+}
+
+// jcc 条件跳转, cond为Go汇编的条件码
+func (b *Backend) jcc(i *parser.Instruction, cond string) error {
+	if err := need(i, 1); err != nil {
+		return err
+	}
+	if i.Args[0].Type != parser.LABEL {
+		return fmt.Errorf("riscv: %s needs a label", i.Instruction)
+	}
+	target := i.Args[0].String
+	c := b.cmp
+	if c == nil {
+		return fmt.Errorf("riscv: %s without CMP", i.Instruction)
+	}
+	br := branches[cond]
+	if c.done {
+		if types.CondUnsigned(cond) != c.unsigned {
+			return fmt.Errorf("riscv: %s mixes signed and unsigned jumps after one CMP", i.Instruction)
+		}
+		// t4是有符号的-1、0、1, 与0比较
+		ra, rb := regT4, regZero
+		if br.swap {
+			ra, rb = rb, ra
+		}
+		b.emit(&Inst{Op: strings.TrimSuffix(br.op, "u"), Rs1: ra, Rs2: rb, Sym: target, Reloc: relBranch})
+		return nil
+	}
+	if c.a.Type == parser.NUMBER && c.b.Type == parser.NUMBER {
+		// 两个常数, 直接决定是否跳转
+		if types.CondHolds(cond, c.a.Num, c.b.Num) {
+			b.emit(&Inst{Op: "jal", Rd: regZero, Sym: target, Reloc: relJal})
+		}
+		return nil
+	}
+	ra, err := b.use(c.a, regT6)
+	if err != nil {
+		return err
+	}
+	rb, err := b.use(c.b, regT5)
+	if err != nil {
+		return err
+	}
+	if br.swap {
+		ra, rb = rb, ra
+	}
+	b.emit(&Inst{Op: br.op, Rs1: ra, Rs2: rb, Sym: target, Reloc: relBranch})
+	return nil
+}
+
+// jump 无条件跳转或调用
+// 本文件内的标签用jal, 其它符号用auipc+jalr覆盖±2GB
+func (b *Backend) jump(v *parser.Value, link bool) error {
+	rd := regZero
+	if link {
+		rd = regRA
+	}
+	switch v.Type {
+	case parser.LABEL:
+		if b.local[v.String] {
+			b.emit(&Inst{Op: "jal", Rd: rd, Sym: v.String, Reloc: relJal})
+			return nil
+		}
+		tmp := regT5
+		if link {
+			tmp = regRA
+		}
+		b.emit(&Inst{Op: "auipc", Rd: tmp, Sym: v.String, Reloc: relPCHi20})
+		b.emit(&Inst{Op: "jalr", Rd: rd, Rs1: tmp, Sym: v.String, Reloc: relPCLo12})
+		return nil
+	case parser.REG, parser.ADDR:
+		rs, err := b.use(v, regT5)
+		if err != nil {
+			return err
+		}
+		b.emitI("jalr", rd, rs, 0)
+		return nil
+	}
+	return fmt.Errorf("riscv: invalid jump target")
+}
+
+// push 压栈, 每个槽位占8字节
+func (b *Backend) push(v *parser.Value) error {
+	rs, err := b.use(v, regT6)
+	if err != nil {
+		return err
+	}
+	b.emitI("addi", regSP, regSP, -8)
+	b.emit(&Inst{Op: "sd", Rs1: regSP, Rs2: rs})
+	return nil
+}
+
+// pop 出栈
+func (b *Backend) pop(v *parser.Value) error {
+	rd := regT6
+	if v.Type == parser.REG {
+		tmp, err := b.reg(v.Reg)
+		if err != nil {
+			return err
+		}
+		rd = tmp
+	} else if v.Type != parser.ADDR {
+		return fmt.Errorf("riscv: invalid POP operand")
+	}
+	b.emitI("ld", rd, regSP, 0)
+	b.emitI("addi", regSP, regSP, 8)
+	if v.Type == parser.ADDR {
+		return b.store(rd, v.Addr)
+	}
+	return nil
+}
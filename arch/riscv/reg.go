@@ -0,0 +1,61 @@
+package riscv
+
+import (
+	"CuteASM/arch/types"
+	"strconv"
+)
+
+// 常用寄存器编号
+const (
+	regZero = 0
+	regRA   = 1
+	regSP   = 2
+	regFP   = 8
+	regT4   = 29 // 保存CMP的结果(模拟标志位)
+	regT5   = 30 // 翻译时的临时寄存器, 用于地址和立即数
+	regT6   = 31 // 翻译内存操作数时的临时寄存器
+)
+
+// 整数寄存器的ABI名称, 下标即寄存器编号
+var regNames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+// RegLookup 寄存器名称到编号的映射
+var RegLookup = map[string]types.Register{
+	"fp": regFP,
+}
+
+func init() {
+	for i, name := range regNames {
+		RegLookup[name] = types.Register(i)
+		RegLookup["x"+strconv.Itoa(i)] = types.Register(i)
+	}
+}
+
+// regTable 虚拟寄存器表(RISC-V psABI)
+// t4-t6保留给指令翻译使用
+func regTable() *types.RegTable {
+	t := &types.RegTable{
+		Arch: "riscv",
+		Bits: 64,
+		Named: map[string]types.PhysReg{
+			"sp": {Num: regSP, Name: "sp", Class: types.RegSaved},
+			"bp": {Num: regFP, Name: "s0", Class: types.RegSaved},
+			"ra": {Num: regRA, Name: "ra", Class: types.RegScratch},
+		},
+	}
+	add := func(class types.RegClass, nums ...int) {
+		for _, i := range nums {
+			t.Regs = append(t.Regs, types.PhysReg{Num: i, Name: regNames[i], Class: class})
+		}
+	}
+	add(types.RegReturn, 10, 11)                                   // a0-a1
+	add(types.RegArg, 12, 13, 14, 15, 16, 17)                      // a2-a7
+	add(types.RegScratch, 5, 6, 7, 28)                             // t0-t3
+	add(types.RegSaved, 9, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27) // s1-s11
+	return t
+}
@@ -0,0 +1,156 @@
+// Package riscv 实现RV64后端
+package riscv
+
+import (
+	"CuteASM/arch"
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"encoding/binary"
+)
+
+// New 创建RV64架构实例
+func New() *types.Architecture {
+	return &types.Architecture{
+		Name:         "riscv64",
+		RegisterList: RegLookup,
+		WordSize:     64,
+		ByteOrder:    binary.LittleEndian,
+		Registers:    regTable(),
+	}
+}
+
+// CMP的结果
+// CMP本身不生成代码, 紧跟的条件跳转直接用beq、blt等比较两个操作数;
+// 遇到其它指令或基本块结束时, 把a-b的符号(-1、0、1)保存到t4
+type cmpState struct {
+	a, b     *parser.Value
+	done     bool // 已经保存到t4
+	unsigned bool // 之后的条件跳转按无符号比较, 保存时使用sltu
+}
+
+// Backend RV64后端
+type Backend struct {
+	arch.Fixed[*Inst]
+
+	arch    *types.Architecture
+	section string
+	local   map[string]bool              // 本文件内定义的标签, 可以用jal直接调用
+	cmps    map[*parser.Instruction]bool // 之后按无符号比较的CMP
+	cmp     *cmpState
+	buf     []*Inst // 当前基本块
+}
+
+// NewBackend 创建RV64后端
+func NewBackend() *Backend {
+	a := New()
+	return &Backend{
+		// 代码对齐填充nop, 即addi zero, zero, 0
+		Fixed: arch.NewFixed("riscv", a.ByteOrder, &Inst{Op: "addi"}, relAbs32, relAbs64),
+		arch:  a,
+		local: map[string]bool{},
+	}
+}
+
+// Arch 返回架构描述
+func (b *Backend) Arch() *types.Architecture {
+	return b.arch
+}
+
+// Prepare 找出按无符号比较的CMP, 收集本文件内定义的标签
+// 其余符号的位置未知, 调用时使用auipc+jalr
+func (b *Backend) Prepare(root *parser.Node) {
+	b.cmps = arch.UnsignedCmps(root)
+	b.markLocal(root)
+}
+
+func (b *Backend) markLocal(node *parser.Node) {
+	for _, n := range node.Children {
+		if label, ok := n.Value.(*parser.LabelBlock); ok {
+			b.local[label.Name] = true
+		}
+		b.markLocal(n)
+	}
+}
+
+// Section 切换当前段
+func (b *Backend) Section(name string) {
+	b.section = name
+}
+
+// Flush 结束当前基本块并返回文本汇编
+func (b *Backend) Flush() []string {
+	if arch.FallsThrough(b.buf) {
+		b.settle()
+	}
+	lines := b.Fixed.Flush(b.buf, (*Inst).Text)
+	b.buf = nil
+	return lines
+}
+
+// Assemble 编码全部指令
+func (b *Backend) Assemble() ([]byte, error) {
+	b.Flush()
+	return b.Fixed.Assemble()
+}
+
+// Uncond 无条件跳转, 之后的代码不可达
+func (in *Inst) Uncond() bool {
+	switch in.Op {
+	case "jal", "jalr":
+		return in.Rd == regZero
+	}
+	return false
+}
+
+func (b *Backend) emit(in *Inst) {
+	b.buf = append(b.buf, in)
+}
+
+func (b *Backend) emitR(op string, rd, rs1, rs2 int) {
+	b.emit(&Inst{Op: op, Rd: rd, Rs1: rs1, Rs2: rs2})
+}
+
+func (b *Backend) emitI(op string, rd, rs1 int, imm int64) {
+	b.emit(&Inst{Op: op, Rd: rd, Rs1: rs1, Imm: imm})
+}
+
+// move 寄存器间传送
+func (b *Backend) move(rd, rs int) {
+	if rd != rs {
+		b.emitI("addi", rd, rs, 0)
+	}
+}
+
+// reg 把CuteASM寄存器映射为物理寄存器
+func (b *Backend) reg(r *parser.Reg) (int, error) {
+	phys, err := b.arch.Registers.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	return phys.Num, err
+}
+
+// width 操作数宽度(字节)
+func width(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		switch v.Reg.Type {
+		case types.Reg8:
+			return 1
+		case types.Reg16:
+			return 2
+		case types.Reg32:
+			return 4
+		}
+	case parser.ADDR:
+		if v.Addr.Length != 0 {
+			return v.Addr.Length
+		}
+	}
+	return 8
+}
+
+// op 根据运算宽度选择64位指令或带w后缀的32位指令
+func op(name string, v *parser.Value) string {
+	if width(v) == 8 {
+		return name
+	}
+	return name + "w"
+}
@@ -0,0 +1,42 @@
+package arch
+
+import (
+	"CuteASM/parser"
+	"strconv"
+)
+
+// GASSymbols 按GNU as(ELF)的写法声明符号的绑定、类型和数据的大小
+func GASSymbols(t *parser.SymbolTable) []string {
+	var lines []string
+	for _, s := range t.Symbols {
+		if s.Hidden {
+			continue
+		}
+		switch s.Bind {
+		case parser.BindGlobal:
+			lines = append(lines, ".globl "+s.Name)
+		case parser.BindWeak:
+			lines = append(lines, ".weak "+s.Name)
+		case parser.BindExtern:
+			lines = append(lines, ".extern "+s.Name)
+		}
+		switch s.Type {
+		case parser.SymFunc:
+			lines = append(lines, ".type "+s.Name+", @function")
+		case parser.SymObject:
+			lines = append(lines, ".type "+s.Name+", @object")
+			if s.Defined {
+				lines = append(lines, ".size "+s.Name+", "+strconv.Itoa(s.Size))
+			}
+		}
+	}
+	return lines
+}
+
+// GASSymbolEnd 在函数结束处记录大小
+func GASSymbolEnd(s *parser.Symbol) []string {
+	if !s.Defined || s.Hidden || s.Type != parser.SymFunc {
+		return nil
+	}
+	return []string{".size " + s.Name + ", .-" + s.Name}
+}
@@ -0,0 +1,84 @@
+package types
+
+// GoCond Go汇编的条件码对应的Intel条件码, 如JGT即jg、SETHI即seta、CMOVQCS即cmovb
+var GoCond = map[string]string{
+	"EQ": "E", "NE": "NE", "GE": "GE", "GT": "G", "LE": "LE", "LT": "L",
+	"HI": "A", "LS": "BE", "CC": "AE", "CS": "B",
+	"MI": "S", "PL": "NS", "OS": "O", "OC": "NO", "PS": "P", "PC": "NP",
+}
+
+// IntelCond Intel条件码(含别名)对应的Go汇编条件码
+var IntelCond = map[string]string{
+	"E": "EQ", "Z": "EQ", "NE": "NE", "NZ": "NE",
+	"GE": "GE", "NL": "GE", "G": "GT", "NLE": "GT",
+	"LE": "LE", "NG": "LE", "L": "LT", "NGE": "LT",
+	"A": "HI", "NBE": "HI", "BE": "LS", "NA": "LS",
+	"AE": "CC", "NB": "CC", "NC": "CC", "B": "CS", "NAE": "CS", "C": "CS",
+	"S": "MI", "NS": "PL", "O": "OS", "NO": "OC",
+	"P": "PS", "PE": "PS", "NP": "PC", "PO": "PC",
+}
+
+// BranchCond 条件跳转按CMP a, b比较时的条件, 返回Go汇编的条件码
+// JMPZ即JE, JMPN即JL; JS、JO、JP等不是比较两个操作数的条件
+func BranchCond(name Instruction) (string, bool) {
+	switch name {
+	case "JMPZ":
+		return "EQ", true
+	case "JMPN":
+		return "LT", true
+	}
+	if len(name) < 2 || name[0] != 'J' {
+		return "", false
+	}
+	cond, ok := IntelCond[string(name[1:])]
+	if !ok || CondFlag(cond) {
+		return "", false
+	}
+	return cond, true
+}
+
+// CondFlag 条件码只看单个标志位, 不是两个操作数的大小关系
+func CondFlag(cond string) bool {
+	switch cond {
+	case "MI", "PL", "OS", "OC", "PS", "PC":
+		return true
+	}
+	return false
+}
+
+// CondUnsigned 条件码是否按无符号比较
+func CondUnsigned(cond string) bool {
+	switch cond {
+	case "HI", "LS", "CC", "CS":
+		return true
+	}
+	return false
+}
+
+// CondHolds 两个常数比较时条件是否成立
+func CondHolds(cond string, a, b int64) bool {
+	ua, ub := uint64(a), uint64(b)
+	switch cond {
+	case "EQ":
+		return a == b
+	case "NE":
+		return a != b
+	case "LT":
+		return a < b
+	case "GE":
+		return a >= b
+	case "LE":
+		return a <= b
+	case "GT":
+		return a > b
+	case "CS":
+		return ua < ub
+	case "CC":
+		return ua >= ub
+	case "LS":
+		return ua <= ub
+	case "HI":
+		return ua > ub
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package types
+
+import "fmt"
+
+// RegClass 寄存器在调用约定中的用途
+type RegClass int
+
+const (
+	RegReturn  RegClass = iota // 返回值
+	RegArg                     // 参数
+	RegScratch                 // 调用者保存的临时寄存器
+	RegSaved                   // 被调用者保存
+)
+
+func (c RegClass) String() string {
+	switch c {
+	case RegReturn:
+		return "return"
+	case RegArg:
+		return "argument"
+	case RegScratch:
+		return "scratch"
+	case RegSaved:
+		return "callee-saved"
+	}
+	return "unknown"
+}
+
+// PhysReg 物理寄存器
+type PhysReg struct {
+	Num   int    // 编码时使用的寄存器编号
+	Name  string // 字长宽度下的名称
+	Class RegClass
+}
+
+// RegTable 虚拟寄存器表
+//
+// 源码中的 %e0、%r1 等与架构无关, 数字N对应Regs[N]。各架构的表都以
+// 返回值寄存器开头, 所以 %e0 总是返回值, 同一份源码可以在不同后端之间移植。
+type RegTable struct {
+	Arch  string
+	Bits  int                // 寄存器的最大宽度
+	Regs  []PhysReg          // 虚拟寄存器
+	Named map[string]PhysReg // %rsp、%rbp 等按名称引用的寄存器, 键为去掉宽度前缀的名称
+}
+
+// Lookup 返回第num个虚拟寄存器, width为访问宽度(字节)
+func (t *RegTable) Lookup(num, width int) (PhysReg, error) {
+	if num < 0 || num >= len(t.Regs) {
+		return PhysReg{}, fmt.Errorf("%s: virtual register %d out of range, only %d available", t.Arch, num, len(t.Regs))
+	}
+	if width*8 > t.Bits {
+		return PhysReg{}, fmt.Errorf("%s: %d-bit register %d is wider than the target's %d-bit registers", t.Arch, width*8, num, t.Bits)
+	}
+	return t.Regs[num], nil
+}
+
+// LookupName 返回按名称引用的寄存器
+func (t *RegTable) LookupName(name string) (PhysReg, error) {
+	reg, ok := t.Named[name]
+	if !ok {
+		return PhysReg{}, fmt.Errorf("%s: unknown register %s", t.Arch, name)
+	}
+	return reg, nil
+}
+
+// Resolve 解析源码中的寄存器, name非空时按名称查找, 否则按编号查找
+func (t *RegTable) Resolve(name string, num, width int) (PhysReg, error) {
+	if name != "" {
+		if width*8 > t.Bits {
+			return PhysReg{}, fmt.Errorf("%s: %d-bit register %s is wider than the target's %d-bit registers", t.Arch, width*8, name, t.Bits)
+		}
+		return t.LookupName(name)
+	}
+	return t.Lookup(num, width)
+}
+
+// Class 返回属于某一类的虚拟寄存器编号
+func (t *RegTable) Class(class RegClass) []int {
+	nums := []int{}
+	for i, reg := range t.Regs {
+		if reg.Class == class {
+			nums = append(nums, i)
+		}
+	}
+	return nums
+}
+
+// RegWidth 返回通用寄存器类型的宽度(字节), 其它类型返回0
+func RegWidth(regType int) int {
+	switch regType {
+	case Reg8:
+		return 1
+	case Reg16:
+		return 2
+	case Reg32:
+		return 4
+	case Reg64:
+		return 8
+	}
+	return 0
+}
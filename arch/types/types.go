@@ -1,5 +1,7 @@
 package types
 
+import "encoding/binary"
+
 type Register int
 type Instruction string
 
@@ -7,8 +9,11 @@ type Instruction string
 type InstructionMap map[Instruction]Opcode
 
 type Architecture struct {
+	Name         string
 	RegisterList map[string]Register
 	WordSize     int
+	ByteOrder    binary.ByteOrder
+	Registers    *RegTable // 虚拟寄存器表
 	Instructions InstructionMap
 }
 
@@ -19,6 +24,27 @@ type Opcode struct {
 
 type OpBytes []byte
 
+// BuiltinI 可移植的内置指令, 每个后端都要翻译全部内置指令
+//
+// 操作数: 第一个操作数是目标, STORE是例外, 写作 STORE src, dst。
+// 至多一个操作数是内存, 立即数按另一个操作数的宽度截断。
+//
+// 宽度: 运算宽度w取寄存器或内存操作数的宽度, 各目标只保证结果的低w位一致;
+// w小于字长时寄存器的高位由目标决定(x86的32位运算清零高位, MIPS和LoongArch符号扩展)。
+// CMP、DIV和SHIFTR读取整个寄存器, 可移植的程序用字长的寄存器进行这些运算。
+//
+// 符号: ADD、SUB、MUL、NEG的低w位与符号无关, MUL取乘积的低w位;
+// DIV是无符号除法, 除数为0时的结果由目标决定; SHIFTR是逻辑右移;
+// SHIFTL、SHIFTR省略位数时移动1位, 位数只取低log2(w*8)位;
+// LOAD按变量声明的SIGNED/UNSIGNED扩展, 未声明时与MOV相同。
+//
+// 标志: 只有CMP a, b产生可移植的条件, 紧跟的JMPZ在a == b时跳转,
+// JMPN在a < b(有符号)时跳转, 两者之间只能插入MOV、LOAD、STORE、PUSH、POP、XCHG。
+// 其它指令之后的标志位由目标决定, 解释器(interp)把这样的条件跳转当作错误。
+// 没有标志位的目标(MIPS、RISC-V、LoongArch)直接用比较分支, 或者把比较结果保存在保留的寄存器中。
+//
+// 栈: PUSH、POP每次移动一个栈槽, 栈槽为字长(Go arm64为16字节), POP不改变标志位。
+// XCHG交换两个操作数, 不改变标志位。HALT使程序陷入(x86为hlt, 其它目标为断点)。
 var BuiltinI = []Instruction{
 	"ADD",
 	"AND",
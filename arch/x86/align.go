@@ -0,0 +1,93 @@
+package x86
+
+import (
+	"CuteASM/arch"
+	"CuteASM/parser"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 推荐的多字节NOP, 下标为长度
+var nopTable = [][]byte{
+	nil,
+	{0x90},
+	{0x66, 0x90},
+	{0x0f, 0x1f, 0x00},
+	{0x0f, 0x1f, 0x40, 0x00},
+	{0x0f, 0x1f, 0x44, 0x00, 0x00},
+	{0x66, 0x0f, 0x1f, 0x44, 0x00, 0x00},
+	{0x0f, 0x1f, 0x80, 0x00, 0x00, 0x00, 0x00},
+	{0x0f, 0x1f, 0x84, 0x00, 0x00, 0x00, 0x00, 0x00},
+	{0x66, 0x0f, 0x1f, 0x84, 0x00, 0x00, 0x00, 0x00, 0x00},
+}
+
+// nops n字节的填充, 尽量使用最长的NOP以减少指令条数
+func nops(n int) []byte {
+	var code []byte
+	for n > 0 {
+		k := min(n, len(nopTable)-1)
+		code = append(code, nopTable[k]...)
+		n -= k
+	}
+	return code
+}
+
+// padding 对齐需要的填充字节
+func padding(a *parser.AlignBlock, pc int) []byte {
+	n := a.Padding(uint64(pc))
+	if a.Code && !a.HasFill {
+		return nops(n)
+	}
+	return bytes.Repeat([]byte{a.Fill}, n)
+}
+
+// FormatAlign 把对齐按方言输出为文本
+// smartalign为假时NASM需要先启用smartalign, 代码的填充才会使用多字节NOP
+func FormatAlign(a *parser.AlignBlock, dialect Dialect, smartalign bool) ([]string, error) {
+	n := strconv.Itoa(a.Align)
+	limited := a.Max >= 0 && a.Max < a.Align-1
+	switch dialect {
+	case GAS, GASIntel:
+		return []string{arch.GASAlign(a)}, nil
+	case MASM:
+		// MASM在代码段中用NOP填充, 其它段中用0填充
+		if limited {
+			return nil, fmt.Errorf("x86: MASM cannot limit the padding of ALIGN")
+		}
+		if a.HasFill && a.Fill != 0 && !(a.Code && a.Fill == 0x90) {
+			return nil, fmt.Errorf("x86: MASM cannot pad ALIGN with %#x", a.Fill)
+		}
+		return []string{"ALIGN " + n}, nil
+	}
+	if limited {
+		// NASM的align不能限制填充的长度, 按位置计算
+		pad := "((-($-$$)) & " + strconv.Itoa(a.Align-1) + ")"
+		if a.HasFill || !a.Code {
+			return []string{"times (" + pad + " <= " + strconv.Itoa(a.Max) + ") * " + pad + " db " + strconv.Itoa(int(a.Fill))}, nil
+		}
+		// 代码按填充的长度逐个给出与内置编码相同的多字节NOP
+		lines := make([]string, a.Max)
+		for k := 1; k <= a.Max; k++ {
+			lines[k-1] = "times (" + pad + " == " + strconv.Itoa(k) + ") db " + dbBytes(nops(k))
+		}
+		return lines, nil
+	}
+	if a.HasFill || !a.Code {
+		return []string{"align " + n + ", db " + strconv.Itoa(int(a.Fill))}, nil
+	}
+	if !smartalign {
+		return []string{"%use smartalign", "alignmode p6", "align " + n}, nil
+	}
+	return []string{"align " + n}, nil
+}
+
+// dbBytes db伪指令的字节列表
+func dbBytes(code []byte) string {
+	list := make([]string, len(code))
+	for i, c := range code {
+		list[i] = fmt.Sprintf("0x%02x", c)
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,353 @@
+package x86
+
+import (
+	"CuteASM/arch"
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Backend x86文本汇编后端
+// 按选定的方言输出文本汇编, 交给现有的汇编器处理
+type Backend struct {
+	Labels map[string]int64 // 最近一次Assemble得到的标签地址和常量的值, 地址从0开始
+
+	arch    *types.Architecture
+	dialect Dialect
+	bits    int
+	lines   []string
+	prog    []item
+	entry   string // MASM在END中指定入口
+	smart   bool   // NASM已经启用smartalign
+}
+
+// item 已经输出的标签、指令或数据
+type item struct {
+	label string
+	inst  *parser.Instruction
+	data  *parser.DataBlock
+	align *parser.AlignBlock
+	equ   *parser.Expr // 依赖标签地址的常量label的值
+}
+
+// NewBackend 创建x86后端, target为x86或x86_64
+func NewBackend(target string, d Dialect) *Backend {
+	bits := 32
+	if target == "x86_64" {
+		bits = 64
+	}
+	return &Backend{arch: NewMode(bits), dialect: d, bits: bits}
+}
+
+// Arch 返回架构描述
+func (b *Backend) Arch() *types.Architecture {
+	return b.arch
+}
+
+// Dialect 返回输出的方言
+func (b *Backend) Dialect() Dialect {
+	return b.dialect
+}
+
+// Prepare x86有标志位, 不需要预先扫描
+func (b *Backend) Prepare(root *parser.Node) {}
+
+// Section 切换当前段
+func (b *Backend) Section(name string) {}
+
+// Label 定义标签
+func (b *Backend) Label(name string) {
+	b.prog = append(b.prog, item{label: name})
+}
+
+// Emit 把指令展开后按方言翻译为文本
+func (b *Backend) Emit(i *parser.Instruction) error {
+	insts, err := Lower(i, b.arch.Registers, b.bits)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, len(insts))
+	for n, in := range insts {
+		if lines[n], err = Format(in, b.dialect, b.arch.Registers, b.bits); err != nil {
+			return err
+		}
+	}
+	b.lines = append(b.lines, lines...)
+	for _, in := range insts {
+		b.prog = append(b.prog, item{inst: in})
+	}
+	return nil
+}
+
+// Data 把初始化数据按方言翻译为文本
+func (b *Backend) Data(d *parser.DataBlock) error {
+	b.lines = append(b.lines, FormatData(d, b.dialect)...)
+	b.prog = append(b.prog, item{data: d})
+	return nil
+}
+
+// Align 对齐当前位置
+func (b *Backend) Align(a *parser.AlignBlock) error {
+	lines, err := FormatAlign(a, b.dialect, b.smart)
+	if err != nil {
+		return err
+	}
+	b.smart = b.smart || b.dialect == NASM && a.Code && !a.HasFill
+	b.lines = append(b.lines, lines...)
+	b.prog = append(b.prog, item{align: a})
+	return nil
+}
+
+// Flush 返回缓存的文本汇编
+func (b *Backend) Flush() []string {
+	lines := b.lines
+	b.lines = nil
+	return lines
+}
+
+// Assemble 用内置编码表编码全部指令
+// 标签从0开始按顺序排列, 只能引用本文件内定义的标签
+func (b *Backend) Assemble() ([]byte, error) {
+	// 引用标签的字段总是4字节, 指令的长度与标签的值无关
+	type encoded struct {
+		code   types.OpBytes
+		fixups []fixup
+	}
+	insts := make([]encoded, len(b.prog))
+	syms := map[string]int64{}
+	equs := map[string]int64{} // 常量定义处的地址, 即表达式中的$
+	pc := 0
+	for n, it := range b.prog {
+		switch {
+		case it.data != nil:
+			pc += it.data.Len()
+		case it.align != nil:
+			pc += it.align.Padding(uint64(pc))
+		case it.equ != nil:
+			equs[it.label] = int64(pc)
+		case it.inst == nil:
+			syms[it.label] = int64(pc)
+		default:
+			code, fixups, err := assemble(it.inst, b.arch)
+			if err != nil {
+				return nil, err
+			}
+			insts[n] = encoded{code, fixups}
+			pc += len(code)
+		}
+	}
+	lookup := func(name string) (int64, error) {
+		if addr, ok := syms[name]; ok {
+			return addr, nil
+		}
+		return 0, fmt.Errorf("%s is not defined in this file, which needs a linker", name)
+	}
+	// 常量按定义的顺序计算, 可以引用前面的常量
+	for _, it := range b.prog {
+		if it.equ == nil {
+			continue
+		}
+		v, err := it.equ.Eval(func(name string) (int64, error) {
+			if name == "$" {
+				return equs[it.label], nil
+			}
+			return lookup(name)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("x86: constant %s: %v", it.label, err)
+		}
+		syms[it.label] = v
+	}
+	b.Labels = syms
+	code := make([]byte, 0, pc)
+	for n, it := range b.prog {
+		switch {
+		case it.align != nil:
+			code = append(code, padding(it.align, len(code))...)
+		case it.data != nil:
+			bin, err := b.data(it.data, lookup)
+			if err != nil {
+				return nil, err
+			}
+			code = append(code, bin...)
+		case it.inst != nil:
+			bin := append(types.OpBytes(nil), insts[n].code...)
+			end := int64(len(code) + len(bin))
+			for _, f := range insts[n].fixups {
+				v, err := f.expr.Eval(lookup)
+				if err != nil {
+					return nil, fmt.Errorf("x86: %s: %v", it.inst.Instruction, err)
+				}
+				if f.rel {
+					v -= end
+				}
+				if v < math.MinInt32 || v > math.MaxUint32 || f.rel && v > math.MaxInt32 {
+					return nil, fmt.Errorf("x86: %s: %s = %#x does not fit in 32 bits", it.inst.Instruction, f.expr, v)
+				}
+				binary.LittleEndian.PutUint32(bin[f.at:], uint32(v))
+			}
+			code = append(code, bin...)
+		}
+	}
+	return code, nil
+}
+
+// data 编码初始化数据, 写入引用的标签地址
+func (b *Backend) data(d *parser.DataBlock, lookup func(string) (int64, error)) ([]byte, error) {
+	bin, refs, err := d.Bytes(b.arch.ByteOrder)
+	if err != nil {
+		return nil, fmt.Errorf("x86: %v", err)
+	}
+	for _, ref := range refs {
+		addr, err := lookup(ref.Sym)
+		if err != nil {
+			return nil, fmt.Errorf("x86: data refers to the address of %v", err)
+		}
+		v := uint64(addr + ref.Addend)
+		switch ref.Size {
+		case 4:
+			if v > math.MaxUint32 {
+				return nil, fmt.Errorf("x86: the address of %s does not fit in 4 bytes", ref.Sym)
+			}
+			b.arch.ByteOrder.PutUint32(bin[ref.Offset:], uint32(v))
+		case 8:
+			b.arch.ByteOrder.PutUint64(bin[ref.Offset:], v)
+		default:
+			return nil, fmt.Errorf("x86: the address of %s does not fit in %d bytes", ref.Sym, ref.Size)
+		}
+	}
+	return bin, nil
+}
+
+// Comment 注释行
+func (b *Backend) Comment(text string) string {
+	if b.dialect == GAS || b.dialect == GASIntel {
+		return "# " + text
+	}
+	return "; " + text
+}
+
+// MASM中常用段对应的简化段伪指令
+var masmSections = map[string]string{
+	".text":   ".code",
+	".data":   ".data",
+	".bss":    ".data?",
+	".rodata": ".const",
+}
+
+// SectionLine 切换段的伪指令
+func (b *Backend) SectionLine(name string) string {
+	switch b.dialect {
+	case GAS, GASIntel:
+		return ".section " + name
+	case MASM:
+		if tmp, ok := masmSections[name]; ok {
+			return tmp
+		}
+		return ".data"
+	}
+	return "section " + name
+}
+
+// LabelLine 定义标签
+func (b *Backend) LabelLine(name string) string {
+	return name + ":"
+}
+
+// EquLine 定义符号常量, 值由汇编器在确定地址后计算
+func (b *Backend) EquLine(name string, e *parser.Expr) (string, error) {
+	b.prog = append(b.prog, item{label: name, equ: e})
+	if b.dialect == GAS || b.dialect == GASIntel {
+		return ".set " + name + ", " + e.Format("."), nil
+	}
+	return name + " equ " + e.Format("$"), nil
+}
+
+// Header 文件开头的伪指令
+func (b *Backend) Header() []string {
+	bits := strconv.Itoa(b.bits)
+	switch b.dialect {
+	case GAS:
+		return []string{".code" + bits}
+	case GASIntel:
+		return []string{".intel_syntax noprefix", ".code" + bits}
+	case MASM:
+		if b.bits == 32 {
+			return []string{".686", ".model flat, c"}
+		}
+		return nil
+	}
+	if b.bits == 64 {
+		// 标签按RIP相对寻址, 与内置编码一致
+		return []string{"bits 64", "default rel"}
+	}
+	return []string{"bits " + bits}
+}
+
+// Footer 文件末尾的伪指令
+func (b *Backend) Footer() []string {
+	if b.dialect == MASM {
+		if b.entry != "" {
+			return []string{"END " + b.entry}
+		}
+		return []string{"END"}
+	}
+	return nil
+}
+
+// SymbolLines 按方言声明符号
+func (b *Backend) SymbolLines(t *parser.SymbolTable) []string {
+	switch b.dialect {
+	case GAS, GASIntel:
+		return arch.GASSymbols(t)
+	case MASM:
+		return b.masmSymbols(t)
+	}
+	var lines []string
+	for _, s := range t.Symbols {
+		weak := ""
+		if s.Bind == parser.BindWeak {
+			weak = ":weak"
+		}
+		switch s.Bind {
+		case parser.BindGlobal, parser.BindWeak:
+			lines = append(lines, "global "+s.Name+weak)
+		case parser.BindExtern:
+			lines = append(lines, "extern "+s.Name)
+		}
+	}
+	return lines
+}
+
+// masmSymbols MASM没有弱符号, 外部符号需要给出类型
+func (b *Backend) masmSymbols(t *parser.SymbolTable) []string {
+	if b.bits == 32 {
+		// ml64的END不能指定入口, 由链接器的/ENTRY指定
+		b.entry = t.Entry
+	}
+	var lines []string
+	for _, s := range t.Symbols {
+		switch s.Bind {
+		case parser.BindGlobal, parser.BindWeak:
+			lines = append(lines, "PUBLIC "+s.Name)
+		case parser.BindExtern:
+			if s.Type == parser.SymObject {
+				lines = append(lines, "EXTERN "+s.Name+":BYTE")
+			} else {
+				lines = append(lines, "EXTERN "+s.Name+":PROC")
+			}
+		}
+	}
+	return lines
+}
+
+// SymbolEnd GAS在函数结束处记录函数的大小
+func (b *Backend) SymbolEnd(s *parser.Symbol) []string {
+	if b.dialect == GAS || b.dialect == GASIntel {
+		return arch.GASSymbolEnd(s)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package x86
+
+import (
+	"CuteASM/arch"
+	"CuteASM/parser"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// 各宽度数据的伪指令
+var (
+	nasmData = map[int]string{1: "db", 2: "dw", 4: "dd", 8: "dq"}
+	gasData  = map[int]string{1: ".byte", 2: ".short", 4: ".long", 8: ".quad"}
+)
+
+// FormatData 把初始化数据按方言输出为文本
+func FormatData(d *parser.DataBlock, dialect Dialect) []string {
+	if dialect == GAS || dialect == GASIntel {
+		return arch.GASData(d, binary.LittleEndian, gasData)
+	}
+	var lines []string
+	for _, line := range d.Lines(binary.LittleEndian, "$") {
+		name, values := nasmData[line.Width], strings.Join(line.Values, ", ")
+		if line.Width == 0 {
+			if len(line.Str) == 0 {
+				continue
+			}
+			name, values = "db", quoteData(line.Str)
+		}
+		switch {
+		case line.Count == 0:
+		case line.Count == 1:
+			lines = append(lines, name+" "+values)
+		case dialect == MASM:
+			lines = append(lines, name+" "+strconv.Itoa(line.Count)+" dup ("+values+")")
+		default:
+			lines = append(lines, "times "+strconv.Itoa(line.Count)+" "+name+" "+values)
+		}
+	}
+	return lines
+}
+
+// quoteData NASM和MASM的字节序列, 可打印的部分写成字符串, 其余写成数值
+func quoteData(b []byte) string {
+	var parts []string
+	start := -1
+	for i := 0; i <= len(b); i++ {
+		printable := i < len(b) && b[i] >= 0x20 && b[i] <= 0x7e && b[i] != '"'
+		if printable {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			parts = append(parts, `"`+string(b[start:i])+`"`)
+			start = -1
+		}
+		if i < len(b) {
+			parts = append(parts, strconv.Itoa(int(b[i])))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
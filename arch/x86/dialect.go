@@ -0,0 +1,409 @@
+package x86
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect 文本汇编的方言
+type Dialect int
+
+const (
+	NASM     Dialect = iota // NASM/YASM
+	GAS                     // GNU as, AT&T语法
+	GASIntel                // GNU as, .intel_syntax noprefix
+	MASM                    // Microsoft MASM
+)
+
+var dialectNames = map[string]Dialect{
+	"nasm":  NASM,
+	"gas":   GAS,
+	"att":   GAS,
+	"intel": GASIntel,
+	"masm":  MASM,
+}
+
+// ParseDialect 按名称查找方言
+func ParseDialect(name string) (Dialect, error) {
+	d, ok := dialectNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown x86 dialect %s", name)
+	}
+	return d, nil
+}
+
+func (d Dialect) String() string {
+	switch d {
+	case GAS:
+		return "gas"
+	case GASIntel:
+		return "intel"
+	case MASM:
+		return "masm"
+	}
+	return "nasm"
+}
+
+// 各宽度通用寄存器的名称, 下标为硬件编号
+var (
+	gpr32 = [16]string{"eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi",
+		"r8d", "r9d", "r10d", "r11d", "r12d", "r13d", "r14d", "r15d"}
+	gpr16 = [16]string{"ax", "cx", "dx", "bx", "sp", "bp", "si", "di",
+		"r8w", "r9w", "r10w", "r11w", "r12w", "r13w", "r14w", "r15w"}
+	gpr8 = [16]string{"al", "cl", "dl", "bl", "spl", "bpl", "sil", "dil",
+		"r8b", "r9b", "r10b", "r11b", "r12b", "r13b", "r14b", "r15b"}
+)
+
+// 其它寄存器类型按编号命名时的前缀
+var regPrefix = map[int]string{
+	types.RegXMM: "xmm",
+	types.RegYMM: "ymm",
+	types.RegZMM: "zmm",
+	types.RegMMX: "mm",
+	types.RegFPU: "st",
+	types.RegTMM: "tmm",
+	types.RegBND: "bnd",
+	types.RegCR:  "cr",
+	types.RegDR:  "dr",
+	types.RegTR:  "tr",
+}
+
+// CuteASM内置指令对应的x86助记符
+var mnemonics = map[types.Instruction]string{
+	"MOV": "mov", "LOAD": "mov", "STORE": "mov",
+	"ADD": "add", "SUB": "sub", "MUL": "imul", "DIV": "div",
+	"AND": "and", "OR": "or", "XOR": "xor", "NOT": "not", "NEG": "neg",
+	"SHIFTL": "shl", "SHIFTR": "shr",
+	"CMP": "cmp", "JMP": "jmp", "JMPZ": "jz", "JMPN": "jl",
+	"CALL": "call", "RET": "ret", "PUSH": "push", "POP": "pop",
+	"XCHG": "xchg", "HALT": "hlt",
+}
+
+// 不需要AT&T宽度后缀的指令
+var noSuffix = map[string]bool{
+	"jmp": true, "jz": true, "jl": true, "call": true, "ret": true, "hlt": true,
+}
+
+// Format 把一条指令按方言输出为文本, 寄存器按table映射为硬件寄存器
+// 64位模式下和内置编码一样, 标签按RIP相对寻址
+func Format(i *parser.Instruction, d Dialect, table *types.RegTable, bits int) (string, error) {
+	name, ok := mnemonics[i.Instruction]
+	if !ok || i.Instruction == "MUL" && len(i.Args) != 2 {
+		// 单操作数的MUL是x86原本的无符号乘法
+		name = strings.ToLower(string(i.Instruction))
+	}
+	args := i.Args
+	wide, widened := widen(i)
+	if widened != nil {
+		name, args = wide, widened
+	}
+	if bits == 64 && (i.Instruction == "MOV" || i.Instruction == "LOAD") && len(args) == 2 && args[0].Type == parser.REG {
+		if sym, off, ok := labelOffset(args[1]); ok {
+			// 标签的地址用RIP相对的lea
+			name = "lea"
+			args = []*parser.Value{args[0], {Type: parser.ADDR, Addr: &parser.MemoryAddr{LabelRef: sym, Displacement: off}}}
+		}
+	}
+	if i.Instruction == "STORE" && len(args) == 2 {
+		// STORE src, dst
+		args = []*parser.Value{args[1], args[0]}
+	}
+	ops := make([]string, len(args))
+	for n, arg := range args {
+		if name == "lea" && arg.Type == parser.ADDR {
+			// lea只计算地址, 内存操作数不写宽度
+			addr := *arg.Addr
+			addr.Length = 0
+			arg = &parser.Value{Type: parser.ADDR, Addr: &addr}
+		}
+		tmp, err := operand(arg, d, table, isBranch(name), bits == 64)
+		if err != nil {
+			return "", err
+		}
+		if d == GAS && isBranch(name) && (arg.Type == parser.REG || arg.Type == parser.ADDR) {
+			// AT&T语法的间接跳转和调用, 如call *%rax
+			tmp = "*" + tmp
+		}
+		ops[n] = tmp
+	}
+	// 内置指令目标在前, 其它指令和编码表一样源操作数在前
+	// AT&T语法源操作数在前, 助记符带宽度后缀
+	if (d == GAS) == i.IsBuiltin() {
+		for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+			ops[l], ops[r] = ops[r], ops[l]
+		}
+	}
+	if d == GAS && !noSuffix[name] && i.IsBuiltin() {
+		if name != "mov" && widened != nil {
+			// AT&T的扩展指令带源和目标两个宽度, 如movsbq、movslq
+			name = name[:4] + suffix(args[1:]) + suffix(args[:1])
+		} else {
+			name += suffix(args)
+		}
+	}
+	if len(ops) == 0 {
+		return name, nil
+	}
+	return name + " " + strings.Join(ops, ", "), nil
+}
+
+// widen LOAD把SIGNED或UNSIGNED变量读入更宽的寄存器
+// 有符号用movsx、movsxd, 无符号用movzx; 无符号的DW直接写入32位寄存器, 高32位自动清零
+func widen(i *parser.Instruction) (string, []*parser.Value) {
+	if i.Instruction != "LOAD" || len(i.Args) != 2 {
+		return "", nil
+	}
+	dst, src := i.Args[0], i.Args[1]
+	if dst.Type != parser.REG || src.Type != parser.ADDR || src.Addr.Sign == 0 {
+		return "", nil
+	}
+	if width := types.RegWidth(dst.Reg.Type); width <= src.Addr.Length || src.Addr.Length == 0 {
+		return "", nil
+	}
+	switch {
+	case src.Addr.Sign == parser.SIGNED && src.Addr.Length == 4:
+		return "movsxd", i.Args
+	case src.Addr.Sign == parser.SIGNED:
+		return "movsx", i.Args
+	case src.Addr.Length == 4:
+		reg := *dst.Reg
+		reg.Type = types.Reg32
+		return "mov", []*parser.Value{{Type: parser.REG, Reg: &reg}, src}
+	}
+	return "movzx", i.Args
+}
+
+// isBranch 操作数是跳转目标的指令: jmp、各种条件跳转、loop和call
+func isBranch(name string) bool {
+	return strings.HasPrefix(name, "j") || strings.HasPrefix(name, "loop") || name == "call"
+}
+
+// operand 输出一个操作数, branch为真时标签是跳转目标, rip为真时内存中的标签按RIP相对寻址
+func operand(v *parser.Value, d Dialect, table *types.RegTable, branch, rip bool) (string, error) {
+	switch v.Type {
+	case parser.REG:
+		name, err := regName(v.Reg, table)
+		if err != nil {
+			return "", err
+		}
+		if d == GAS {
+			return "%" + name, nil
+		}
+		return name, nil
+	case parser.NUMBER:
+		num := strconv.FormatInt(v.Num, 10)
+		if d == GAS {
+			return "$" + num, nil
+		}
+		return num, nil
+	case parser.LABEL:
+		if d == GAS && !branch {
+			// 标签地址作为立即数
+			return "$" + v.String, nil
+		}
+		if (d == MASM || d == GASIntel) && !branch {
+			return "offset " + v.String, nil
+		}
+		return v.String, nil
+	case parser.EXPR:
+		here := "$"
+		if d == GAS || d == GASIntel {
+			here = "."
+		}
+		text := v.Expr.Format(here)
+		if branch {
+			return text, nil
+		}
+		if d == GAS {
+			return "$(" + text + ")", nil
+		}
+		if _, _, ok := v.Expr.Offset(); ok && (d == MASM || d == GASIntel) {
+			// 标签加偏移的地址
+			return "offset " + text, nil
+		}
+		return text, nil
+	case parser.STRING:
+		return "'" + v.String + "'", nil
+	case parser.ADDR:
+		return memory(v.Addr, d, table, rip)
+	}
+	return "", fmt.Errorf("x86: cannot format operand of type %d", v.Type)
+}
+
+// regName 寄存器在目标上的名称
+func regName(r *parser.Reg, table *types.RegTable) (string, error) {
+	width := types.RegWidth(r.Type)
+	if width == 0 {
+		if r.Name != "" {
+			return r.Name, nil
+		}
+		prefix, ok := regPrefix[r.Type]
+		if !ok {
+			return "", fmt.Errorf("x86: unknown register type %d", r.Type)
+		}
+		return prefix + strconv.Itoa(r.Num), nil
+	}
+	phys, err := table.Resolve(r.Name, r.Num, width)
+	if err != nil {
+		return "", err
+	}
+	if phys.Num < 0 || phys.Num >= len(gprNames) {
+		return "", fmt.Errorf("x86: register %d has no name", phys.Num)
+	}
+	switch width {
+	case 1:
+		return gpr8[phys.Num], nil
+	case 2:
+		return gpr16[phys.Num], nil
+	case 4:
+		return gpr32[phys.Num], nil
+	}
+	return gprNames[phys.Num], nil
+}
+
+// memory 输出内存操作数
+// Intel风格为 dword [rbp-8] 或 dword ptr [rbp-8], AT&T风格为 -8(%rbp)
+// rip为真时没有寄存器的标签地址按RIP相对寻址: NASM靠default rel, MASM默认如此,
+// GAS写作msg(%rip)或[rip+msg]; 没有标签的常数地址仍是绝对地址
+func memory(addr *parser.MemoryAddr, d Dialect, table *types.RegTable, rip bool) (string, error) {
+	var base, index string
+	var err error
+	if addr.BaseReg != nil {
+		if base, err = regName(addr.BaseReg, table); err != nil {
+			return "", err
+		}
+	}
+	if addr.IndexReg != nil {
+		if index, err = regName(addr.IndexReg, table); err != nil {
+			return "", err
+		}
+	}
+	scale := addr.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	disp := addr.Displacement
+	rip = rip && base == "" && index == ""
+
+	if d == GAS {
+		text := addr.LabelRef
+		if disp != 0 || (text == "" && base == "" && index == "") {
+			if text != "" && disp > 0 {
+				text += "+"
+			}
+			text += strconv.FormatInt(disp, 10)
+		}
+		if rip && addr.LabelRef != "" {
+			return text + "(%rip)", nil
+		}
+		if base == "" && index == "" {
+			return text, nil
+		}
+		text += "("
+		if base != "" {
+			text += "%" + base
+		}
+		if index != "" {
+			text += ",%" + index + "," + strconv.Itoa(scale)
+		}
+		return text + ")", nil
+	}
+
+	parts := []string{}
+	if rip && addr.LabelRef != "" && d == GASIntel {
+		parts = append(parts, "rip")
+	}
+	if base != "" {
+		parts = append(parts, base)
+	}
+	if index != "" {
+		if scale != 1 {
+			index += "*" + strconv.Itoa(scale)
+		}
+		parts = append(parts, index)
+	}
+	if addr.LabelRef != "" {
+		parts = append(parts, addr.LabelRef)
+	}
+	text := strings.Join(parts, "+")
+	switch {
+	case disp > 0 && text != "":
+		text += "+" + strconv.FormatInt(disp, 10)
+	case disp != 0 || text == "":
+		text += strconv.FormatInt(disp, 10)
+	}
+	if rip && addr.LabelRef == "" && d == NASM {
+		text = "abs " + text
+	}
+	text = "[" + text + "]"
+	size := sizeName(addr.Length, d)
+	if size == "" {
+		return text, nil
+	}
+	if d == NASM {
+		return size + " " + text, nil
+	}
+	return size + " ptr " + text, nil
+}
+
+// sizeName 内存操作数的宽度关键字
+func sizeName(length int, d Dialect) string {
+	switch length {
+	case 1:
+		return "byte"
+	case 2:
+		return "word"
+	case 4:
+		return "dword"
+	case 8:
+		return "qword"
+	case 10:
+		if d == NASM {
+			return "tword"
+		}
+		return "tbyte"
+	case 16:
+		if d == NASM {
+			return "oword"
+		}
+		return "xmmword"
+	case 32:
+		if d == NASM {
+			return "yword"
+		}
+		return "ymmword"
+	case 64:
+		if d == NASM {
+			return "zword"
+		}
+		return "zmmword"
+	}
+	return ""
+}
+
+// suffix AT&T语法的宽度后缀, 取第一个通用寄存器或内存操作数的宽度
+func suffix(args []*parser.Value) string {
+	for _, arg := range args {
+		width := 0
+		switch arg.Type {
+		case parser.REG:
+			width = types.RegWidth(arg.Reg.Type)
+		case parser.ADDR:
+			width = arg.Addr.Length
+		}
+		switch width {
+		case 1:
+			return "b"
+		case 2:
+			return "w"
+		case 4:
+			return "l"
+		case 8:
+			return "q"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,680 @@
+package x86
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"CuteASM/utils"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Inst 反汇编得到的一条指令
+//
+// 名称和操作数采用parser.Instruction的表示, 内置指令与解析同一行CuteASM源码的结果一致
+// (LOAD、STORE的编码与MOV相同, 写作MOV); 条件跳转、置位和传送使用Intel的名称(ja、sete、cmova),
+// 其它指令使用instructions表中带大小后缀的名称, 操作数都是目标在前。
+// 寄存器是虚拟寄存器编号, rsp、rbp按名称引用; PC相对跳转的操作数是相对偏移,
+// 与DoASM的输入相同。
+type Inst struct {
+	parser.Instruction
+	Addr   int    // 指令在code中的偏移
+	Len    int    // 指令的字节数
+	Target int    // PC相对跳转和调用的目标偏移, 其它指令为-1
+	Text   string // CuteASM语法的文本
+}
+
+// Disassemble 反汇编code, mode为32时按32位模式解码, 其它值按64位模式
+// 无法解码的字节成为一条单字节的BB数据, 然后从下一个字节继续
+//
+// 内置指令按encodings表解码, 与DoASM使用同一张表; 表中没有的形式(如累加器的短形式)
+// 和其它通用整数指令按操作码的布局解码。浮点、SIMD和特权指令都输出为数据。
+func Disassemble(code []byte, mode int) []Inst {
+	if mode != 32 {
+		mode = 64
+	}
+	insts := []Inst{}
+	for pc := 0; pc < len(code); {
+		d := &disasm{code: code, start: pc, pc: pc, mode: mode, target: -1}
+		i, ok := d.decode()
+		if !ok || d.short || d.pc-pc > 15 {
+			i = &parser.Instruction{Instruction: "BB", Args: []*parser.Value{disNum(int64(code[pc]))}}
+			d.pc, d.target = pc+1, -1
+		}
+		in := Inst{Instruction: *i, Addr: pc, Len: d.pc - pc, Target: d.target}
+		in.Text = disText(&in.Instruction)
+		insts = append(insts, in)
+		pc = d.pc
+	}
+	return insts
+}
+
+// disasm 一条指令的解码状态
+type disasm struct {
+	code   []byte
+	start  int
+	pc     int // 下一个要读取的字节
+	mode   int
+	rex    byte
+	opsize bool // 0x66前缀
+	addr32 bool // 64位模式下的0x67前缀
+	rep    byte // 0xF2或0xF3前缀
+	short  bool // 指令超出了code的末尾
+	target int
+}
+
+// disRM ModRM的r/m部分
+type disRM struct {
+	reg  int // mem为假时的寄存器硬件编号
+	mem  bool
+	addr parser.MemoryAddr
+}
+
+// 算术指令的名称, 下标为操作码的3到5位或ModRM的reg字段
+var disALU = [8]string{"ADD", "OR", "ADC", "SBB", "AND", "SUB", "XOR", "CMP"}
+
+// 移位指令的名称, 下标为ModRM的reg字段
+var disShift = [8]string{"ROL", "ROR", "RCL", "RCR", "SHIFTL", "SHIFTR", "SAL", "SAR"}
+
+// Intel的条件码, 下标为操作码的低4位
+// Jcc、SETcc、CMOVcc使用intelMnemonics中的名称, 不用instructions表中Go汇编的写法(JHI、SETEQ、CMOVQHI)
+var disCond = [16]string{"O", "NO", "B", "AE", "E", "NE", "BE", "A", "S", "NS", "P", "NP", "L", "GE", "LE", "G"}
+
+// 没有操作数的指令, 名称与instructions表一致
+var disNoOperand = map[byte]string{
+	0x9E: "SAHF", 0x9F: "LAHF", 0xF5: "CMC", 0xF8: "CLC", 0xF9: "STC",
+	0xFA: "CLI", 0xFB: "STI", 0xFC: "CLD", 0xFD: "STD",
+}
+
+var disNoOperand0F = map[byte]string{
+	0x0B: "UD2", 0x31: "RDTSC", 0xA2: "CPUID",
+}
+
+// disEntry 反汇编表的一项
+type disEntry struct {
+	name types.Instruction
+	e    encoding
+}
+
+// disTable 按操作码索引的encodings表, formO、formOI的一项占8个操作码
+var disTable = func() map[string][]disEntry {
+	names := make([]string, 0, len(encodings))
+	for name := range encodings {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	t := map[string][]disEntry{}
+	for _, name := range names {
+		for _, e := range encodings[types.Instruction(name)] {
+			n := 1
+			if e.form == formO || e.form == formOI {
+				n = 8
+			}
+			for r := 0; r < n; r++ {
+				op := append([]byte(nil), e.opcode...)
+				op[len(op)-1] += byte(r)
+				t[string(op)] = append(t[string(op)], disEntry{types.Instruction(name), e})
+			}
+		}
+	}
+	return t
+}()
+
+// disVirt 硬件编号对应的虚拟寄存器编号, 由regTable反查, rsp、rbp为-1
+var disVirt = func() [16]int {
+	virt := [16]int{}
+	for n := range virt {
+		virt[n] = -1
+	}
+	for n, r := range regTable(64).Regs {
+		virt[r.Num] = n
+	}
+	return virt
+}()
+
+func (d *disasm) byte1() byte {
+	if d.pc >= len(d.code) {
+		d.short = true
+		return 0
+	}
+	b := d.code[d.pc]
+	d.pc++
+	return b
+}
+
+// imm 读取size字节的立即数并符号扩展, 64位操作数的立即数只有32位
+func (d *disasm) imm(size int) int64 {
+	if size == 8 {
+		size = 4
+	}
+	v := uint64(0)
+	for n := 0; n < size; n++ {
+		v |= uint64(d.byte1()) << (8 * n)
+	}
+	shift := 64 - 8*size
+	return int64(v<<shift) >> shift
+}
+
+// width 操作数大小
+func (d *disasm) width() int {
+	switch {
+	case d.rex&0x08 != 0:
+		return 8
+	case d.opsize:
+		return 2
+	}
+	return 4
+}
+
+// stack 栈操作的宽度
+func (d *disasm) stack() int {
+	if d.opsize {
+		return 2
+	}
+	return d.mode / 8
+}
+
+func (d *disasm) op(name string, args ...*parser.Value) (*parser.Instruction, bool) {
+	return &parser.Instruction{Instruction: types.Instruction(name), Args: args}, true
+}
+
+// regOf 硬件编号为num的寄存器
+// 没有REX前缀时8位寄存器4到7是ah、ch、dh、bh, 它们没有虚拟编号, 按名称表示
+func (d *disasm) regOf(num, width int) *parser.Reg {
+	switch {
+	case width == 1 && d.rex == 0 && num >= 4 && num < 8:
+		return &parser.Reg{Name: [...]string{"ah", "ch", "dh", "bh"}[num-4], Type: regTypes[width]}
+	case disVirt[num] < 0:
+		return &parser.Reg{Name: gprNames[num][1:], Type: regTypes[width]}
+	}
+	return &parser.Reg{Num: disVirt[num], Type: regTypes[width]}
+}
+
+func (d *disasm) reg(num, width int) *parser.Value {
+	return &parser.Value{Type: parser.REG, Reg: d.regOf(num, width)}
+}
+
+// modrm 解码ModRM、SIB和偏移, 返回reg字段(含REX.R)和r/m部分
+func (d *disasm) modrm() (int, disRM) {
+	b := d.byte1()
+	mod, m := b>>6, int(b&7)
+	reg := int(b>>3&7) | int(d.rex>>2&1)<<3
+	if mod == 3 {
+		return reg, disRM{reg: m | int(d.rex&1)<<3}
+	}
+	rm := disRM{mem: true, addr: parser.MemoryAddr{Scale: 1}}
+	asize, base := d.mode/8, -1
+	if d.addr32 {
+		asize = 4
+	}
+	switch {
+	case m == 4:
+		sib := d.byte1()
+		if index := int(sib>>3&7) | int(d.rex>>1&1)<<3; index != 4 {
+			rm.addr.IndexReg = d.regOf(index, asize)
+			rm.addr.Scale = 1 << (sib >> 6)
+		}
+		if sib&7 == 5 && mod == 0 {
+			rm.addr.Displacement = d.imm(4)
+		} else {
+			base = int(sib&7) | int(d.rex&1)<<3
+		}
+	case m == 5 && mod == 0:
+		rm.addr.Displacement = d.imm(4)
+		if d.mode == 64 && !d.addr32 {
+			// RIP相对寻址
+			rm.addr.BaseReg = &parser.Reg{Name: "ip", Type: types.Reg64}
+		}
+	default:
+		base = m | int(d.rex&1)<<3
+	}
+	if base >= 0 {
+		rm.addr.BaseReg = d.regOf(base, asize)
+	}
+	switch mod {
+	case 1:
+		rm.addr.Displacement += d.imm(1)
+	case 2:
+		rm.addr.Displacement += d.imm(4)
+	}
+	return reg, rm
+}
+
+// rm r/m部分作为width字节的操作数
+func (d *disasm) rm(rm disRM, width int) *parser.Value {
+	if !rm.mem {
+		return d.reg(rm.reg, width)
+	}
+	addr := rm.addr
+	addr.Length = width
+	return &parser.Value{Type: parser.ADDR, Addr: &addr}
+}
+
+// rel PC相对的跳转和调用
+func (d *disasm) rel(name string, size int) (*parser.Instruction, bool) {
+	rel := d.imm(size)
+	d.target = d.pc + int(rel)
+	return d.op(name, disNum(rel))
+}
+
+// jcc 条件跳转, JE和JL是内置的JMPZ和JMPN
+func (d *disasm) jcc(cc byte, size int) (*parser.Instruction, bool) {
+	switch cc {
+	case 0x4:
+		return d.rel("JMPZ", size)
+	case 0xC:
+		return d.rel("JMPN", size)
+	}
+	return d.rel("J"+disCond[cc], size)
+}
+
+func (d *disasm) decode() (*parser.Instruction, bool) {
+	b := d.byte1()
+	for !d.short && d.pc-d.start <= 15 {
+		switch {
+		case b == 0x66:
+			d.opsize = true
+		case b == 0x67 && d.mode == 64:
+			d.addr32 = true
+		case b == 0xF2 || b == 0xF3:
+			d.rep = b
+		case d.mode == 64 && b&0xF0 == 0x40:
+			// REX必须紧挨着操作码
+			d.rex = b
+			b = d.byte1()
+			if b == 0x66 || b == 0x67 || b == 0xF2 || b == 0xF3 || b&0xF0 == 0x40 {
+				return nil, false
+			}
+			return d.opcode(b)
+		default:
+			return d.opcode(b)
+		}
+		b = d.byte1()
+	}
+	return nil, false
+}
+
+// table 按encodings表解码内置指令, op是已经读取的操作码
+// 没有符合的项时退回到操作码之后, 由opcode按布局解码
+func (d *disasm) table(op []byte) (*parser.Instruction, bool) {
+	rows := disTable[string(op)]
+	if len(rows) == 0 || d.rep != 0 {
+		return nil, false
+	}
+	pc := d.pc
+	reg, rm := 0, disRM{}
+	switch rows[0].e.form {
+	case formMR, formRM, formM, formMI, formMC, formRMI:
+		reg, rm = d.modrm()
+	}
+	for _, row := range rows {
+		e := row.e
+		w := d.width()
+		switch {
+		case e.word:
+			w = d.stack()
+		case e.ops[0]&rm8 != 0 && e.ops[0]&rmW == 0:
+			w = 1
+		}
+		if e.ops[0]&(rm8|rmW) != 0 && e.ops[0]&(regKinds[w]|memKinds[w]) == 0 {
+			continue
+		}
+		switch e.form {
+		case formM, formMI, formMC:
+			if reg&7 != int(e.digit) {
+				continue
+			}
+		case formRMI:
+			if rm.mem || rm.reg != reg {
+				continue
+			}
+		}
+		return d.operands(row.name, e, op[len(op)-1], reg, rm, w)
+	}
+	d.pc = pc
+	return nil, false
+}
+
+// operands 按编码表一项的形式读取操作数, w是操作数的宽度
+func (d *disasm) operands(name types.Instruction, e encoding, op byte, reg int, rm disRM, w int) (*parser.Instruction, bool) {
+	i := &parser.Instruction{Instruction: name}
+	switch e.form {
+	case formMR:
+		i.Args = []*parser.Value{d.rm(rm, w), d.reg(reg, w)}
+	case formRM:
+		i.Args = []*parser.Value{d.reg(reg, w), d.rm(rm, w)}
+	case formM:
+		i.Args = []*parser.Value{d.rm(rm, w)}
+	case formMI:
+		i.Args = []*parser.Value{d.rm(rm, w), d.immOf(e.ops[1], w)}
+	case formMC:
+		i.Args = []*parser.Value{d.rm(rm, w), d.reg(1, 1)}
+	case formRMI:
+		i.Args = []*parser.Value{d.reg(reg, w), d.immOf(e.ops[1], w)}
+	case formO, formOI:
+		i.Args = []*parser.Value{d.reg(int(op&7)|int(d.rex&1)<<3, w)}
+		if e.form == formOI {
+			i.Args = append(i.Args, d.immOf(e.ops[1], w))
+		}
+	case formI:
+		i.Args = []*parser.Value{d.immOf(e.ops[0], w)}
+	case formD:
+		return d.rel(string(name), 4)
+	}
+	return i, true
+}
+
+// immOf 读取编码表中类型为k的立即数, 与编码时的字节数相同
+func (d *disasm) immOf(k types.Operand, w int) *parser.Value {
+	switch size := immSize(k, w); {
+	case size == 8:
+		// 唯一带64位立即数的形式
+		lo := uint64(uint32(d.imm(4)))
+		hi := uint64(uint32(d.imm(4)))
+		return disNum(int64(hi<<32 | lo))
+	case size == 2 && w != 2:
+		// RET n的字节数
+		return disNum(d.imm(2) & 0xffff)
+	default:
+		return disNum(d.imm(size))
+	}
+}
+
+func (d *disasm) opcode(op byte) (*parser.Instruction, bool) {
+	if op == 0x0F {
+		op = d.byte1()
+		if i, ok := d.table([]byte{0x0F, op}); ok {
+			return i, ok
+		}
+		return d.opcode0F(op)
+	}
+	if i, ok := d.table([]byte{op}); ok {
+		return i, ok
+	}
+	if d.rep != 0 && !(op == 0x90 && d.rep == 0xF3) {
+		// 不支持串操作指令
+		return nil, false
+	}
+	size := d.width()
+	sfx := disSuffix(size)
+	switch {
+	case op < 0x40 && op&7 < 6:
+		// ADD、OR、ADC、SBB、AND、SUB、XOR、CMP
+		if op&1 == 0 {
+			size = 1
+		}
+		name := disALUName(int(op>>3), size)
+		switch op & 7 {
+		case 0, 1:
+			reg, rm := d.modrm()
+			return d.op(name, d.rm(rm, size), d.reg(reg, size))
+		case 2, 3:
+			reg, rm := d.modrm()
+			return d.op(name, d.reg(reg, size), d.rm(rm, size))
+		}
+		return d.op(name, d.reg(0, size), disNum(d.imm(size)))
+	case d.mode == 32 && op >= 0x40 && op <= 0x4F:
+		name := "INC"
+		if op >= 0x48 {
+			name = "DEC"
+		}
+		return d.op(name+sfx, d.reg(int(op&7), size))
+	case op == 0x63 && d.mode == 64:
+		reg, rm := d.modrm()
+		return d.op("MOVLQSX", d.reg(reg, size), d.rm(rm, 4))
+	case op == 0x69 || op == 0x6B:
+		reg, rm := d.modrm()
+		immSize := size
+		if op == 0x6B {
+			immSize = 1
+		}
+		return d.op("IMUL3"+sfx, d.reg(reg, size), d.rm(rm, size), disNum(d.imm(immSize)))
+	case op >= 0x70 && op <= 0x7F:
+		return d.jcc(op&0xF, 1)
+	case op == 0x80 || op == 0x81 || op == 0x83:
+		reg, rm := d.modrm()
+		immSize := size
+		if op == 0x80 {
+			size, immSize = 1, 1
+		} else if op == 0x83 {
+			immSize = 1
+		}
+		dst := d.rm(rm, size)
+		return d.op(disALUName(reg&7, size), dst, disNum(d.imm(immSize)))
+	case op == 0x84 || op == 0x85:
+		if op == 0x84 {
+			size = 1
+		}
+		reg, rm := d.modrm()
+		return d.op("TEST"+disSuffix(size), d.rm(rm, size), d.reg(reg, size))
+	case op == 0x8D:
+		reg, rm := d.modrm()
+		if !rm.mem {
+			return nil, false
+		}
+		return d.op("LEA"+sfx, d.reg(reg, size), d.rm(rm, size))
+	case op == 0x90 && d.rex&1 == 0:
+		if d.rep == 0xF3 {
+			return d.op("PAUSE")
+		}
+		return d.op("NOP")
+	case op >= 0x91 && op <= 0x97 || op == 0x90:
+		return d.op("XCHG", d.reg(0, size), d.reg(int(op&7)|int(d.rex&1)<<3, size))
+	case op == 0x98:
+		return d.op(map[int]string{2: "CBW", 4: "CWDE", 8: "CDQE"}[size])
+	case op == 0x99:
+		return d.op(map[int]string{2: "CWD", 4: "CDQ", 8: "CQO"}[size])
+	case op == 0x9C || op == 0x9D:
+		name := "PUSHF"
+		if op == 0x9D {
+			name = "POPF"
+		}
+		return d.op(name + disSuffix(d.stack()))
+	case op == 0xA8 || op == 0xA9:
+		if op == 0xA8 {
+			size = 1
+		}
+		return d.op("TEST"+disSuffix(size), d.reg(0, size), disNum(d.imm(size)))
+	case op == 0xC0 || op == 0xC1 || op >= 0xD0 && op <= 0xD3:
+		if op&1 == 0 {
+			size = 1
+		}
+		// SHIFTL、SHIFTR在编码表中, 这里是其它移位指令
+		reg, rm := d.modrm()
+		name := disShift[reg&7] + disSuffix(size)
+		dst := d.rm(rm, size)
+		switch op {
+		case 0xC0, 0xC1:
+			return d.op(name, dst, disNum(d.imm(1)&0xff))
+		case 0xD0, 0xD1:
+			return d.op(name, dst, disNum(1))
+		}
+		return d.op(name, dst, d.reg(1, 1))
+	case op == 0xC9:
+		return d.op("LEAVE" + disSuffix(d.stack()))
+	case op == 0xCC:
+		return d.op("INT", disNum(3))
+	case op == 0xCD:
+		return d.op("INT", disNum(d.imm(1)&0xff))
+	case op == 0xEB:
+		return d.rel("JMP", 1)
+	case op == 0xF6 || op == 0xF7:
+		if op == 0xF6 {
+			size = 1
+		}
+		return d.group3(size)
+	case op == 0xFE || op == 0xFF:
+		if op == 0xFE {
+			size = 1
+		}
+		return d.group5(size)
+	}
+	if name, ok := disNoOperand[op]; ok {
+		return d.op(name)
+	}
+	return nil, false
+}
+
+// group3 0xF6、0xF7组中不在编码表里的TEST、IMUL、IDIV
+func (d *disasm) group3(size int) (*parser.Instruction, bool) {
+	reg, rm := d.modrm()
+	src := d.rm(rm, size)
+	sfx := disSuffix(size)
+	switch reg & 7 {
+	case 0, 1:
+		return d.op("TEST"+sfx, src, disNum(d.imm(size)))
+	case 5:
+		return d.op("IMUL"+sfx, src)
+	case 7:
+		return d.op("IDIV"+sfx, src)
+	}
+	return nil, false
+}
+
+// group5 0xFE、0xFF组中不在编码表里的INC、DEC
+func (d *disasm) group5(size int) (*parser.Instruction, bool) {
+	reg, rm := d.modrm()
+	switch reg & 7 {
+	case 0:
+		return d.op("INC"+disSuffix(size), d.rm(rm, size))
+	case 1:
+		return d.op("DEC"+disSuffix(size), d.rm(rm, size))
+	}
+	return nil, false
+}
+
+// opcode0F 0x0F开头的双字节操作码
+func (d *disasm) opcode0F(op byte) (*parser.Instruction, bool) {
+	if d.rep != 0 {
+		return nil, false
+	}
+	size := d.width()
+	sfx := disSuffix(size)
+	switch {
+	case op == 0x1F:
+		reg, rm := d.modrm()
+		if reg&7 != 0 {
+			return nil, false
+		}
+		return d.op("NOP"+sfx, d.rm(rm, size))
+	case op >= 0x40 && op <= 0x4F:
+		reg, rm := d.modrm()
+		return d.op("CMOV"+disCond[op&0xF], d.reg(reg, size), d.rm(rm, size))
+	case op >= 0x80 && op <= 0x8F:
+		return d.jcc(op&0xF, 4)
+	case op >= 0x90 && op <= 0x9F:
+		_, rm := d.modrm()
+		return d.op("SET"+disCond[op&0xF], d.rm(rm, 1))
+	case op == 0xA3 || op == 0xAB || op == 0xB3 || op == 0xBB:
+		reg, rm := d.modrm()
+		name := map[byte]string{0xA3: "BT", 0xAB: "BTS", 0xB3: "BTR", 0xBB: "BTC"}[op]
+		return d.op(name+sfx, d.rm(rm, size), d.reg(reg, size))
+	case op == 0xB6 || op == 0xB7 || op == 0xBE || op == 0xBF:
+		reg, rm := d.modrm()
+		from, ext := 1+int(op&1), "ZX"
+		if op >= 0xBE {
+			ext = "SX"
+		}
+		return d.op("MOV"+disSuffix(from)+sfx+ext, d.reg(reg, size), d.rm(rm, from))
+	case op == 0xBC || op == 0xBD:
+		reg, rm := d.modrm()
+		name := "BSF"
+		if op == 0xBD {
+			name = "BSR"
+		}
+		return d.op(name+sfx, d.reg(reg, size), d.rm(rm, size))
+	case op >= 0xC8 && op <= 0xCF:
+		return d.op("BSWAP"+sfx, d.reg(int(op&7)|int(d.rex&1)<<3, size))
+	}
+	if name, ok := disNoOperand0F[op]; ok {
+		return d.op(name)
+	}
+	return nil, false
+}
+
+// disALUName 内置指令没有ADC和SBB, 它们使用instructions表中带大小后缀的名称
+func disALUName(kind, size int) string {
+	if kind == 2 || kind == 3 {
+		return disALU[kind] + disSuffix(size)
+	}
+	return disALU[kind]
+}
+
+// disSuffix instructions表中的大小后缀, 1、2、4、8字节依次为B、W、L、Q
+func disSuffix(size int) string {
+	return string("BWLQ"[bits.Len(uint(size))-1])
+}
+
+func disNum(n int64) *parser.Value {
+	return &parser.Value{Type: parser.NUMBER, Num: n}
+}
+
+// disText 指令的CuteASM文本
+func disText(i *parser.Instruction) string {
+	if i.Instruction == "BB" {
+		return fmt.Sprintf("BB 0x%02x", i.Args[0].Num)
+	}
+	args := make([]string, len(i.Args))
+	for n, arg := range i.Args {
+		switch arg.Type {
+		case parser.REG:
+			args[n] = disReg(arg.Reg)
+		case parser.ADDR:
+			args[n] = disMem(arg.Addr)
+		default:
+			args[n] = disNumText(arg.Num)
+		}
+	}
+	text := strings.ToLower(string(i.Instruction))
+	if len(args) != 0 {
+		text += " " + strings.Join(args, ", ")
+	}
+	return text
+}
+
+// disReg 寄存器的文本, 宽度前缀l、n、e、r分别表示8、16、32、64位
+func disReg(r *parser.Reg) string {
+	prefix := map[int]string{1: "l", 2: "n", 4: "e", 8: "r"}[types.RegWidth(r.Type)]
+	if r.Name != "" {
+		return "%" + prefix + r.Name
+	}
+	return "%" + prefix + strconv.Itoa(r.Num)
+}
+
+// disMem 内存操作数的文本, 如 QW[%rbp+%r1*8-16]
+func disMem(addr *parser.MemoryAddr) string {
+	parts := ""
+	if addr.BaseReg != nil {
+		parts = disReg(addr.BaseReg)
+	}
+	if addr.IndexReg != nil {
+		if parts != "" {
+			parts += "+"
+		}
+		parts += disReg(addr.IndexReg)
+		if addr.Scale != 1 {
+			parts += "*" + strconv.Itoa(addr.Scale)
+		}
+	}
+	if disp := addr.Displacement; parts == "" || disp != 0 {
+		text := disNumText(disp)
+		if parts != "" && disp > 0 {
+			text = "+" + text
+		}
+		parts += text
+	}
+	return utils.GetLengthName(addr.Length) + "[" + parts + "]"
+}
+
+// disNumText 小的数用十进制, 其它用十六进制
+func disNumText(n int64) string {
+	switch {
+	case n > -256 && n < 256:
+		return strconv.FormatInt(n, 10)
+	case n < 0:
+		return "-0x" + strconv.FormatUint(-uint64(n), 16)
+	}
+	return "0x" + strconv.FormatUint(uint64(n), 16)
+}
@@ -0,0 +1,146 @@
+package x86
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// 汇编、反汇编、再汇编得到相同的字节
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+	}{
+		{64, "mov %r0, 5"},
+		{64, "mov %e10, 1"},
+		{64, "mov %r3, 0x123456789"},
+		{64, "mov %r3, -1"},
+		{64, "mov %e3, 0xffffffff"},
+		{64, "mov %l4, 3"},
+		{64, "mov %n2, 0x1234"},
+		{64, "mov %l0, BB[%r2]"},
+		{64, "mov BB[%r2+1], %l11"},
+		{64, "mov QW[%r1+%r9*8-16], %r12"},
+		{64, "mov %r0, QW[%rsp+8]"},
+		{64, "mov DW[%rbp-4], 7"},
+		{64, "mov DW[%e1+8], %e2"},
+		{64, "mov BB[%r0], 0xff"},
+		{64, "add %r0, %r8"},
+		{64, "add %r5, 100"},
+		{64, "add %r5, 1000"},
+		{64, "add DW[%r1+%r2*4+0x100], %e4"},
+		{64, "add QW[%r13], 1"},
+		{64, "add QW[%r10], %r11"},
+		{64, "or %l0, 1"},
+		{64, "and %e1, 0xfe"},
+		{64, "sub %r2, QW[%r3]"},
+		{64, "xor %n0, %n1"},
+		{64, "cmp %r3, %r10"},
+		{64, "cmp BB[%r0], 3"},
+		{64, "mul %e1"},
+		{64, "mul %r9, 7"},
+		{64, "mul %e0, 1000"},
+		{64, "mul %r1, QW[%r2]"},
+		{64, "div %r3"},
+		{64, "neg BB[%r0]"},
+		{64, "not %r12"},
+		{64, "shiftl %e3"},
+		{64, "shiftl %r3, 4"},
+		{64, "shiftr %l1, %l1"},
+		{64, "shiftr QW[%r0], %l1"},
+		{64, "xchg %r11, QW[%r0]"},
+		{64, "xchg %l0, %l1"},
+		{64, "push %r9"},
+		{64, "push QW[%r1]"},
+		{64, "push 1000"},
+		{64, "push -1"},
+		{64, "pop %r10"},
+		{64, "pop QW[%r1]"},
+		{64, "call %r0"},
+		{64, "call QW[%r0+8]"},
+		{64, "call 100"},
+		{64, "jmp %r13"},
+		{64, "jmp -5"},
+		{64, "jmpz 16"},
+		{64, "jmpn -16"},
+		{64, "ret"},
+		{64, "ret 16"},
+		{64, "halt"},
+		{64, "syscall"},
+		{32, "mov %e0, 5"},
+		{32, "mov %l3, 1"},
+		{32, "add DW[%e1+8], %e2"},
+		{32, "mov DW[0x1000], 1"},
+		{32, "mov %e4, DW[%esp+%e1*2]"},
+		{32, "push %e0"},
+		{32, "push DW[%e1]"},
+		{32, "pop %e5"},
+		{32, "call %e0"},
+		{32, "shiftr %e2, 3"},
+		{32, "mul %e3, %e1"},
+	}
+	for _, tt := range tests {
+		code, err := DoASM(parseInst(t, tt.bits, tt.src), NewMode(tt.bits))
+		if err != nil {
+			t.Errorf("%d: %s: %v", tt.bits, tt.src, err)
+			continue
+		}
+		insts := Disassemble(code, tt.bits)
+		if len(insts) != 1 || insts[0].Len != len(code) {
+			t.Errorf("%d: %s = %x: disassembled as %+v", tt.bits, tt.src, code, insts)
+			continue
+		}
+		again, err := DoASM(parseInst(t, tt.bits, insts[0].Text), NewMode(tt.bits))
+		if err != nil || !bytes.Equal(again, code) {
+			t.Errorf("%d: %s = %x, %q = %x %v", tt.bits, tt.src, code, insts[0].Text, again, err)
+		}
+	}
+}
+
+// 内置指令之外的指令和编码器不使用的形式按操作码的布局解码
+func TestDisassembleOther(t *testing.T) {
+	tests := []struct {
+		bits int
+		code string
+		want string
+	}{
+		{64, "4805e8030000", "add %r0, 0x3e8"},       // 累加器的短形式
+		{64, "4887c8", "xchg %r0, %r1"},              // 两个寄存器的XCHG按MR形式
+		{64, "4891", "xchg %r0, %r1"},                // 与rax交换的短形式
+		{64, "8bc1", "mov %e0, %e1"},                 // RM形式的MOV
+		{64, "4811c8", "adcq %r0, %r1"},              // ADC
+		{64, "48d3c0", "rolq %r0, %l1"},              // 其它移位指令
+		{64, "48f7f9", "idivq %r1"},                  // IDIV
+		{64, "48ffc0", "incq %r0"},                   // INC
+		{64, "0f94c0", "sete %l0"},                   // SETcc
+		{64, "0f92c0", "setb %l0"},                   // 无符号的SETcc
+		{64, "480f47c1", "cmova %r0, %r1"},           // CMOVcc不带大小后缀
+		{64, "0f4fc1", "cmovg %e0, %e1"},             // 32位的CMOVcc
+		{64, "7405", "jmpz 5"},                       // 8位偏移的JE
+		{64, "7705", "ja 5"},                         // 无符号的Jcc
+		{64, "0f8e00010000", "jle 0x100"},            // 32位偏移的Jcc
+		{64, "488d0500000000", "leaq %r0, QW[%rip]"}, // RIP相对的LEA
+		{64, "0fa2", "cpuid"},
+		{64, "f3a4", "BB 0xf3"}, // 串操作
+	}
+	for _, tt := range tests {
+		code, _ := hex.DecodeString(tt.code)
+		insts := Disassemble(code, tt.bits)
+		if len(insts) == 0 || insts[0].Text != tt.want {
+			t.Errorf("%d: %s: got %+v, want %q", tt.bits, tt.code, insts, tt.want)
+		}
+	}
+}
+
+// 条件跳转、置位和传送的名称都能作为源码解析
+func TestDisassembleCondNames(t *testing.T) {
+	for cc := byte(0); cc < 16; cc++ {
+		for _, code := range [][]byte{{0x70 + cc, 0}, {0x0F, 0x90 + cc, 0xC0}, {0x48, 0x0F, 0x40 + cc, 0xC1}} {
+			in := Disassemble(code, 64)[0]
+			if i := parseInst(t, 64, in.Text); i.Instruction != in.Instruction.Instruction {
+				t.Errorf("%x: %q parsed as %s, want %s", code, in.Text, i.Instruction, in.Instruction.Instruction)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package emu
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+func (c *CPU) flag(f uint64) bool {
+	return c.Flags&f != 0
+}
+
+func (c *CPU) setFlag(f uint64, on bool) {
+	if on {
+		c.Flags |= f
+	} else {
+		c.Flags &^= f
+	}
+}
+
+// result 按结果设置ZF、SF和PF
+func (c *CPU) result(r uint64, size int) {
+	c.setFlag(FlagZF, r&mask(size) == 0)
+	c.setFlag(FlagSF, r&sign(size) != 0)
+	c.setFlag(FlagPF, bits.OnesCount8(uint8(r))%2 == 0)
+}
+
+// cond 条件码cc(Jcc、SETcc、CMOVcc操作码的低4位)是否成立
+func (c *CPU) cond(cc byte) bool {
+	var ok bool
+	switch cc >> 1 {
+	case 0: // O
+		ok = c.flag(FlagOF)
+	case 1: // B
+		ok = c.flag(FlagCF)
+	case 2: // E
+		ok = c.flag(FlagZF)
+	case 3: // BE
+		ok = c.flag(FlagCF) || c.flag(FlagZF)
+	case 4: // S
+		ok = c.flag(FlagSF)
+	case 5: // P
+		ok = c.flag(FlagPF)
+	case 6: // L
+		ok = c.flag(FlagSF) != c.flag(FlagOF)
+	case 7: // LE
+		ok = c.flag(FlagZF) || c.flag(FlagSF) != c.flag(FlagOF)
+	}
+	return ok != (cc&1 != 0)
+}
+
+// alu 操作码0x00到0x3F和0x80组的运算, kind依次是ADD、OR、ADC、SBB、AND、SUB、XOR、CMP
+// 返回结果, CMP的结果不写回
+func (c *CPU) alu(kind int, a, b uint64, size int) uint64 {
+	a, b = a&mask(size), b&mask(size)
+	carry := uint64(0)
+	if (kind == 2 || kind == 3) && c.flag(FlagCF) {
+		carry = 1
+	}
+	switch kind {
+	case 0, 2:
+		return c.add(a, b, carry, size)
+	case 3, 5, 7:
+		return c.sub(a, b, carry, size)
+	case 1:
+		return c.logic(a|b, size)
+	case 4:
+		return c.logic(a&b, size)
+	}
+	return c.logic(a^b, size)
+}
+
+func (c *CPU) add(a, b, carry uint64, size int) uint64 {
+	sum, out := bits.Add64(a, b, carry)
+	r := sum & mask(size)
+	if size < 8 {
+		out = sum >> (8 * size)
+	}
+	c.setFlag(FlagCF, out != 0)
+	c.setFlag(FlagOF, (a^r)&(b^r)&sign(size) != 0)
+	c.result(r, size)
+	return r
+}
+
+func (c *CPU) sub(a, b, borrow uint64, size int) uint64 {
+	diff, out := bits.Sub64(a, b, borrow)
+	r := diff & mask(size)
+	c.setFlag(FlagCF, out != 0)
+	c.setFlag(FlagOF, (a^b)&(a^r)&sign(size) != 0)
+	c.result(r, size)
+	return r
+}
+
+func (c *CPU) logic(r uint64, size int) uint64 {
+	c.Flags &^= FlagCF | FlagOF
+	c.result(r, size)
+	return r & mask(size)
+}
+
+// incDec INC和DEC, 不改变CF
+func (c *CPU) incDec(a uint64, dec bool, size int) uint64 {
+	cf := c.flag(FlagCF)
+	var r uint64
+	if dec {
+		r = c.sub(a&mask(size), 1, 0, size)
+	} else {
+		r = c.add(a&mask(size), 1, 0, size)
+	}
+	c.setFlag(FlagCF, cf)
+	return r
+}
+
+// shift 0xC0、0xD0、0xD2组的移位, digit为ModRM的reg字段
+func (c *CPU) shift(digit int, a, count uint64, size int) uint64 {
+	if size == 8 {
+		count &= 63
+	} else {
+		count &= 31
+	}
+	a &= mask(size)
+	if count == 0 {
+		return a
+	}
+	n := uint64(8 * size)
+	var r uint64
+	switch digit {
+	case 0: // ROL
+		k := count % n
+		r = (a<<k | a>>(n-k)) & mask(size)
+		c.setFlag(FlagCF, r&1 != 0)
+		c.setFlag(FlagOF, (r&sign(size) != 0) != (r&1 != 0))
+		return r
+	case 1: // ROR
+		k := count % n
+		r = (a>>k | a<<(n-k)) & mask(size)
+		c.setFlag(FlagCF, r&sign(size) != 0)
+		c.setFlag(FlagOF, (r^r<<1)&sign(size) != 0)
+		return r
+	case 4, 6: // SHL, SAL
+		r = a << count & mask(size)
+		c.setFlag(FlagCF, count <= n && a>>(n-count)&1 != 0)
+		c.setFlag(FlagOF, (r&sign(size) != 0) != c.flag(FlagCF))
+	case 5: // SHR
+		r = a >> count
+		c.setFlag(FlagCF, a>>(count-1)&1 != 0)
+		c.setFlag(FlagOF, a&sign(size) != 0)
+	case 7: // SAR
+		s := sext(a, size)
+		r = uint64(s>>count) & mask(size)
+		c.setFlag(FlagCF, s>>(count-1)&1 != 0)
+		c.setFlag(FlagOF, false)
+	default:
+		c.unsupported("RCL/RCR")
+	}
+	c.result(r, size)
+	return r
+}
+
+// imul 两个和三个操作数的IMUL, 结果截断为size字节
+func (c *CPU) imul(a, b uint64, size int) uint64 {
+	x, y := sext(a, size), sext(b, size)
+	var overflow bool
+	r := uint64(x * y)
+	if size == 8 {
+		hi, lo := bits.Mul64(uint64(x), uint64(y))
+		if x < 0 {
+			hi -= uint64(y)
+		}
+		if y < 0 {
+			hi -= uint64(x)
+		}
+		overflow = hi != uint64(int64(lo)>>63)
+	} else {
+		overflow = sext(r, size) != x*y
+	}
+	r &= mask(size)
+	c.setFlag(FlagCF, overflow)
+	c.setFlag(FlagOF, overflow)
+	c.result(r, size)
+	return r
+}
+
+// mul 单操作数的MUL和IMUL, 乘积放在rDX:rAX(8位时为AX)
+func (c *CPU) mul(src uint64, signed bool, size int) {
+	a := c.getReg(RAX, size)
+	var hi, lo uint64
+	switch {
+	case size == 8 && signed:
+		x, y := int64(a), int64(src)
+		hi, lo = bits.Mul64(a, src)
+		if x < 0 {
+			hi -= uint64(y)
+		}
+		if y < 0 {
+			hi -= uint64(x)
+		}
+	case size == 8:
+		hi, lo = bits.Mul64(a, src)
+	default:
+		var p uint64
+		if signed {
+			p = uint64(sext(a, size) * sext(src, size))
+		} else {
+			p = (a & mask(size)) * (src & mask(size))
+		}
+		lo, hi = p&mask(size), p>>(8*size)&mask(size)
+	}
+	var overflow bool
+	if signed {
+		overflow = sext(hi, size) != sext(lo, size)>>63
+	} else {
+		overflow = hi != 0
+	}
+	if size == 1 {
+		c.setReg(RAX, 2, hi<<8|lo)
+	} else {
+		c.setReg(RAX, size, lo)
+		c.setReg(RDX, size, hi)
+	}
+	c.setFlag(FlagCF, overflow)
+	c.setFlag(FlagOF, overflow)
+}
+
+// div 单操作数的DIV和IDIV, 被除数是rDX:rAX(8位时为AX)
+// 除数为0或商超出范围时是除法错误
+func (c *CPU) div(src uint64, signed bool, size int) {
+	src &= mask(size)
+	if src == 0 {
+		panic(fault("divide error: division by zero"))
+	}
+	var hi, lo uint64
+	if size == 1 {
+		ax := c.getReg(RAX, 2)
+		hi, lo = ax>>8, ax&0xff
+	} else {
+		hi, lo = c.getReg(RDX, size), c.getReg(RAX, size)
+	}
+	// 用大整数统一处理各种宽度
+	n := new(big.Int).Lsh(new(big.Int).SetUint64(hi), uint(8*size))
+	n.Or(n, new(big.Int).SetUint64(lo))
+	d := new(big.Int).SetUint64(src)
+	if signed {
+		n = signedBig(n, 16*size)
+		d = signedBig(d, 8*size)
+	}
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	var qmin, qmax *big.Int
+	if signed {
+		qmax = new(big.Int).Lsh(big.NewInt(1), uint(8*size-1))
+		qmin = new(big.Int).Neg(qmax)
+		qmax.Sub(qmax, big.NewInt(1))
+	} else {
+		qmin = new(big.Int)
+		qmax = new(big.Int).SetUint64(mask(size))
+	}
+	if q.Cmp(qmin) < 0 || q.Cmp(qmax) > 0 {
+		panic(fault("divide error: quotient overflow"))
+	}
+	qv, rv := uint64(q.Int64())&mask(size), uint64(r.Int64())&mask(size)
+	if q.IsUint64() {
+		qv = q.Uint64() & mask(size)
+	}
+	if r.IsUint64() {
+		rv = r.Uint64() & mask(size)
+	}
+	if size == 1 {
+		c.setReg(RAX, 2, rv<<8|qv)
+	} else {
+		c.setReg(RAX, size, qv)
+		c.setReg(RDX, size, rv)
+	}
+}
+
+// signedBig 把n位的无符号数解释为有符号数
+func signedBig(v *big.Int, n int) *big.Int {
+	if v.Bit(n-1) == 0 {
+		return v
+	}
+	return new(big.Int).Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(n)))
+}
@@ -0,0 +1,161 @@
+package emu
+
+import "fmt"
+
+// operand ModRM的r/m部分: 寄存器或内存地址
+type operand struct {
+	mem   bool
+	reg   int // mem为假时的寄存器编号
+	base  int // 基址寄存器, -1表示没有
+	index int // 变址寄存器, -1表示没有
+	scale uint64
+	disp  int64
+	rip   bool // RIP相对寻址
+}
+
+func regOperand(n int) operand {
+	return operand{reg: n}
+}
+
+// fetch 读取指令中的下一个size字节
+func (c *CPU) fetch(size int) uint64 {
+	v := c.read(c.next, size)
+	c.next += uint64(size)
+	return v
+}
+
+// imm 读取size字节的立即数并符号扩展, 64位操作数的立即数也只有32位
+func (c *CPU) imm(size int) uint64 {
+	if size == 8 {
+		size = 4
+	}
+	return uint64(sext(c.fetch(size), size))
+}
+
+// width 当前指令的操作数大小
+func (c *CPU) width() int {
+	switch {
+	case c.rex&0x08 != 0:
+		return 8
+	case c.opsize:
+		return 2
+	}
+	return 4
+}
+
+// modrm 解码ModRM、SIB和偏移, 返回reg字段(含REX.R)和r/m操作数
+func (c *CPU) modrm() (int, operand) {
+	b := byte(c.fetch(1))
+	mod, rm := b>>6, int(b&7)
+	reg := int(b>>3&7) | int(c.rex>>2&1)<<3
+	if mod == 3 {
+		return reg, regOperand(rm | int(c.rex&1)<<3)
+	}
+	op := operand{mem: true, base: -1, index: -1, scale: 1}
+	switch {
+	case rm == 4:
+		sib := byte(c.fetch(1))
+		op.scale = 1 << (sib >> 6)
+		if index := int(sib>>3&7) | int(c.rex>>1&1)<<3; index != RSP {
+			op.index = index
+		}
+		if sib&7 == 5 && mod == 0 {
+			op.disp = sext(c.fetch(4), 4)
+		} else {
+			op.base = int(sib&7) | int(c.rex&1)<<3
+		}
+	case rm == 5 && mod == 0:
+		op.rip = true
+		op.disp = sext(c.fetch(4), 4)
+	default:
+		op.base = rm | int(c.rex&1)<<3
+	}
+	switch mod {
+	case 1:
+		op.disp += sext(c.fetch(1), 1)
+	case 2:
+		op.disp += sext(c.fetch(4), 4)
+	}
+	return reg, op
+}
+
+// ea 内存操作数的地址
+// RIP相对地址以下一条指令为基准, 因此要在读完立即数之后计算
+func (c *CPU) ea(op operand) uint64 {
+	addr := uint64(op.disp)
+	if op.rip {
+		addr += c.next
+	}
+	if op.base >= 0 {
+		addr += c.Regs[op.base]
+	}
+	if op.index >= 0 {
+		addr += c.Regs[op.index] * op.scale
+	}
+	return addr
+}
+
+// getReg 读取寄存器的低size字节
+// 没有REX前缀时8位寄存器4到7是AH、CH、DH、BH
+func (c *CPU) getReg(n, size int) uint64 {
+	if size == 1 && c.rex == 0 && n >= 4 && n < 8 {
+		return c.Regs[n-4] >> 8 & 0xff
+	}
+	return c.Regs[n] & mask(size)
+}
+
+// setReg 写入寄存器的低size字节, 32位写入清零高32位
+func (c *CPU) setReg(n, size int, v uint64) {
+	switch {
+	case size == 1 && c.rex == 0 && n >= 4 && n < 8:
+		c.Regs[n-4] = c.Regs[n-4]&^0xff00 | (v&0xff)<<8
+	case size == 4:
+		c.Regs[n] = v & mask(4)
+	default:
+		c.Regs[n] = c.Regs[n]&^mask(size) | v&mask(size)
+	}
+}
+
+func (c *CPU) get(op operand, size int) uint64 {
+	if op.mem {
+		return c.read(c.ea(op), size)
+	}
+	return c.getReg(op.reg, size)
+}
+
+func (c *CPU) set(op operand, size int, v uint64) {
+	if op.mem {
+		c.write(c.ea(op), size, v)
+		return
+	}
+	c.setReg(op.reg, size, v)
+}
+
+// invalid 无法解码的指令
+func (c *CPU) invalid() {
+	panic(fault(fmt.Sprintf("cannot decode instruction (%d bytes read)", c.next-c.start)))
+}
+
+// unsupported 能解码但不模拟的指令
+func (c *CPU) unsupported(name string) {
+	panic(fault(name + " is not supported"))
+}
+
+// mask size字节的掩码
+func mask(size int) uint64 {
+	if size == 8 {
+		return ^uint64(0)
+	}
+	return 1<<(8*size) - 1
+}
+
+// sign size字节的符号位
+func sign(size int) uint64 {
+	return 1 << (8*size - 1)
+}
+
+// sext 把size字节的值符号扩展为64位
+func sext(v uint64, size int) int64 {
+	shift := 64 - 8*size
+	return int64(v<<shift) >> shift
+}
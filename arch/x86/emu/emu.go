@@ -0,0 +1,290 @@
+// Package emu 纯Go实现的x86-64用户态模拟器
+//
+// 模拟器解码并执行CuteASM能编码的指令子集, 用来在没有外部反汇编器和目标机器时
+// 检查x86后端的输出: 用x86.DoASM汇编一段代码, 交给Exec执行, 再检查寄存器。
+// 解码结果和预期不一致往往说明编码有误, 例如漏掉了REX前缀。
+//
+// 机器模型:
+//   - 16个通用寄存器、RIP和RFLAGS中的CF、PF、ZF、SF、DF、OF。
+//     32位写入把寄存器的高32位清零, 8位和16位写入保留其余的位。
+//   - 平坦内存从地址0开始, 共Config.MemSize字节, 越界访问是错误。
+//     代码默认放在CodeAddr, 栈从内存顶端向下增长。
+//   - SYSCALL交给CPU.Syscall处理, 默认按Linux的约定实现write和exit。
+//   - 不支持段寄存器、浮点、SIMD和特权指令, 遇到时报告无法解码。
+package emu
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	CodeAddr = 0x1000             // Exec放置代码的地址
+	StopAddr = 0x7ffffffffffff000 // Call压入的返回地址, 返回到这里时停止执行
+)
+
+// 寄存器编号, 与ModRM中的编号一致
+const (
+	RAX = iota
+	RCX
+	RDX
+	RBX
+	RSP
+	RBP
+	RSI
+	RDI
+	R8
+	R9
+	R10
+	R11
+	R12
+	R13
+	R14
+	R15
+)
+
+// RFLAGS中模拟的位
+const (
+	FlagCF = 1 << 0
+	FlagPF = 1 << 2
+	FlagZF = 1 << 6
+	FlagSF = 1 << 7
+	FlagDF = 1 << 10
+	FlagOF = 1 << 11
+)
+
+// Linux x86-64的系统调用号
+const (
+	SysWrite     = 1
+	SysExit      = 60
+	SysExitGroup = 231
+)
+
+var regNames = [16]string{
+	"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+}
+
+// Config 模拟器的设置, 为0的项使用默认值
+type Config struct {
+	MemSize  int       // 内存的字节数, 默认1M
+	MaxSteps int       // 最多执行的指令数, 默认100万, 用于发现死循环
+	Stdout   io.Writer // write写入fd 1和2的内容, 为nil时丢弃
+}
+
+// CPU 模拟器的状态
+type CPU struct {
+	Regs  [16]uint64
+	RIP   uint64
+	Flags uint64
+	Mem   []byte
+
+	// Syscall 处理SYSCALL指令, 为nil时调用LinuxSyscall
+	// 返回错误时停止执行, 并报告在SYSCALL指令处
+	Syscall func(c *CPU) error
+
+	Steps    int  // 已经执行的指令数
+	Halted   bool // 因HLT停止
+	Exited   bool // 因exit系统调用停止
+	ExitCode int
+
+	cfg Config
+
+	// 当前指令的解码状态
+	start  uint64 // 指令的地址
+	next   uint64 // 下一个要读取的字节, 执行结束后成为新的RIP
+	rex    byte
+	opsize bool // 0x66前缀
+}
+
+// Fault 执行时的错误
+type Fault struct {
+	RIP   uint64 // 出错指令的地址
+	Bytes []byte // 出错指令开头的字节, 用于排查解码问题
+	Err   string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("emu: %#x [% x]: %s", f.RIP, f.Bytes, f.Err)
+}
+
+// fault 执行中的错误, 由Step恢复为*Fault
+type fault string
+
+// New 创建模拟器, 栈指针指向内存顶端
+func New(cfg Config) *CPU {
+	if cfg.MemSize == 0 {
+		cfg.MemSize = 1 << 20
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = 1000000
+	}
+	c := &CPU{Mem: make([]byte, cfg.MemSize), cfg: cfg}
+	c.Reset()
+	return c
+}
+
+// Reset 清空寄存器和状态, 内存保持不变
+func (c *CPU) Reset() {
+	c.Regs = [16]uint64{}
+	c.Regs[RSP] = uint64(len(c.Mem)) &^ 15
+	c.RIP, c.Flags, c.Steps = 0, 0, 0
+	c.Halted, c.Exited, c.ExitCode = false, false, 0
+}
+
+// Load 把code复制到addr
+func (c *CPU) Load(addr uint64, code []byte) error {
+	if addr > uint64(len(c.Mem)) || uint64(len(code)) > uint64(len(c.Mem))-addr {
+		return fmt.Errorf("emu: %d bytes at %#x do not fit in memory", len(code), addr)
+	}
+	copy(c.Mem[addr:], code)
+	return nil
+}
+
+// Exec 把code放在CodeAddr并作为函数调用, 代码以RET或HLT结束
+func Exec(code []byte, cfg Config) (*CPU, error) {
+	c := New(cfg)
+	if err := c.Load(CodeAddr, code); err != nil {
+		return c, err
+	}
+	return c, c.Call(CodeAddr)
+}
+
+// Call 压入StopAddr并从addr执行, 直到返回、HLT或exit
+func (c *CPU) Call(addr uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(fault)
+			if !ok {
+				panic(r)
+			}
+			err = &Fault{RIP: c.RIP, Err: string(f)}
+		}
+	}()
+	c.push(StopAddr)
+	c.RIP = addr
+	return c.Run()
+}
+
+// Run 从RIP执行到HLT、exit或返回到StopAddr
+func (c *CPU) Run() error {
+	for !c.Halted && !c.Exited && c.RIP != StopAddr {
+		if c.Steps >= c.cfg.MaxSteps {
+			return c.errorf("step limit %d exceeded", c.cfg.MaxSteps)
+		}
+		if err := c.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 执行一条指令
+func (c *CPU) Step() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(fault)
+			if !ok {
+				panic(r)
+			}
+			err = c.errorf("%s", string(f))
+		}
+	}()
+	c.Steps++
+	c.start, c.next = c.RIP, c.RIP
+	c.rex, c.opsize = 0, false
+	c.exec()
+	c.RIP = c.next
+	return nil
+}
+
+// errorf 报告当前指令处的错误
+func (c *CPU) errorf(format string, args ...any) *Fault {
+	f := &Fault{RIP: c.RIP, Err: fmt.Sprintf(format, args...)}
+	if c.RIP < uint64(len(c.Mem)) {
+		f.Bytes = c.Mem[c.RIP:min(c.RIP+8, uint64(len(c.Mem)))]
+	}
+	return f
+}
+
+// LinuxSyscall 按Linux x86-64的约定处理write和exit, 其它调用返回-ENOSYS
+func (c *CPU) LinuxSyscall() error {
+	switch c.Regs[RAX] {
+	case SysWrite:
+		fd, buf, n := c.Regs[RDI], c.Regs[RSI], c.Regs[RDX]
+		if buf > uint64(len(c.Mem)) || n > uint64(len(c.Mem))-buf {
+			c.Regs[RAX] = ^uint64(14 - 1) // -EFAULT
+			return nil
+		}
+		if fd != 1 && fd != 2 {
+			c.Regs[RAX] = ^uint64(9 - 1) // -EBADF
+			return nil
+		}
+		if c.cfg.Stdout != nil {
+			if _, err := c.cfg.Stdout.Write(c.Mem[buf : buf+n]); err != nil {
+				return err
+			}
+		}
+		c.Regs[RAX] = n
+	case SysExit, SysExitGroup:
+		c.Exited, c.ExitCode = true, int(int32(c.Regs[RDI]))
+	default:
+		c.Regs[RAX] = ^uint64(38 - 1) // -ENOSYS
+	}
+	return nil
+}
+
+// Dump 输出寄存器和标志位
+func (c *CPU) Dump() string {
+	sb := &strings.Builder{}
+	for n, v := range c.Regs {
+		fmt.Fprintf(sb, "%-3s = %#x\n", regNames[n], v)
+	}
+	fmt.Fprintf(sb, "rip = %#x\nflags:", c.RIP)
+	for _, f := range []struct {
+		name string
+		bit  uint64
+	}{{"CF", FlagCF}, {"PF", FlagPF}, {"ZF", FlagZF}, {"SF", FlagSF}, {"DF", FlagDF}, {"OF", FlagOF}} {
+		if c.Flags&f.bit != 0 {
+			sb.WriteString(" " + f.name)
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// read 读取size字节的小端序无符号数
+func (c *CPU) read(addr uint64, size int) uint64 {
+	c.check(addr, size)
+	v := uint64(0)
+	for n := 0; n < size; n++ {
+		v |= uint64(c.Mem[addr+uint64(n)]) << (8 * n)
+	}
+	return v
+}
+
+// write 写入size字节
+func (c *CPU) write(addr uint64, size int, v uint64) {
+	c.check(addr, size)
+	for n := 0; n < size; n++ {
+		c.Mem[addr+uint64(n)] = byte(v >> (8 * n))
+	}
+}
+
+func (c *CPU) check(addr uint64, size int) {
+	if addr > uint64(len(c.Mem)) || uint64(size) > uint64(len(c.Mem))-addr {
+		panic(fault(fmt.Sprintf("%d-byte access at %#x is outside memory", size, addr)))
+	}
+}
+
+func (c *CPU) push(v uint64) {
+	c.Regs[RSP] -= 8
+	c.write(c.Regs[RSP], 8, v)
+}
+
+func (c *CPU) pop() uint64 {
+	v := c.read(c.Regs[RSP], 8)
+	c.Regs[RSP] += 8
+	return v
+}
@@ -0,0 +1,99 @@
+package emu_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/arch/x86/emu"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// asm 用DoASM汇编一段64位的源码, 内置指令先经过Lower展开
+func asm(t *testing.T, src string) []byte {
+	t.Helper()
+	arch := x86.NewMode(64)
+	p := parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), arch)
+	var code []byte
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			insts, err := x86.Lower(i, arch.Registers, 64)
+			if err != nil {
+				t.Fatalf("%s: %v", i.Instruction, err)
+			}
+			for _, in := range insts {
+				bin, err := x86.DoASM(in, arch)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				code = append(code, bin...)
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	return code
+}
+
+// 虚拟寄存器%x0-%x13依次为rax、rcx、rdx、rbx、rsi、rdi、r8-r15
+func TestExec(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[int]uint64
+	}{
+		{"mov imm", "mov %r0, 5\nret", map[int]uint64{emu.RAX: 5}},
+		{"mov r12d", "mov %r10, -1\nmov %e10, 1\nret", map[int]uint64{emu.R12: 1}},
+		{"mov imm64", "mov %r3, 0x123456789\nadd %r3, 1\nret", map[int]uint64{emu.RBX: 0x12345678a}},
+		{"add r10", "mov %r8, 7\nmov %r0, 3\nadd %r0, %r8\nret", map[int]uint64{emu.RAX: 10, emu.R10: 7}},
+		{"mul one", "mov %e0, 6\nmov %e1, 7\nmul %e1\nret", map[int]uint64{emu.RAX: 42, emu.RDX: 0}},
+		{"mul two", "mov %r9, 6\nmul %r9, -7\nret", map[int]uint64{emu.R11: 0xffffffffffffffd6}},
+		{"div", "mov %r11, 100\ndiv %r11, 7\nmov %r12, 9\nmov %r0, 45\ndiv %r0, %r12\nret",
+			map[int]uint64{emu.R13: 14, emu.RAX: 5, emu.R14: 9}},
+		{"shift cl", "mov %r7, 1\nmov %r1, 5\nshiftl %r7, %r1\nshiftr %r7\nret", map[int]uint64{emu.R9: 16, emu.RCX: 5}},
+		{"byte sil", "mov %r4, 0x1234\nmov %l4, 0xff\nret", map[int]uint64{emu.RSI: 0x12ff}},
+		{"push pop", "mov %r11, 0x55\npush %r11\npop %r12\nret", map[int]uint64{emu.R14: 0x55}},
+		{"neg not xchg", "mov %r2, 3\nneg %r2\nmov %r3, 0\nnot %r3\nxchg %r2, %r3\nret",
+			map[int]uint64{emu.RDX: 0xffffffffffffffff, emu.RBX: 0xfffffffffffffffd}},
+		{"memory", "sub %r0, %r0\nmov QW[%r13-8], 0x77\nmov %r2, QW[%r13-8]\nadd QW[%r13+%r0*8-8], %r2\nmov %r3, QW[%r13-8]\nret",
+			map[int]uint64{emu.RDX: 0x77, emu.RBX: 0xee}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := emu.New(emu.Config{})
+			// %r13(r15)指向栈下面的一块内存
+			c.Regs[emu.R15] = uint64(len(c.Mem)) / 2
+			code := asm(t, tt.src)
+			if err := c.Load(emu.CodeAddr, code); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Call(emu.CodeAddr); err != nil {
+				t.Fatalf("%v\n%x", err, code)
+			}
+			for reg, want := range tt.want {
+				if c.Regs[reg] != want {
+					t.Errorf("reg %d = %#x, want %#x\n%x", reg, c.Regs[reg], want, code)
+				}
+			}
+		})
+	}
+}
+
+// CALL寄存器调用另一段代码, 返回后继续执行
+func TestCallReg(t *testing.T) {
+	c := emu.New(emu.Config{})
+	if err := c.Load(0x2000, asm(t, "mov %e2, 11\nret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(emu.CodeAddr, asm(t, "mov %r0, 0x2000\ncall %r0\nadd %r2, 1\nret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Call(emu.CodeAddr); err != nil {
+		t.Fatal(err)
+	}
+	if c.Regs[emu.RDX] != 12 {
+		t.Errorf("rdx = %d, want 12", c.Regs[emu.RDX])
+	}
+}
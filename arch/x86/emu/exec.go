@@ -0,0 +1,324 @@
+package emu
+
+// exec 解码前缀和操作码并执行
+func (c *CPU) exec() {
+	for {
+		b := byte(c.fetch(1))
+		switch {
+		case b == 0x66:
+			c.opsize = true
+			continue
+		case b == 0xF2 || b == 0xF3:
+			// 没有串操作指令, REP前缀对其余指令没有作用
+			continue
+		case b == 0x2E || b == 0x3E || b == 0x26 || b == 0x36:
+			// 64位模式下忽略这些段前缀
+			continue
+		case b == 0x64 || b == 0x65:
+			c.unsupported("FS/GS segment override")
+		case b == 0x67:
+			c.unsupported("address-size prefix")
+		case b&0xF0 == 0x40:
+			// REX必须紧挨着操作码
+			c.rex = b
+			b = byte(c.fetch(1))
+		}
+		if b == 0x0F {
+			c.exec0F(byte(c.fetch(1)))
+		} else {
+			c.exec1(b)
+		}
+		return
+	}
+}
+
+// exec1 单字节操作码
+func (c *CPU) exec1(op byte) {
+	size := c.width()
+	switch {
+	case op < 0x40 && op&7 < 6:
+		// ADD、OR、ADC、SBB、AND、SUB、XOR、CMP的六种形式
+		kind := int(op >> 3)
+		if op&1 == 0 {
+			size = 1
+		}
+		var dst, src operand
+		switch op & 7 {
+		case 0, 1: // r/m, r
+			reg, rm := c.modrm()
+			dst, src = rm, regOperand(reg)
+		case 2, 3: // r, r/m
+			reg, rm := c.modrm()
+			dst, src = regOperand(reg), rm
+		case 4, 5: // rAX, imm
+			b := c.imm(size)
+			c.aluTo(kind, regOperand(RAX), b, size)
+			return
+		}
+		c.aluTo(kind, dst, c.get(src, size), size)
+	case op >= 0x50 && op <= 0x57: // PUSH r64
+		c.push(c.Regs[int(op&7)|int(c.rex&1)<<3])
+	case op >= 0x58 && op <= 0x5F: // POP r64
+		c.Regs[int(op&7)|int(c.rex&1)<<3] = c.pop()
+	case op == 0x63: // MOVSXD r, r/m32
+		reg, rm := c.modrm()
+		c.setReg(reg, size, uint64(sext(c.get(rm, 4), 4)))
+	case op == 0x68: // PUSH imm32
+		c.push(c.imm(4))
+	case op == 0x6A: // PUSH imm8
+		c.push(c.imm(1))
+	case op == 0x69 || op == 0x6B: // IMUL r, r/m, imm
+		reg, rm := c.modrm()
+		immSize := size
+		if op == 0x6B {
+			immSize = 1
+		}
+		b := c.imm(immSize)
+		c.setReg(reg, size, c.imul(c.get(rm, size), b, size))
+	case op >= 0x70 && op <= 0x7F: // Jcc rel8
+		rel := c.imm(1)
+		if c.cond(op & 0xF) {
+			c.next += rel
+		}
+	case op == 0x80 || op == 0x81 || op == 0x83: // 运算 r/m, imm
+		reg, rm := c.modrm()
+		immSize := size
+		if op == 0x80 {
+			size, immSize = 1, 1
+		} else if op == 0x83 {
+			immSize = 1
+		}
+		c.aluTo(reg&7, rm, c.imm(immSize), size)
+	case op == 0x84 || op == 0x85: // TEST r/m, r
+		if op == 0x84 {
+			size = 1
+		}
+		reg, rm := c.modrm()
+		c.logic(c.get(rm, size)&c.getReg(reg, size), size)
+	case op == 0x86 || op == 0x87: // XCHG r/m, r
+		if op == 0x86 {
+			size = 1
+		}
+		reg, rm := c.modrm()
+		a, b := c.get(rm, size), c.getReg(reg, size)
+		c.set(rm, size, b)
+		c.setReg(reg, size, a)
+	case op >= 0x88 && op <= 0x8B: // MOV
+		if op&1 == 0 {
+			size = 1
+		}
+		reg, rm := c.modrm()
+		if op&2 == 0 {
+			c.set(rm, size, c.getReg(reg, size))
+		} else {
+			c.setReg(reg, size, c.get(rm, size))
+		}
+	case op == 0x8D: // LEA
+		reg, rm := c.modrm()
+		if !rm.mem {
+			c.invalid()
+		}
+		c.setReg(reg, size, c.ea(rm))
+	case op == 0x8F: // POP r/m64
+		reg, rm := c.modrm()
+		if reg&7 != 0 {
+			c.invalid()
+		}
+		c.set(rm, 8, c.pop())
+	case op == 0x90 && c.rex&1 == 0: // NOP
+	case op >= 0x90 && op <= 0x97: // XCHG rAX, r
+		n := int(op&7) | int(c.rex&1)<<3
+		a, b := c.getReg(RAX, size), c.getReg(n, size)
+		c.setReg(RAX, size, b)
+		c.setReg(n, size, a)
+	case op == 0x98: // CBW、CWDE、CDQE
+		c.setReg(RAX, size, uint64(sext(c.getReg(RAX, size/2), size/2)))
+	case op == 0x99: // CWD、CDQ、CQO
+		c.setReg(RDX, size, uint64(sext(c.getReg(RAX, size), size)>>63))
+	case op == 0xA8 || op == 0xA9: // TEST rAX, imm
+		if op == 0xA8 {
+			size = 1
+		}
+		c.logic(c.getReg(RAX, size)&c.imm(size), size)
+	case op >= 0xB0 && op <= 0xB7: // MOV r8, imm8
+		c.setReg(int(op&7)|int(c.rex&1)<<3, 1, c.fetch(1))
+	case op >= 0xB8 && op <= 0xBF: // MOV r, imm, REX.W时是64位立即数
+		c.setReg(int(op&7)|int(c.rex&1)<<3, size, c.fetch(size))
+	case op == 0xC0 || op == 0xC1 || op >= 0xD0 && op <= 0xD3: // 移位
+		if op&1 == 0 {
+			size = 1
+		}
+		reg, rm := c.modrm()
+		var count uint64
+		switch op {
+		case 0xC0, 0xC1:
+			count = c.fetch(1)
+		case 0xD0, 0xD1:
+			count = 1
+		default:
+			count = c.getReg(RCX, 1)
+		}
+		c.set(rm, size, c.shift(reg&7, c.get(rm, size), count, size))
+	case op == 0xC2: // RET imm16
+		n := c.fetch(2)
+		c.next = c.pop()
+		c.Regs[RSP] += n
+	case op == 0xC3: // RET
+		c.next = c.pop()
+	case op == 0xC6 || op == 0xC7: // MOV r/m, imm
+		if op == 0xC6 {
+			size = 1
+		}
+		reg, rm := c.modrm()
+		if reg&7 != 0 {
+			c.invalid()
+		}
+		c.set(rm, size, c.imm(size))
+	case op == 0xC9: // LEAVE
+		c.Regs[RSP] = c.Regs[RBP]
+		c.Regs[RBP] = c.pop()
+	case op == 0xCC: // INT3
+		c.unsupported("INT3 breakpoint")
+	case op == 0xE8: // CALL rel32
+		rel := c.imm(4)
+		c.push(c.next)
+		c.next += rel
+	case op == 0xE9: // JMP rel32
+		c.next += c.imm(4)
+	case op == 0xEB: // JMP rel8
+		c.next += c.imm(1)
+	case op == 0xF4: // HLT
+		c.Halted = true
+	case op == 0xF5: // CMC
+		c.Flags ^= FlagCF
+	case op == 0xF6 || op == 0xF7:
+		if op == 0xF6 {
+			size = 1
+		}
+		c.group3(size)
+	case op == 0xF8: // CLC
+		c.setFlag(FlagCF, false)
+	case op == 0xF9: // STC
+		c.setFlag(FlagCF, true)
+	case op == 0xFC: // CLD
+		c.setFlag(FlagDF, false)
+	case op == 0xFD: // STD
+		c.setFlag(FlagDF, true)
+	case op == 0xFE || op == 0xFF:
+		if op == 0xFE {
+			size = 1
+		}
+		c.group5(size)
+	default:
+		c.invalid()
+	}
+}
+
+// aluTo 运算结果写回dst, CMP不写回
+func (c *CPU) aluTo(kind int, dst operand, b uint64, size int) {
+	r := c.alu(kind, c.get(dst, size), b, size)
+	if kind != 7 {
+		c.set(dst, size, r)
+	}
+}
+
+// group3 0xF6、0xF7组: TEST、NOT、NEG、MUL、IMUL、DIV、IDIV
+func (c *CPU) group3(size int) {
+	reg, rm := c.modrm()
+	switch reg & 7 {
+	case 0, 1: // TEST r/m, imm
+		b := c.imm(size)
+		c.logic(c.get(rm, size)&b, size)
+	case 2: // NOT
+		c.set(rm, size, ^c.get(rm, size))
+	case 3: // NEG
+		a := c.get(rm, size)
+		c.set(rm, size, c.sub(0, a, 0, size))
+	case 4:
+		c.mul(c.get(rm, size), false, size)
+	case 5:
+		c.mul(c.get(rm, size), true, size)
+	case 6:
+		c.div(c.get(rm, size), false, size)
+	case 7:
+		c.div(c.get(rm, size), true, size)
+	}
+}
+
+// group5 0xFE、0xFF组: INC、DEC, 以及0xFF的间接CALL、JMP和PUSH
+func (c *CPU) group5(size int) {
+	reg, rm := c.modrm()
+	digit := reg & 7
+	if size == 1 && digit > 1 {
+		c.invalid()
+	}
+	switch digit {
+	case 0, 1:
+		c.set(rm, size, c.incDec(c.get(rm, size), digit == 1, size))
+	case 2: // CALL r/m64
+		target := c.get(rm, 8)
+		c.push(c.next)
+		c.next = target
+	case 4: // JMP r/m64
+		c.next = c.get(rm, 8)
+	case 6: // PUSH r/m64
+		c.push(c.get(rm, 8))
+	case 3, 5:
+		c.unsupported("far CALL/JMP")
+	default:
+		c.invalid()
+	}
+}
+
+// exec0F 0x0F开头的双字节操作码
+func (c *CPU) exec0F(op byte) {
+	size := c.width()
+	switch {
+	case op == 0x05: // SYSCALL
+		c.Regs[RCX], c.Regs[R11] = c.next, c.Flags
+		handler := c.Syscall
+		if handler == nil {
+			handler = (*CPU).LinuxSyscall
+		}
+		if err := handler(c); err != nil {
+			panic(fault("syscall: " + err.Error()))
+		}
+	case op == 0x0B:
+		c.unsupported("UD2")
+	case op == 0x1F: // 多字节NOP
+		c.modrm()
+	case op >= 0x40 && op <= 0x4F: // CMOVcc
+		reg, rm := c.modrm()
+		v := c.get(rm, size)
+		if c.cond(op & 0xF) {
+			c.setReg(reg, size, v)
+		} else if size == 4 {
+			// 条件不成立时32位目的寄存器的高位也会清零
+			c.setReg(reg, 4, c.getReg(reg, 4))
+		}
+	case op >= 0x80 && op <= 0x8F: // Jcc rel32
+		rel := c.imm(4)
+		if c.cond(op & 0xF) {
+			c.next += rel
+		}
+	case op >= 0x90 && op <= 0x9F: // SETcc
+		_, rm := c.modrm()
+		v := uint64(0)
+		if c.cond(op & 0xF) {
+			v = 1
+		}
+		c.set(rm, 1, v)
+	case op == 0xAF: // IMUL r, r/m
+		reg, rm := c.modrm()
+		c.setReg(reg, size, c.imul(c.getReg(reg, size), c.get(rm, size), size))
+	case op == 0xB6 || op == 0xB7: // MOVZX
+		reg, rm := c.modrm()
+		c.setReg(reg, size, c.get(rm, int(op-0xB6)+1))
+	case op == 0xBE || op == 0xBF: // MOVSX
+		reg, rm := c.modrm()
+		src := int(op-0xBE) + 1
+		c.setReg(reg, size, uint64(sext(c.get(rm, src), src)))
+	default:
+		c.invalid()
+	}
+}
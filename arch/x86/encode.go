@@ -0,0 +1,559 @@
+package x86
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 内置指令的编码表
+// 每条指令有一张按顺序尝试的表, 使用第一个操作数类型、宽度和立即数范围都符合的形式。
+// 反汇编使用同一张表, 所以表中只列出编码器会生成的形式。
+
+// form 操作数在指令中的位置
+type form int
+
+const (
+	formNone form = iota // 没有操作数
+	formMR               // 第一个操作数在ModRM.rm, 第二个在ModRM.reg
+	formRM               // 第一个操作数在ModRM.reg, 第二个在ModRM.rm
+	formM                // 只有ModRM.rm, ModRM.reg是digit
+	formMI               // ModRM.rm和立即数, ModRM.reg是digit
+	formMC               // ModRM.rm, ModRM.reg是digit, 第二个操作数固定是cl
+	formRMI              // 寄存器同时在ModRM.reg和rm, 然后是立即数(IMUL r, r, imm)
+	formO                // 寄存器编号加在操作码的最后一个字节上
+	formOI               // 同formO, 然后是立即数
+	formI                // 只有立即数
+	formD                // 32位的PC相对偏移, 以指令末尾为基准
+)
+
+// encoding 编码表的一项
+type encoding struct {
+	ops    [2]types.Operand // 各操作数可以是的类型, 没有的操作数为OpNone
+	opcode []byte
+	form   form
+	digit  byte // ModRM.reg中的扩展操作码
+	word   bool // 操作数是栈的字长, 64位模式不需要REX.W
+	widen  bool // 第二个操作数比第一个窄(movzx、movsx)
+}
+
+const (
+	regW = OpReg16 | OpReg32 | OpReg64
+	memW = OpMem16 | OpMem32 | OpMem64
+	rm8  = OpReg8 | OpMem8
+	rmW  = regW | memW
+)
+
+func ops(a ...types.Operand) (o [2]types.Operand) {
+	copy(o[:], a)
+	return o
+}
+
+// alu ADD、OR、AND、SUB、XOR、CMP, base是8位r/m, r形式的操作码, digit是立即数形式的扩展操作码
+func alu(base, digit byte) []encoding {
+	return []encoding{
+		{ops: ops(rm8, OpReg8), opcode: []byte{base}, form: formMR},
+		{ops: ops(rmW, regW), opcode: []byte{base + 1}, form: formMR},
+		{ops: ops(OpReg8, OpMem8), opcode: []byte{base + 2}, form: formRM},
+		{ops: ops(regW, memW), opcode: []byte{base + 3}, form: formRM},
+		{ops: ops(rm8, OpImm32), opcode: []byte{0x80}, form: formMI, digit: digit},
+		{ops: ops(rmW, OpImm8), opcode: []byte{0x83}, form: formMI, digit: digit},
+		{ops: ops(rmW, OpImm32|OpLabel), opcode: []byte{0x81}, form: formMI, digit: digit},
+	}
+}
+
+// unary NEG、NOT、DIV等只有一个r/m操作数的F6、F7组
+func unary(digit byte) []encoding {
+	return []encoding{
+		{ops: ops(rm8), opcode: []byte{0xF6}, form: formM, digit: digit},
+		{ops: ops(rmW), opcode: []byte{0xF7}, form: formM, digit: digit},
+	}
+}
+
+// shiftOps 移1位、移立即数位和移cl位
+func shiftOps(digit byte) []encoding {
+	return []encoding{
+		{ops: ops(rm8), opcode: []byte{0xD0}, form: formM, digit: digit},
+		{ops: ops(rmW), opcode: []byte{0xD1}, form: formM, digit: digit},
+		{ops: ops(rm8, OpImm8), opcode: []byte{0xC0}, form: formMI, digit: digit},
+		{ops: ops(rmW, OpImm8), opcode: []byte{0xC1}, form: formMI, digit: digit},
+		{ops: ops(rm8, OpReg8), opcode: []byte{0xD2}, form: formMC, digit: digit},
+		{ops: ops(rmW, OpReg8), opcode: []byte{0xD3}, form: formMC, digit: digit},
+	}
+}
+
+// jump PC相对跳转, 目标是立即数时就是相对偏移
+func jump(op ...byte) encoding {
+	return encoding{ops: ops(OpLabel | OpImm32), opcode: op, form: formD}
+}
+
+var movOps = []encoding{
+	{ops: ops(rm8, OpReg8), opcode: []byte{0x88}, form: formMR},
+	{ops: ops(rmW, regW), opcode: []byte{0x89}, form: formMR},
+	{ops: ops(OpReg8, OpMem8), opcode: []byte{0x8A}, form: formRM},
+	{ops: ops(regW, memW), opcode: []byte{0x8B}, form: formRM},
+	{ops: ops(OpReg8, OpImm32), opcode: []byte{0xB0}, form: formOI},
+	{ops: ops(OpReg16|OpReg32, OpImm32|OpLabel), opcode: []byte{0xB8}, form: formOI},
+	{ops: ops(rmW, OpImm32|OpLabel), opcode: []byte{0xC7}, form: formMI}, // 64位时符号扩展
+	{ops: ops(OpReg64, OpImm64), opcode: []byte{0xB8}, form: formOI},
+	{ops: ops(OpMem8, OpImm32), opcode: []byte{0xC6}, form: formMI},
+}
+
+// LOAD把SIGNED或UNSIGNED变量读入更宽的寄存器
+var movzxOps = []encoding{
+	{ops: ops(regW, rm8), opcode: []byte{0x0F, 0xB6}, form: formRM, widen: true},
+	{ops: ops(OpReg32|OpReg64, OpReg16|OpMem16), opcode: []byte{0x0F, 0xB7}, form: formRM, widen: true},
+}
+
+var movsxOps = []encoding{
+	{ops: ops(regW, rm8), opcode: []byte{0x0F, 0xBE}, form: formRM, widen: true},
+	{ops: ops(OpReg32|OpReg64, OpReg16|OpMem16), opcode: []byte{0x0F, 0xBF}, form: formRM, widen: true},
+	{ops: ops(OpReg64, OpReg32|OpMem32), opcode: []byte{0x63}, form: formRM, widen: true},
+}
+
+// MOV寄存器, 标签在64位模式下用RIP相对的LEA取地址
+var leaOps = []encoding{
+	{ops: ops(regW, memW), opcode: []byte{0x8D}, form: formRM},
+}
+
+var pushOps = []encoding{
+	{ops: ops(regW), opcode: []byte{0x50}, form: formO, word: true},
+	{ops: ops(memW), opcode: []byte{0xFF}, form: formM, digit: 6, word: true},
+	{ops: ops(OpImm8), opcode: []byte{0x6A}, form: formI, word: true},
+	{ops: ops(OpImm32 | OpLabel), opcode: []byte{0x68}, form: formI, word: true},
+}
+
+var popOps = []encoding{
+	{ops: ops(regW), opcode: []byte{0x58}, form: formO, word: true},
+	{ops: ops(memW), opcode: []byte{0x8F}, form: formM, word: true},
+}
+
+// 两个操作数的MUL只保留低位, 与有无符号无关, 使用IMUL
+var mulOps = append(unary(4),
+	encoding{ops: ops(regW, rmW), opcode: []byte{0x0F, 0xAF}, form: formRM},
+	encoding{ops: ops(regW, OpImm8), opcode: []byte{0x6B}, form: formRMI},
+	encoding{ops: ops(regW, OpImm32|OpLabel), opcode: []byte{0x69}, form: formRMI},
+)
+
+var xchgOps = []encoding{
+	{ops: ops(rm8, OpReg8), opcode: []byte{0x86}, form: formMR},
+	{ops: ops(rmW, regW), opcode: []byte{0x87}, form: formMR},
+	{ops: ops(OpReg8, OpMem8), opcode: []byte{0x86}, form: formRM},
+	{ops: ops(regW, memW), opcode: []byte{0x87}, form: formRM},
+}
+
+// encodings 内置指令和SYSCALL的编码表, LOAD和STORE使用MOV的表
+var encodings = map[types.Instruction][]encoding{
+	"ADD":    alu(0x00, 0),
+	"OR":     alu(0x08, 1),
+	"AND":    alu(0x20, 4),
+	"SUB":    alu(0x28, 5),
+	"XOR":    alu(0x30, 6),
+	"CMP":    alu(0x38, 7),
+	"MOV":    movOps,
+	"PUSH":   pushOps,
+	"POP":    popOps,
+	"MUL":    mulOps,
+	"DIV":    unary(6),
+	"NEG":    unary(3),
+	"NOT":    unary(2),
+	"SHIFTL": shiftOps(4),
+	"SHIFTR": shiftOps(5),
+	"XCHG":   xchgOps,
+	"CALL":   {jump(0xE8), {ops: ops(rmW), opcode: []byte{0xFF}, form: formM, digit: 2, word: true}},
+	"JMP":    {jump(0xE9), {ops: ops(rmW), opcode: []byte{0xFF}, form: formM, digit: 4, word: true}},
+	"JMPZ":   {jump(0x0F, 0x84)}, // JE
+	"JMPN":   {jump(0x0F, 0x8C)}, // JL, CMP a, b之后a < b(有符号)时跳转
+	"RET":    {{opcode: []byte{0xC3}}, {ops: ops(OpImm16), opcode: []byte{0xC2}, form: formI}},
+	"HALT":   {{opcode: []byte{0xF4}}},
+
+	"SYSCALL": {{opcode: []byte{0x0F, 0x05}}},
+}
+
+// fixup 编码时还不知道值的32位字段, 地址确定后写入expr的值, rel时减去指令末尾的地址
+type fixup struct {
+	at   int // 在指令中的偏移
+	expr *parser.Expr
+	rel  bool
+}
+
+var (
+	regKinds = map[int]types.Operand{1: OpReg8, 2: OpReg16, 4: OpReg32, 8: OpReg64}
+	memKinds = map[int]types.Operand{1: OpMem8, 2: OpMem16, 4: OpMem32, 8: OpMem64}
+)
+
+// width 寄存器或内存操作数的宽度, 没有指定长度的内存操作数和立即数为0
+func width(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		return types.RegWidth(v.Reg.Type)
+	case parser.ADDR:
+		return v.Addr.Length
+	}
+	return 0
+}
+
+// kind 操作数的类型, 没有长度的内存操作数按指令的宽度w
+func kind(v *parser.Value, w int) types.Operand {
+	switch v.Type {
+	case parser.REG:
+		return regKinds[types.RegWidth(v.Reg.Type)]
+	case parser.ADDR:
+		if v.Addr.Length != 0 {
+			w = v.Addr.Length
+		}
+		if w == 0 {
+			return OpMem
+		}
+		return memKinds[w]
+	case parser.NUMBER:
+		return OpImm8 | OpImm16 | OpImm32 | OpImm64
+	case parser.LABEL, parser.EXPR:
+		return OpLabel
+	}
+	return OpNone
+}
+
+// immSize 立即数的字节数, 宽度为0时(PUSH)按32位
+func immSize(k types.Operand, w int) int {
+	switch {
+	case k&OpImm8 != 0:
+		return 1
+	case k&OpImm16 != 0:
+		return 2
+	case k&OpImm64 != 0:
+		return 8
+	case w == 1 || w == 2:
+		return w
+	}
+	return 4
+}
+
+// fits 立即数能否用size字节表示, 1、2字节时允许无符号的写法, 4字节在64位宽度时符号扩展
+func fits(n int64, size, w int) bool {
+	switch size {
+	case 1:
+		if w == 1 {
+			return n >= math.MinInt8 && n <= math.MaxUint8
+		}
+		return n >= math.MinInt8 && n <= math.MaxInt8
+	case 2:
+		return n >= math.MinInt16 && n <= math.MaxUint16
+	case 4:
+		if w == 8 || w == 0 {
+			return n >= math.MinInt32 && n <= math.MaxInt32
+		}
+		return n >= math.MinInt32 && n <= math.MaxUint32
+	}
+	return true
+}
+
+// opSize 指令的宽度, 取第一个寄存器或有长度的内存操作数
+func opSize(args []*parser.Value) int {
+	for _, arg := range args {
+		if w := width(arg); w != 0 {
+			return w
+		}
+	}
+	return 0
+}
+
+// match 操作数是否符合编码表的一项
+func (b *X86Builtin) match(e encoding, args []*parser.Value, w int) bool {
+	n := 0
+	for n < len(e.ops) && e.ops[n] != OpNone {
+		n++
+	}
+	if n != len(args) {
+		return false
+	}
+	if e.word && w != 0 && w != 2 && w != b.mode/8 {
+		return false
+	}
+	for n, arg := range args {
+		k := kind(arg, w)
+		if e.ops[n]&k == 0 {
+			return false
+		}
+		switch arg.Type {
+		case parser.ADDR:
+			if w == 0 && !e.word {
+				// 不知道内存操作数的宽度
+				return false
+			}
+		case parser.NUMBER:
+			if e.form == formD {
+				if !fits(arg.Num, 4, 8) {
+					return false
+				}
+			} else if !fits(arg.Num, immSize(e.ops[n], w), w) {
+				return false
+			}
+		case parser.LABEL, parser.EXPR:
+			if e.form != formD && immSize(e.ops[n], w) != 4 {
+				return false
+			}
+		}
+		if e.form == formMC && n == 1 {
+			if arg.Type != parser.REG || arg.Reg.Num != numCX {
+				return false
+			}
+			continue
+		}
+		if ww := width(arg); !e.widen && ww != 0 && ww != w {
+			return false
+		}
+	}
+	return true
+}
+
+// encode 按编码表编码指令
+func (b *X86Builtin) encode(name types.Instruction, args []*parser.Value, table []encoding) (types.OpBytes, error) {
+	w := opSize(args)
+	for _, e := range table {
+		if b.match(e, args, w) {
+			return b.emit(name, e, args, w)
+		}
+	}
+	return nil, fmt.Errorf("x86: no encoding of %s %s", name, kinds(args))
+}
+
+// kinds 报错时描述操作数, 如r32, imm
+func kinds(args []*parser.Value) string {
+	s := make([]string, len(args))
+	for n, arg := range args {
+		switch arg.Type {
+		case parser.REG:
+			if w := types.RegWidth(arg.Reg.Type); w != 0 {
+				s[n] = fmt.Sprintf("r%d", w*8)
+			} else {
+				s[n] = "reg"
+			}
+		case parser.ADDR:
+			s[n] = "mem"
+			if arg.Addr.Length != 0 {
+				s[n] = fmt.Sprintf("m%d", arg.Addr.Length*8)
+			}
+		case parser.NUMBER:
+			s[n] = "imm"
+		case parser.LABEL, parser.EXPR:
+			s[n] = "label"
+		default:
+			s[n] = "?"
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// emit 按选定的形式输出前缀、操作码、ModRM、SIB、偏移和立即数
+func (b *X86Builtin) emit(name types.Instruction, e encoding, args []*parser.Value, w int) (types.OpBytes, error) {
+	reg, opreg := -1, -1
+	var rm, imm *parser.Value
+	switch e.form {
+	case formMR:
+		rm, reg = args[0], args[1].Reg.Num
+	case formRM:
+		reg, rm = args[0].Reg.Num, args[1]
+	case formM, formMC:
+		rm, reg = args[0], int(e.digit)
+	case formMI:
+		rm, reg, imm = args[0], int(e.digit), args[1]
+	case formRMI:
+		reg, rm, imm = args[0].Reg.Num, args[0], args[1]
+	case formO:
+		opreg = args[0].Reg.Num
+	case formOI:
+		opreg, imm = args[0].Reg.Num, args[1]
+	case formI, formD:
+		imm = args[0]
+	}
+	code := types.OpBytes{}
+	rex := byte(0)
+	if w == 8 && !e.word {
+		rex |= 0x48
+	}
+	if reg >= 8 {
+		rex |= 0x44
+	}
+	if opreg >= 8 {
+		rex |= 0x41
+	}
+	if rm != nil && rm.Type == parser.REG && rm.Reg.Num >= 8 {
+		rex |= 0x41
+	}
+	if rm != nil && rm.Type == parser.ADDR {
+		a := rm.Addr
+		if a.BaseReg != nil && a.BaseReg.Num >= 8 {
+			rex |= 0x41
+		}
+		if a.IndexReg != nil && a.IndexReg.Num >= 8 {
+			rex |= 0x42
+		}
+		aw, err := b.addrSize(a)
+		if err != nil {
+			return nil, err
+		}
+		if aw == 4 && b.mode == 64 {
+			code = append(code, 0x67)
+		}
+	}
+	for _, arg := range args {
+		if arg.Type == parser.REG && types.RegWidth(arg.Reg.Type) == 1 && arg.Reg.Num >= 4 && arg.Reg.Num < 8 {
+			// spl、bpl、sil、dil需要REX前缀, 没有REX时这几个编号是ah、ch、dh、bh
+			rex |= 0x40
+		}
+	}
+	if rex != 0 && b.mode != 64 {
+		return nil, fmt.Errorf("x86: %s %s needs a REX prefix, which 32-bit mode does not have", name, kinds(args))
+	}
+	if w == 2 {
+		code = append(code, 0x66)
+	}
+	if rex != 0 {
+		code = append(code, rex)
+	}
+	code = append(code, e.opcode...)
+	if opreg >= 0 {
+		code[len(code)-1] += byte(opreg & 7)
+	}
+	var err error
+	switch {
+	case rm == nil:
+	case rm.Type == parser.REG:
+		code = append(code, 0xC0|byte(reg&7)<<3|byte(rm.Reg.Num&7))
+	default:
+		if code, err = b.memory(code, rm.Addr, reg); err != nil {
+			return nil, err
+		}
+	}
+	if imm != nil {
+		size := 4
+		if e.form != formD {
+			size = immSize(e.ops[len(args)-1], w)
+		}
+		switch imm.Type {
+		case parser.NUMBER:
+			for n := 0; n < size; n++ {
+				code = append(code, byte(imm.Num>>(8*n)))
+			}
+		default:
+			code = b.field(code, symExpr(imm), e.form == formD)
+		}
+	}
+	return code, nil
+}
+
+// symExpr 标签或引用标签的表达式
+func symExpr(v *parser.Value) *parser.Expr {
+	if v.Type == parser.LABEL {
+		return &parser.Expr{Sym: v.String}
+	}
+	return v.Expr
+}
+
+// addrExpr 标签+偏移
+func addrExpr(sym string, off int64) *parser.Expr {
+	e := &parser.Expr{Sym: sym}
+	if off == 0 {
+		return e
+	}
+	return &parser.Expr{Op: "+", X: e, Y: &parser.Expr{Val: parser.Const{Int: off}}}
+}
+
+// field 地址确定后才知道值的32位字段, 先填0
+func (b *X86Builtin) field(code types.OpBytes, e *parser.Expr, rel bool) types.OpBytes {
+	b.fixups = append(b.fixups, fixup{at: len(code), expr: e, rel: rel})
+	return append(code, 0, 0, 0, 0)
+}
+
+// addrSize 地址寄存器的宽度, 没有寄存器时为0
+func (b *X86Builtin) addrSize(a *parser.MemoryAddr) (int, error) {
+	aw := 0
+	for _, r := range []*parser.Reg{a.BaseReg, a.IndexReg} {
+		if r == nil {
+			continue
+		}
+		w := types.RegWidth(r.Type)
+		if w != 4 && w != 8 || aw != 0 && w != aw {
+			return 0, fmt.Errorf("x86: invalid address register width %d", w*8)
+		}
+		aw = w
+	}
+	return aw, nil
+}
+
+var scaleBits = map[int]byte{0: 0, 1: 0, 2: 1, 4: 2, 8: 3}
+
+// memory 内存操作数的ModRM、SIB和偏移, reg是ModRM.reg字段
+// 64位模式下只有标签的地址按RIP相对寻址, 没有寄存器的常数地址使用SIB的绝对地址形式
+func (b *X86Builtin) memory(code types.OpBytes, a *parser.MemoryAddr, reg int) (types.OpBytes, error) {
+	r := byte(reg&7) << 3
+	var sym *parser.Expr
+	if a.LabelRef != "" {
+		sym = addrExpr(a.LabelRef, a.Displacement)
+	}
+	disp32 := func(code types.OpBytes) (types.OpBytes, error) {
+		if sym != nil {
+			return b.field(code, sym, false), nil
+		}
+		if a.Displacement < math.MinInt32 || a.Displacement > math.MaxInt32 {
+			return nil, fmt.Errorf("x86: displacement %#x does not fit in 32 bits", a.Displacement)
+		}
+		return binary.LittleEndian.AppendUint32(code, uint32(a.Displacement)), nil
+	}
+	scale, ok := scaleBits[a.Scale]
+	if !ok {
+		return nil, fmt.Errorf("x86: invalid scale %d", a.Scale)
+	}
+	index := -1
+	if a.IndexReg != nil {
+		if index = a.IndexReg.Num; index == numSP {
+			return nil, fmt.Errorf("x86: sp cannot be an index register")
+		}
+	}
+	if a.BaseReg == nil {
+		switch {
+		case index >= 0:
+			code = append(code, r|4, scale<<6|byte(index&7)<<3|5)
+		case b.mode != 64:
+			code = append(code, r|5)
+		case sym != nil:
+			// RIP相对
+			code = append(code, r|5)
+			return b.field(code, sym, true), nil
+		default:
+			code = append(code, r|4, 0x25)
+		}
+		return disp32(code)
+	}
+	base := byte(a.BaseReg.Num & 7)
+	mod := byte(0x80)
+	switch {
+	case sym != nil:
+	case a.Displacement == 0 && base != 5:
+		// rbp、r13作基址时必须有偏移
+		mod = 0
+	case a.Displacement >= math.MinInt8 && a.Displacement <= math.MaxInt8:
+		mod = 0x40
+	}
+	if index < 0 && base != 4 {
+		code = append(code, mod|r|base)
+	} else {
+		// rsp、r12作基址时需要SIB
+		idx := byte(4)
+		if index >= 0 {
+			idx = byte(index & 7)
+		}
+		code = append(code, mod|r|4, scale<<6|idx<<3|base)
+	}
+	switch mod {
+	case 0x40:
+		return append(code, byte(a.Displacement)), nil
+	case 0x80:
+		return disp32(code)
+	}
+	return code, nil
+}
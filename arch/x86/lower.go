@@ -0,0 +1,452 @@
+package x86
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+	"math"
+)
+
+// 内置指令到x86指令的展开
+// 可移植的写法在x86上不一定有对应的指令: DIV使用固定的rdx:rax, 移位的位数只能放在cl,
+// 两个操作数不能都是内存, 立即数最多32位。Lower把这样的指令展开为多条指令,
+// 需要的临时寄存器用PUSH/POP保存, 展开后的指令只改变目标操作数。
+
+// 临时寄存器的候选, 32位模式下只有前四个有8位的形式
+var scratchRegs = []string{"ax", "cx", "dx", "bx", "si", "di"}
+
+// 硬件编号
+const (
+	numAX = 0
+	numCX = 1
+	numDX = 2
+	numSP = 4
+)
+
+type lowering struct {
+	table  *types.RegTable
+	bits   int
+	used   map[int]bool // 指令已经使用的硬件寄存器
+	pushed int64        // 已经压栈的字节数, 用于修正基于rsp的内存操作数
+	out    []*parser.Instruction
+}
+
+// Lower 把一条内置指令展开为x86能够编码的指令序列, bits为32或64
+// 不需要展开时返回原指令
+func Lower(i *parser.Instruction, table *types.RegTable, bits int) ([]*parser.Instruction, error) {
+	l := &lowering{table: table, bits: bits, used: map[int]bool{}}
+	for _, arg := range i.Args {
+		for _, r := range regsOf(arg) {
+			num, err := l.phys(r)
+			if err != nil {
+				return nil, err
+			}
+			l.used[num] = true
+		}
+	}
+	var err error
+	switch i.Instruction {
+	case "DIV":
+		if len(i.Args) != 2 {
+			// 单操作数是x86原本的写法
+			return []*parser.Instruction{i}, nil
+		}
+		err = l.div(i.Args[0], i.Args[1])
+	case "MUL":
+		if len(i.Args) != 2 {
+			return []*parser.Instruction{i}, nil
+		}
+		err = l.mul(i.Args[0], i.Args[1])
+	case "SHIFTL", "SHIFTR":
+		err = l.shift(i)
+	case "PUSH", "POP":
+		if len(i.Args) != 1 {
+			return []*parser.Instruction{i}, nil
+		}
+		err = l.stack(i)
+	case "CMP", "ADD", "SUB", "AND", "OR", "XOR", "MOV", "LOAD", "STORE", "XCHG":
+		if len(i.Args) != 2 {
+			return []*parser.Instruction{i}, nil
+		}
+		err = l.binary(i)
+	default:
+		return []*parser.Instruction{i}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.out == nil {
+		return []*parser.Instruction{i}, nil
+	}
+	return l.out, nil
+}
+
+// regsOf 操作数用到的寄存器
+func regsOf(v *parser.Value) []*parser.Reg {
+	var regs []*parser.Reg
+	switch v.Type {
+	case parser.REG:
+		if types.RegWidth(v.Reg.Type) != 0 {
+			regs = append(regs, v.Reg)
+		}
+	case parser.ADDR:
+		if v.Addr.BaseReg != nil {
+			regs = append(regs, v.Addr.BaseReg)
+		}
+		if v.Addr.IndexReg != nil {
+			regs = append(regs, v.Addr.IndexReg)
+		}
+	}
+	return regs
+}
+
+func (l *lowering) phys(r *parser.Reg) (int, error) {
+	phys, err := l.table.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+	return phys.Num, err
+}
+
+// uses 操作数是否用到硬件寄存器num
+func (l *lowering) uses(v *parser.Value, num int) bool {
+	for _, r := range regsOf(v) {
+		if n, err := l.phys(r); err == nil && n == num {
+			return true
+		}
+	}
+	return false
+}
+
+// isReg 操作数是否就是硬件寄存器num
+func (l *lowering) isReg(v *parser.Value, num int) bool {
+	return v.Type == parser.REG && l.uses(v, num)
+}
+
+// stack PUSH/POP总是移动一个字, 较窄的寄存器按字长压栈
+func (l *lowering) stack(i *parser.Instruction) error {
+	arg, word := i.Args[0], l.bits/8
+	switch w := widthOf(arg); {
+	case w == 0 || w == word:
+		return nil
+	case arg.Type == parser.REG:
+		l.emit(i.Instruction, resize(arg, word))
+		return nil
+	}
+	return fmt.Errorf("x86: %s of a %d-byte memory operand, the stack slot is %d bytes", i.Instruction, widthOf(arg), word)
+}
+
+// 各宽度通用寄存器的类型
+var regTypes = map[int]int{1: types.Reg8, 2: types.Reg16, 4: types.Reg32, 8: types.Reg64}
+
+// reg 按名称引用的寄存器, width为访问宽度
+func reg(name string, width int) *parser.Value {
+	return &parser.Value{Type: parser.REG, Reg: &parser.Reg{Name: name, Type: regTypes[width]}}
+}
+
+// resize 同一个寄存器的另一个宽度
+func resize(v *parser.Value, width int) *parser.Value {
+	tmp := *v.Reg
+	tmp.Type = regTypes[width]
+	return &parser.Value{Type: parser.REG, Reg: &tmp}
+}
+
+// widthOf 寄存器或内存操作数的宽度, 立即数为0
+func widthOf(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		return types.RegWidth(v.Reg.Type)
+	case parser.ADDR:
+		return v.Addr.Length
+	}
+	return 0
+}
+
+// opWidth 运算宽度, 没有寄存器和带长度的内存操作数时为字长
+func (l *lowering) opWidth(args ...*parser.Value) int {
+	for _, arg := range args {
+		if w := widthOf(arg); w != 0 {
+			return w
+		}
+	}
+	return l.bits / 8
+}
+
+// bigImm 立即数不能用符号扩展的32位表示
+func (l *lowering) bigImm(v *parser.Value, width int) bool {
+	return v.Type == parser.NUMBER && width == 8 && (v.Num < math.MinInt32 || v.Num > math.MaxInt32)
+}
+
+func (l *lowering) emit(name types.Instruction, args ...*parser.Value) {
+	for n, arg := range args {
+		if arg.Type == parser.ADDR && l.pushed != 0 && l.uses(arg, numSP) {
+			// 压栈之后基于rsp的偏移增加
+			tmp := *arg
+			addr := *arg.Addr
+			addr.Displacement += l.pushed
+			tmp.Addr = &addr
+			args[n] = &tmp
+		}
+	}
+	l.out = append(l.out, &parser.Instruction{Instruction: name, Args: args})
+}
+
+func (l *lowering) push(name string) {
+	l.emit("PUSH", reg(name, l.bits/8))
+	l.pushed += int64(l.bits / 8)
+}
+
+func (l *lowering) pop(name string) {
+	l.pushed -= int64(l.bits / 8)
+	l.emit("POP", reg(name, l.bits/8))
+}
+
+// scratch 取一个指令没有用到的寄存器并压栈保存, byteReg表示需要8位的形式
+func (l *lowering) scratch(byteReg bool) (string, error) {
+	pool := scratchRegs
+	if byteReg && l.bits == 32 {
+		pool = pool[:4]
+	}
+	for n, name := range pool {
+		num := n
+		if num >= numSP {
+			// si、di的编号是6、7
+			num += 2
+		}
+		if !l.used[num] {
+			l.used[num] = true
+			l.push(name)
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("x86: no free register to lower the instruction")
+}
+
+// load 把操作数装入一个临时寄存器, 返回寄存器的名称和对应宽度的操作数
+func (l *lowering) load(v *parser.Value, width int) (string, *parser.Value, error) {
+	tmp, err := l.scratch(width == 1)
+	if err != nil {
+		return "", nil, err
+	}
+	t := reg(tmp, width)
+	l.emit("MOV", t, v)
+	return tmp, t, nil
+}
+
+// popAll 按相反的顺序恢复临时寄存器
+func (l *lowering) popAll(names []string) {
+	for n := len(names) - 1; n >= 0; n-- {
+		l.pop(names[n])
+	}
+}
+
+// binary 双操作数指令: 两个内存操作数、立即数在前的CMP和超过32位的立即数经过临时寄存器
+func (l *lowering) binary(i *parser.Instruction) error {
+	dst, src := i.Args[0], i.Args[1]
+	if i.Instruction == "STORE" {
+		dst, src = src, dst
+	}
+	width := l.opWidth(dst, src)
+	cmpImm := i.Instruction == "CMP" && dst.Type == parser.NUMBER
+	bothMem := dst.Type == parser.ADDR && src.Type == parser.ADDR
+	big := l.bigImm(src, width) && (dst.Type == parser.ADDR || i.Instruction != "MOV" && i.Instruction != "LOAD")
+	if !cmpImm && !bothMem && !big {
+		return nil
+	}
+	if i.Instruction == "XCHG" && bothMem {
+		tmp, t, err := l.load(dst, width)
+		if err != nil {
+			return err
+		}
+		l.emit("XCHG", t, src)
+		l.emit("MOV", dst, t)
+		l.pop(tmp)
+		return nil
+	}
+	var saved []string
+	if cmpImm {
+		tmp, t, err := l.load(dst, width)
+		if err != nil {
+			return err
+		}
+		saved, dst = append(saved, tmp), t
+	}
+	if bothMem || l.bigImm(src, width) {
+		tmp, t, err := l.load(src, width)
+		if err != nil {
+			return err
+		}
+		saved, src = append(saved, tmp), t
+	}
+	if i.Instruction == "STORE" {
+		l.emit("STORE", src, dst)
+	} else {
+		l.emit(i.Instruction, dst, src)
+	}
+	l.popAll(saved)
+	return nil
+}
+
+// mul 取乘积的低位
+// imul只能写寄存器, 8位的imul只有单操作数的形式, 所以字节乘法按32位计算后取低8位
+func (l *lowering) mul(dst, src *parser.Value) error {
+	width := l.opWidth(dst, src)
+	if width == 1 {
+		return l.mulByte(dst, src)
+	}
+	if dst.Type == parser.REG && !l.bigImm(src, width) {
+		return nil
+	}
+	var saved []string
+	d := dst
+	if dst.Type != parser.REG {
+		tmp, t, err := l.load(dst, width)
+		if err != nil {
+			return err
+		}
+		saved, d = append(saved, tmp), t
+	}
+	s := src
+	if l.bigImm(src, width) {
+		tmp, t, err := l.load(src, width)
+		if err != nil {
+			return err
+		}
+		saved, s = append(saved, tmp), t
+	}
+	l.emit("MUL", d, s)
+	if d != dst {
+		l.emit("MOV", dst, d)
+	}
+	l.popAll(saved)
+	return nil
+}
+
+// mulByte 字节乘法, 两个操作数零扩展到32位
+func (l *lowering) mulByte(dst, src *parser.Value) error {
+	var saved []string
+	d := dst
+	switch dst.Type {
+	case parser.REG:
+		d = resize(dst, 4)
+	case parser.ADDR:
+		tmp, err := l.scratch(true)
+		if err != nil {
+			return err
+		}
+		saved, d = append(saved, tmp), reg(tmp, 4)
+		l.extend(d, dst)
+	default:
+		return fmt.Errorf("x86: invalid MUL destination")
+	}
+	s := src
+	switch src.Type {
+	case parser.REG:
+		s = resize(src, 4)
+	case parser.ADDR:
+		tmp, err := l.scratch(false)
+		if err != nil {
+			return err
+		}
+		saved, s = append(saved, tmp), reg(tmp, 4)
+		l.extend(s, src)
+	}
+	l.emit("MUL", d, s)
+	if dst.Type == parser.ADDR {
+		l.emit("MOV", dst, resize(d, 1))
+	}
+	l.popAll(saved)
+	return nil
+}
+
+// extend 把8位的操作数零扩展到32位寄存器
+func (l *lowering) extend(dst, src *parser.Value) {
+	if src.Type == parser.REG {
+		l.emit("MOV", dst, resize(src, 4))
+		return
+	}
+	addr := *src.Addr
+	addr.Length, addr.Sign = 1, parser.UNSIGNED
+	l.emit("LOAD", dst, &parser.Value{Type: parser.ADDR, Addr: &addr})
+}
+
+// shift 移位的位数是立即数或cl, 省略时为1
+func (l *lowering) shift(i *parser.Instruction) error {
+	if len(i.Args) != 1 && len(i.Args) != 2 {
+		return fmt.Errorf("x86: %s needs 1 or 2 operands, got %d", i.Instruction, len(i.Args))
+	}
+	dst := i.Args[0]
+	if len(i.Args) == 1 {
+		l.emit(i.Instruction, dst, &parser.Value{Type: parser.NUMBER, Num: 1})
+		return nil
+	}
+	count := i.Args[1]
+	switch {
+	case count.Type == parser.NUMBER:
+		return nil
+	case l.isReg(count, numCX):
+		l.emit(i.Instruction, dst, reg("cx", 1))
+		return nil
+	case l.isReg(dst, numCX):
+		// 目标就是rcx, 在临时寄存器中移位
+		tmp, t, err := l.load(dst, widthOf(dst))
+		if err != nil {
+			return err
+		}
+		l.emit("MOV", reg("cx", l.opWidth(count)), count)
+		l.emit(i.Instruction, t, reg("cx", 1))
+		l.emit("MOV", dst, t)
+		l.pop(tmp)
+		return nil
+	case l.uses(dst, numCX):
+		return fmt.Errorf("x86: %s cannot address its destination through cx when the count is not in cx", i.Instruction)
+	}
+	l.push("cx")
+	l.emit("MOV", reg("cx", l.opWidth(count)), count)
+	l.emit(i.Instruction, dst, reg("cx", 1))
+	l.pop("cx")
+	return nil
+}
+
+// div 无符号除法 dst = dst / src
+// 被除数放在rdx:rax(字节除法为ax), 商在rax(al), 用到的rax、rdx事先保存
+func (l *lowering) div(dst, src *parser.Value) error {
+	if dst.Type == parser.ADDR && (l.uses(dst, numAX) || l.uses(dst, numDX)) {
+		return fmt.Errorf("x86: DIV cannot address its destination through ax or dx")
+	}
+	if dst.Type != parser.REG && dst.Type != parser.ADDR {
+		return fmt.Errorf("x86: invalid DIV destination")
+	}
+	width := l.opWidth(dst, src)
+	var saved []string
+	if !l.isReg(dst, numAX) {
+		saved = append(saved, "ax")
+	}
+	if width > 1 && !l.isReg(dst, numDX) {
+		saved = append(saved, "dx")
+	}
+	l.used[numAX], l.used[numDX] = true, true
+	for _, name := range saved {
+		l.push(name)
+	}
+	divisor := src
+	if src.Type == parser.NUMBER || l.uses(src, numAX) || l.uses(src, numDX) {
+		tmp, t, err := l.load(src, width)
+		if err != nil {
+			return err
+		}
+		saved, divisor = append(saved, tmp), t
+	}
+	acc := reg("ax", width)
+	if !l.isReg(dst, numAX) {
+		l.emit("MOV", acc, dst)
+	}
+	if width == 1 {
+		l.emit("AND", reg("ax", 2), &parser.Value{Type: parser.NUMBER, Num: 0xff})
+	} else {
+		l.emit("XOR", reg("dx", 4), reg("dx", 4))
+	}
+	l.emit("DIV", divisor)
+	if !l.isReg(dst, numAX) {
+		l.emit("MOV", dst, acc)
+	}
+	l.popAll(saved)
+	return nil
+}
@@ -0,0 +1,46 @@
+package x86
+
+import "CuteASM/arch/types"
+
+// 指令表instructions使用Go汇编的名称(ADDL、JGE、LEAQ), 源码中更常见的是Intel的名称。
+// 这里列出可以直接写在源码中的Intel指令, 它们不经过展开, 按原样输出到文本汇编。
+var intelMnemonics = []types.Instruction{
+	// 条件跳转
+	"JA", "JAE", "JB", "JBE", "JC", "JE", "JG", "JGE", "JL", "JLE",
+	"JNA", "JNAE", "JNB", "JNBE", "JNC", "JNE", "JNG", "JNGE", "JNL", "JNLE",
+	"JNO", "JNP", "JNS", "JNZ", "JO", "JP", "JPE", "JPO", "JS", "JZ",
+	"JECXZ", "JRCXZ", "LOOP", "LOOPE", "LOOPNE",
+
+	// 条件传送和置位
+	"CMOVA", "CMOVAE", "CMOVB", "CMOVBE", "CMOVE", "CMOVG", "CMOVGE", "CMOVL",
+	"CMOVLE", "CMOVNE", "CMOVNO", "CMOVNP", "CMOVNS", "CMOVO", "CMOVP", "CMOVS",
+	"SETA", "SETAE", "SETB", "SETBE", "SETE", "SETG", "SETGE", "SETL",
+	"SETLE", "SETNE", "SETNO", "SETNP", "SETNS", "SETO", "SETP", "SETS",
+
+	// 整数运算
+	"ADC", "SBB", "INC", "DEC", "NEG", "NOT", "TEST", "IMUL", "IDIV",
+	"SHL", "SHR", "SAL", "SAR", "ROL", "ROR", "RCL", "RCR", "SHLD", "SHRD",
+	"BT", "BTC", "BTR", "BTS", "BSF", "BSR", "BSWAP", "XADD", "CMPXCHG",
+	"CBW", "CWDE", "CDQE", "CWD",
+
+	// 数据传送
+	"LEA", "MOVZX", "MOVSX", "MOVSXD", "PUSHF", "POPF", "PUSHAD", "POPAD",
+	"LODSB", "STOSB", "MOVSB", "REP", "CLD", "STD", "CLC", "STC",
+
+	// 控制
+	"ENTER", "LEAVE", "SYSENTER", "IRET", "IRETQ", "UD2", "PAUSE",
+}
+
+// instructionSet 源码中可以使用的全部x86指令
+func instructionSet() types.InstructionMap {
+	m := make(types.InstructionMap, len(instructions)+len(intelMnemonics))
+	for name, op := range instructions {
+		m[name] = op
+	}
+	for _, name := range intelMnemonics {
+		if _, ok := m[name]; !ok {
+			m[name] = types.Opcode{}
+		}
+	}
+	return m
+}
@@ -289,6 +289,17 @@ func (e *OperandsEncoder) encodeDualOperands() (byte, error) {
 		return (byte(dst.Reg.Num & 7) << 3) | (mod << 6) | rm, nil
 	}
 
+	// 内存到寄存器
+	if dstType.Has(OpMem) && srcType.Has(OpReg) {
+		if dst.Addr == nil {
+			return 0, fmt.Errorf("memory operand is missing address information")
+		}
+
+		mod := e.getModValue(dst.Addr.Displacement, dst.Addr.LabelRef)
+		rm := e.getRMValue(dst.Addr)
+		return (byte(src.Reg.Num & 7) << 3) | (mod << 6) | rm, nil
+	}
+
 	// 立即数到内存
 	if dstType.Has(OpMem) && srcType.Has(OpImm) {
 		if dst.Addr == nil {
@@ -404,7 +415,7 @@ func (e *OperandsEncoder) encodeSegmentReg() (byte, error) {
 }
 
 // 获取Mod字段值
-func (e *OperandsEncoder) getModValue(disp float64, labelRef string) byte {
+func (e *OperandsEncoder) getModValue(disp int64, labelRef string) byte {
 	if labelRef != "" {
 		return 0b10 // 标签引用总是32位位移
 	}
@@ -488,7 +499,7 @@ func (e *OperandsEncoder) generateDisplacement() ([]byte, error) {
 // 生成立即数
 func (e *OperandsEncoder) generateImmediate() ([]byte, error) {
 	// 查找立即数操作数
-	var immValue float64
+	var immValue int64
 	var immSize int
 
 	for _, arg := range e.inst.Args {
@@ -521,7 +532,7 @@ func (e *OperandsEncoder) generateImmediate() ([]byte, error) {
 		return buf, nil
 	case 64:
 		buf := make([]byte, 8)
-		binary.LittleEndian.PutUint64(buf, uint64(int64(immValue)))
+		binary.LittleEndian.PutUint64(buf, uint64(immValue))
 		return buf, nil
 	default:
 		return nil, fmt.Errorf("unsupported immediate size: %d", immSize)
@@ -561,7 +572,7 @@ func (e *OperandsEncoder) getImmSize() int {
 }
 
 // 根据值获取立即数大小
-func getImmSizeByValue(value float64) int {
+func getImmSizeByValue(value int64) int {
 	// 根据数值大小确定
 	if value >= -128 && value <= 127 {
 		return 8
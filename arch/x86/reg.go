@@ -1,6 +1,9 @@
 package x86
 
-import "CuteASM/arch/types"
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+)
 
 var RegLookup = map[string]types.Register{
 	// 通用寄存器
@@ -85,3 +88,94 @@ var RegLookup = map[string]types.Register{
 	// 系统表指针 (210-213)
 	"gdtr": 210, "ldtr": 211, "idtr": 212, "tr": 213,
 }
+
+// 通用寄存器的硬件编号和64位名称
+var gprNames = [16]string{
+	"rax", "rcx", "rdx", "rbx", "rsp", "rbp", "rsi", "rdi",
+	"r8", "r9", "r10", "r11", "r12", "r13", "r14", "r15",
+}
+
+// regTable 虚拟寄存器表(System V调用约定), bits为32或64
+// %x0-%x3依次为rax、rcx、rdx、rbx, 与寄存器的硬件编号一致。
+// 32位模式只有8个通用寄存器, 去掉rsp、rbp后剩下6个虚拟寄存器, 参数都在栈上。
+func regTable(bits int) *types.RegTable {
+	t := &types.RegTable{
+		Arch:  "x86",
+		Bits:  bits,
+		Named: map[string]types.PhysReg{},
+	}
+	classes := [16]types.RegClass{
+		types.RegReturn, types.RegArg, types.RegArg, types.RegSaved, // rax rcx rdx rbx
+		types.RegSaved, types.RegSaved, types.RegArg, types.RegArg, // rsp rbp rsi rdi
+		types.RegArg, types.RegArg, types.RegScratch, types.RegScratch, // r8-r11
+		types.RegSaved, types.RegSaved, types.RegSaved, types.RegSaved, // r12-r15
+	}
+	names := gprNames[:]
+	if bits == 32 {
+		classes = [16]types.RegClass{
+			types.RegReturn, types.RegScratch, types.RegScratch, types.RegSaved, // eax ecx edx ebx
+			types.RegSaved, types.RegSaved, types.RegSaved, types.RegSaved, // esp ebp esi edi
+		}
+		names = make([]string, 8)
+		for num, name := range gprNames[:8] {
+			names[num] = "e" + name[1:]
+		}
+	}
+	for num, name := range names {
+		if num == 4 || num == 5 {
+			// rsp、rbp只能按名称引用
+			continue
+		}
+		t.Regs = append(t.Regs, types.PhysReg{Num: num, Name: name, Class: classes[num]})
+	}
+	for num, name := range names[:8] {
+		// %rax、%ebp 等去掉宽度前缀后为 ax、bp
+		class := types.RegScratch
+		if num == 4 || num == 5 {
+			class = types.RegSaved
+		}
+		t.Named[name[1:]] = types.PhysReg{Num: num, Name: name, Class: class}
+	}
+	return t
+}
+
+// resolveRegs 把指令中的虚拟寄存器换成硬件编号
+// 返回的是副本, 语法树保持不变
+func resolveRegs(i *parser.Instruction, table *types.RegTable) (*parser.Instruction, error) {
+	resolve := func(r *parser.Reg) (*parser.Reg, error) {
+		if r == nil || types.RegWidth(r.Type) == 0 {
+			return r, nil
+		}
+		phys, err := table.Resolve(r.Name, r.Num, types.RegWidth(r.Type))
+		if err != nil {
+			return nil, err
+		}
+		tmp := *r
+		tmp.Num = phys.Num
+		return &tmp, nil
+	}
+	out := *i
+	out.Args = make([]*parser.Value, len(i.Args))
+	for n, arg := range i.Args {
+		tmp := *arg
+		var err error
+		switch arg.Type {
+		case parser.REG:
+			tmp.Reg, err = resolve(arg.Reg)
+		case parser.ADDR:
+			addr := *arg.Addr
+			if addr.BaseReg != nil {
+				addr.BaseReg, err = resolve(addr.BaseReg)
+			}
+			if err == nil && addr.IndexReg != nil {
+				addr.IndexReg, err = resolve(addr.IndexReg)
+			}
+			tmp.Addr = &addr
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Args[n] = &tmp
+	}
+	return &out, nil
+}
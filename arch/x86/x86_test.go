@@ -0,0 +1,278 @@
+package x86
+
+import (
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"fmt"
+	"testing"
+)
+
+// 数据段中的msg供引用标签的指令使用
+const dataHead = "section .data\nmsg: DW 5\nsection .text\n"
+
+// parseInsts 解析一段源码, 返回其中的指令
+func parseInsts(t *testing.T, bits int, src string) []*parser.Instruction {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexerText("test.asm", dataHead+src+"\n"), NewMode(bits))
+	var insts []*parser.Instruction
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			insts = append(insts, i)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	return insts
+}
+
+func parseInst(t *testing.T, bits int, src string) *parser.Instruction {
+	t.Helper()
+	insts := parseInsts(t, bits, src)
+	if len(insts) != 1 {
+		t.Fatalf("%q: got %d instructions", src, len(insts))
+	}
+	return insts[0]
+}
+
+// 预期的字节与GNU as对同一条指令的输出一致(标签处为0)
+// 64位的虚拟寄存器%x0-%x13依次为rax、rcx、rdx、rbx、rsi、rdi、r8-r15
+func TestDoASM(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		want string
+	}{
+		{64, "mov %r0, 5", "48c7c005000000"},
+		{64, "mov %e10, 1", "41bc01000000"},
+		{64, "add %r0, %r8", "4c01d0"},
+		{64, "mul %e1", "f7e1"},
+		{64, "call %r0", "ffd0"},
+		{64, "mov %r0, msg", "488d0500000000"},
+		{64, "mov %r3, 0x123456789", "48bb8967452301000000"},
+		{64, "mov %r3, -1", "48c7c3ffffffff"},
+		{64, "mov %e3, 0xffffffff", "bbffffffff"},
+		{64, "mov %l4, 3", "40b603"},
+		{64, "mov %n2, 0x1234", "66ba3412"},
+		{64, "add %r5, 100", "4883c764"},
+		{64, "add %r5, 1000", "4881c7e8030000"},
+		{64, "add DW[%r1+%r2*4+0x100], %e4", "01b49100010000"},
+		{64, "add QW[%r13], 1", "49830701"},
+		{64, "add QW[%r10], %r11", "4d012c24"},
+		{64, "mov DW[msg], 1", "c7050000000001000000"},
+		{64, "mul %r9, 7", "4d6bdb07"},
+		{64, "mul %e0, 1000", "69c0e8030000"},
+		{64, "not %r12", "49f7d6"},
+		{64, "shiftl %e3", "d1e3"},
+		{64, "shiftl %r3, 4", "48c1e304"},
+		{64, "xchg %r11, QW[%r0]", "4c8728"},
+		{64, "push %r9", "4153"},
+		{64, "pop %r10", "415c"},
+		{64, "push 1000", "68e8030000"},
+		{64, "cmp %r3, %r10", "4c39e3"},
+		{64, "jmpz 16", "0f8410000000"},
+		{64, "syscall", "0f05"},
+		{32, "mov %e0, 5", "b805000000"},
+		{32, "add DW[%e1+8], %e2", "015108"},
+		{32, "mov DW[0x1000], 1", "c7050010000001000000"},
+		{32, "mov %e0, msg", "b800000000"},
+		{32, "push %e0", "50"},
+	}
+	for _, tt := range tests {
+		i := parseInst(t, tt.bits, tt.src)
+		got, err := DoASM(i, NewMode(tt.bits))
+		if err != nil {
+			t.Errorf("%d: %s: %v", tt.bits, tt.src, err)
+			continue
+		}
+		if fmt.Sprintf("%x", got) != tt.want {
+			t.Errorf("%d: %s = %x, want %s", tt.bits, tt.src, got, tt.want)
+		}
+	}
+}
+
+// 无法编码的指令和操作数返回错误, 不能输出错误的机器码
+func TestDoASMErrors(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+	}{
+		{64, "cpuid"},                    // instructions表中的指令
+		{64, "add DW[%r1], %r0"},         // 宽度不一致
+		{64, "shiftr %e1, %e2"},          // 位数不在cl中, 需要Lower
+		{64, "div %e1, 3"},               // 两个操作数的DIV需要Lower
+		{64, "cmp 5, %e0"},               // 立即数在前
+		{64, "push %e0"},                 // 64位模式只能压入字长
+		{64, "mov QW[%r1], 0x123456789"}, // 超过32位的立即数需要Lower
+		{32, "mov %l4, 3"},               // esi没有8位的形式
+	}
+	for _, tt := range tests {
+		i := parseInst(t, tt.bits, tt.src)
+		if got, err := DoASM(i, NewMode(tt.bits)); err == nil {
+			t.Errorf("%d: %s = %x, want an error", tt.bits, tt.src, got)
+		}
+	}
+}
+
+// 标签的位置按指令末尾计算相对偏移, 立即数在偏移之后
+func TestFixups(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		at   int
+		rel  bool
+	}{
+		{64, "mov %r0, msg", 3, true},
+		{64, "mov DW[msg], 1", 2, true},
+		{64, "jmp msg", 1, true},
+		{64, "add %r1, QW[msg+4]", 3, true},
+		{32, "mov DW[msg], 1", 2, false},
+		{32, "mov %e0, msg", 1, false},
+	}
+	for _, tt := range tests {
+		i := parseInst(t, tt.bits, tt.src)
+		_, fixups, err := assemble(i, NewMode(tt.bits))
+		if err != nil {
+			t.Errorf("%d: %s: %v", tt.bits, tt.src, err)
+			continue
+		}
+		if len(fixups) != 1 || fixups[0].at != tt.at || fixups[0].rel != tt.rel {
+			t.Errorf("%d: %s: fixups %+v, want one at %d rel %v", tt.bits, tt.src, fixups, tt.at, tt.rel)
+		}
+	}
+}
+
+// assembleSrc 按编译器的顺序把源码交给后端, 返回机器码
+func assembleSrc(t *testing.T, bits int, src string) (*Backend, []byte, error) {
+	t.Helper()
+	target := "x86"
+	if bits == 64 {
+		target = "x86_64"
+	}
+	b := NewBackend(target, NASM)
+	p := parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), b.Arch())
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		for _, c := range n.Children {
+			switch v := c.Value.(type) {
+			case *parser.LabelBlock:
+				b.Label(v.Name)
+			case *parser.Instruction:
+				if err := b.Emit(v); err != nil {
+					t.Fatal(err)
+				}
+			case *parser.DataBlock:
+				if err := b.Data(v); err != nil {
+					t.Fatal(err)
+				}
+			case *parser.ConstBlock:
+				if !v.Expr.IsConst() {
+					b.EquLine(v.Name, v.Expr)
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	code, err := b.Assemble()
+	return b, code, err
+}
+
+// 标签的地址从0开始, 相对偏移按指令末尾计算
+func TestAssembleLabels(t *testing.T) {
+	tests := []struct {
+		bits int
+		src  string
+		want string
+	}{
+		{64, "start:\n    jmp start", "e9fbffffff"},
+		{64, "    jmpz next\nnext:\n    ret", "0f8400000000c3"},
+		{64, "    mov DW[v], 1\n    ret\nv: DW 0", "c7050100000001000000c300000000"},
+		{32, "    mov DW[v], 1\n    ret\nv: DW 0", "c7050b00000001000000c300000000"},
+		{64, "p: QW q\nq: DW 1", "080000000000000001000000"},
+		{32, "    mov %e0, end - start\nstart:\n    ret\nend:\nCONST size, end - start", "b801000000c3"},
+	}
+	for _, tt := range tests {
+		_, code, err := assembleSrc(t, tt.bits, tt.src)
+		if err != nil {
+			t.Errorf("%d: %q: %v", tt.bits, tt.src, err)
+			continue
+		}
+		if fmt.Sprintf("%x", code) != tt.want {
+			t.Errorf("%d: %q = %x, want %s", tt.bits, tt.src, code, tt.want)
+		}
+	}
+}
+
+// 没有在本文件中定义的符号需要链接器
+func TestAssembleUndefined(t *testing.T) {
+	for _, src := range []string{"EXTERN puts\n    call puts", "EXTERN puts\np: QW puts"} {
+		if _, code, err := assembleSrc(t, 64, src); err == nil {
+			t.Errorf("%q = %x, want an error", src, code)
+		}
+	}
+}
+
+// 64位模式下标签按RIP相对寻址, 与内置编码一致; 32位是绝对地址
+func TestFormatRIP(t *testing.T) {
+	tests := []struct {
+		bits int
+		d    Dialect
+		src  string
+		want string
+	}{
+		{64, NASM, "mov %r0, msg", "lea rax, [msg]"},
+		{64, GAS, "mov %r0, msg", "leaq msg(%rip), %rax"},
+		{64, GASIntel, "mov %r0, msg + 4", "lea rax, [rip+msg+4]"},
+		{64, MASM, "mov %r0, msg", "lea rax, [msg]"},
+		{64, NASM, "mov %e0, DW[msg]", "mov eax, dword [msg]"},
+		{64, GAS, "mov %e0, DW[msg]", "movl msg(%rip), %eax"},
+		{64, GASIntel, "mov %e0, DW[msg]", "mov eax, dword ptr [rip+msg]"},
+		{64, MASM, "mov %e0, DW[msg]", "mov eax, dword ptr [msg]"},
+		{64, NASM, "mov %e0, DW[16]", "mov eax, dword [abs 16]"},
+		{64, GAS, "mov %e0, DW[16]", "movl 16, %eax"},
+		{64, GAS, "mov %e0, DW[%r1 + msg]", "movl msg(%rcx), %eax"},
+		{32, NASM, "mov %e0, msg", "mov eax, msg"},
+		{32, GAS, "mov %e0, DW[msg]", "movl msg, %eax"},
+		{32, GASIntel, "mov %e0, msg", "mov eax, offset msg"},
+	}
+	for _, tt := range tests {
+		arch := NewMode(tt.bits)
+		got, err := Format(parseInst(t, tt.bits, tt.src), tt.d, arch.Registers, tt.bits)
+		if err != nil {
+			t.Errorf("%d %s: %q: %v", tt.bits, tt.d, tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%d %s: %q = %q, want %q", tt.bits, tt.d, tt.src, got, tt.want)
+		}
+	}
+}
+
+// NASM限制了填充长度的代码对齐使用与内置编码相同的多字节NOP
+func TestFormatAlignMax(t *testing.T) {
+	a := &parser.AlignBlock{Align: 16, Max: 3, Code: true}
+	got, err := FormatAlign(a, NASM, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := "((-($-$$)) & 15)"
+	want := []string{
+		"times (" + pad + " == 1) db 0x90",
+		"times (" + pad + " == 2) db 0x66, 0x90",
+		"times (" + pad + " == 3) db 0x0f, 0x1f, 0x00",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	a = &parser.AlignBlock{Align: 16, Max: 3, Fill: 0xcc, HasFill: true, Code: true}
+	got, err = FormatAlign(a, NASM, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "times (" + pad + " <= 3) * " + pad + " db 204"; len(got) != 1 || got[0] != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+; 内置指令一致性测试
+; 同一程序在各个目标上运行, 结束时(HALT前)的寄存器应当相同:
+;   %e0 = 0x2a  %e1 = 0x30  %e2 = 7  %e3 = 0xfffffffe  %e4 = 0x80  %e5 = 0x2a
+;   cell = 0x1234  flag = 1
+; 参照结果由解释器给出: CuteASM builtin.asm run
+section .data
+cell: DW 0x1230
+flag: DW 0
+
+section .text
+conformance:()
+    mov %e0, 6
+    mov %e1, 7
+    mul %e0, %e1; 42
+    add %e0, 10; 52
+    sub %e0, %e1; 45
+    and %e0, 0xfe; 44
+    or %e0, 2; 46
+    xor %e0, 4; 42
+    mov %e2, %e0
+    div %e2, 6; 7 (无符号)
+    mov %e3, 1
+    neg %e3; -1
+    shiftl %e3; -2
+    mov %e4, 0x200
+    shiftr %e4, 2; 0x80 (逻辑右移)
+    mov %e1, 3
+    not %e1; -4
+    not %e1; 3
+    shiftl %e1, 4; 0x30
+    xchg %e1, %e2
+    xchg %e1, %e2
+    load %e5, DW[cell]
+    add %e5, 4
+    store %e5, DW[cell]; 0x1234
+    push %e0
+    pop %e5
+    cmp %e5, %e0
+    jmpz equal
+    halt
+equal:
+    cmp %e3, %e4
+    jmpn less; -2 < 0x80 (有符号)
+    halt
+less:
+    mov DW[flag], 1
+    halt
@@ -0,0 +1,28 @@
+package compiler_test
+
+import (
+	"CuteASM/compiler"
+	"testing"
+)
+
+// 每个有后端的目标都有默认的调用约定, Go汇编固定使用ABI0
+func TestDefaultABI(t *testing.T) {
+	for _, target := range append(targets, "riscv64", "loongarch64") {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI("default"); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+	for _, target := range []string{"go-amd64", "go-arm64"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI("default"); err == nil {
+			t.Errorf("%s: want an error", target)
+		}
+	}
+}
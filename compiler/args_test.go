@@ -0,0 +1,97 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"strings"
+	"testing"
+)
+
+// 引用第一个和最后一个参数, 寄存器参数写回home槽, 其余参数在栈上
+const argsSrc = `section .text
+f:(dw a, qw b, dw c, dw d, dw e, dw g, dw h, dw i)
+    mov %e0, $a
+    add %e0, $i
+    ret
+`
+
+func TestArgOffsets(t *testing.T) {
+	tests := []struct {
+		target, abi string
+		want        []string
+	}{
+		{"x86", "cdecl", []string{"mov eax, dword [ebp+8]", "add eax, dword [ebp+40]", "    ret\n"}},
+		{"x86", "stdcall", []string{"mov eax, dword [ebp+8]", "add eax, dword [ebp+40]", "ret 36"}},
+		{"x86_64", "sysv", []string{"mov dword [rbp-8], edi", "mov eax, dword [rbp-8]", "add eax, dword [rbp+24]"}},
+		{"x86_64", "win64", []string{"mov dword [rbp+16], ecx", "mov eax, dword [rbp+16]", "add eax, dword [rbp+72]"}},
+		{"mips", "o32", []string{"sw $a0, 8($fp)", "lw $v0, 8($fp)", "lw $at, 40($fp)"}},
+	}
+	for _, tt := range tests {
+		c, err := compiler.NewCompiler(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI(tt.abi); err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("args.asm", argsSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", tt.abi, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(c.Code, s) {
+				t.Errorf("%s: missing %q in\n%s", tt.abi, s, c.Code)
+			}
+		}
+	}
+}
+
+// 寄存器传递的参数在模拟器上读回调用者传入的值, 没有引用的参数不写回
+func TestArgRun(t *testing.T) {
+	src := `section .text
+f:(dw a, qw b, dw c, dw d)
+    mov %e0, $a
+    sub %e0, $d
+    mov %r1, $b
+    ret
+`
+	args := []uint64{100, 0x100000002, 7, 30}
+	for _, target := range []string{"riscv", "loongarch", "mips64", "mips64el"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI("default"); err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("args.asm", src), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := newMachine(t, target, c)
+		for n, v := range args {
+			m.regs[c.ABI.ArgRegs[n]] = v
+		}
+		regs := c.Arch.Registers
+		for _, reg := range regs.Regs {
+			if reg.Num == c.ABI.ArgRegs[2] && strings.Contains(c.Code, reg.Name+", ") {
+				t.Errorf("%s: unreferenced $c spilled in\n%s", target, c.Code)
+			}
+		}
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		if r0, r1 := uint32(m.regs[regs.Regs[0].Num]), m.regs[regs.Regs[1].Num]; r0 != 70 || r1 != args[1] {
+			t.Errorf("%s: %%e0 = %d, %%r1 = %#x, want 70 and %#x", target, r0, r1, args[1])
+		}
+	}
+}
@@ -1,74 +1,311 @@
 package compiler
 
 import (
+	"CuteASM/arch"
+	"CuteASM/arch/abi"
+	"CuteASM/arch/loongarch"
+	"CuteASM/arch/mips"
+	"CuteASM/arch/plan9"
+	"CuteASM/arch/riscv"
 	"CuteASM/arch/types"
 	"CuteASM/arch/x86"
 	"CuteASM/parser"
 	"fmt"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type Compiler struct {
-	Arch  *types.Architecture
-	count int
-	Code  string
+	Arch    *types.Architecture
+	Backend arch.Backend        // 为nil时只输出段和标签
+	ABI     *abi.Convention     // 不为nil时自动生成函数的序言和尾声
+	Symbols *parser.SymbolTable // 解析得到的符号表
+	Errors  []error
+	target  string
+	count   int
+	Code    string
 }
 
-func NewCompiler(archType string) *Compiler {
-	// 根据架构类型创建对应的编译器实例
-	var archImpl *types.Architecture = x86.New()
-	code := fmt.Sprintf("; ==============================\n; Assembly Code Generated By CuteASM\n; Time: %s\n; Architecture: %s\n; OS: %s\n; ==============================\n\n", time.Now().Format(time.DateTime), archType, runtime.GOOS)
-	return &Compiler{Arch: archImpl, Code: code}
+// NewCompiler 创建目标架构的编译器, 没有后端的目标返回错误
+func NewCompiler(archType string) (*Compiler, error) {
+	var backend arch.Backend
+	switch archType {
+	case "x86", "x86_64":
+		backend = x86.NewBackend(archType, x86.NASM)
+	case "mips", "mipsel", "mips64", "mips64el":
+		backend = mips.NewBackend(mips.ConfigFor(archType))
+	case "loongarch", "loongarch64":
+		backend = loongarch.NewBackend()
+	case "go-amd64", "go-arm64":
+		backend = plan9.NewBackend(strings.TrimPrefix(archType, "go-"))
+	case "arm", "arm64":
+		// 只有寄存器表, 还不能翻译指令
+		return nil, fmt.Errorf("%s has no backend yet, use go-arm64 for Go assembly", archType)
+	case "riscv", "riscv64":
+		backend = riscv.NewBackend()
+	default:
+		return nil, fmt.Errorf("unknown target %s", archType)
+	}
+	return &Compiler{Arch: backend.Arch(), Backend: backend, target: archType}, nil
+}
+
+// SetABI 选择调用约定, "default"表示目标的默认约定
+func (c *Compiler) SetABI(name string) error {
+	if _, ok := c.Backend.(*plan9.Backend); ok {
+		return fmt.Errorf("Go assembly always uses the Go ABI0 calling convention")
+	}
+	conv, err := abi.Lookup(name, c.target)
+	if err != nil {
+		return err
+	}
+	if conv.Arch != c.Arch.Name {
+		return fmt.Errorf("calling convention %s is for %s, not %s", conv.Name, conv.Arch, c.target)
+	}
+	c.ABI = conv
+	return nil
+}
+
+// SetDialect 选择x86文本汇编的方言: nasm、gas(att)、intel、masm
+func (c *Compiler) SetDialect(name string) error {
+	if _, ok := c.Backend.(*x86.Backend); !ok {
+		return fmt.Errorf("dialects are only available for x86 targets, not %s", c.target)
+	}
+	d, err := x86.ParseDialect(name)
+	if err != nil {
+		return err
+	}
+	c.Backend = x86.NewBackend(c.target, d)
+	return nil
 }
 
 func (c *Compiler) Compile(node *parser.Node) string {
+	if node.Father == nil {
+		c.header()
+	}
+	if node.Father == nil && c.ABI != nil {
+		c.lowerFrames(node)
+	}
+	if node.Father == nil && c.Backend != nil {
+		c.Backend.Prepare(node)
+	}
+	if node.Father == nil {
+		c.Symbols = parser.SymbolsOf(node)
+		c.symbolLines()
+	}
 	for i := 0; i < len(node.Children); i++ {
 		n := node.Children[i]
 		switch n.Value.(type) {
 		case *parser.SECTION:
 			c.count = 0
 			section := n.Value.(*parser.SECTION)
-			c.Code += c.format("section " + section.Name + "; " + section.Desc)
+			c.flush()
+			if c.Backend != nil {
+				c.Backend.Section(section.Name)
+			}
+			c.Code += c.format(c.sectionLine(section.Name))
+			if section.Desc != "" {
+				c.Code += c.format(c.comment(section.Desc))
+			}
 			c.Compile(n)
 		case *parser.LabelBlock:
 			label := n.Value.(*parser.LabelBlock)
-			if label.IsFunc {
-				c.Code += c.format("; ==============================\n; Function:" + label.Name)
+			c.flush()
+			if c.Backend != nil {
+				c.Backend.Label(label.Name)
 			}
-			c.Code += c.format(label.Name + ":")
-			c.count++
 			if label.IsFunc {
-				// 使用架构特定的函数序言
-				//prologue := c.Arch.Prologue(label.Name, label.StackRoom)
-				/*for _, line := range prologue {
-					c.Code += c.format(line)
-				}*/
+				c.Code += c.format(c.comment("=============================="))
+				c.Code += c.format(c.comment("Function:" + label.Name))
 			}
+			if line := c.labelLine(label.Name); line != "" {
+				c.Code += c.format(line)
+			}
+			c.count++
 			c.Compile(n)
+			c.flush()
 			c.count--
 			if label.IsFunc {
-				c.Code += c.format("\n; Function End:" + label.Name + "\n; ==============================\n")
+				c.symbolEnd(label.Name)
+				c.Code += "\n" + c.format(c.comment("Function End:"+label.Name))
+				c.Code += c.format(c.comment("==============================")) + "\n"
+			}
+		case *parser.DataBlock:
+			c.flush()
+			if c.Backend != nil {
+				if err := c.Backend.Data(n.Value.(*parser.DataBlock)); err != nil {
+					c.Errors = append(c.Errors, err)
+					c.Code += c.format(c.comment("error: " + err.Error()))
+				}
 			}
+		case *parser.AlignBlock:
+			c.flush()
+			c.align(n.Value.(*parser.AlignBlock))
+		case *parser.ConstBlock:
+			c.flush()
+			c.equ(n.Value.(*parser.ConstBlock))
 		case *parser.Instruction:
 			instruction := n.Value.(*parser.Instruction)
-			tmp := instruction.Instruction
-			if len(instruction.Args) > 0 {
-				tmp += " "
+			if c.Backend != nil {
+				if err := c.Backend.Emit(instruction); err != nil {
+					c.Errors = append(c.Errors, err)
+					c.Code += c.format(c.comment("error: " + err.Error()))
+				}
 			}
-			for i := 0; i < len(instruction.Args); i++ {
-				//tmp += c.Arch.ParseValue(instruction.Args[i]) + ", " // 传入架构信息
-			}
-			if len(instruction.Args) > 0 {
-				tmp = tmp[:len(tmp)-2]
+		}
+	}
+	if node.Father == nil {
+		c.flush()
+		if syntax, ok := c.Backend.(arch.Syntax); ok {
+			for _, line := range syntax.Footer() {
+				c.Code += c.format(line)
 			}
-			//c.Code += c.format(tmp)
 		}
 	}
 	return c.Code
 }
 
+// header 文件头的注释和伪指令
+func (c *Compiler) header() {
+	for _, line := range []string{
+		"==============================",
+		"Assembly Code Generated By CuteASM",
+		"Time: " + time.Now().Format(time.DateTime),
+		"Architecture: " + c.target,
+		"OS: " + runtime.GOOS,
+		"==============================",
+	} {
+		c.Code += c.comment(line) + "\n"
+	}
+	c.Code += "\n"
+	if syntax, ok := c.Backend.(arch.Syntax); ok {
+		for _, line := range syntax.Header() {
+			c.Code += line + "\n"
+		}
+	}
+}
+
+// comment 按后端的写法输出注释
+func (c *Compiler) comment(text string) string {
+	if syntax, ok := c.Backend.(arch.Syntax); ok {
+		return syntax.Comment(text)
+	}
+	return "; " + text
+}
+
+func (c *Compiler) sectionLine(name string) string {
+	if syntax, ok := c.Backend.(arch.Syntax); ok {
+		return syntax.SectionLine(name)
+	}
+	return "section " + name
+}
+
+func (c *Compiler) labelLine(name string) string {
+	if syntax, ok := c.Backend.(arch.Syntax); ok {
+		return syntax.LabelLine(name)
+	}
+	return name + ":"
+}
+
+// symbolLines 声明符号的可见性
+func (c *Compiler) symbolLines() {
+	if c.Symbols == nil {
+		return
+	}
+	if s, ok := c.Backend.(arch.Symbols); ok {
+		for _, line := range s.SymbolLines(c.Symbols) {
+			c.Code += c.format(line)
+		}
+		return
+	}
+	for _, s := range c.Symbols.Symbols {
+		switch s.Bind {
+		case parser.BindGlobal, parser.BindWeak:
+			c.Code += c.format("global " + s.Name)
+		case parser.BindExtern:
+			c.Code += c.format("extern " + s.Name)
+		}
+	}
+}
+
+// symbolEnd 函数结束处的伪指令
+func (c *Compiler) symbolEnd(name string) {
+	s, ok := c.Backend.(arch.Symbols)
+	if sym := c.Symbols.Lookup(name); ok && sym != nil {
+		for _, line := range s.SymbolEnd(sym) {
+			c.Code += c.format(line)
+		}
+	}
+}
+
+// align 对齐, 没有后端时按NASM的写法输出
+func (c *Compiler) align(a *parser.AlignBlock) {
+	if c.Backend == nil {
+		c.Code += c.format("align " + strconv.Itoa(a.Align))
+		return
+	}
+	if err := c.Backend.Align(a); err != nil {
+		c.Errors = append(c.Errors, err)
+		c.Code += c.format(c.comment("error: " + err.Error()))
+	}
+}
+
+// equ 输出依赖标签地址的常量
+func (c *Compiler) equ(block *parser.ConstBlock) {
+	if c.Backend == nil {
+		c.Code += c.format(block.Name + " equ " + block.Expr.String())
+		return
+	}
+	equ, ok := c.Backend.(arch.Equ)
+	if !ok {
+		err := fmt.Errorf("constant %s depends on label addresses, which %s cannot resolve", block.Name, c.target)
+		c.Errors = append(c.Errors, err)
+		c.Code += c.format(c.comment("error: " + err.Error()))
+		return
+	}
+	line, err := equ.EquLine(block.Name, block.Expr)
+	if err != nil {
+		c.Errors = append(c.Errors, err)
+		c.Code += c.format(c.comment("error: " + err.Error()))
+		return
+	}
+	c.Code += c.format(line)
+}
+
+// Assemble 把已编译的指令编码为机器码
+func (c *Compiler) Assemble() ([]byte, error) {
+	if c.Backend == nil {
+		return nil, fmt.Errorf("no backend for %s", c.Arch.Name)
+	}
+	asm, ok := c.Backend.(arch.Assembler)
+	if !ok {
+		return nil, fmt.Errorf("%s output is assembled by an external toolchain", c.Arch.Name)
+	}
+	return asm.Assemble()
+}
+
+// lowerFrames 为所有函数生成序言和尾声
+func (c *Compiler) lowerFrames(node *parser.Node) {
+	for _, n := range node.Children {
+		if label, ok := n.Value.(*parser.LabelBlock); ok && label.IsFunc {
+			c.ABI.Lower(n, c.Arch.Registers)
+			continue
+		}
+		c.lowerFrames(n)
+	}
+}
+
+// flush 输出后端缓存的指令
+func (c *Compiler) flush() {
+	if c.Backend == nil {
+		return
+	}
+	for _, line := range c.Backend.Flush() {
+		c.Code += c.format(line)
+	}
+}
+
 func (c *Compiler) format(text string) string {
 	return strings.Repeat("    ", c.count) + text + "\n"
 }
@@ -0,0 +1,221 @@
+package compiler_test
+
+import (
+	"CuteASM/arch"
+	"CuteASM/arch/loongarch"
+	laemu "CuteASM/arch/loongarch/emu"
+	"CuteASM/arch/mips"
+	mipsemu "CuteASM/arch/mips/emu"
+	"CuteASM/arch/riscv"
+	rvemu "CuteASM/arch/riscv/emu"
+	"CuteASM/arch/x86"
+	"CuteASM/arch/x86/emu"
+	"CuteASM/compiler"
+	"CuteASM/interp"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// builtin.asm结束时的结果, 见文件开头的说明
+var (
+	wantRegs = [6]uint64{0x2a, 0x30, 7, 0xfffffffe, 0x80, 0x2a}
+	wantMem  = map[string]uint64{"cell": 0x1234, "flag": 1}
+)
+
+// 64位模式下%e0-%e5依次为eax、ecx、edx、ebx、esi、edi
+var x86Regs = [6]int{emu.RAX, emu.RCX, emu.RDX, emu.RBX, emu.RSI, emu.RDI}
+
+// 所有目标都检查能否编码, x86_64和定长指令的目标另外在模拟器上运行
+var targets = []string{"x86", "x86_64", "mips", "mipsel", "mips64", "mips64el", "riscv", "loongarch"}
+
+func parse(t *testing.T, target string, bits int) *parser.Node {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer("../builtin.asm"), x86.NewMode(bits))
+	p.Define("ARCH", target)
+	return p.Parse()
+}
+
+func compile(t *testing.T, target string) *compiler.Compiler {
+	t.Helper()
+	c, err := compiler.NewCompiler(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Compile(parse(t, target, c.Arch.WordSize))
+	for _, err := range c.Errors {
+		t.Error(err)
+	}
+	return c
+}
+
+func assemble(t *testing.T, target string) (*compiler.Compiler, []byte) {
+	t.Helper()
+	c := compile(t, target)
+	bin, err := c.Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, bin
+}
+
+// 32位的值按低32位比较, 64位目标上高32位的清零方式不同
+func check(t *testing.T, regs [6]uint64, mem map[string]uint64) {
+	t.Helper()
+	for n, want := range wantRegs {
+		if got := uint32(regs[n]); uint64(got) != want {
+			t.Errorf("%%e%d = %#x, want %#x", n, got, want)
+		}
+	}
+	for name, want := range wantMem {
+		if mem[name] != want {
+			t.Errorf("%s = %#x, want %#x", name, mem[name], want)
+		}
+	}
+}
+
+func TestBuiltinInterp(t *testing.T) {
+	m, err := interp.New(parse(t, "run", 64), interp.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Halted {
+		t.Error("returned before HALT")
+	}
+	var regs [6]uint64
+	copy(regs[:], m.Regs[:6])
+	mem := map[string]uint64{}
+	for name := range wantMem {
+		addr, ok := m.Addr(name)
+		if !ok {
+			t.Fatalf("no label %s", name)
+		}
+		if mem[name], err = m.Read(addr, 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(t, regs, mem)
+}
+
+func TestBuiltinX86_64(t *testing.T) {
+	c, bin := assemble(t, "x86_64")
+	labels := c.Backend.(*x86.Backend).Labels
+	cpu := emu.New(emu.Config{})
+	if err := cpu.Load(emu.CodeAddr, bin); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpu.Call(emu.CodeAddr + uint64(labels["conformance"])); err != nil {
+		t.Fatalf("%v\n%s", err, cpu.Dump())
+	}
+	if !cpu.Halted {
+		t.Error("returned before HLT")
+	}
+	var regs [6]uint64
+	for n, r := range x86Regs {
+		regs[n] = cpu.Regs[r]
+	}
+	mem := map[string]uint64{}
+	for name := range wantMem {
+		addr := emu.CodeAddr + int(labels[name])
+		mem[name] = uint64(cpu.Mem[addr]) | uint64(cpu.Mem[addr+1])<<8 |
+			uint64(cpu.Mem[addr+2])<<16 | uint64(cpu.Mem[addr+3])<<24
+	}
+	check(t, regs, mem)
+}
+
+// machine 定长指令目标的模拟器
+type machine struct {
+	cpu interface {
+		Load(addr uint64, code []byte) error
+		Call(addr uint64) error
+		Read(addr uint64, size int) (uint64, error)
+		Dump() string
+	}
+	regs   *[32]uint64
+	halted *bool
+	labels map[string]uint64
+	relocs []arch.Reloc
+}
+
+func newMachine(t *testing.T, target string, c *compiler.Compiler) machine {
+	switch b := c.Backend.(type) {
+	case *mips.Backend:
+		cfg := mips.ConfigFor(target)
+		cpu := mipsemu.New(mipsemu.Config{Bits: cfg.Bits, BigEndian: cfg.BigEndian})
+		return machine{cpu, &cpu.Regs, &cpu.Halted, b.Labels, b.Relocs}
+	case *riscv.Backend:
+		cpu := rvemu.New(rvemu.Config{})
+		return machine{cpu, &cpu.Regs, &cpu.Halted, b.Labels, b.Relocs}
+	case *loongarch.Backend:
+		cpu := laemu.New(laemu.Config{})
+		return machine{cpu, &cpu.Regs, &cpu.Halted, b.Labels, b.Relocs}
+	}
+	t.Fatalf("no emulator for %T", c.Backend)
+	return machine{}
+}
+
+// Assemble的地址从0开始, 代码放在地址0执行不需要重定位
+func TestBuiltinEmu(t *testing.T) {
+	for _, target := range []string{"mips", "mipsel", "mips64", "mips64el", "riscv", "loongarch"} {
+		t.Run(target, func(t *testing.T) {
+			c, bin := assemble(t, target)
+			m := newMachine(t, target, c)
+			if len(m.relocs) != 0 {
+				t.Fatalf("unexpected relocations %v", m.relocs)
+			}
+			if err := m.cpu.Load(0, bin); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.cpu.Call(m.labels["conformance"]); err != nil {
+				t.Fatalf("%v\n%s", err, m.cpu.Dump())
+			}
+			if !*m.halted {
+				t.Error("returned before HALT")
+			}
+			var regs [6]uint64
+			for n := range regs {
+				regs[n] = m.regs[c.Arch.Registers.Regs[n].Num]
+			}
+			mem := map[string]uint64{}
+			for name := range wantMem {
+				v, err := m.cpu.Read(m.labels[name], 4)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mem[name] = v
+			}
+			check(t, regs, mem)
+		})
+	}
+}
+
+func TestBuiltinAssemble(t *testing.T) {
+	for _, target := range targets {
+		t.Run(target, func(t *testing.T) {
+			if _, bin := assemble(t, target); len(bin) == 0 {
+				t.Error("no code")
+			}
+		})
+	}
+	// Go汇编由go工具链汇编, 只检查能否翻译
+	for _, target := range []string{"go-amd64", "go-arm64"} {
+		t.Run(target, func(t *testing.T) {
+			c := compile(t, target)
+			if _, ok := c.Backend.(arch.Assembler); ok {
+				t.Error("Go assembly backend claims to encode machine code")
+			}
+		})
+	}
+}
+
+// 只有寄存器表的目标不能静默地只输出标签
+func TestNoBackend(t *testing.T) {
+	for _, target := range []string{"arm", "arm64", "sparc"} {
+		if _, err := compiler.NewCompiler(target); err == nil {
+			t.Errorf("%s: want an error", target)
+		}
+	}
+}
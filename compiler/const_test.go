@@ -0,0 +1,48 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// 引用标签的CONST由后端在确定地址后计算, 标签加常量作为偏移
+const constSrc = `section .text
+f:
+    mov %e0, len
+    load %l1, BB[msg + 7]
+    ret
+section .data
+msg: BB "hello, world"
+CONST len, $ - msg
+`
+
+func TestConstLabelRun(t *testing.T) {
+	for _, target := range []string{"mips", "mips64el", "riscv", "loongarch"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("const.asm", constSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c)
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		regs := c.Arch.Registers.Regs
+		if r0, r1 := uint32(m.regs[regs[0].Num]), uint8(m.regs[regs[1].Num]); r0 != 12 || r1 != 'w' {
+			t.Errorf("%s: %%e0 = %d, %%l1 = %q, want 12 and 'w'", target, r0, r1)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"bytes"
+	"math"
+	"testing"
+)
+
+// 数据按目标的字节序存放, 读回的值与字节序无关
+const dataSrc = `section .text
+f:
+    load %e0, DW[w]
+    load %e1, DW[w + 4]
+    load %l2, BB[s + 1]
+    ret
+section .data
+w: DW 0x11223344, 1.5
+s: BB "ok", 0
+`
+
+func TestDataRun(t *testing.T) {
+	for _, target := range []string{"mips", "mipsel", "mips64", "riscv", "loongarch"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("data.asm", dataSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c)
+		want := []byte{0x44, 0x33, 0x22, 0x11}
+		if target == "mips" || target == "mips64" {
+			want = []byte{0x11, 0x22, 0x33, 0x44}
+		}
+		if w := bin[m.labels["w"]:][:4]; !bytes.Equal(w, want) {
+			t.Errorf("%s: w starts with % x, want % x", target, w, want)
+		}
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		regs := c.Arch.Registers.Regs
+		if got := uint32(m.regs[regs[0].Num]); got != 0x11223344 {
+			t.Errorf("%s: %%e0 = %#x", target, got)
+		}
+		if got := uint32(m.regs[regs[1].Num]); got != math.Float32bits(1.5) {
+			t.Errorf("%s: %%e1 = %#x, want %#x", target, got, math.Float32bits(1.5))
+		}
+		if got := uint8(m.regs[regs[2].Num]); got != 'k' {
+			t.Errorf("%s: %%l2 = %q, want 'k'", target, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 有符号和无符号的条件跳转; 内存操作数使CMP的结果提前保存, 之后的jb、jbe按无符号比较
+const jccSrc = `section .text
+f:
+    cmp %r1, %r2
+    ja L
+    jle L
+    cmp %r1, 5
+    jae L
+    jg L
+    cmp %r1, DW[msg]
+    jb L
+    jbe L
+    ret
+L:
+    ret
+section .data
+msg: DW 1
+`
+
+// 没有标志位的目标把x86的条件跳转翻译为比较和跳转
+func TestJcc(t *testing.T) {
+	tests := map[string][]string{
+		"mips64": {
+			"sltu $at, $a0, $v1", "bne $at, $zero, L",
+			"slt $at, $a0, $v1", "beq $at, $zero, L",
+			"sltiu $at, $v1, 5", "beq $at, $zero, L",
+			"slt $at, $at, $v1", "bne $at, $zero, L",
+			"sltu $t8, $v1, $at", "sltu $at, $at, $v1", "bltz $t8, L", "blez $t8, L",
+		},
+		"riscv": {
+			"bltu a2, a1, L", "bge a2, a1, L", "bgeu a1, t5, L", "blt t5, a1, L",
+			"sltu t4, a1, t5", "sltu t5, t5, a1", "blt t4, zero, L", "bge zero, t4, L",
+		},
+		"loongarch": {
+			"bltu $a2, $a1, L", "bge $a2, $a1, L", "bgeu $a1, $t6, L", "blt $t6, $a1, L",
+			"bltu $t5, $t6, L", "bgeu $t6, $t5, L",
+		},
+	}
+	for target, want := range tests {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("jcc.asm", jccSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Errorf("%s: %v", target, err)
+		}
+		// 按顺序出现
+		code := c.Code
+		for _, line := range want {
+			n := strings.Index(code, "    "+line+"\n")
+			if n < 0 {
+				t.Errorf("%s: missing %q in\n%s", target, line, c.Code)
+				break
+			}
+			code = code[n+len(line):]
+		}
+	}
+}
+
+// CMP的结果提前保存后只能按一种方式比较
+func TestJccMixed(t *testing.T) {
+	src := "section .text\nf:\n    cmp %e1, DW[msg]\n    jb f\n    jl f\n    ret\nsection .data\nmsg: DW 1\n"
+	for _, target := range []string{"mips", "riscv"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("jcc.asm", src), x86.NewMode(c.Arch.WordSize)).Parse())
+		if len(c.Errors) != 1 || !strings.Contains(c.Errors[0].Error(), "JL mixes signed and unsigned") {
+			t.Errorf("%s: got %v, want one error for JL", target, c.Errors)
+		}
+	}
+}
+
+// 各种条件跳转在模拟器上的结果与x86的语义一致
+// 第二个操作数依次为寄存器、立即数、内存, 以及CMP之后隔着其它指令(结果提前保存)的寄存器
+func TestJccRun(t *testing.T) {
+	conds := map[string]func(a, b int32) bool{
+		"je":  func(a, b int32) bool { return a == b },
+		"jne": func(a, b int32) bool { return a != b },
+		"jl":  func(a, b int32) bool { return a < b },
+		"jle": func(a, b int32) bool { return a <= b },
+		"jg":  func(a, b int32) bool { return a > b },
+		"jge": func(a, b int32) bool { return a >= b },
+		"jb":  func(a, b int32) bool { return uint32(a) < uint32(b) },
+		"jbe": func(a, b int32) bool { return uint32(a) <= uint32(b) },
+		"ja":  func(a, b int32) bool { return uint32(a) > uint32(b) },
+		"jae": func(a, b int32) bool { return uint32(a) >= uint32(b) },
+	}
+	forms := []string{
+		"mov %e2, B\n    cmp %e1, %e2\n",
+		"cmp %e1, B\n",
+		"cmp %e1, DW[v]\n",
+		"mov %e2, B\n    cmp %e1, %e2\n    mov %e3, 0\n",
+	}
+	pairs := [][2]int32{{1, 2}, {2, 1}, {2, 2}, {-1, 1}, {1, -1}}
+	for _, target := range []string{"mips", "mipsel", "mips64", "mips64el", "riscv", "loongarch"} {
+		for name, holds := range conds {
+			for _, form := range forms {
+				for _, p := range pairs {
+					src := fmt.Sprintf("section .text\nf:\n    mov %%e0, 0\n    mov %%e1, %d\n    %s    %s T\n    halt\nT:\n"+
+						"    mov %%e0, 1\n    halt\nsection .data\nv: DW %d\n",
+						p[0], strings.ReplaceAll(form, "B", fmt.Sprint(p[1])), name, p[1])
+					c, err := compiler.NewCompiler(target)
+					if err != nil {
+						t.Fatal(err)
+					}
+					c.Compile(parser.NewParser(lexer.NewLexerText("jcc.asm", src), x86.NewMode(c.Arch.WordSize)).Parse())
+					for _, err := range c.Errors {
+						t.Fatalf("%s: %v\n%s", target, err, src)
+					}
+					bin, err := c.Assemble()
+					if err != nil {
+						t.Fatal(err)
+					}
+					m := newMachine(t, target, c)
+					if err := m.cpu.Load(0, bin); err != nil {
+						t.Fatal(err)
+					}
+					if err := m.cpu.Call(m.labels["f"]); err != nil {
+						t.Fatalf("%s: %v\n%s", target, err, src)
+					}
+					got := m.regs[c.Arch.Registers.Regs[0].Num] == 1
+					if got != holds(p[0], p[1]) {
+						t.Errorf("%s: %s %d, %d: taken = %v\n%s\n%s", target, name, p[0], p[1], got, src, c.Code)
+					}
+				}
+			}
+		}
+	}
+}
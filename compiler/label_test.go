@@ -0,0 +1,60 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// 两个函数各有自己的.loop和1:
+const labelSrc = `f:()
+    mov %e0, 0
+    mov %e1, 5
+.loop:
+    add %e0, 3
+    sub %e1, 1
+    cmp %e1, 0
+    jmpz 1f
+    jmp .loop
+1:
+    jmp g
+g:()
+    mov %e1, 2
+.loop:
+    add %e0, 100
+    sub %e1, 1
+    cmp %e1, 0
+    jmpz 1f
+    jmp .loop
+1:
+    ret
+`
+
+func TestLocalLabelRun(t *testing.T) {
+	for _, target := range []string{"mips", "mips64el", "riscv", "loongarch"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("label.asm", labelSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c)
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		if r0 := uint32(m.regs[c.Arch.Registers.Regs[0].Num]); r0 != 215 {
+			t.Errorf("%s: %%e0 = %d, want 215", target, r0)
+		}
+	}
+}
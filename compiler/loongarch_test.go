@@ -0,0 +1,63 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"encoding/binary"
+	"testing"
+)
+
+// 64位立即数、乘除、移位、PC相对访存和栈在模拟器上的结果
+const loongarchSrc = `section .text
+f:
+    mov %r0, 0x123456789abcdef0
+    mov %r1, -3
+    mul %r0, %r1
+    mov %r2, 1000000007
+    div %r0, %r2
+    shiftl %r2, 33
+    shiftr %r2, 1
+    store %r2, QW[v]
+    load %r3, QW[v]
+    push %r3
+    pop %r4
+    xor %r4, %r3
+    ret
+section .data
+v: QW 0
+`
+
+func TestLoongArchRun(t *testing.T) {
+	c, err := compiler.NewCompiler("loongarch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Compile(parser.NewParser(lexer.NewLexerText("la.asm", loongarchSrc), x86.NewMode(64)).Parse())
+	for _, err := range c.Errors {
+		t.Fatal(err)
+	}
+	bin, err := c.Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMachine(t, "loongarch", c)
+	// 最后一条是ret, 即jirl $zero, $ra, 0
+	if ret := binary.LittleEndian.Uint32(bin[m.labels["v"]-4:]); ret != 0x4c000020 {
+		t.Errorf("ret = %#08x, want 0x4c000020", ret)
+	}
+	if err := m.cpu.Load(0, bin); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.cpu.Call(m.labels["f"]); err != nil {
+		t.Fatalf("%v\n%s", err, m.cpu.Dump())
+	}
+	x, y, d := uint64(0x123456789abcdef0), ^uint64(2), uint64(1000000007)
+	want := []uint64{x * y / d, y, d << 33 >> 1, d << 33 >> 1, 0}
+	for n, w := range want {
+		if got := m.regs[c.Arch.Registers.Regs[n].Num]; got != w {
+			t.Errorf("%%r%d = %#x, want %#x", n, got, w)
+		}
+	}
+}
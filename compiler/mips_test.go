@@ -0,0 +1,72 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"strings"
+	"testing"
+)
+
+// 跳转前没有依赖的指令移进延迟槽, 有依赖时填充nop
+const delaySrc = `section .text
+f:
+    mov %e0, 1
+    add %e0, 2
+    jmp L
+    add %e0, 100
+L:
+    mov %e1, %e0
+    mov %e2, g
+    call %e2
+    call g
+    halt
+g:
+    add %e1, 1
+    ret
+`
+
+func TestDelaySlots(t *testing.T) {
+	// 32位目标上相邻的几行
+	want := [][]string{
+		{"j L", "addiu $v0, $v0, 2", "addiu $v0, $v0, 100"},
+		{"addiu $a0, $a0, %lo(g)", "jalr $a0", "nop"},
+		{"jal g", "nop"},
+		{"jr $ra", "addiu $v1, $v1, 1"},
+	}
+	for _, target := range []string{"mips", "mipsel", "mips64", "mips64el"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("delay.asm", delaySrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		for _, lines := range want {
+			if c.Arch.WordSize != 32 {
+				break
+			}
+			if text := "    " + strings.Join(lines, "\n    ") + "\n"; !strings.Contains(c.Code, text) {
+				t.Errorf("%s: missing %q in\n%s", target, text, c.Code)
+			}
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := newMachine(t, target, c)
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		// 延迟槽中的指令只执行一次, 跳过的指令不执行
+		regs := c.Arch.Registers.Regs
+		if e0, e1 := uint32(m.regs[regs[0].Num]), uint32(m.regs[regs[1].Num]); e0 != 3 || e1 != 5 {
+			t.Errorf("%s: %%e0 = %d, %%e1 = %d, want 3 and 5", target, e0, e1)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/plan9"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// 参数通过FP引用, 结果写入ret, 数据符号为本文件内的k<>
+const plan9Src = `section .text
+sum:(qw a, dw b)
+    mov %r0, $a
+    mov %e1, $b
+    add %r0, %r1
+    add %r0, QW[k]
+    ret
+section .data
+k: QW 5
+`
+
+const plan9Test = `package p
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	if got := sum(40, 2); got != 47 {
+		t.Errorf("sum(40, 2) = %d, want 47", got)
+	}
+}
+`
+
+func TestPlan9Output(t *testing.T) {
+	want := map[string][]string{
+		"go-amd64": {"TEXT ·sum(SB), NOSPLIT, $0-24", "MOVQ a+0(FP), AX", "MOVL b+8(FP), CX", "ADDQ k<>(SB), AX", "MOVQ AX, ret+16(FP)"},
+		"go-arm64": {"TEXT ·sum(SB), NOSPLIT, $0-24", "MOVD a+0(FP), R0", "MOVWU b+8(FP), R1", "MOVD R0, ret+16(FP)"},
+	}
+	dir := t.TempDir()
+	files := map[string]string{"go.mod": "module p\n\ngo 1.21\n", "sum_test.go": plan9Test}
+	for _, target := range []string{"go-amd64", "go-arm64"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("sum.asm", plan9Src), c.Arch).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		for _, s := range append(want[target], `#include "textflag.h"`, "DATA k<>+0(SB)/8, $5", "GLOBL k<>(SB), NOPTR, $8") {
+			if !strings.Contains(c.Code, s) {
+				t.Errorf("%s: missing %q in\n%s", target, s, c.Code)
+			}
+		}
+		b := c.Backend.(*plan9.Backend)
+		stub := b.Stub("p")
+		if !strings.Contains(stub, "func sum(a int64, b int32) (ret int64)\n") {
+			t.Errorf("%s: stub\n%s", target, stub)
+		}
+		files["sum_"+b.GOARCH+".s"] = c.Code
+		files["sum_stub.go"] = stub
+	}
+	if testing.Short() {
+		return
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// go vet的asmdecl检查FP偏移和函数签名是否一致
+	run := func(goarch string, args ...string) {
+		cmd := exec.Command(goTool, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOARCH="+goarch, "GOFLAGS=-mod=mod")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("GOARCH=%s go %s: %v\n%s", goarch, strings.Join(args, " "), err, out)
+		}
+	}
+	for _, goarch := range []string{"amd64", "arm64"} {
+		run(goarch, "vet", ".")
+	}
+	if runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" {
+		run(runtime.GOARCH, "test", ".")
+	}
+}
+
+// 输出的Go汇编按Plan 9语法读回, 再次输出相同的函数, 换到其它目标后在模拟器上得到相同的结果
+func TestPlan9RoundTrip(t *testing.T) {
+	c, err := compiler.NewCompiler("go-amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Compile(parser.NewParser(lexer.NewLexerText("sum.asm", plan9Src), c.Arch).Parse())
+	for _, err := range c.Errors {
+		t.Fatal(err)
+	}
+	body := c.Code[strings.Index(c.Code, "TEXT"):strings.Index(c.Code, "RET")]
+	for _, target := range []string{"go-amd64", "riscv", "loongarch", "mips64"} {
+		c2, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != "go-amd64" {
+			if err := c2.SetABI("default"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c2.Compile(parser.NewParser(lexer.NewLexerText("sum_amd64.s", c.Code), c2.Arch).ParsePlan9())
+		for _, err := range c2.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		if target == "go-amd64" {
+			if !strings.Contains(c2.Code, body) {
+				t.Errorf("missing\n%s\nin\n%s", body, c2.Code)
+			}
+			continue
+		}
+		bin, err := c2.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c2)
+		m.regs[c2.ABI.ArgRegs[0]], m.regs[c2.ABI.ArgRegs[1]] = 40, 2
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["sum"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		if got := m.regs[c2.Arch.Registers.Regs[0].Num]; got != 47 {
+			t.Errorf("%s: sum(40, 2) = %d, want 47", target, got)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/compiler"
+	"testing"
+)
+
+// 各目标的虚拟寄存器表以返回值寄存器开头, %sp、%bp按名称引用
+func TestRegisterTables(t *testing.T) {
+	tests := []struct {
+		target    string
+		bits      int
+		r0, r1    string
+		sp, bp    string
+		argsStart int // 第一个参数寄存器的虚拟编号
+	}{
+		{"x86", 32, "eax", "ecx", "esp", "ebp", -1},
+		{"x86_64", 64, "rax", "rcx", "rsp", "rbp", 1},
+		{"mips", 32, "v0", "v1", "sp", "fp", 2},
+		{"mips64", 64, "v0", "v1", "sp", "fp", 2},
+		{"riscv", 64, "a0", "a1", "sp", "s0", 2},
+		{"loongarch", 64, "a0", "a1", "sp", "fp", 2},
+		{"go-arm64", 64, "x0", "x1", "sp", "x29", 1},
+	}
+	for _, tt := range tests {
+		c, err := compiler.NewCompiler(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := c.Arch.Registers
+		if r.Bits != tt.bits || r.Regs[0].Name != tt.r0 || r.Regs[1].Name != tt.r1 || r.Regs[0].Class != types.RegReturn {
+			t.Errorf("%s: bits %d, %%x0 %+v, %%x1 %+v", tt.target, r.Bits, r.Regs[0], r.Regs[1])
+		}
+		if r.Named["sp"].Name != tt.sp || r.Named["bp"].Name != tt.bp {
+			t.Errorf("%s: %%sp = %s, %%bp = %s", tt.target, r.Named["sp"].Name, r.Named["bp"].Name)
+		}
+		if args := r.Class(types.RegArg); tt.argsStart >= 0 && (len(args) == 0 || args[0] != tt.argsStart) {
+			t.Errorf("%s: argument registers %v", tt.target, args)
+		} else if tt.argsStart < 0 && len(args) != 0 {
+			t.Errorf("%s: argument registers %v, want none", tt.target, args)
+		}
+		if _, err := r.Lookup(len(r.Regs), 4); err == nil {
+			t.Errorf("%s: register %d out of range accepted", tt.target, len(r.Regs))
+		}
+		if _, err := r.Resolve("", 0, 8); (err == nil) != (tt.bits == 64) {
+			t.Errorf("%s: 64-bit %%r0 gave %v", tt.target, err)
+		}
+		if _, err := r.Resolve("sp", 0, 8); (err == nil) != (tt.bits == 64) {
+			t.Errorf("%s: 64-bit %%rsp gave %v", tt.target, err)
+		}
+	}
+}
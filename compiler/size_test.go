@@ -0,0 +1,88 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"strings"
+	"testing"
+)
+
+// LOAD把SIGNED变量符号扩展, UNSIGNED变量零扩展到更宽的寄存器
+const widenSrc = `f:()
+    VAR $s, BB, SIGNED
+    VAR $u, BB, UNSIGNED
+    VAR $d, DW, SIGNED
+    VAR $e, DW, UNSIGNED
+    mov $s, 255
+    mov $u, 255
+    mov $d, -2
+    mov $e, -2
+    load %r0, $s
+    load %r1, $u
+    load %r2, $d
+    load %r3, $e
+    ret
+`
+
+func TestWidenText(t *testing.T) {
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"nasm", []string{"movsx rax, byte [rbp-1]", "movzx rcx, byte [rbp-2]", "movsxd rdx, dword [rbp-8]", "mov ebx, dword [rbp-12]"}},
+		{"gas", []string{"movsbq -1(%rbp), %rax", "movzbq -2(%rbp), %rcx", "movslq -8(%rbp), %rdx", "movl -12(%rbp), %ebx"}},
+	}
+	for _, tt := range tests {
+		c, err := compiler.NewCompiler("x86_64")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetDialect(tt.dialect); err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("widen.asm", widenSrc), x86.NewMode(64)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", tt.dialect, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(c.Code, s) {
+				t.Errorf("%s: missing %q in\n%s", tt.dialect, s, c.Code)
+			}
+		}
+	}
+}
+
+func TestWidenRun(t *testing.T) {
+	want := []uint64{0xffffffffffffffff, 0xff, 0xfffffffffffffffe, 0xfffffffe}
+	for _, target := range []string{"mips64", "mips64el", "riscv", "loongarch"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI("default"); err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("widen.asm", widenSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c)
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		for n, w := range want {
+			if r := m.regs[c.Arch.Registers.Regs[n].Num]; r != w {
+				t.Errorf("%s: %%r%d = %#x, want %#x", target, n, r, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// 结构体变量在栈上保留整个结构体, 字段按偏移存取, 不与之后的变量重叠
+const structSrc = `STRUCT Point
+    x: DW
+    y: DW
+ENDS
+STRUCT Outer
+    c: BB
+    p: Point
+ENDS
+f:()
+    VAR $o, Outer
+    VAR $n, DW
+    mov %e1, 7
+    mov $o.p.y, %e1
+    mov %e1, 5
+    mov $o.p.x, %e1
+    mov %e1, 100
+    mov $n, %e1
+    mov %e0, $o.p.y
+    mov %e2, $o.p.x
+    sub %e0, %e2
+    mov %e2, $n
+    add %e0, %e2
+    add %e0, SIZEOF(Outer)
+    ret
+`
+
+func TestStructRun(t *testing.T) {
+	for _, target := range []string{"mips", "mips64el", "riscv", "loongarch"} {
+		c, err := compiler.NewCompiler(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.SetABI("default"); err != nil {
+			t.Fatal(err)
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("struct.asm", structSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s: %v", target, err)
+		}
+		bin, err := c.Assemble()
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m := newMachine(t, target, c)
+		if err := m.cpu.Load(0, bin); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.cpu.Call(m.labels["f"]); err != nil {
+			t.Fatalf("%s: %v\n%s", target, err, m.cpu.Dump())
+		}
+		if r0 := uint32(m.regs[c.Arch.Registers.Regs[0].Num]); r0 != 114 {
+			t.Errorf("%s: %%e0 = %d, want 114", target, r0)
+		}
+	}
+}
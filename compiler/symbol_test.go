@@ -0,0 +1,66 @@
+package compiler_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/compiler"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"strings"
+	"testing"
+)
+
+const symbolSrc = `GLOBAL main, helper:weak
+EXTERN puts:function, errno:object
+ENTRY main
+section .text
+main:()
+.loop:
+    call puts
+    mov %e0, DW[errno]
+    cmp %e0, 0
+    jmpz .loop
+    ret
+helper:
+    ret
+section .data
+tab: DW 1, 2, 3
+`
+
+// 各方言按符号表声明符号, 局部标签不导出
+func TestSymbolLines(t *testing.T) {
+	tests := []struct {
+		target, dialect string
+		want            []string
+	}{
+		{"x86_64", "nasm", []string{"global main\n", "global helper:weak\n", "extern puts\n", "extern errno\n"}},
+		{"x86_64", "gas", []string{".globl main\n", ".type main, @function\n", ".weak helper\n", ".extern puts\n", ".type puts, @function\n", ".type errno, @object\n", ".type tab, @object\n", ".size tab, 12\n", ".size main, .-main\n"}},
+		{"x86", "masm", []string{"PUBLIC main\n", "PUBLIC helper\n", "EXTERN puts:PROC\n", "EXTERN errno:BYTE\n", "END main"}},
+		{"riscv", "", []string{".globl main\n", ".weak helper\n", ".extern errno\n", ".type errno, @object\n", ".size tab, 12\n"}},
+		{"mips", "", []string{".globl main\n", ".weak helper\n", ".type puts, @function\n", ".size main, .-main\n"}},
+	}
+	for _, tt := range tests {
+		c, err := compiler.NewCompiler(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.dialect != "" {
+			if err := c.SetDialect(tt.dialect); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.Compile(parser.NewParser(lexer.NewLexerText("symbol.asm", symbolSrc), x86.NewMode(c.Arch.WordSize)).Parse())
+		for _, err := range c.Errors {
+			t.Fatalf("%s %s: %v", tt.target, tt.dialect, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(c.Code, s) {
+				t.Errorf("%s %s: missing %q in\n%s", tt.target, tt.dialect, s, c.Code)
+			}
+		}
+		for _, line := range strings.Split(c.Code, "\n") {
+			if strings.Contains(line, "loop") && (strings.Contains(line, "global") || strings.Contains(line, "globl") || strings.Contains(line, "PUBLIC")) {
+				t.Errorf("%s %s: local label exported: %s", tt.target, tt.dialect, line)
+			}
+		}
+	}
+}
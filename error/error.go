@@ -10,9 +10,8 @@ import (
 )
 
 type Error struct {
-	Text     string
-	Path     string
-	LineFeed string
+	*Source
+	Trace []string // 宏展开和INCLUDE的位置, 由内向外
 }
 
 func (e *Error) GetErrPos(start int, end int) string {
@@ -25,7 +24,8 @@ func (e *Error) GetErrPos(start int, end int) string {
 	}
 	beforeLastLine := lines[line-1]
 	col := len(beforeLastLine)
-	lineText := beforeLastLine
+	// tmp与源码共用内存, 复制后再拼接
+	lineText := append([]byte(nil), beforeLastLine...)
 	lineText = append(lineText, bytes.Split(tmp[start:], []byte(e.LineFeed))[0]...)
 	text := strconv.Itoa(line) + " | " + strings.TrimLeft(string(lineText), " \n\r\t") + "\n"
 	for i := 0; i < len(strconv.Itoa(line)+" | "+strings.TrimLeft(string(beforeLastLine), " \n\r\t"))-1; i++ {
@@ -44,14 +44,22 @@ func (e *Error) GetErrPos(start int, end int) string {
 	return text
 }
 
+func (e *Error) printTrace() {
+	for _, t := range e.Trace {
+		fmt.Println("\t" + t)
+	}
+}
+
 func (e *Error) MissError(errType string, cursor int, msg string) {
 	fmt.Println(e.GetErrPos(cursor, cursor+1) + "\033[31m" + errType + ":\033[0m " + msg)
+	e.printTrace()
 	panic("")
 	os.Exit(1)
 }
 
 func (e *Error) MissErrors(errType string, start int, end int, msg string) {
 	fmt.Println(e.GetErrPos(start, end) + "\033[31m" + errType + ":\033[0m " + msg)
+	e.printTrace()
 	panic("")
 	os.Exit(1)
 }
@@ -0,0 +1,46 @@
+package errorUtil
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Source 一个源文件, 光标是文件内的字节偏移
+// 每个文件(包括INCLUDE的文件和宏展开的文本)各有一个Source, 光标只在所属的Source中有意义
+type Source struct {
+	Path     string
+	Text     string
+	LineFeed string
+}
+
+// NewSource 创建源文件并识别换行符
+func NewSource(path string, text string) *Source {
+	s := &Source{Path: path, Text: text}
+	if strings.Count(text, "\r\n") != 0 {
+		s.LineFeed = "\r\n"
+	} else if strings.Count(text, "\n\r") != 0 {
+		s.LineFeed = "\n\r"
+	} else if strings.Count(text, "\r") != 0 {
+		s.LineFeed = "\r"
+	} else {
+		s.LineFeed = "\n"
+	}
+	return s
+}
+
+// LineCol 光标所在的行和列, 行从1开始
+func (s *Source) LineCol(cursor int) (line int, col int) {
+	before := s.Text[:min(cursor, len(s.Text))]
+	line = strings.Count(before, s.LineFeed) + 1
+	col = len(before)
+	if k := strings.LastIndex(before, s.LineFeed); k != -1 {
+		col = len(before) - k - len(s.LineFeed)
+	}
+	return line, col
+}
+
+// Position 光标所在的 文件:行:列
+func (s *Source) Position(cursor int) string {
+	line, col := s.LineCol(cursor)
+	return s.Path + ":" + strconv.Itoa(line) + ":" + strconv.Itoa(col)
+}
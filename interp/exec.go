@@ -0,0 +1,484 @@
+package interp
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/parser"
+	"fmt"
+)
+
+// step 执行一条指令, 语义见 types.BuiltinI
+func (m *Machine) step(i *parser.Instruction) error {
+	switch i.Instruction {
+	case "CMP", "JMPZ", "JMPN", "MOV", "LOAD", "STORE", "PUSH", "POP", "XCHG":
+	default:
+		// 其它指令之后的条件由目标决定
+		m.cmp = nil
+	}
+	switch i.Instruction {
+	case "MOV":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		w := m.width(i.Args[0], i.Args[1])
+		v, err := m.get(i.Args[1], w)
+		if err != nil {
+			return err
+		}
+		return m.set(i.Args[0], w, v)
+	case "LOAD":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return m.load(i.Args[0], i.Args[1])
+	case "STORE":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		w := m.width(i.Args[1], i.Args[0])
+		v, err := m.get(i.Args[0], w)
+		if err != nil {
+			return err
+		}
+		return m.set(i.Args[1], w, v)
+	case "ADD", "SUB", "AND", "OR", "XOR", "MUL", "DIV":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		return m.binary(i)
+	case "NEG", "NOT":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		w := m.width(i.Args[0])
+		v, err := m.get(i.Args[0], w)
+		if err != nil {
+			return err
+		}
+		if i.Instruction == "NEG" {
+			v = -v
+		} else {
+			v = ^v
+		}
+		return m.set(i.Args[0], w, v)
+	case "SHIFTL", "SHIFTR":
+		return m.shift(i)
+	case "XCHG":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		w := m.width(i.Args[0], i.Args[1])
+		a, err := m.get(i.Args[0], w)
+		if err != nil {
+			return err
+		}
+		b, err := m.get(i.Args[1], w)
+		if err != nil {
+			return err
+		}
+		if err := m.set(i.Args[0], w, b); err != nil {
+			return err
+		}
+		return m.set(i.Args[1], w, a)
+	case "CMP":
+		if err := need(i, 2); err != nil {
+			return err
+		}
+		w := m.width(i.Args[0], i.Args[1])
+		a, err := m.get(i.Args[0], w)
+		if err != nil {
+			return err
+		}
+		b, err := m.get(i.Args[1], w)
+		if err != nil {
+			return err
+		}
+		m.cmp = &cond{eq: a == b, lt: sext(a, w) < sext(b, w)}
+		return nil
+	case "JMPZ", "JMPN":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		if m.cmp == nil {
+			return fmt.Errorf("%s without a preceding CMP", i.Instruction)
+		}
+		if i.Instruction == "JMPZ" && !m.cmp.eq || i.Instruction == "JMPN" && !m.cmp.lt {
+			return nil
+		}
+		return m.jump(i.Args[0])
+	case "JMP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		return m.jump(i.Args[0])
+	case "CALL":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		ret := m.pc
+		if err := m.jump(i.Args[0]); err != nil {
+			return err
+		}
+		if err := m.push(CodeBase + uint64(ret)); err != nil {
+			return err
+		}
+		return m.enter(m.pc)
+	case "RET":
+		return m.ret(i)
+	case "PUSH":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		if w := widthOf(i.Args[0]); w != 0 && w != m.word && i.Args[0].Type == parser.ADDR {
+			return fmt.Errorf("PUSH of a %d-byte memory operand, the stack slot is %d bytes", w, m.word)
+		}
+		v, err := m.get(full(i.Args[0]), m.word)
+		if err != nil {
+			return err
+		}
+		return m.push(v)
+	case "POP":
+		if err := need(i, 1); err != nil {
+			return err
+		}
+		if w := widthOf(i.Args[0]); w != 0 && w != m.word && i.Args[0].Type == parser.ADDR {
+			return fmt.Errorf("POP of a %d-byte memory operand, the stack slot is %d bytes", w, m.word)
+		}
+		v, err := m.pop()
+		if err != nil {
+			return err
+		}
+		return m.set(full(i.Args[0]), m.word, v)
+	case "HALT":
+		m.Halted = true
+		return nil
+	}
+	return fmt.Errorf("%s is not a builtin instruction", i.Instruction)
+}
+
+func need(i *parser.Instruction, n int) error {
+	if len(i.Args) != n {
+		return fmt.Errorf("%s needs %d operands", i.Instruction, n)
+	}
+	return nil
+}
+
+// binary 两个操作数的运算, 结果写回第一个操作数
+func (m *Machine) binary(i *parser.Instruction) error {
+	w := m.width(i.Args[0], i.Args[1])
+	a, err := m.get(i.Args[0], w)
+	if err != nil {
+		return err
+	}
+	b, err := m.get(i.Args[1], w)
+	if err != nil {
+		return err
+	}
+	switch i.Instruction {
+	case "ADD":
+		a += b
+	case "SUB":
+		a -= b
+	case "AND":
+		a &= b
+	case "OR":
+		a |= b
+	case "XOR":
+		a ^= b
+	case "MUL":
+		a *= b
+	case "DIV":
+		if b == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		a /= b
+	}
+	return m.set(i.Args[0], w, a)
+}
+
+// shift 移位, 省略位数时移动1位, 位数只取低log2(w*8)位
+func (m *Machine) shift(i *parser.Instruction) error {
+	if len(i.Args) != 1 && len(i.Args) != 2 {
+		return fmt.Errorf("%s needs 1 or 2 operands", i.Instruction)
+	}
+	w := m.width(i.Args[0])
+	v, err := m.get(i.Args[0], w)
+	if err != nil {
+		return err
+	}
+	count := uint64(1)
+	if len(i.Args) == 2 {
+		if count, err = m.get(i.Args[1], m.width(i.Args[1])); err != nil {
+			return err
+		}
+	}
+	count &= uint64(w*8 - 1)
+	if i.Instruction == "SHIFTL" {
+		v <<= count
+	} else {
+		v >>= count
+	}
+	return m.set(i.Args[0], w, v)
+}
+
+// load 读入寄存器, 较窄的内存操作数按变量的符号扩展, 未声明时零扩展
+func (m *Machine) load(dst, src *parser.Value) error {
+	w := m.width(dst, src)
+	if dst.Type != parser.REG || src.Type != parser.ADDR || src.Addr.Length == 0 || src.Addr.Length >= w {
+		v, err := m.get(src, w)
+		if err != nil {
+			return err
+		}
+		return m.set(dst, w, v)
+	}
+	v, err := m.get(src, src.Addr.Length)
+	if err != nil {
+		return err
+	}
+	if src.Addr.Sign == parser.SIGNED {
+		v = uint64(sext(v, src.Addr.Length))
+	}
+	return m.set(dst, w, v)
+}
+
+// jump 跳转到标签或寄存器、内存中的地址
+func (m *Machine) jump(target *parser.Value) error {
+	if target.Type == parser.LABEL {
+		pc, ok := m.pcs[target.String]
+		if !ok {
+			return fmt.Errorf("jump to undefined label %s", target.String)
+		}
+		m.pc = pc
+		return nil
+	}
+	addr, err := m.get(target, m.word)
+	if err != nil {
+		return err
+	}
+	return m.goTo(addr)
+}
+
+// goTo 跳转到指令的地址
+func (m *Machine) goTo(addr uint64) error {
+	if addr == exitAddr {
+		m.pc = exitPC
+		return nil
+	}
+	if addr < CodeBase || addr-CodeBase >= uint64(len(m.prog)) {
+		return fmt.Errorf("jump to %#x, which is not an instruction", addr)
+	}
+	m.pc = int(addr - CodeBase)
+	return nil
+}
+
+// enter 进入函数, Config.Frames为真时建立栈帧
+func (m *Machine) enter(pc int) error {
+	fn := m.fns[pc]
+	if !m.cfg.Frames || fn == nil {
+		m.calls = append(m.calls, false)
+		return nil
+	}
+	if err := m.push(m.BP); err != nil {
+		return err
+	}
+	m.BP = m.SP
+	m.SP -= uint64(alignUp(fn.StackRoom, m.word))
+	m.calls = append(m.calls, true)
+	return nil
+}
+
+// ret 返回, 拆除enter建立的栈帧, RET n再弹出n字节的参数
+func (m *Machine) ret(i *parser.Instruction) error {
+	if len(i.Args) > 1 {
+		return fmt.Errorf("RET needs at most 1 operand")
+	}
+	if n := len(m.calls); n != 0 {
+		if m.calls[n-1] {
+			m.SP = m.BP
+			bp, err := m.pop()
+			if err != nil {
+				return err
+			}
+			m.BP = bp
+		}
+		m.calls = m.calls[:n-1]
+	}
+	addr, err := m.pop()
+	if err != nil {
+		return err
+	}
+	if len(i.Args) == 1 {
+		n, err := m.get(i.Args[0], m.word)
+		if err != nil {
+			return err
+		}
+		m.SP += n
+	}
+	return m.goTo(addr)
+}
+
+func (m *Machine) push(v uint64) error {
+	m.SP -= uint64(m.word)
+	return m.Write(m.SP, m.word, v)
+}
+
+func (m *Machine) pop() (uint64, error) {
+	v, err := m.Read(m.SP, m.word)
+	m.SP += uint64(m.word)
+	return v, err
+}
+
+// width 运算宽度, 取第一个寄存器或带长度的内存操作数的宽度, 都没有时为字长
+func (m *Machine) width(args ...*parser.Value) int {
+	for _, arg := range args {
+		if w := widthOf(arg); w != 0 {
+			return w
+		}
+	}
+	return m.word
+}
+
+func widthOf(v *parser.Value) int {
+	switch v.Type {
+	case parser.REG:
+		return types.RegWidth(v.Reg.Type)
+	case parser.ADDR:
+		return v.Addr.Length
+	}
+	return 0
+}
+
+// full 同一个寄存器的字长形式, PUSH和POP总是移动整个寄存器
+func full(v *parser.Value) *parser.Value {
+	if v.Type != parser.REG {
+		return v
+	}
+	r := *v.Reg
+	r.Type = types.Reg64
+	return &parser.Value{Type: parser.REG, Reg: &r}
+}
+
+// reg 寄存器的存储位置
+func (m *Machine) reg(r *parser.Reg) (*uint64, int, error) {
+	w := types.RegWidth(r.Type)
+	if w == 0 {
+		return nil, 0, fmt.Errorf("%%%s%d is not a general register", r.Name, r.Num)
+	}
+	w = min(w, m.word)
+	switch r.Name {
+	case "":
+		if r.Num < 0 || r.Num >= NumRegs {
+			return nil, 0, fmt.Errorf("virtual register %d out of range, only %d available", r.Num, NumRegs)
+		}
+		return &m.Regs[r.Num], w, nil
+	case "sp":
+		return &m.SP, w, nil
+	case "bp":
+		return &m.BP, w, nil
+	}
+	return nil, 0, fmt.Errorf("unknown register %s", r.Name)
+}
+
+// get 按宽度w读取操作数
+func (m *Machine) get(v *parser.Value, w int) (uint64, error) {
+	switch v.Type {
+	case parser.REG:
+		p, rw, err := m.reg(v.Reg)
+		if err != nil {
+			return 0, err
+		}
+		return *p & mask(min(rw, w)), nil
+	case parser.ADDR:
+		addr, err := m.addr(v.Addr)
+		if err != nil {
+			return 0, err
+		}
+		if v.Addr.Length != 0 {
+			w = v.Addr.Length
+		}
+		return m.Read(addr, w)
+	case parser.NUMBER:
+		return uint64(v.Num) & mask(w), nil
+	case parser.LABEL:
+		addr, ok := m.addrs[v.String]
+		if !ok {
+			return 0, fmt.Errorf("undefined label %s", v.String)
+		}
+		return addr & mask(w), nil
+	case parser.EXPR:
+		n, err := m.eval(v.Expr, CodeBase+uint64(m.pc-1))
+		return uint64(n) & mask(w), err
+	}
+	return 0, fmt.Errorf("operand cannot be read")
+}
+
+// set 按宽度w写入操作数, 写寄存器时高位清零
+func (m *Machine) set(v *parser.Value, w int, val uint64) error {
+	switch v.Type {
+	case parser.REG:
+		p, rw, err := m.reg(v.Reg)
+		if err != nil {
+			return err
+		}
+		*p = val & mask(rw)
+		return nil
+	case parser.ADDR:
+		addr, err := m.addr(v.Addr)
+		if err != nil {
+			return err
+		}
+		if v.Addr.Length != 0 {
+			w = v.Addr.Length
+		}
+		return m.Write(addr, w, val)
+	}
+	return fmt.Errorf("operand cannot be written")
+}
+
+// addr 内存操作数的地址, 变量和参数相对%rbp
+// 参数位于返回地址和旧的%rbp之上, 按解释器的字长重新计算位置
+func (m *Machine) addr(a *parser.MemoryAddr) (uint64, error) {
+	addr := uint64(a.Displacement)
+	base := a.BaseReg
+	switch {
+	case a.Arg != nil:
+		addr, base = m.BP+uint64(2*m.word+a.Arg.Offset), nil
+	case base != nil:
+	case a.Var != "":
+		addr += m.BP
+	}
+	for _, r := range []*parser.Reg{base, a.IndexReg} {
+		if r == nil {
+			continue
+		}
+		p, _, err := m.reg(r)
+		if err != nil {
+			return 0, err
+		}
+		if r == a.IndexReg {
+			addr += *p * uint64(a.Scale)
+		} else {
+			addr += *p
+		}
+	}
+	if a.LabelRef != "" {
+		label, ok := m.addrs[a.LabelRef]
+		if !ok {
+			return 0, fmt.Errorf("undefined label %s", a.LabelRef)
+		}
+		addr += label
+	}
+	return addr, nil
+}
+
+func mask(w int) uint64 {
+	if w >= 8 {
+		return ^uint64(0)
+	}
+	return 1<<(8*w) - 1
+}
+
+// sext 把低w字节按符号扩展
+func sext(v uint64, w int) int64 {
+	shift := 64 - 8*w
+	return int64(v<<shift) >> shift
+}
@@ -0,0 +1,394 @@
+// Package interp 直接执行解析得到的语法树
+//
+// 解释器按 arch/types.BuiltinI 描述的语义执行内置指令, 不经过任何后端,
+// 可以在没有目标硬件时测试CuteASM程序, 也是检查各后端翻译结果的参照。
+//
+// 机器模型:
+//   - NumRegs个虚拟寄存器 %r0…, 以及按名称引用的 %rsp、%rbp。
+//     写入w字节宽的寄存器时高位清零, 与后端比较时只比较低w位。
+//   - 各段按出现的顺序从DataBase开始排列, 每段按4K对齐, 之后是栈。
+//     指令不占用内存, 第n条指令的地址是CodeBase+n, 只用于CALL和跳转。
+//   - 变量和参数相对%rbp寻址。Config.Frames为真时, CALL函数会像默认的栈约定
+//     一样保存%rbp并分配局部变量, 否则由程序自己建立栈帧。
+//   - CMP记录比较结果, 只有MOV、LOAD、STORE、PUSH、POP、XCHG和条件跳转保留它,
+//     其它指令之后的JMPZ、JMPN是错误。
+package interp
+
+import (
+	"CuteASM/parser"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	NumRegs  = 32           // 虚拟寄存器的数量
+	DataBase = 0x10000      // 第一个段的地址
+	CodeBase = 0x40000000   // 第一条指令的地址
+	StackTop = 0x7fff0000   // 栈顶, 栈向低地址增长
+	exitAddr = CodeBase - 1 // Call压入的返回地址, 返回到这里时结束执行
+)
+
+// Config 解释器的设置, 为0的项使用默认值
+type Config struct {
+	WordSize  int              // 字长(字节), 默认8, 与解析时的架构一致
+	ByteOrder binary.ByteOrder // 默认小端序
+	StackSize int              // 栈的字节数, 默认64K
+	MaxSteps  int              // 最多执行的指令数, 默认100万, 用于发现死循环
+	Frames    bool             // CALL函数时自动建立栈帧
+}
+
+// Machine 解释器的状态
+type Machine struct {
+	Regs   [NumRegs]uint64
+	SP, BP uint64
+	Steps  int  // 已经执行的指令数
+	Halted bool // 因HALT停止, 否则是从入口函数返回
+
+	cfg    Config
+	big    bool
+	word   int
+	mem    []*region
+	prog   []*parser.Instruction
+	where  []string                   // 每条指令所在的标签和偏移, 用于报错
+	fns    map[int]*parser.LabelBlock // 函数入口的指令序号
+	addrs  map[string]uint64          // 标签的地址
+	pcs    map[string]int             // 标签之后第一条指令的序号
+	consts map[string]*parser.Expr    // 依赖标签地址的CONST常量
+	entry  string
+	pc     int
+	cmp    *cond
+	calls  []bool // 调用栈, 记录每次CALL是否自动建立了栈帧
+}
+
+// cond CMP a, b的结果
+type cond struct {
+	eq, lt bool
+}
+
+// Fault 执行时的错误
+type Fault struct {
+	PC    int    // 出错指令的序号
+	Where string // 所在的标签和偏移
+	Inst  string
+	Err   string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("interp: %s: %s: %s", f.Where, f.Inst, f.Err)
+}
+
+// New 布置内存并收集指令和标签
+// 数据中引用未定义的标签(EXTERN)时返回错误
+func New(root *parser.Node, cfg Config) (*Machine, error) {
+	if cfg.WordSize == 0 {
+		cfg.WordSize = 8
+	}
+	if cfg.ByteOrder == nil {
+		cfg.ByteOrder = binary.LittleEndian
+	}
+	if cfg.StackSize == 0 {
+		cfg.StackSize = 64 << 10
+	}
+	if cfg.MaxSteps == 0 {
+		cfg.MaxSteps = 1000000
+	}
+	m := &Machine{
+		cfg:    cfg,
+		big:    cfg.ByteOrder == binary.BigEndian,
+		word:   cfg.WordSize,
+		fns:    map[int]*parser.LabelBlock{},
+		addrs:  map[string]uint64{},
+		pcs:    map[string]int{},
+		consts: map[string]*parser.Expr{},
+	}
+	if t := parser.SymbolsOf(root); t != nil {
+		m.entry = t.Entry
+	}
+	l := &loader{m: m, sections: map[string]*region{}}
+	l.walk(root)
+	if err := l.layout(); err != nil {
+		return nil, err
+	}
+	m.Reset()
+	return m, nil
+}
+
+// Reset 清空寄存器和栈, 段的内容保持不变
+func (m *Machine) Reset() {
+	m.Regs = [NumRegs]uint64{}
+	m.SP, m.BP = StackTop, StackTop
+	m.Steps, m.Halted = 0, false
+	m.cmp, m.calls = nil, nil
+	stack := m.mem[len(m.mem)-1]
+	clear(stack.data)
+}
+
+// Addr 标签的地址
+func (m *Machine) Addr(label string) (uint64, bool) {
+	addr, ok := m.addrs[label]
+	return addr, ok
+}
+
+// Run 从入口执行到HALT或入口函数返回
+// 入口是ENTRY指定的符号, 没有时依次尝试main和第一个函数
+func (m *Machine) Run() error {
+	entry := m.entry
+	if entry == "" {
+		if _, ok := m.pcs["main"]; ok {
+			entry = "main"
+		} else if len(m.fns) != 0 {
+			first := len(m.prog)
+			for pc := range m.fns {
+				first = min(first, pc)
+			}
+			entry = m.fns[first].Name
+		}
+	}
+	if entry == "" {
+		return fmt.Errorf("interp: no entry point")
+	}
+	return m.Call(entry)
+}
+
+// Call 调用函数name, 参数按声明的长度依次放在栈上, 返回值在Regs[0]
+func (m *Machine) Call(name string, args ...int64) error {
+	pc, ok := m.pcs[name]
+	if !ok {
+		return fmt.Errorf("interp: undefined label %s", name)
+	}
+	if fn := m.fns[pc]; fn != nil && fn.Name == name {
+		if len(args) != len(fn.Args) {
+			return fmt.Errorf("interp: %s takes %d arguments, got %d", name, len(fn.Args), len(args))
+		}
+		m.SP -= uint64(alignUp(fn.ArgOffset, m.word))
+		for n, arg := range fn.Args {
+			if err := m.Write(m.SP+uint64(arg.Offset), arg.Length, uint64(args[n])); err != nil {
+				return fmt.Errorf("interp: %v", err)
+			}
+		}
+	} else if len(args) != 0 {
+		return fmt.Errorf("interp: %s is not a function", name)
+	}
+	sp := m.SP
+	if err := m.push(exitAddr); err != nil {
+		return fmt.Errorf("interp: %v", err)
+	}
+	if err := m.enter(pc); err != nil {
+		return m.fault(pc, err)
+	}
+	err := m.run()
+	if err == nil && !m.Halted {
+		m.SP = sp
+	}
+	return err
+}
+
+// run 执行到HALT或返回到exitAddr
+func (m *Machine) run() error {
+	for !m.Halted && m.pc != exitPC {
+		if m.pc < 0 || m.pc >= len(m.prog) {
+			return m.fault(len(m.prog)-1, fmt.Errorf("execution ran past the last instruction"))
+		}
+		if m.Steps >= m.cfg.MaxSteps {
+			return m.fault(m.pc, fmt.Errorf("step limit %d exceeded", m.cfg.MaxSteps))
+		}
+		m.Steps++
+		pc := m.pc
+		m.pc++
+		if err := m.step(m.prog[pc]); err != nil {
+			return m.fault(pc, err)
+		}
+	}
+	return nil
+}
+
+// 返回到exitAddr之后的指令序号
+const exitPC = -1
+
+func (m *Machine) fault(pc int, err error) error {
+	f := &Fault{PC: pc, Err: err.Error()}
+	if pc >= 0 && pc < len(m.prog) {
+		f.Where, f.Inst = m.where[pc], string(m.prog[pc].Instruction)
+	}
+	return f
+}
+
+// Dump 输出非0的寄存器和各段的内容
+func (m *Machine) Dump() string {
+	sb := &strings.Builder{}
+	for n, v := range m.Regs {
+		if v != 0 {
+			fmt.Fprintf(sb, "r%-2d = %#x\n", n, v)
+		}
+	}
+	fmt.Fprintf(sb, "sp  = %#x\nbp  = %#x\n", m.SP, m.BP)
+	if m.cmp != nil {
+		fmt.Fprintf(sb, "cmp: eq=%t lt=%t\n", m.cmp.eq, m.cmp.lt)
+	}
+	for _, r := range m.mem[:len(m.mem)-1] {
+		r.dump(sb)
+	}
+	return sb.String()
+}
+
+// loader 按语法树布置内存
+type loader struct {
+	m        *Machine
+	cur      *region
+	sections map[string]*region
+	order    []*region
+	labels   []labelPos
+	fixups   []fixup
+	label    string // 最近的标签, 用于报错
+	count    int    // 最近的标签之后的指令数
+}
+
+// labelPos 标签在段中的位置
+type labelPos struct {
+	name string
+	sec  *region
+	off  int
+	pc   int
+	code bool // 代码标签, 地址是指令的地址
+}
+
+// fixup 数据中依赖标签地址的值
+type fixup struct {
+	sec  *region
+	off  int
+	size int
+	expr *parser.Expr
+}
+
+func (l *loader) section(name string) {
+	r, ok := l.sections[name]
+	if !ok {
+		r = &region{name: name}
+		l.sections[name] = r
+		l.order = append(l.order, r)
+	}
+	l.cur = r
+}
+
+func (l *loader) walk(node *parser.Node) {
+	for _, n := range node.Children {
+		if l.cur == nil {
+			if _, ok := n.Value.(*parser.SECTION); !ok {
+				l.section(".text")
+			}
+		}
+		switch v := n.Value.(type) {
+		case *parser.SECTION:
+			l.section(v.Name)
+		case *parser.LabelBlock:
+			pos := labelPos{name: v.Name, sec: l.cur, off: len(l.cur.data), pc: len(l.m.prog)}
+			pos.code = isCode(l.cur.name) && !hasData(n)
+			l.labels = append(l.labels, pos)
+			if v.IsFunc {
+				l.m.fns[pos.pc] = v
+			}
+			if !v.Local {
+				l.label, l.count = v.Name, 0
+			}
+		case *parser.DataBlock:
+			l.data(v)
+		case *parser.AlignBlock:
+			pad := v.Padding(uint64(len(l.cur.data)))
+			for n := 0; n < pad; n++ {
+				l.cur.data = append(l.cur.data, v.Fill)
+			}
+		case *parser.ConstBlock:
+			l.m.consts[v.Name] = v.Expr
+		case *parser.Instruction:
+			l.m.prog = append(l.m.prog, v)
+			l.m.where = append(l.m.where, fmt.Sprintf("%s+%d", l.label, l.count))
+			l.count++
+		}
+		l.walk(n)
+	}
+}
+
+func (l *loader) data(d *parser.DataBlock) {
+	for _, it := range d.Items {
+		b := it.Bytes(l.m.cfg.ByteOrder)
+		for n := 0; n < it.Count; n++ {
+			if it.Expr != nil {
+				l.fixups = append(l.fixups, fixup{sec: l.cur, off: len(l.cur.data), size: it.Unit, expr: it.Expr})
+			}
+			l.cur.data = append(l.cur.data, b...)
+		}
+	}
+}
+
+// layout 确定各段和标签的地址, 填写依赖标签地址的数据
+func (l *loader) layout() error {
+	m := l.m
+	base := uint64(DataBase)
+	for _, r := range l.order {
+		r.base = base
+		base += uint64(alignUp(max(len(r.data), 1), 0x1000))
+		m.mem = append(m.mem, r)
+	}
+	// 栈总是最后一段
+	m.mem = append(m.mem, &region{name: "stack", base: StackTop - uint64(m.cfg.StackSize), data: make([]byte, m.cfg.StackSize)})
+	for _, pos := range l.labels {
+		m.pcs[pos.name] = pos.pc
+		if pos.code {
+			m.addrs[pos.name] = CodeBase + uint64(pos.pc)
+		} else {
+			m.addrs[pos.name] = pos.sec.base + uint64(pos.off)
+		}
+	}
+	for _, f := range l.fixups {
+		here := f.sec.base + uint64(f.off)
+		v, err := m.eval(f.expr, here)
+		if err != nil {
+			return fmt.Errorf("interp: data in %s at %#x: %v", f.sec.name, here, err)
+		}
+		if err := m.Write(here, f.size, uint64(v)); err != nil {
+			return fmt.Errorf("interp: %v", err)
+		}
+	}
+	return nil
+}
+
+// eval 计算引用标签的表达式, here是当前位置$的值
+func (m *Machine) eval(e *parser.Expr, here uint64) (int64, error) {
+	var sym func(name string) (int64, error)
+	depth := 0
+	sym = func(name string) (int64, error) {
+		if name == "$" {
+			return int64(here), nil
+		}
+		if addr, ok := m.addrs[name]; ok {
+			return int64(addr), nil
+		}
+		if c, ok := m.consts[name]; ok && depth < 64 {
+			depth++
+			defer func() { depth-- }()
+			return c.Eval(sym)
+		}
+		return 0, fmt.Errorf("undefined symbol %s", name)
+	}
+	return e.Eval(sym)
+}
+
+// isCode 段是否存放代码, 与解析器的判断一致
+func isCode(section string) bool {
+	return section == ".text" || strings.HasPrefix(section, ".text.")
+}
+
+// hasData 标签下是否直接定义了数据
+func hasData(label *parser.Node) bool {
+	for _, n := range label.Children {
+		if _, ok := n.Value.(*parser.DataBlock); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
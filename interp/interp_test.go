@@ -0,0 +1,108 @@
+package interp_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/interp"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"strings"
+	"testing"
+)
+
+// newMachine 解析一段源码, 入口为main
+func newMachine(t *testing.T, src string, cfg interp.Config) *interp.Machine {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexerText("test.asm", "section .text\nmain:()\n"+src+"\n"), x86.NewMode(64))
+	m, err := interp.New(p.Parse(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestArith(t *testing.T) {
+	tests := []struct {
+		src  string
+		want uint64
+	}{
+		{"mov %r0, 6\nmul %r0, 7", 42},
+		{"mov %r0, 5\nsub %r0, 7", 0xfffffffffffffffe},
+		{"mov %e0, 5\nsub %e0, 7", 0xfffffffe},
+		{"mov %r0, -1\nmov %l0, 3", 3}, // 高位清零
+		{"mov %r0, 100\ndiv %r0, 7", 14},
+		{"mov %r0, -8\nshiftr %r0, 1", 0x7ffffffffffffffc},
+		{"mov %r0, 3\nshiftl %r0", 6},
+		{"mov %r0, 0xf0\nand %r0, 0x3c\nor %r0, 1\nxor %r0, 0xff", 0xce},
+		{"mov %r0, 1\nneg %r0\nnot %r0", 0},
+		{"mov %r0, 1\nmov %r1, 2\nxchg %r0, %r1", 2},
+		{"push 9\npop %r0", 9},
+		{"mov %r0, 0\nmov %r1, 3\ncmp %r0, %r1\njmpn less\nmov %r0, 1\nhalt\nless:\nmov %r0, 2", 2},
+		{"mov %r0, -1\nmov %r1, 3\ncmp %r0, %r1\njmpn less\nmov %r0, 1\nhalt\nless:\nmov %r0, 2", 2},
+		{"mov %r0, 3\ncmp %r0, 3\nmov %r1, 1\njmpz eq\nmov %r0, 1\nhalt\neq:\nmov %r0, 2", 2},
+	}
+	for _, tt := range tests {
+		m := newMachine(t, tt.src+"\nhalt", interp.Config{})
+		if err := m.Run(); err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if m.Regs[0] != tt.want {
+			t.Errorf("%q: r0 = %#x, want %#x", tt.src, m.Regs[0], tt.want)
+		}
+	}
+}
+
+// 条件跳转只能使用CMP及其后保留比较结果的指令
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"jmpz main", "without a preceding CMP"},
+		{"cmp %r0, 1\nadd %r0, 1\njmpz main", "without a preceding CMP"},
+		{"mov %r1, 0\ndiv %r0, %r1", "division by zero"},
+		{"loop:\njmp loop", "step limit"},
+		{"jmp nowhere\nnowhere:", "ran past the last instruction"},
+	}
+	for _, tt := range tests {
+		m := newMachine(t, tt.src, interp.Config{MaxSteps: 100})
+		err := m.Run()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+// 函数相对%rbp访问参数和变量, 需要Frames建立栈帧
+const frameSrc = `push 4
+call f
+add %rsp, 8
+halt
+f:(dw a)
+var $x, dw
+mov $x, 7
+mov %e0, $x
+add %e0, $a
+ret`
+
+func TestFrames(t *testing.T) {
+	m := newMachine(t, frameSrc, interp.Config{Frames: true})
+	if err := m.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Regs[0] != 11 {
+		t.Errorf("r0 = %d, want 11", m.Regs[0])
+	}
+	m.Reset()
+	if err := m.Call("f", 30); err != nil {
+		t.Fatal(err)
+	}
+	if m.Regs[0] != 37 || m.BP != interp.StackTop {
+		t.Errorf("r0 = %d bp = %#x, want 37 and bp restored", m.Regs[0], m.BP)
+	}
+	// 没有栈帧时%rbp仍是栈顶, 参数在栈外
+	m = newMachine(t, frameSrc, interp.Config{})
+	if err := m.Run(); err == nil {
+		t.Error("want an error without frames")
+	}
+}
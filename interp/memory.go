@@ -0,0 +1,81 @@
+package interp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// region 一段连续的内存, 每个段和栈各占一段
+type region struct {
+	name string
+	base uint64
+	data []byte
+}
+
+func (r *region) contains(addr uint64, size int) bool {
+	return addr >= r.base && addr-r.base+uint64(size) <= uint64(len(r.data))
+}
+
+// find 包含[addr, addr+size)的内存段
+func (m *Machine) find(addr uint64, size int) (*region, error) {
+	for _, r := range m.mem {
+		if r.contains(addr, size) {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%d-byte access at %#x is outside memory", size, addr)
+}
+
+// Read 按目标字节序读取size字节的无符号数
+func (m *Machine) Read(addr uint64, size int) (uint64, error) {
+	r, err := m.find(addr, size)
+	if err != nil {
+		return 0, err
+	}
+	b := r.data[addr-r.base:][:size]
+	v := uint64(0)
+	for n := 0; n < size; n++ {
+		if m.big {
+			v = v<<8 | uint64(b[n])
+		} else {
+			v |= uint64(b[n]) << (8 * n)
+		}
+	}
+	return v, nil
+}
+
+// Write 按目标字节序写入size字节
+func (m *Machine) Write(addr uint64, size int, v uint64) error {
+	r, err := m.find(addr, size)
+	if err != nil {
+		return err
+	}
+	b := r.data[addr-r.base:][:size]
+	for n := 0; n < size; n++ {
+		if m.big {
+			b[size-1-n] = byte(v >> (8 * n))
+		} else {
+			b[n] = byte(v >> (8 * n))
+		}
+	}
+	return nil
+}
+
+// Section 段的起始地址和内容, 段不存在时ok为假
+func (m *Machine) Section(name string) (base uint64, data []byte, ok bool) {
+	for _, r := range m.mem {
+		if r.name == name {
+			return r.base, r.data, true
+		}
+	}
+	return 0, nil, false
+}
+
+// dump 按每行16字节输出段的内容
+func (r *region) dump(sb *strings.Builder) {
+	fmt.Fprintf(sb, "%s @%#x, %d bytes\n", r.name, r.base, len(r.data))
+	for off := 0; off < len(r.data); off += 16 {
+		end := min(off+16, len(r.data))
+		fmt.Fprintf(sb, "  %08x  % x\n", r.base+uint64(off), r.data[off:end])
+	}
+}
@@ -33,6 +33,11 @@ var (
 		"ENDIF":    8,
 		"CONST":    8,
 		"CONTINUE": 8,
+		"ENDFOR":   8,
+		"MACRO":    8,
+		"ENDM":     8,
+		"INCLUDE":  8,
+		"INCBIN":   8,
 		"VAR":      8,
 		"SECTION":  8,
 		"BB":       8,
@@ -43,6 +48,22 @@ var (
 		"OW":       8,
 		"YW":       8,
 		"ZW":       8,
+
+		// 对齐
+		"ALIGN":      8,
+		"PCALIGN":    8,
+		"PCALIGNMAX": 8,
+		// 结构体
+		"STRUCT": 8,
+		"ENDS":   8,
+
+		// 作用域
+		"BLOCK":    8,
+		"ENDBLOCK": 8,
+
+		// 变量的符号
+		"SIGNED":   8,
+		"UNSIGNED": 8,
 	}
 	// LexToken类型(反查用)
 	LexTokenType = map[string]int{
@@ -38,30 +38,29 @@ func (t Token) String() string {
 }
 
 func NewLexer(filename string) *Lexer {
-	l := &Lexer{
-		Filename: filename,
-	}
 	tmp, err := os.ReadFile(filename)
 	if err != nil {
 		panic(err)
 	}
-	l.Text = unsafe.String(unsafe.SliceData(tmp), len(tmp))
-	if l.Text == "" {
+	text := unsafe.String(unsafe.SliceData(tmp), len(tmp))
+	if text == "" {
 		panic("Lexer:Text is empty")
 	}
-	if strings.Count(l.Text, "\r\n") != 0 {
-		l.LineFeed = "\r\n"
-	} else if strings.Count(l.Text, "\n\r") != 0 {
-		l.LineFeed = "\n\r"
-	} else if strings.Count(l.Text, "\r") != 0 {
-		l.LineFeed = "\r"
-	} else {
-		l.LineFeed = "\n"
-	}
-	l.Error = &errorUtil.Error{
-		Text:     l.Text,
-		Path:     l.Filename,
-		LineFeed: l.LineFeed,
+	return NewLexerText(filename, text)
+}
+
+// NewLexerText 对已经在内存中的文本做词法分析, filename用于报错
+func NewLexerText(filename string, text string) *Lexer {
+	return NewLexerSource(errorUtil.NewSource(filename, text))
+}
+
+// NewLexerSource 对源文件做词法分析, 报错位置按源文件计算
+func NewLexerSource(src *errorUtil.Source) *Lexer {
+	l := &Lexer{
+		Filename: src.Path,
+		Text:     src.Text,
+		LineFeed: src.LineFeed,
+		Error:    &errorUtil.Error{Source: src},
 	}
 	l.TextLength = len(l.Text)
 	l.Cursor = 0
@@ -79,6 +78,11 @@ func (l *Lexer) GetString() string {
 			l.Error.MissError("Syntax Error", startCursor, "Only one \"\\\"\" mark was found")
 		}
 		l.Cursor++
+		if word == '\\' && l.Cursor < l.TextLength-1 {
+			// 转义的字符, 由使用者处理
+			l.Cursor++
+			continue
+		}
 		if word == '"' {
 			break
 		}
@@ -97,6 +101,11 @@ func (l *Lexer) GetChar() string {
 			l.Error.MissError("Syntax Error", startCursor, "Only one \"\\\"\" mark was found")
 		}
 		l.Cursor++
+		if word == '\\' && l.Cursor < l.TextLength-1 {
+			// 转义的字符, 由使用者处理
+			l.Cursor++
+			continue
+		}
 		if word == '\'' {
 			break
 		}
@@ -216,18 +225,6 @@ func (l *Lexer) GetToken() (Token, error) {
 				goto fallthru
 			}
 			if IsDigit(w) {
-				word2, _ := l.GetWord()
-				word3, _ := l.GetWord()
-				if word2 == "." && IsDigit(word3) {
-					token := Token{
-						Type:      NUMBER,
-						Value:     word + w + "." + word3,
-						EndCursor: l.Cursor,
-					}
-					token.Cursor = l.Cursor - len(token.Value)
-					return token, nil
-				}
-				l.Back(len(word2 + word3))
 				token := Token{
 					Type:      NUMBER,
 					Value:     word + w,
@@ -236,6 +233,8 @@ func (l *Lexer) GetToken() (Token, error) {
 				token.Cursor = l.Cursor - len(token.Value)
 				return token, nil
 			}
+			// 不是数字, 把读到的单词退回去
+			l.Back(len(w))
 		fallthru:
 			fallthrough
 		default:
@@ -258,18 +257,6 @@ func (l *Lexer) GetToken() (Token, error) {
 		return token, nil
 	}
 	if IsDigit(word) {
-		word2, _ := l.GetWord()
-		word3, _ := l.GetWord()
-		if word2 == "." && IsDigit(word3) {
-			token := Token{
-				Type:      NUMBER,
-				Value:     word + "." + word3,
-				EndCursor: l.Cursor,
-			}
-			token.Cursor = l.Cursor - len(token.Value)
-			return token, nil
-		}
-		l.Back(len(word2 + word3))
 		token := Token{
 			Type:      NUMBER,
 			Value:     word,
@@ -318,10 +305,22 @@ func (token Token) IsEmpty() bool {
 	return token.Type == 0
 }
 
+// IsDigit 判断单词是否为数字, 支持十进制、0x十六进制和0b二进制
 func IsDigit(str string) bool {
-	strLength := len(str)
-	for i := 0; i < strLength; i++ {
-		if (str[i] < '0' || str[i] > '9') && (str[i] > 'F' || str[i] < 'A') {
+	if str == "" || str[0] < '0' || str[0] > '9' {
+		return false
+	}
+	digits := "0123456789"
+	if len(str) > 2 && str[0] == '0' {
+		switch str[1] {
+		case 'x', 'X':
+			digits, str = "0123456789abcdefABCDEF", str[2:]
+		case 'b', 'B':
+			digits, str = "01", str[2:]
+		}
+	}
+	for i := 0; i < len(str); i++ {
+		if !strings.ContainsRune(digits, rune(str[i])) {
 			return false
 		}
 	}
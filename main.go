@@ -1,10 +1,16 @@
 package main
 
 import (
+	"CuteASM/arch"
+	"CuteASM/arch/plan9"
 	"CuteASM/arch/x86"
 	"CuteASM/compiler"
+	"CuteASM/interp"
 	"CuteASM/lexer"
 	"CuteASM/parser"
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,30 +21,78 @@ import (
 func main() {
 	path := "./test.asm"
 	archType := "x86" // 默认架构
-	if len(os.Args) > 1 {
-		path = os.Args[1]
+	abiName := ""     // 调用约定, 为空或none时不生成函数序言和尾声
+	dialect := ""     // x86文本汇编的方言, 默认为nasm
+	// -DNAME或-DNAME=value定义条件汇编使用的符号, 可以出现在任意位置
+	// -Idir或-I dir添加INCLUDE和INCBIN的查找目录, 按出现的顺序查找
+	// -MD同时生成make格式的依赖文件 源文件名.d
+	// -frames解释执行时CALL函数自动建立栈帧, 用于没有自己建立栈帧的程序
+	args := []string{os.Args[0]}
+	defines := []string{}
+	includes := []string{}
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case strings.HasPrefix(arg, "-D") && len(arg) > 2:
+			defines = append(defines, arg[2:])
+		case arg == "-I" && i+1 < len(os.Args):
+			i++
+			includes = append(includes, os.Args[i])
+		case strings.HasPrefix(arg, "-I") && len(arg) > 2:
+			includes = append(includes, arg[2:])
+		case arg == "-MD":
+			depFile = true
+		case arg == "-frames":
+			frames = true
+		default:
+			args = append(args, arg)
+		}
+	}
+	if len(args) > 1 {
+		path = args[1]
+	}
+	if len(args) > 2 {
+		archType = args[2] // 从命令行参数获取架构类型
+	}
+	if len(args) > 3 {
+		abiName = args[3]
 	}
-	if len(os.Args) > 2 {
-		archType = os.Args[2] // 从命令行参数获取架构类型
+	if abiName == "none" {
+		abiName = ""
+	}
+	if len(args) > 4 {
+		dialect = args[4]
 	}
 	start := time.Now()
-	if archType == "all" {
-		for _, arch := range []string{"x86", "mips", "arm", "riscv", "loongarch", "x86_64"} {
-			Compile(path, arch)
+	if archType == "run" {
+		// 不编译, 直接解释执行
+		Interpret(path, defines, includes)
+	} else if archType == "disasm" {
+		// 反汇编x86机器码, 第三个参数为x86或x86_64
+		Disasm(path, abiName)
+	} else if archType == "all" {
+		for _, arch := range []string{"x86", "mips", "riscv", "loongarch", "x86_64"} {
+			Compile(path, arch, abiName, dialect, defines, includes)
 		}
 	} else if strings.Contains(archType, ",") {
 		archs := strings.Split(archType, ",")
 		for _, arch := range archs {
-			Compile(path, strings.TrimSpace(arch))
+			Compile(path, strings.TrimSpace(arch), abiName, dialect, defines, includes)
 		}
 	} else {
-		Compile(path, archType)
+		Compile(path, archType, abiName, dialect, defines, includes)
 	}
 	fmt.Println("总耗时", time.Since(start))
 }
 
 var btmp = []byte{}
 
+// depFile 是否生成依赖文件
+var depFile bool
+
+// frames 解释执行时是否自动建立栈帧
+var frames bool
+
 func pr(block *parser.Node, tabnum int) {
 	tmp := ""
 	for i := 0; i < tabnum; i++ {
@@ -46,7 +100,7 @@ func pr(block *parser.Node, tabnum int) {
 	}
 	tmp2 := []byte{}
 	if _, ok := block.Value.(*parser.Instruction); ok {
-		tmp2 = x86.DoASM(block.Value.(*parser.Instruction), x86.New())
+		tmp2 = tryASM(block.Value.(*parser.Instruction))
 	}
 	fmt.Println(tmp, block.Value, tmp2, fmt.Sprintf("%x", tmp2))
 	btmp = append(btmp, tmp2...)
@@ -58,19 +112,161 @@ func pr(block *parser.Node, tabnum int) {
 	}
 }
 
-func Compile(path string, archType string) {
+// tryASM 用x86编码表编码一条指令
+// 内置指令要经过后端展开才能编码, 无法直接编码时返回nil
+func tryASM(i *parser.Instruction) []byte {
+	bin, err := x86.DoASM(i, x86.New())
+	if err != nil {
+		return nil
+	}
+	return bin
+}
+
+// parse 解析源文件, ARCH定义为目标架构
+// 源码使用x86的指令和寄存器, 变量和参数按目标的字长bits寻址
+func parse(path string, archType string, bits int, defines []string, includes []string) *parser.Parser {
+	lex := lexer.NewLexer(path)
+	p := parser.NewParser(lex, x86.NewMode(bits))
+	p.IncludeDirs = includes
+	p.Define("ARCH", archType)
+	for _, def := range defines {
+		name, value, _ := strings.Cut(def, "=")
+		p.Define(name, value)
+	}
+	if filepath.Ext(path) == ".s" {
+		// Go(Plan 9)汇编
+		p.ParsePlan9()
+	} else {
+		p.Parse()
+	}
+	return p
+}
+
+// Interpret 用解释器执行源文件, 输出结束时的寄存器和内存
+func Interpret(path string, defines []string, includes []string) {
+	fmt.Println("开始执行:", filepath.Base(path))
+	p := parse(path, "run", 64, defines, includes)
+	m, err := interp.New(p.Block, interp.Config{Frames: frames})
+	if err == nil {
+		err = m.Run()
+	}
+	if err != nil {
+		fmt.Println("\033[31mRun Error:\033[0m " + err.Error())
+	}
+	if m != nil {
+		fmt.Print(m.Dump())
+		fmt.Println("执行完成 指令数", m.Steps)
+	}
+}
+
+// Disasm 反汇编x86机器码并输出清单
+// 输入可以是ELF文件(反汇编.text段)、十六进制文本或原始的机器码,
+// target为x86时按32位模式解码, 为空时ELF按文件的位数, 其它输入按64位
+func Disasm(path string, target string) {
+	code, base, mode, err := loadCode(path)
+	if err != nil {
+		fmt.Println("\033[31mDisasm Error:\033[0m " + err.Error())
+		return
+	}
+	switch target {
+	case "x86":
+		mode = 32
+	case "x86_64":
+		mode = 64
+	case "":
+	default:
+		fmt.Println("\033[31mDisasm Error:\033[0m unknown target " + target)
+		return
+	}
+	for _, in := range x86.Disassemble(code, mode) {
+		line := fmt.Sprintf("%08x  %-30x %s", base+uint64(in.Addr), code[in.Addr:in.Addr+in.Len], in.Text)
+		if in.Target >= 0 {
+			line += fmt.Sprintf("; %#x", base+uint64(in.Target))
+		}
+		fmt.Println(line)
+	}
+}
+
+// loadCode 读取要反汇编的机器码, 返回代码、起始地址和ELF的位数(其它输入为64)
+func loadCode(path string) (code []byte, base uint64, mode int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		f, err := elf.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		text := f.Section(".text")
+		if text == nil {
+			return nil, 0, 0, fmt.Errorf("%s has no .text section", path)
+		}
+		code, err = text.Data()
+		mode = 64
+		if f.Class == elf.ELFCLASS32 {
+			mode = 32
+		}
+		return code, text.Addr, mode, err
+	}
+	// 十六进制文本, 允许空白和0x前缀
+	fields := strings.Fields(strings.ReplaceAll(string(data), "0x", " "))
+	if len(fields) != 0 {
+		if bin, err := hex.DecodeString(strings.Join(fields, "")); err == nil {
+			return bin, 0, 64, nil
+		}
+	}
+	return data, 0, 64, nil
+}
+
+func Compile(path string, archType string, abiName string, dialect string, defines []string, includes []string) {
 	startTime := time.Now()
 	fmt.Println("开始编译:", filepath.Base(path), "架构:", archType)
-	arch := x86.New()
-	lex := lexer.NewLexer(path)
-	p := parser.NewParser(lex, arch)
-	p.Parse()
-	pr(p.Block, 0)
 	// 创建指定架构的编译器
-	compiler := compiler.NewCompiler(archType)
+	compiler, err := compiler.NewCompiler(archType)
+	if err != nil {
+		fmt.Println("\033[31mCompile Error:\033[0m " + err.Error())
+		return
+	}
+	p := parse(path, archType, compiler.Arch.WordSize, defines, includes)
+	pr(p.Block, 0)
+	if abiName != "" {
+		if err := compiler.SetABI(abiName); err != nil {
+			fmt.Println("\033[31mCompile Error:\033[0m " + err.Error())
+			return
+		}
+	}
+	if dialect != "" {
+		if err := compiler.SetDialect(dialect); err != nil {
+			fmt.Println("\033[31mCompile Error:\033[0m " + err.Error())
+			return
+		}
+	}
 	res := compiler.Compile(p.Block)
+	for _, err := range compiler.Errors {
+		fmt.Println("\033[31mCompile Error:\033[0m " + err.Error())
+	}
+	if _, ok := compiler.Backend.(arch.Assembler); ok {
+		// 只输出文本的后端(Go汇编)由外部工具链汇编
+		if bin, err := compiler.Assemble(); err != nil {
+			fmt.Println("\033[31mAssemble Error:\033[0m " + err.Error())
+		} else {
+			fmt.Printf("%s 机器码: %x\n", archType, bin)
+		}
+	}
 	// 生成输出文件名
-	outPath := path[:len(path)-len(filepath.Ext(path))] + "." + archType + ".asm"
+	base := path[:len(path)-len(filepath.Ext(path))]
+	outPath := base + "." + archType + ".asm"
+	if backend, ok := compiler.Backend.(*plan9.Backend); ok {
+		// Go汇编按GOARCH命名, 同时生成声明函数签名的Go文件
+		outPath = base + "_" + backend.GOARCH + ".s"
+		abs, _ := filepath.Abs(path)
+		pkg := plan9.Ident(filepath.Base(filepath.Dir(abs)))
+		os.WriteFile(base+"_stub.go", []byte(backend.Stub(pkg)), 0644)
+	}
 	os.WriteFile(outPath, []byte(res), 0755)
+	if depFile {
+		os.WriteFile(base+".d", []byte(p.DepFile(outPath)), 0644)
+	}
 	fmt.Println("编译完成 耗时" + time.Since(startTime).String())
 }
@@ -0,0 +1,120 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"fmt"
+	"strings"
+)
+
+// AlignBlock 对齐
+//
+//	ALIGN 16           ; 代码段中用NOP填充, 其它段中用0填充
+//	ALIGN 8, 0xCC      ; 指定填充的字节
+//	PCALIGN 32         ; 同ALIGN, 只用于代码
+//	PCALIGNMAX 32, 8   ; 需要的填充超过8字节时不对齐
+type AlignBlock struct {
+	Align   int  // 对齐的字节数, 2的幂
+	Max     int  // 最多填充的字节数, 为-1时不限制
+	Fill    byte // 填充的字节
+	HasFill bool // 指定了填充的字节, 否则代码用NOP填充
+	Code    bool // 位于代码段
+}
+
+func (p *Parser) isAlign(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && (token.Value == "ALIGN" || token.Value == "PCALIGN" || token.Value == "PCALIGNMAX")
+}
+
+// Parse 解析 ALIGN n[, fill]、PCALIGN n、PCALIGNMAX n, max
+func (a *AlignBlock) Parse(tokens []lexer.Token, p *Parser) {
+	kind := tokens[0].Value
+	if len(tokens) < 2 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, kind+" needs an alignment")
+	}
+	cursor := tokenStart(tokens[1])
+	args := splitOperands(p.exprText(tokens[1:]))
+	values := make([]int64, len(args))
+	for n, arg := range args {
+		c, err := p.Eval(arg)
+		if err == nil && (c.IsStr || c.Int < 0) {
+			err = fmt.Errorf("%s takes non-negative integers", kind)
+		}
+		if err != nil {
+			p.Error.MissError("Expression Error", cursor, err.Error())
+		}
+		values[n] = c.Int
+	}
+	a.Align, a.Max, a.Code = int(values[0]), -1, p.inCode()
+	if a.Align < 1 || a.Align&(a.Align-1) != 0 {
+		p.Error.MissError("Syntax Error", cursor, fmt.Sprintf("alignment %d is not a power of 2", a.Align))
+	}
+	switch kind {
+	case "ALIGN":
+		if len(args) > 2 {
+			p.Error.MissError("Syntax Error", cursor, "ALIGN takes an alignment and a fill byte")
+		}
+		if len(args) == 2 {
+			if values[1] > 0xff {
+				p.Error.MissError("Syntax Error", cursor, "the fill value must be a byte")
+			}
+			a.Fill, a.HasFill = byte(values[1]), true
+		}
+	case "PCALIGN":
+		if len(args) != 1 {
+			p.Error.MissError("Syntax Error", cursor, "PCALIGN takes one alignment")
+		}
+	case "PCALIGNMAX":
+		if len(args) != 2 {
+			p.Error.MissError("Syntax Error", cursor, "PCALIGNMAX takes an alignment and the maximum padding")
+		}
+		a.Max = int(values[1])
+	}
+	if kind != "ALIGN" && !a.Code {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, kind+" can only be used in code")
+	}
+	p.ThisBlock.AddChild(&Node{Value: a})
+}
+
+// inCode 当前位置是否在代码段中, 不在任何段中时按代码处理
+func (p *Parser) inCode() bool {
+	for n := p.ThisBlock; n != nil; n = n.Father {
+		if s, ok := n.Value.(*SECTION); ok {
+			return s.Name == ".text" || strings.HasPrefix(s.Name, ".text.")
+		}
+	}
+	return true
+}
+
+// Padding 位于pc时需要填充的字节数
+func (a *AlignBlock) Padding(pc uint64) int {
+	pad := int(-pc & uint64(a.Align-1))
+	if a.Max >= 0 && pad > a.Max {
+		return 0
+	}
+	return pad
+}
+
+// DataLen 标签中数据的字节数, 包括数据之间对齐的填充, 不包括末尾的填充
+func DataLen(label *Node) int {
+	size, pad := 0, 0
+	for _, child := range label.Children {
+		switch v := child.Value.(type) {
+		case *DataBlock:
+			size += pad + v.Len()
+			pad = 0
+		case *AlignBlock:
+			if size != 0 {
+				pad += v.Padding(uint64(size + pad))
+			}
+		}
+	}
+	return size
+}
+
+// Log2 对齐字节数以2为底的对数
+func (a *AlignBlock) Log2() int {
+	n := 0
+	for 1<<n < a.Align {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+)
+
+// condBlock 一层IF/ELSE/ENDIF
+type condBlock struct {
+	cursor int  // IF所在位置, 用于报错
+	active bool // 当前分支是否汇编
+	taken  bool // 已经有分支被汇编, 或外层不汇编
+	inElse bool
+}
+
+func (p *Parser) isCond(token lexer.Token) bool {
+	if token.Type != lexer.PSEUDO {
+		return false
+	}
+	switch token.Value {
+	case "IF", "ELSE", "ENDIF":
+		return true
+	}
+	return false
+}
+
+// skipping 当前是否位于不汇编的分支中
+func (p *Parser) skipping() bool {
+	return len(p.conds) != 0 && !p.conds[len(p.conds)-1].active
+}
+
+// ParseCond 处理条件汇编
+// IF 表达式 ... ELSE ... ENDIF, 可以嵌套, 不汇编的分支中的IF不计算条件
+func (p *Parser) ParseCond(tokens []lexer.Token) {
+	switch tokens[0].Value {
+	case "IF":
+		c := &condBlock{cursor: tokens[0].Cursor}
+		if p.skipping() {
+			c.taken = true
+		} else {
+			c.active = p.condition(tokens)
+			c.taken = c.active
+		}
+		p.conds = append(p.conds, c)
+	case "ELSE":
+		if len(p.conds) == 0 {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "ELSE without IF")
+		}
+		c := p.conds[len(p.conds)-1]
+		if c.inElse {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "duplicate ELSE")
+		}
+		if len(tokens) > 1 && tokens[1].Type == lexer.PSEUDO && tokens[1].Value == "IF" {
+			// ELSE IF 表达式
+			if c.taken {
+				c.active = false
+			} else {
+				c.active = p.condition(tokens[1:])
+				c.taken = c.active
+			}
+			return
+		}
+		if len(tokens) > 1 {
+			p.Error.MissError("Syntax Error", tokens[1].Cursor, "unexpected "+tokens[1].Value+" after ELSE")
+		}
+		c.inElse = true
+		c.active = !c.taken
+		c.taken = true
+	case "ENDIF":
+		if len(p.conds) == 0 {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDIF without IF")
+		}
+		if len(tokens) > 1 {
+			p.Error.MissError("Syntax Error", tokens[1].Cursor, "unexpected "+tokens[1].Value+" after ENDIF")
+		}
+		p.conds = p.conds[:len(p.conds)-1]
+	}
+}
+
+// condition 计算IF后面的条件表达式
+func (p *Parser) condition(tokens []lexer.Token) bool {
+	if len(tokens) < 2 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "IF needs a condition")
+	}
+	c, err := p.Eval(p.exprText(tokens[1:]))
+	if err != nil {
+		p.Error.MissError("Expression Error", tokenStart(tokens[1]), err.Error())
+	}
+	return c.Bool()
+}
@@ -0,0 +1,97 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// imms 按NAME=VALUE定义符号后解析, 返回各条指令最后一个操作数的值
+func imms(t *testing.T, src string, defines ...string) []int64 {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), x86.NewMode(64))
+	for _, def := range defines {
+		name, value, _ := strings.Cut(def, "=")
+		p.Define(name, value)
+	}
+	var nums []int64
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok && len(i.Args) != 0 {
+			nums = append(nums, i.Args[len(i.Args)-1].Num)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	return nums
+}
+
+// wantError 解析出错时MissError会panic
+func wantError(t *testing.T, src string) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%q: want an error", src)
+		}
+	}()
+	parseInsts(t, src)
+}
+
+const condSrc = `mov %r0, 1
+IF ARCH == "x86_64"
+    mov %r0, 2
+    IF DEFINED(DEBUG)
+        mov %r0, 3
+    ELSE
+        mov %r0, 4
+    ENDIF
+ELSE IF ARCH == "riscv"
+    mov %r0, 5
+    IF 1
+        mov %r0, 6
+    ENDIF
+ELSE
+    mov %r0, 7
+ENDIF
+mov %r0, 8`
+
+func TestCond(t *testing.T) {
+	tests := []struct {
+		defines []string
+		want    []int64
+	}{
+		{[]string{"ARCH=x86_64"}, []int64{1, 2, 4, 8}},
+		{[]string{"ARCH=x86_64", "DEBUG"}, []int64{1, 2, 3, 8}},
+		{[]string{"ARCH=riscv", "DEBUG"}, []int64{1, 5, 6, 8}},
+		{[]string{"ARCH=mips"}, []int64{1, 7, 8}},
+	}
+	for _, tt := range tests {
+		if got := imms(t, condSrc, tt.defines...); !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.defines, got, tt.want)
+		}
+	}
+	// 不汇编的分支中的IF不计算条件, 其中未定义的符号不报错
+	if got := imms(t, "IF 0\nIF NOPE / 0\nmov %r0, 1\nENDIF\nELSE\nmov %r0, 2\nENDIF"); !slices.Equal(got, []int64{2}) {
+		t.Errorf("skipped IF gave %v", got)
+	}
+}
+
+func TestCondErrors(t *testing.T) {
+	for _, src := range []string{
+		"ELSE",
+		"ENDIF",
+		"IF 1\nmov %r0, 1",
+		"IF 1\nELSE\nELSE\nENDIF",
+		"IF\nENDIF",
+		"IF 1\nELSE 2\nENDIF",
+		"IF 1\nENDIF 2",
+		"IF NOPE\nENDIF",
+	} {
+		wantError(t, src)
+	}
+}
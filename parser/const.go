@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+)
+
+// ConstBlock 依赖标签地址的常量, 如 CONST messageLen, $ - message
+// 不依赖标签的常量在解析时直接求值, 不生成节点
+type ConstBlock struct {
+	Name string
+	Expr *Expr
+}
+
+// Parse 解析 CONST name, 表达式
+func (c *ConstBlock) Parse(tokens []lexer.Token, p *Parser) {
+	if len(tokens) < 4 || tokens[1].Type != lexer.NAME || tokens[2].Value != "," {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "CONST needs a name and a value: CONST name, expr")
+	}
+	c.Name = tokens[1].Value
+	if p.IsDefined(c.Name) {
+		p.Error.MissError("Syntax Error", tokenStart(tokens[1]), "constant "+c.Name+" is already defined")
+	}
+	e, err := p.ParseExpr(p.exprText(tokens[3:]))
+	if err != nil {
+		p.Error.MissError("Expression Error", tokenStart(tokens[3]), err.Error())
+	}
+	if e.IsConst() {
+		if p.Defines == nil {
+			p.Defines = map[string]Const{}
+		}
+		p.Defines[c.Name] = e.Val
+		return
+	}
+	if p.equs == nil {
+		p.equs = map[string]bool{}
+	}
+	p.equs[c.Name] = true
+	p.referenceExpr(e, tokenStart(tokens[3]))
+	c.Expr = e
+	p.AddChild(&Node{Value: c})
+}
@@ -0,0 +1,95 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"slices"
+	"testing"
+)
+
+// 运算符优先级与C相同, 结果是精确的64位整数
+func TestEval(t *testing.T) {
+	tests := []struct {
+		text string
+		want int64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"7 / 2 + 7 % 2", 4},
+		{"-7 / 2", -3},
+		{"1 << 4 | 1", 17},
+		{"0xff & ~0x0f ^ 1", 0xf1},
+		{"-1 >> 1", -1},
+		{"0x7fffffffffffffff", 0x7fffffffffffffff},
+		{"0x7fffffffffffffff - 1", 0x7ffffffffffffffe},
+		{"'A' + 1", 'B'},
+		{"'\\n'", '\n'},
+		{"0b101 + 0o17", 20},
+		{"N * 2", 10},
+		{"1 < 2 && 2 > 1", 1},
+		{"\"x\" == \"x\"", 1},
+		{"0 && 1 / 0", 0},
+	}
+	p := parser.NewParser(lexer.NewLexerText("test.asm", ""), x86.NewMode(64))
+	p.Define("N", "5")
+	for _, tt := range tests {
+		c, err := p.Eval(tt.text)
+		if err != nil || c.IsStr || c.Int != tt.want {
+			t.Errorf("%s = %v, %v, want %d", tt.text, c, err, tt.want)
+		}
+	}
+	for _, text := range []string{"1 / 0", "1 % 0", "1 << 64", "(1", "1 +", "\"a\" + 1", "NOPE"} {
+		if _, err := p.Eval(text); err == nil {
+			t.Errorf("%s: want an error", text)
+		}
+	}
+}
+
+// CONST可以引用之前的常量, 用在立即数和偏移中
+func TestConst(t *testing.T) {
+	src := `CONST A, 4
+CONST B, A * 2 + 1
+mov %r0, B
+mov %r0, QW[%r1 + A*8 + B]
+mov %r0, -(A << 2)`
+	insts := parseInsts(t, src)
+	if got := []int64{insts[0].Args[1].Num, insts[1].Args[1].Addr.Displacement, insts[2].Args[1].Num}; !slices.Equal(got, []int64{9, 41, -16}) {
+		t.Errorf("got %v, want [9 41 -16]", got)
+	}
+}
+
+// 引用标签的常量保留为表达式, 如 $ - msg
+func TestConstLabel(t *testing.T) {
+	root := parser.NewParser(lexer.NewLexerText("test.asm", "msg: BB \"hello\"\nCONST len, $ - msg\n"), x86.NewMode(64)).Parse()
+	var c *parser.ConstBlock
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if tmp, ok := n.Value.(*parser.ConstBlock); ok {
+			c = tmp
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if c == nil || c.Name != "len" || c.Expr.IsConst() {
+		t.Fatalf("got %+v", c)
+	}
+	if n, err := c.Expr.Eval(func(name string) (int64, error) {
+		return map[string]int64{"$": 105, "msg": 100}[name], nil
+	}); err != nil || n != 5 {
+		t.Errorf("$ - msg = %d, %v", n, err)
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	for _, src := range []string{
+		"CONST A",
+		"CONST 1, 2",
+		"CONST A, 1\nCONST A, 2",
+		"CONST A, 1 / 0",
+	} {
+		wantError(t, src)
+	}
+}
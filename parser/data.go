@@ -0,0 +1,537 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"CuteASM/utils"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DataBlock 初始化数据
+//
+//	msg: BB "Hello\n", 0
+//	     DW 1, 2, -3, 1.5
+//	     BB 0 DUP 64
+//	     TW 3.14159
+//	     OW DW(1, 2, 3, 4)
+//
+// 每项可以是整数表达式、字符串、浮点数(DW、QW、TW), 大于8字节的元素还可以是
+// 整数字面量或按通道给出的向量; 值 DUP 次数 重复一项
+type DataBlock struct {
+	Size  int // 元素的字节数
+	Items []*DataItem
+}
+
+// DataItem 数据中的一项
+type DataItem struct {
+	Unit  int    // 按目标字节序存放的单位, 为0时是按原样存放的字符串
+	Data  []byte // 小端序的值
+	Expr  *Expr  // 依赖标签地址的值, 此时Data为空
+	Count int    // 重复次数
+}
+
+// DataRef 数据中对标签地址的引用
+type DataRef struct {
+	Offset int
+	Size   int
+	Sym    string
+	Addend int64
+}
+
+// DataLine 文本汇编中的一行数据
+type DataLine struct {
+	Width  int      // 每个值的字节数, 为0时是字符串
+	Values []string // 值, 依赖标签地址时是表达式
+	Str    []byte
+	Count  int
+}
+
+func (p *Parser) isData(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && utils.GetLength(token.Value) != 0
+}
+
+func (d *DataBlock) Parse(tokens []lexer.Token, p *Parser) {
+	d.Size = utils.GetLength(tokens[0].Value)
+	if len(tokens) < 2 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, tokens[0].Value+" needs at least one value")
+	}
+	for _, text := range splitOperands(p.exprText(tokens[1:])) {
+		item, err := d.parseItem(text, p)
+		if err != nil {
+			p.Error.MissError("Data Error", tokenStart(tokens[1]), err.Error())
+		}
+		p.referenceExpr(item.Expr, tokenStart(tokens[1]))
+		d.Items = append(d.Items, item)
+	}
+	p.ThisBlock.AddChild(&Node{Value: d})
+}
+
+// parseItem 解析一项, 格式为 值 或 值 DUP 次数
+func (d *DataBlock) parseItem(text string, p *Parser) (*DataItem, error) {
+	item := &DataItem{Unit: d.Size, Count: 1}
+	if value, count, ok := splitDup(text); ok {
+		c, err := p.Eval(count)
+		if err != nil {
+			return nil, err
+		}
+		if c.IsStr || c.Int < 0 {
+			return nil, fmt.Errorf("invalid repeat count %s", count)
+		}
+		text, item.Count = value, int(c.Int)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	// 按通道给出的向量, 如 OW DW(1, 2, 3, 4)
+	if lane, values, ok := splitLanes(text); ok {
+		if lane >= d.Size {
+			return nil, fmt.Errorf("lanes of %d bytes do not fit in %d bytes", lane, d.Size)
+		}
+		lanes := splitOperands(values)
+		if len(lanes) > d.Size/lane {
+			return nil, fmt.Errorf("%d lanes do not fit in %d bytes", len(lanes), d.Size)
+		}
+		item.Unit = lane
+		for _, v := range lanes {
+			b, err := encodeValue(v, lane, p)
+			if err != nil {
+				return nil, err
+			}
+			item.Data = append(item.Data, b...)
+		}
+		item.Data = append(item.Data, make([]byte, d.Size-len(item.Data))...)
+		return item, nil
+	}
+
+	if s, ok := quoted(text); ok {
+		str, err := unescape(s)
+		if err != nil {
+			return nil, err
+		}
+		item.Unit = 0
+		item.Data = padString(str, d.Size)
+		return item, nil
+	}
+
+	if isFloat(text) || d.Size > 8 && isBigInt(text) {
+		b, err := encodeValue(text, d.Size, p)
+		if err != nil {
+			return nil, err
+		}
+		item.Data = b
+		return item, nil
+	}
+
+	e, err := p.ParseExpr(text)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsConst() {
+		if d.Size > 8 {
+			return nil, fmt.Errorf("label addresses do not fit in %d bytes", d.Size)
+		}
+		item.Expr = e
+		return item, nil
+	}
+	if e.Val.IsStr {
+		item.Unit = 0
+		item.Data = padString(e.Val.Str, d.Size)
+		return item, nil
+	}
+	item.Data, err = encodeInt(e.Val.Int, d.Size)
+	return item, err
+}
+
+// encodeValue 把一个整数、浮点数或字符常量编码为size字节的小端序值
+func encodeValue(text string, size int, p *Parser) ([]byte, error) {
+	if isFloat(text) {
+		return encodeFloat(text, size)
+	}
+	if size > 8 && isBigInt(text) {
+		n, ok := new(big.Int).SetString(text, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %s", text)
+		}
+		return encodeBig(n, size)
+	}
+	c, err := p.Eval(text)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsStr {
+		return nil, fmt.Errorf("string %q cannot be used as a number", c.Str)
+	}
+	return encodeInt(c.Int, size)
+}
+
+// encodeInt 编码整数, 不超过8字节时检查范围, 更宽时按符号扩展
+func encodeInt(n int64, size int) ([]byte, error) {
+	if size < 8 {
+		bits := uint(size * 8)
+		if n < -1<<(bits-1) || n >= 1<<bits {
+			return nil, fmt.Errorf("%d does not fit in %d bytes", n, size)
+		}
+	}
+	b := make([]byte, size)
+	for i := range b {
+		if i < 8 {
+			b[i] = byte(n >> (8 * i))
+		} else if n < 0 {
+			b[i] = 0xff
+		}
+	}
+	return b, nil
+}
+
+// encodeBig 编码超过64位的整数, 负数使用补码
+func encodeBig(n *big.Int, size int) ([]byte, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	if n.Sign() < 0 {
+		n = new(big.Int).Add(n, limit)
+	}
+	if n.Sign() < 0 || n.Cmp(limit) >= 0 {
+		return nil, fmt.Errorf("number does not fit in %d bytes", size)
+	}
+	be := n.FillBytes(make([]byte, size))
+	b := make([]byte, size)
+	for i := range be {
+		b[size-1-i] = be[i]
+	}
+	return b, nil
+}
+
+// encodeFloat 编码浮点数: DW为单精度, QW为双精度, TW为x87的80位扩展精度
+func encodeFloat(text string, size int) ([]byte, error) {
+	b := make([]byte, size)
+	switch size {
+	case 4:
+		f, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid floating-point number %s", text)
+		}
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(f)))
+	case 8:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid floating-point number %s", text)
+		}
+		binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+	case 10:
+		f, _, err := big.ParseFloat(text, 10, 64, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("invalid floating-point number %s", text)
+		}
+		sign, exp, mant := extended(f)
+		binary.LittleEndian.PutUint64(b, mant)
+		binary.LittleEndian.PutUint16(b[8:], sign|exp)
+	default:
+		return nil, fmt.Errorf("floating-point numbers need DW, QW or TW")
+	}
+	return b, nil
+}
+
+// extended 80位扩展精度: 1位符号, 15位指数(偏置16383), 显式整数位的64位尾数
+func extended(f *big.Float) (sign, exp uint16, mant uint64) {
+	if f.Signbit() {
+		sign = 0x8000
+	}
+	switch {
+	case f.IsInf():
+		return sign, 0x7fff, 1 << 63
+	case f.Sign() == 0:
+		return sign, 0, 0
+	}
+	m := new(big.Float)
+	e := f.MantExp(m) // f = m × 2^e, 0.5 <= |m| < 1
+	m.Abs(m)
+	m.SetMantExp(m, 64)
+	mant, _ = m.Uint64()
+	biased := e - 1 + 16383
+	switch {
+	case biased >= 0x7fff:
+		return sign, 0x7fff, 1 << 63
+	case biased <= 0:
+		// 非规格化数
+		if shift := 1 - biased; shift < 64 {
+			return sign, 0, mant >> uint(shift)
+		}
+		return sign, 0, 0
+	}
+	return sign, uint16(biased), mant
+}
+
+// padString 字符串按元素大小补0
+func padString(s string, size int) []byte {
+	b := []byte(s)
+	if n := len(b) % size; n != 0 {
+		b = append(b, make([]byte, size-n)...)
+	}
+	return b
+}
+
+// splitDup 在顶层的DUP处切分
+func splitDup(text string) (value, count string, ok bool) {
+	depth := 0
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && i+3 <= len(text) && strings.EqualFold(text[i:i+3], "DUP") &&
+			(i == 0 || !isNameChar(text[i-1])) && (i+3 == len(text) || !isNameChar(text[i+3])):
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+3:]), true
+		}
+	}
+	return text, "", false
+}
+
+// splitLanes 切分 BB(...)、WW(...)、DW(...)、QW(...) 形式的向量
+func splitLanes(text string) (lane int, values string, ok bool) {
+	n := strings.IndexByte(text, '(')
+	if n < 0 || !strings.HasSuffix(text, ")") {
+		return 0, "", false
+	}
+	lane = utils.GetLength(strings.ToUpper(strings.TrimSpace(text[:n])))
+	if lane == 0 || lane > 8 {
+		return 0, "", false
+	}
+	return lane, text[n+1 : len(text)-1], true
+}
+
+// quoted 整项是一个字符串字面量时返回引号中的内容
+func quoted(text string) (string, bool) {
+	s, n := scanQuoted(text)
+	return s, n > 0 && n == len(text)
+}
+
+// scanQuoted 读取开头的字符串字面量, 返回引号中的内容和字面量的长度, 不是字符串或没有结束时长度为0
+func scanQuoted(text string) (string, int) {
+	if len(text) < 2 || text[0] != '"' && text[0] != '\'' {
+		return "", 0
+	}
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case text[0]:
+			return text[1:i], i + 1
+		}
+	}
+	return "", 0
+}
+
+// isFloat 是否为十进制浮点数字面量
+func isFloat(text string) bool {
+	s := strings.TrimLeft(text, "+-")
+	if strings.EqualFold(s, "inf") {
+		return true
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' || strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return false
+	}
+	if !strings.ContainsAny(s, ".eE") {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// isBigInt 是否为整数字面量
+func isBigInt(text string) bool {
+	_, ok := new(big.Int).SetString(text, 0)
+	return ok
+}
+
+// unescape 处理字符串中的转义: \n \t \r \0 \a \b \f \v \e \\ \' \" \xHH 和八进制\ooo
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("unterminated escape in %q", s)
+		}
+		switch c := s[i]; c {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'e':
+			sb.WriteByte(27)
+		case '\\', '\'', '"', '`':
+			sb.WriteByte(c)
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+1 {
+				return "", fmt.Errorf("invalid escape \\x in %q", s)
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			sb.WriteByte(byte(n))
+			i = j - 1
+		default:
+			if c < '0' || c > '7' {
+				return "", fmt.Errorf("invalid escape \\%c in %q", c, s)
+			}
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			n, err := strconv.ParseUint(s[i:j], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape \\%s in %q", s[i:j], s)
+			}
+			sb.WriteByte(byte(n))
+			i = j - 1
+		}
+	}
+	return sb.String(), nil
+}
+
+// Len 数据的总字节数
+func (d *DataBlock) Len() int {
+	n := 0
+	for _, it := range d.Items {
+		n += it.Len() * it.Count
+	}
+	return n
+}
+
+// Len 一次重复的字节数
+func (it *DataItem) Len() int {
+	if it.Expr != nil {
+		return it.Unit
+	}
+	return len(it.Data)
+}
+
+// Bytes 一次重复的值, 按目标字节序排列; 依赖标签地址时为0
+func (it *DataItem) Bytes(order binary.ByteOrder) []byte {
+	b := make([]byte, it.Len())
+	copy(b, it.Data)
+	if order == binary.BigEndian && it.Unit > 1 {
+		for i := 0; i+it.Unit <= len(b); i += it.Unit {
+			unit := b[i : i+it.Unit]
+			for l, r := 0, len(unit)-1; l < r; l, r = l+1, r-1 {
+				unit[l], unit[r] = unit[r], unit[l]
+			}
+		}
+	}
+	return b
+}
+
+// Bytes 按目标字节序编码全部数据, 引用标签地址的位置填0并返回引用
+// 只支持 标签±常数 形式的地址
+func (d *DataBlock) Bytes(order binary.ByteOrder) ([]byte, []DataRef, error) {
+	var code []byte
+	var refs []DataRef
+	for _, it := range d.Items {
+		b := it.Bytes(order)
+		for n := 0; n < it.Count; n++ {
+			if it.Expr != nil {
+				sym, off, ok := it.Expr.Offset()
+				if !ok {
+					return nil, nil, fmt.Errorf("cannot encode data %s", it.Expr)
+				}
+				refs = append(refs, DataRef{Offset: len(code), Size: it.Unit, Sym: sym, Addend: off})
+			}
+			code = append(code, b...)
+		}
+	}
+	return code, refs, nil
+}
+
+// Words 把一次重复的值按目标字节序拆成宽度为1、2、4或8字节的字,
+// 按这个宽度依次输出各个字就得到相同的字节
+func (it *DataItem) Words(order binary.ByteOrder) (width int, words []int64) {
+	b := it.Bytes(order)
+	switch it.Unit {
+	case 1, 2, 4, 8:
+		width = it.Unit
+	default:
+		width = 1
+		for _, w := range []int{8, 4, 2} {
+			if len(b)%w == 0 {
+				width = w
+				break
+			}
+		}
+	}
+	for i := 0; i+width <= len(b); i += width {
+		var n int64
+		switch width {
+		case 1:
+			n = int64(int8(b[i]))
+		case 2:
+			n = int64(int16(order.Uint16(b[i:])))
+		case 4:
+			n = int64(int32(order.Uint32(b[i:])))
+		case 8:
+			n = int64(order.Uint64(b[i:]))
+		}
+		words = append(words, n)
+	}
+	return width, words
+}
+
+// Lines 文本汇编中的各行, 相邻的同宽度的值合并为一行
+// here为表达式中当前位置的写法
+func (d *DataBlock) Lines(order binary.ByteOrder, here string) []DataLine {
+	var lines []DataLine
+	for _, it := range d.Items {
+		line := DataLine{Count: it.Count}
+		switch {
+		case it.Expr != nil:
+			line.Width = it.Unit
+			line.Values = []string{it.Expr.Format(here)}
+		case it.Unit == 0:
+			line.Str = it.Data
+		default:
+			width, words := it.Words(order)
+			line.Width = width
+			for _, w := range words {
+				line.Values = append(line.Values, strconv.FormatInt(w, 10))
+			}
+		}
+		if n := len(lines) - 1; n >= 0 && line.Count == 1 && lines[n].Count == 1 &&
+			line.Width != 0 && lines[n].Width == line.Width {
+			lines[n].Values = append(lines[n].Values, line.Values...)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
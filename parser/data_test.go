@@ -0,0 +1,111 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// dataOf 解析源码, 返回全部数据块
+func dataOf(t *testing.T, src string) []*parser.DataBlock {
+	t.Helper()
+	root := parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), x86.NewMode(64)).Parse()
+	var blocks []*parser.DataBlock
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if d, ok := n.Value.(*parser.DataBlock); ok {
+			blocks = append(blocks, d)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(root)
+	return blocks
+}
+
+func TestData(t *testing.T) {
+	tests := []struct {
+		src    string
+		le, be []byte
+	}{
+		{`BB "Hi\n", 0, 'A'`, []byte{'H', 'i', '\n', 0, 'A'}, nil},
+		{`BB "a\x41\101\0"`, []byte{'a', 'A', 'A', 0}, nil},
+		{`WW 1, -2`, []byte{1, 0, 0xfe, 0xff}, []byte{0, 1, 0xff, 0xfe}},
+		{`DW 0x11223344`, []byte{0x44, 0x33, 0x22, 0x11}, []byte{0x11, 0x22, 0x33, 0x44}},
+		{`WW "abc"`, []byte{'a', 'b', 'c', 0}, nil},
+		{`BB 0xaa DUP 3, 1`, []byte{0xaa, 0xaa, 0xaa, 1}, nil},
+		{`WW 7 DUP 0`, []byte{}, nil},
+		{`WW 2 * 3 DUP 1 + 1`, []byte{6, 0, 6, 0}, []byte{0, 6, 0, 6}},
+		{`DW 1.5`, []byte{0, 0, 0xc0, 0x3f}, []byte{0x3f, 0xc0, 0, 0}},
+		{`QW -2.0`, []byte{0, 0, 0, 0, 0, 0, 0, 0xc0}, []byte{0xc0, 0, 0, 0, 0, 0, 0, 0}},
+		{`TW 1.0`, []byte{0, 0, 0, 0, 0, 0, 0, 0x80, 0xff, 0x3f}, []byte{0x3f, 0xff, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{`TW -0.5`, []byte{0, 0, 0, 0, 0, 0, 0, 0x80, 0xfe, 0xbf}, []byte{0xbf, 0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{`OW WW(1, 2)`, []byte{1, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, []byte{0, 1, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{`OW 0x0102030405060708090a0b0c0d0e0f10`, []byte{16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+		{`OW -1`, bytes.Repeat([]byte{0xff}, 16), nil},
+	}
+	for _, tt := range tests {
+		blocks := dataOf(t, "d: "+tt.src)
+		if tt.be == nil {
+			tt.be = tt.le
+		}
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			want := tt.le
+			if order == binary.BigEndian {
+				want = tt.be
+			}
+			var got []byte
+			for _, d := range blocks {
+				b, refs, err := d.Bytes(order)
+				if err != nil || len(refs) != 0 {
+					t.Fatalf("%s: %v %v", tt.src, refs, err)
+				}
+				got = append(got, b...)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s (%v): got % x, want % x", tt.src, order, got, want)
+			}
+		}
+	}
+}
+
+// 标签地址在数据中留出位置, 由输出的汇编器重定位
+func TestDataRefs(t *testing.T) {
+	blocks := dataOf(t, "a: BB 1\nt: DW 7\n   QW a, a + 8 DUP 2")
+	b, refs, err := blocks[len(blocks)-1].Bytes(binary.LittleEndian)
+	if err != nil || len(b) != 24 {
+		t.Fatalf("got % x, %v", b, err)
+	}
+	want := []parser.DataRef{{Offset: 0, Size: 8, Sym: "a"}, {Offset: 8, Size: 8, Sym: "a", Addend: 8}, {Offset: 16, Size: 8, Sym: "a", Addend: 8}}
+	if len(refs) != len(want) {
+		t.Fatalf("refs %+v", refs)
+	}
+	for n := range want {
+		if refs[n] != want[n] {
+			t.Errorf("ref %d = %+v, want %+v", n, refs[n], want[n])
+		}
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	for _, src := range []string{
+		"d: BB",
+		"d: BB 256",
+		"d: WW -32769",
+		"d: BB 1.5",
+		"d: BB \"abc",
+		"d: BB \"\\q\"",
+		"d: BB 1 DUP -1",
+		"d: OW DW(1, 2, 3, 4, 5)",
+		"d: OW QW 1",
+		"d: OW a",
+		"d: DB 1",
+		"d: mov %r0, 1",
+	} {
+		wantError(t, src)
+	}
+}
@@ -0,0 +1,623 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Const 汇编期常量, 整数或字符串
+type Const struct {
+	Int   int64
+	Str   string
+	IsStr bool
+}
+
+func (c Const) String() string {
+	if c.IsStr {
+		return strconv.Quote(c.Str)
+	}
+	return strconv.FormatInt(c.Int, 10)
+}
+
+// Bool 条件是否成立, 非0整数和非空字符串为真
+func (c Const) Bool() bool {
+	if c.IsStr {
+		return c.Str != ""
+	}
+	return c.Int != 0
+}
+
+func boolConst(b bool) Const {
+	if b {
+		return Const{Int: 1}
+	}
+	return Const{}
+}
+
+// Expr 常量表达式
+// 不引用标签时在解析时折叠为常量, 引用标签或当前位置$时保留为符号表达式,
+// 由输出的汇编器在确定地址后计算
+type Expr struct {
+	Op  string // 运算符, 叶子为空
+	X   *Expr  // 一元运算只有X
+	Y   *Expr
+	Val Const  // 常量叶子
+	Sym string // 标签叶子, $为当前位置
+	Equ bool   // Sym是CONST定义的常量, 不是地址
+}
+
+// IsConst 表达式是否已经折叠为常量
+func (e *Expr) IsConst() bool {
+	return e.Op == "" && e.Sym == ""
+}
+
+// Offset 表达式是否为 标签±常量 的形式
+func (e *Expr) Offset() (sym string, off int64, ok bool) {
+	switch {
+	case e.Op == "" && e.Sym != "" && e.Sym != "$" && !e.Equ:
+		return e.Sym, 0, true
+	case e.Op == "+" && e.Y.IsConst():
+		sym, off, ok = e.X.Offset()
+		return sym, off + e.Y.Val.Int, ok
+	case e.Op == "+" && e.X.IsConst():
+		sym, off, ok = e.Y.Offset()
+		return sym, off + e.X.Val.Int, ok
+	case e.Op == "-" && e.Y.IsConst():
+		sym, off, ok = e.X.Offset()
+		return sym, off - e.Y.Val.Int, ok
+	}
+	return "", 0, false
+}
+
+// Eval 在地址确定之后计算表达式, sym给出标签、CONST常量和当前位置$的值
+func (e *Expr) Eval(sym func(name string) (int64, error)) (int64, error) {
+	switch {
+	case e.Sym != "":
+		return sym(e.Sym)
+	case e.Op == "":
+		if e.Val.IsStr {
+			return 0, fmt.Errorf("string cannot be used as a number")
+		}
+		return e.Val.Int, nil
+	}
+	x, err := e.X.Eval(sym)
+	if err != nil {
+		return 0, err
+	}
+	if e.Y == nil {
+		switch e.Op {
+		case "-":
+			return -x, nil
+		case "~":
+			return ^x, nil
+		}
+		return 0, fmt.Errorf("unknown operator %s", e.Op)
+	}
+	y, err := e.Y.Eval(sym)
+	if err != nil {
+		return 0, err
+	}
+	c, err := apply(e.Op, Const{Int: x}, Const{Int: y})
+	return c.Int, err
+}
+
+// Format 输出表达式的文本, here为目标汇编器中当前位置的写法
+func (e *Expr) Format(here string) string {
+	switch {
+	case e.Sym == "$":
+		return here
+	case e.Sym != "":
+		return e.Sym
+	case e.Op == "":
+		if e.Val.Int < 0 {
+			return "(" + e.Val.String() + ")"
+		}
+		return e.Val.String()
+	case e.Y == nil:
+		return e.Op + e.X.operand(here)
+	}
+	return e.X.operand(here) + e.Op + e.Y.operand(here)
+}
+
+// operand 作为运算数时输出, 运算加括号
+func (e *Expr) operand(here string) string {
+	if e.Op != "" {
+		return "(" + e.Format(here) + ")"
+	}
+	return e.Format(here)
+}
+
+func (e *Expr) String() string {
+	return e.Format("$")
+}
+
+// Define 定义符号, 值为空时定义为1, 能解析为整数时为整数, 否则为字符串
+func (p *Parser) Define(name, value string) {
+	if p.Defines == nil {
+		p.Defines = map[string]Const{}
+	}
+	if value == "" {
+		p.Defines[name] = Const{Int: 1}
+		return
+	}
+	if n, err := strconv.ParseInt(value, 0, 64); err == nil {
+		p.Defines[name] = Const{Int: n}
+		return
+	}
+	p.Defines[name] = Const{Str: value, IsStr: true}
+}
+
+// IsDefined 名称是否为已定义的符号或常量
+func (p *Parser) IsDefined(name string) bool {
+	_, ok := p.Defines[name]
+	return ok || p.equs[name]
+}
+
+// Eval 计算常量表达式
+// 支持整数、字符串、字符、符号和DEFINED(name), 运算符优先级与C相同
+func (p *Parser) Eval(text string) (Const, error) {
+	e, err := p.parseExpr(text, false)
+	if err != nil {
+		return Const{}, err
+	}
+	return e.Val, nil
+}
+
+// ParseExpr 解析表达式, 未定义的名称作为标签
+func (p *Parser) ParseExpr(text string) (*Expr, error) {
+	return p.parseExpr(text, true)
+}
+
+func (p *Parser) parseExpr(text string, labels bool) (*Expr, error) {
+	if strings.Contains(text, "{") {
+		// FOR中生成的名称
+		tmp, err := p.expand(text)
+		if err != nil {
+			return nil, err
+		}
+		text = tmp
+	}
+	e := &exprParser{text: text, p: p, labels: labels}
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	x, err := e.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if e.tok != "" {
+		return nil, fmt.Errorf("unexpected %s in expression", e.tok)
+	}
+	return x, nil
+}
+
+// exprText 记号序列在源码中的原文
+// 词法分析不认识大部分运算符, 表达式按原文解析
+func (p *Parser) exprText(tokens []lexer.Token) string {
+	last := tokens[len(tokens)-1]
+	return p.Lexer.Text[tokenStart(tokens[0]):last.EndCursor]
+}
+
+// tokenStart 记号在源码中的起始位置, 字符串和字符包含引号
+func tokenStart(token lexer.Token) int {
+	if token.Type == lexer.STRING || token.Type == lexer.CHAR {
+		return token.EndCursor - len(token.Value) - 2
+	}
+	return token.Cursor
+}
+
+// exprParser 表达式解析时的状态
+type exprParser struct {
+	p      *Parser
+	text   string
+	pos    int
+	tok    string // 当前记号, 结束时为空
+	kind   int    // 当前记号的类型
+	labels bool   // 是否允许引用标签
+	skip   int    // 大于0时位于被短路的一侧, 未定义的符号和运算错误按0处理
+}
+
+// 表达式记号类型
+const (
+	exprOp = iota
+	exprNum
+	exprStr
+	exprChar
+	exprName
+)
+
+// 两个字符的运算符, 需要先于单个字符匹配
+var exprOps2 = []string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>"}
+
+// next 读取下一个记号
+func (e *exprParser) next() error {
+	for e.pos < len(e.text) && strings.ContainsRune(" \t\r\n", rune(e.text[e.pos])) {
+		e.pos++
+	}
+	e.tok = ""
+	if e.pos >= len(e.text) {
+		return nil
+	}
+	start := e.pos
+	c := e.text[e.pos]
+	switch {
+	case c == '"' || c == '\'':
+		s, n := scanQuoted(e.text[start:])
+		if n == 0 {
+			return fmt.Errorf("unterminated string in expression")
+		}
+		e.pos = start + n
+		tok, err := unescape(s)
+		if err != nil {
+			return err
+		}
+		e.tok = tok
+		e.kind = exprStr
+		if c == '\'' {
+			e.kind = exprChar
+		}
+		return nil
+	case c >= '0' && c <= '9':
+		for e.pos < len(e.text) && isNameChar(e.text[e.pos]) {
+			e.pos++
+		}
+		e.kind = exprNum
+	case isNameChar(c) || c == '.':
+		for e.pos < len(e.text) && (isNameChar(e.text[e.pos]) || e.text[e.pos] == '.') {
+			e.pos++
+		}
+		e.kind = exprName
+	default:
+		e.pos++
+		for _, op := range exprOps2 {
+			if strings.HasPrefix(e.text[start:], op) {
+				e.pos = start + 2
+				break
+			}
+		}
+		e.kind = exprOp
+	}
+	e.tok = e.text[start:e.pos]
+	return nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isOp 当前记号是否为给定的运算符之一
+func (e *exprParser) isOp(ops ...string) bool {
+	if e.kind != exprOp {
+		return false
+	}
+	for _, op := range ops {
+		if e.tok == op {
+			return true
+		}
+	}
+	return false
+}
+
+// exprOpChars 表达式运算符用到的字符
+const exprOpChars = "|&^=!<>+-*/%~()"
+
+// exprLevels 按优先级从低到高的二元运算符, 每一级由下一级组成
+var exprLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// 可以作用于符号表达式的运算符
+var symbolicOps = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true,
+	"<<": true, ">>": true, "&": true, "|": true, "^": true,
+}
+
+func (e *exprParser) binary(level int) (*Expr, error) {
+	if level == len(exprLevels) {
+		return e.unary()
+	}
+	l, err := e.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for e.isOp(exprLevels[level]...) {
+		op := e.tok
+		if err := e.next(); err != nil {
+			return nil, err
+		}
+		short := l.IsConst() && (op == "&&" && !l.Val.Bool() || op == "||" && l.Val.Bool())
+		if short {
+			e.skip++
+		}
+		r, err := e.binary(level + 1)
+		if short {
+			e.skip--
+		}
+		if err != nil {
+			return nil, err
+		}
+		if short {
+			l = &Expr{Val: boolConst(l.Val.Bool())}
+			continue
+		}
+		if l, err = e.fold(op, l, r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// fold 两侧都是常量时直接计算, 否则生成符号表达式
+func (e *exprParser) fold(op string, l, r *Expr) (*Expr, error) {
+	if !l.IsConst() || !r.IsConst() {
+		if e.skip != 0 {
+			return &Expr{}, nil
+		}
+		if !symbolicOps[op] {
+			return nil, fmt.Errorf("operator %s cannot be used on labels", op)
+		}
+		if l.Val.IsStr || r.Val.IsStr {
+			return nil, fmt.Errorf("operator %s cannot be used on strings", op)
+		}
+		return &Expr{Op: op, X: l, Y: r}, nil
+	}
+	c, err := apply(op, l.Val, r.Val)
+	if err != nil {
+		if e.skip == 0 {
+			return nil, err
+		}
+		c = Const{}
+	}
+	return &Expr{Val: c}, nil
+}
+
+// apply 计算二元运算, 字符串只能比较
+func apply(op string, l, r Const) (Const, error) {
+	switch op {
+	case "||":
+		return boolConst(l.Bool() || r.Bool()), nil
+	case "&&":
+		return boolConst(l.Bool() && r.Bool()), nil
+	}
+	if l.IsStr || r.IsStr {
+		if !l.IsStr || !r.IsStr {
+			return Const{}, fmt.Errorf("cannot compare string with integer")
+		}
+		switch op {
+		case "==":
+			return boolConst(l.Str == r.Str), nil
+		case "!=":
+			return boolConst(l.Str != r.Str), nil
+		case "<":
+			return boolConst(l.Str < r.Str), nil
+		case "<=":
+			return boolConst(l.Str <= r.Str), nil
+		case ">":
+			return boolConst(l.Str > r.Str), nil
+		case ">=":
+			return boolConst(l.Str >= r.Str), nil
+		}
+		return Const{}, fmt.Errorf("operator %s cannot be used on strings", op)
+	}
+	a, b := l.Int, r.Int
+	switch op {
+	case "|":
+		return Const{Int: a | b}, nil
+	case "^":
+		return Const{Int: a ^ b}, nil
+	case "&":
+		return Const{Int: a & b}, nil
+	case "==":
+		return boolConst(a == b), nil
+	case "!=":
+		return boolConst(a != b), nil
+	case "<":
+		return boolConst(a < b), nil
+	case "<=":
+		return boolConst(a <= b), nil
+	case ">":
+		return boolConst(a > b), nil
+	case ">=":
+		return boolConst(a >= b), nil
+	case "<<", ">>":
+		if b < 0 || b > 63 {
+			return Const{}, fmt.Errorf("shift count %d out of range", b)
+		}
+		if op == "<<" {
+			return Const{Int: a << uint(b)}, nil
+		}
+		return Const{Int: a >> uint(b)}, nil
+	case "+":
+		return Const{Int: a + b}, nil
+	case "-":
+		return Const{Int: a - b}, nil
+	case "*":
+		return Const{Int: a * b}, nil
+	case "/", "%":
+		if b == 0 {
+			return Const{}, fmt.Errorf("division by zero")
+		}
+		if op == "/" {
+			return Const{Int: a / b}, nil
+		}
+		return Const{Int: a % b}, nil
+	}
+	return Const{}, fmt.Errorf("unknown operator %s", op)
+}
+
+func (e *exprParser) unary() (*Expr, error) {
+	if !e.isOp("-", "+", "~", "!") {
+		return e.primary()
+	}
+	op := e.tok
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	x, err := e.unary()
+	if err != nil {
+		return nil, err
+	}
+	if op == "+" {
+		return x, nil
+	}
+	if !x.IsConst() {
+		if op == "!" {
+			return nil, fmt.Errorf("operator ! cannot be used on labels")
+		}
+		return &Expr{Op: op, X: x}, nil
+	}
+	c := x.Val
+	if op == "!" {
+		return &Expr{Val: boolConst(!c.Bool())}, nil
+	}
+	if c.IsStr {
+		return nil, fmt.Errorf("operator %s cannot be used on strings", op)
+	}
+	if op == "-" {
+		c.Int = -c.Int
+	} else {
+		c.Int = ^c.Int
+	}
+	return &Expr{Val: c}, nil
+}
+
+func (e *exprParser) primary() (*Expr, error) {
+	tok, kind := e.tok, e.kind
+	if tok == "" {
+		return nil, fmt.Errorf("incomplete expression")
+	}
+	if err := e.next(); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case exprNum:
+		if isAnonRef(tok) && e.labels && e.skip == 0 {
+			name, err := e.p.labelRef(tok)
+			if err != nil {
+				return nil, err
+			}
+			return &Expr{Sym: name}, nil
+		}
+		n, err := strconv.ParseInt(tok, 0, 64)
+		if err != nil {
+			u, uerr := strconv.ParseUint(tok, 0, 64)
+			if uerr != nil {
+				return nil, fmt.Errorf("invalid number %s", tok)
+			}
+			n = int64(u)
+		}
+		return &Expr{Val: Const{Int: n}}, nil
+	case exprStr:
+		return &Expr{Val: Const{Str: tok, IsStr: true}}, nil
+	case exprChar:
+		// 字符按小端序组成整数, 与NASM相同
+		if len(tok) == 0 || len(tok) > 8 {
+			return nil, fmt.Errorf("invalid character constant '%s'", tok)
+		}
+		var n int64
+		for i := len(tok) - 1; i >= 0; i-- {
+			n = n<<8 | int64(tok[i])
+		}
+		return &Expr{Val: Const{Int: n}}, nil
+	case exprName:
+		switch strings.ToUpper(tok) {
+		case "DEFINED":
+			return e.defined()
+		case "SIZEOF":
+			return e.sizeof()
+		}
+		if c, ok := e.p.Defines[tok]; ok {
+			return &Expr{Val: c}, nil
+		}
+		if e.p.equs[tok] {
+			return &Expr{Sym: tok, Equ: true}, nil
+		}
+		if e.skip != 0 {
+			return &Expr{}, nil
+		}
+		if !e.labels {
+			return nil, fmt.Errorf("undefined symbol %s", tok)
+		}
+		name, err := e.p.labelRef(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &Expr{Sym: name}, nil
+	}
+	switch tok {
+	case "(":
+		x, err := e.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		if !e.isOp(")") {
+			return nil, fmt.Errorf("need ')'")
+		}
+		return x, e.next()
+	case "$":
+		if !e.labels {
+			return nil, fmt.Errorf("$ cannot be used in a constant expression")
+		}
+		return &Expr{Sym: "$"}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s in expression", tok)
+}
+
+// defined DEFINED(name), 括号可以省略
+func (e *exprParser) defined() (*Expr, error) {
+	name, err := e.nameArg("DEFINED")
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{Val: boolConst(e.p.IsDefined(name))}, nil
+}
+
+// sizeof SIZEOF(name), name为结构体、结构体的字段或BB…ZW, 括号可以省略
+func (e *exprParser) sizeof() (*Expr, error) {
+	name, err := e.nameArg("SIZEOF")
+	if err != nil {
+		return nil, err
+	}
+	size, ok := e.p.sizeOf(name)
+	if !ok {
+		return nil, fmt.Errorf("SIZEOF: unknown type %s", name)
+	}
+	return &Expr{Val: Const{Int: int64(size)}}, nil
+}
+
+// nameArg 读取内置函数的名称参数, 括号可以省略
+func (e *exprParser) nameArg(fn string) (string, error) {
+	paren := e.isOp("(")
+	if paren {
+		if err := e.next(); err != nil {
+			return "", err
+		}
+	}
+	if e.kind != exprName || e.tok == "" {
+		return "", fmt.Errorf("%s needs a symbol name", fn)
+	}
+	name := e.tok
+	if err := e.next(); err != nil {
+		return "", err
+	}
+	if paren {
+		if !e.isOp(")") {
+			return "", fmt.Errorf("need ')'")
+		}
+		if err := e.next(); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
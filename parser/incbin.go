@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 文本汇编中INCBIN每行输出的字节数
+const incbinLine = 16
+
+func (p *Parser) isIncbin(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && token.Value == "INCBIN"
+}
+
+// ParseIncbin INCBIN "file"[, offset[, length]]
+// 把文件的内容作为字节数据放在当前位置, 路径的查找方式与INCLUDE相同
+func (p *Parser) ParseIncbin(tokens []lexer.Token) {
+	if len(tokens) < 2 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, `INCBIN needs a path: INCBIN "file"[, offset[, length]]`)
+	}
+	cursor := tokenStart(tokens[1])
+	args := splitOperands(p.exprText(tokens[1:]))
+	if len(args) > 3 {
+		p.Error.MissError("Syntax Error", cursor, "INCBIN takes a path, an offset and a length")
+	}
+	raw, ok := quoted(args[0])
+	name, err := unescape(raw)
+	if !ok || err != nil || name == "" {
+		p.Error.MissError("Syntax Error", cursor, "invalid INCBIN path "+args[0])
+	}
+	path := p.findInclude(name)
+	if path == "" {
+		p.Error.MissError("Include Error", cursor, "cannot find "+name+" in the current directory or the -I directories")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.Error.MissError("Include Error", cursor, err.Error())
+	}
+	p.depend(path)
+
+	bounds := []int64{0, int64(len(data))}
+	for n, arg := range args[1:] {
+		c, err := p.Eval(arg)
+		if err == nil && (c.IsStr || c.Int < 0) {
+			err = fmt.Errorf("INCBIN offset and length must be non-negative integers")
+		}
+		if err != nil {
+			p.Error.MissError("Expression Error", cursor, err.Error())
+		}
+		bounds[n] = c.Int
+		if n == 0 {
+			bounds[1] = max(int64(len(data))-c.Int, 0)
+		}
+	}
+	offset, length := bounds[0], bounds[1]
+	if offset+length > int64(len(data)) {
+		p.Error.MissError("Include Error", cursor, fmt.Sprintf("%s has %d bytes, cannot read %d bytes at offset %d", name, len(data), length, offset))
+	}
+	data = data[offset : offset+length]
+
+	// 按行切分, 文本汇编中每行输出一段
+	d := &DataBlock{Size: 1}
+	for i := 0; i < len(data); i += incbinLine {
+		d.Items = append(d.Items, &DataItem{Data: data[i:min(i+incbinLine, len(data))], Count: 1})
+	}
+	p.ThisBlock.AddChild(&Node{Value: d})
+}
+
+// depend 记录读取的文件, 用于生成依赖文件
+func (p *Parser) depend(path string) {
+	for _, dep := range p.Deps {
+		if dep == path {
+			return
+		}
+	}
+	p.Deps = append(p.Deps, path)
+}
+
+// DepFile make格式的依赖规则: target依赖源文件以及INCLUDE和INCBIN读取的文件
+func (p *Parser) DepFile(target string) string {
+	deps := append([]string{p.Lexer.Filename}, p.Deps...)
+	for i, dep := range deps {
+		deps[i] = strings.ReplaceAll(dep, " ", `\ `)
+	}
+	return strings.ReplaceAll(target, " ", `\ `) + ": " + strings.Join(deps, " ") + "\n"
+}
@@ -0,0 +1,91 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncbin(t *testing.T) {
+	blob := make([]byte, 40)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	tests := []struct {
+		src  string
+		want []byte
+	}{
+		{`INCBIN "blob.bin"`, blob},
+		{`INCBIN "blob.bin", 30`, blob[30:]},
+		{`INCBIN "blob.bin", 4, 3`, blob[4:7]},
+		{`INCBIN "blob.bin", 2 * 2, 1 + 2`, blob[4:7]},
+		{`INCBIN "blob.bin", 40`, nil},
+		{`INCBIN "sub.bin"`, []byte("sub")},
+		{"INCBIN \"blob.bin\", 38\nINCBIN \"blob.bin\", 0, 1", []byte{38, 39, 0}},
+	}
+	for _, tt := range tests {
+		dir := writeFiles(t, map[string]string{"src/main.asm": "d: " + tt.src + "\n", "src/blob.bin": string(blob), "inc/sub.bin": "sub"})
+		p := parser.NewParser(lexer.NewLexer(filepath.Join(dir, "src/main.asm")), x86.NewMode(64))
+		p.IncludeDirs = []string{filepath.Join(dir, "inc")}
+		size := parser.DataLen(p.Parse().Children[0])
+		var got []byte
+		for _, d := range dataBlocks(p) {
+			b, _, err := d.Bytes(binary.BigEndian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, b...)
+		}
+		if !bytes.Equal(got, tt.want) || size != len(tt.want) {
+			t.Errorf("%s: got % x (size %d), want % x", tt.src, got, size, tt.want)
+		}
+		// 依赖文件列出读取的文件, 同一个文件只列一次
+		if dep := p.DepFile("main.o"); strings.Count(dep, ".bin") != 1 {
+			t.Errorf("%s: dep file %q", tt.src, dep)
+		}
+	}
+}
+
+// dataBlocks 解析结果中的全部数据块
+func dataBlocks(p *parser.Parser) []*parser.DataBlock {
+	var blocks []*parser.DataBlock
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if d, ok := n.Value.(*parser.DataBlock); ok {
+			blocks = append(blocks, d)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Block)
+	return blocks
+}
+
+func TestIncbinErrors(t *testing.T) {
+	for _, src := range []string{
+		`INCBIN`,
+		`INCBIN blob.bin`,
+		`INCBIN "nope.bin"`,
+		`INCBIN "blob.bin", 41`,
+		`INCBIN "blob.bin", 4, 37`,
+		`INCBIN "blob.bin", -1`,
+		`INCBIN "blob.bin", "a"`,
+		`INCBIN "blob.bin", 0, 1, 2`,
+	} {
+		dir := writeFiles(t, map[string]string{"main.asm": src + "\n", "blob.bin": strings.Repeat("x", 40)})
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want an error", src)
+				}
+			}()
+			parser.NewParser(lexer.NewLexer(filepath.Join(dir, "main.asm")), x86.NewMode(64)).Parse()
+		}()
+	}
+}
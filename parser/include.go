@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// INCLUDE "path"
+//
+// 相对路径先在当前文件所在的目录中查找, 再按顺序在IncludeDirs中查找;
+// 同一个文件只包含一次, 文件之间互相包含时报错
+
+func (p *Parser) isInclude(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && token.Value == "INCLUDE"
+}
+
+// ParseInclude 在当前位置解析被包含的文件
+func (p *Parser) ParseInclude(tokens []lexer.Token) {
+	if len(tokens) != 2 || tokens[1].Type != lexer.STRING {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, `INCLUDE takes one quoted path: INCLUDE "file.asm"`)
+	}
+	cursor := tokenStart(tokens[1])
+	name, err := unescape(tokens[1].Value)
+	if err != nil || name == "" {
+		p.Error.MissError("Syntax Error", cursor, "invalid include path "+tokens[1].Value)
+	}
+	path := p.findInclude(name)
+	if path == "" {
+		p.Error.MissError("Include Error", cursor, "cannot find "+name+" in the current directory or the -I directories")
+	}
+	key := includeKey(path)
+	for i, file := range p.including {
+		if file == key {
+			chain := append(append([]string{}, p.including[i:]...), key)
+			for n := range chain {
+				chain[n] = filepath.Base(chain[n])
+			}
+			p.Error.MissError("Include Error", cursor, "include cycle: "+strings.Join(chain, " -> "))
+		}
+	}
+	if p.included[key] {
+		// 已经包含过
+		return
+	}
+	p.included[key] = true
+	text, readErr := os.ReadFile(path)
+	if readErr != nil {
+		p.Error.MissError("Include Error", cursor, readErr.Error())
+	}
+	p.depend(path)
+	if len(text) == 0 {
+		return
+	}
+	lex := lexer.NewLexerText(path, string(text))
+	lex.Error.Trace = append([]string{"included from " + p.Error.Position(cursor)}, p.Error.Trace...)
+
+	oldLexer, oldError, oldLoops := p.Lexer, p.Error, p.loops
+	conds := len(p.conds)
+	p.Lexer, p.Error, p.loops = lex, lex.Error, nil
+	p.including = append(p.including, key)
+	for p.Line() {
+	}
+	if len(p.conds) != conds {
+		p.Error.MissError("Syntax Error", p.conds[len(p.conds)-1].cursor, "IF without ENDIF in included file")
+	}
+	p.including = p.including[:len(p.including)-1]
+	p.Lexer, p.Error, p.loops = oldLexer, oldError, oldLoops
+}
+
+// findInclude 查找被包含的文件, 找不到时返回空
+func (p *Parser) findInclude(name string) string {
+	if filepath.IsAbs(name) {
+		if isFile(name) {
+			return name
+		}
+		return ""
+	}
+	dirs := append([]string{filepath.Dir(p.Lexer.Filename)}, p.IncludeDirs...)
+	for _, dir := range dirs {
+		if path := filepath.Join(dir, name); isFile(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// includeKey 比较文件时使用的绝对路径
+func includeKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
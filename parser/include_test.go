@@ -0,0 +1,107 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFiles 在临时目录中写入文件, 返回目录
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// parseFile 解析文件, 在-I目录inc中查找被包含的文件
+func parseFile(t *testing.T, path string, inc ...string) (*parser.Parser, []int64) {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(path), x86.NewMode(64))
+	p.IncludeDirs = inc
+	var nums []int64
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			nums = append(nums, i.Args[len(i.Args)-1].Num)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	return p, nums
+}
+
+// 先在当前文件的目录中查找, 再查找-I目录; 同一个文件只包含一次
+func TestInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/main.asm":  "INCLUDE \"a.inc\"\nINCLUDE \"a.inc\"\nINCLUDE \"lib.inc\"\nINCLUDE \"empty.inc\"\nmov %r0, B\n",
+		"src/a.inc":     "CONST A, 1\nmov %r0, A\n",
+		"inc/lib.inc":   "INCLUDE \"../src/a.inc\"\nCONST B, A + 1\nmov %r0, 5\n",
+		"inc/a.inc":     "CONST A, 9\nmov %r0, 9\n",
+		"inc/empty.inc": "",
+	})
+	p, got := parseFile(t, filepath.Join(dir, "src/main.asm"), filepath.Join(dir, "inc"))
+	if !slices.Equal(got, []int64{1, 5, 2}) {
+		t.Errorf("got %v, want [1 5 2]", got)
+	}
+	if len(p.Deps) != 3 || filepath.Base(p.Deps[0]) != "a.inc" || filepath.Base(p.Deps[1]) != "lib.inc" {
+		t.Errorf("deps %v", p.Deps)
+	}
+	if dep := p.DepFile("main.o"); !strings.HasPrefix(dep, "main.o: ") || !strings.Contains(dep, "lib.inc") {
+		t.Errorf("dep file %q", dep)
+	}
+}
+
+// 被包含的文件中的错误报告该文件中的位置和包含的位置
+func TestIncludeErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"bad.asm":     "ret\nINCLUDE \"bad.inc\"\n",
+		"bad.inc":     "\n\nbogus 1\n",
+		"cycle.asm":   "INCLUDE \"c1.inc\"\n",
+		"c1.inc":      "INCLUDE \"c2.inc\"\n",
+		"c2.inc":      "INCLUDE \"c1.inc\"\n",
+		"missing.asm": "INCLUDE \"nope.inc\"\n",
+		"bare.asm":    "INCLUDE a.inc\n",
+		"if.asm":      "INCLUDE \"if.inc\"\nENDIF\n",
+		"if.inc":      "IF 1\n",
+	})
+	for _, name := range []string{"bad.asm", "cycle.asm", "missing.asm", "bare.asm", "if.asm"} {
+		var p *parser.Parser
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: want an error", name)
+				}
+			}()
+			p = parser.NewParser(lexer.NewLexer(filepath.Join(dir, name)), x86.NewMode(64))
+			p.Parse()
+		}()
+		if name != "bad.asm" {
+			continue
+		}
+		if filepath.Base(p.Error.Path) != "bad.inc" {
+			t.Errorf("error reported in %s, want bad.inc", p.Error.Path)
+		}
+		if line, _ := p.Error.LineCol(strings.Index(p.Error.Text, "bogus")); line != 3 {
+			t.Errorf("error at line %d, want 3", line)
+		}
+		if len(p.Error.Trace) != 1 || !strings.HasSuffix(p.Error.Trace[0], "bad.asm:2:8") {
+			t.Errorf("trace %q", p.Error.Trace)
+		}
+	}
+}
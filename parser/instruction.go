@@ -16,7 +16,6 @@ func (i *Instruction) ParseInstruction(tokens []lexer.Token, p *Parser) {
 	// 解析名称和后面的一个空格
 	i.Instruction = types.Instruction(strings.ToUpper(tokens[0].Value))
 	if len(tokens) <= 1 {
-		p.ThisBlock.AddChild(&Node{Value: i})
 		return
 	}
 	tokens = tokens[1:]
@@ -47,7 +46,9 @@ func (i *Instruction) Parse(tokens []lexer.Token, p *Parser) {
 		arg := i.Args[e]
 		if arg.Type == VAR {
 			arg.Var.FindDefind(p)
-			valueToMemoryAddr(arg)
+			cursor := arg.Var.cursor
+			valueToMemoryAddr(arg, p)
+			i.checkVar(p, arg, cursor)
 		}
 	}
 	p.ThisBlock.AddChild(&Node{Value: i})
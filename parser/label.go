@@ -4,18 +4,23 @@ import (
 	"CuteASM/lexer"
 	"CuteASM/utils"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type LabelBlock struct {
 	IsFunc    bool
 	Args      []*ArgBlock
-	VarOffset int
+	Results   []*ArgBlock // Go汇编中引用的结果槽, 如ret+16(FP)
+	VarOffset int         // 当前作用域中已经分配的局部变量字节数
+	VarRoom   int         // 局部变量最多同时占用的字节数
 	ArgOffset int
 	StackRoom int
 	//Class      typeSys.Type
 	//Return     []typeSys.Type
 	Name string
 	//BuildFlags []*Build
+	Local bool // 局部标签或匿名标签, 不导出
 }
 
 type ArgBlock struct {
@@ -27,15 +32,32 @@ type ArgBlock struct {
 
 func (l *LabelBlock) Parse(tokens []lexer.Token, p *Parser) {
 	l.Name = tokens[0].Value
-	node := &Node{Value: l}
-	if p.ThisBlock.Father != nil {
-		if _, ok := p.ThisBlock.Value.(*LabelBlock); !ok || !p.ThisBlock.Value.(*LabelBlock).IsFunc {
-			p.Back(1)
+	if tokens[0].Type == lexer.NUMBER {
+		l.Name, l.Local = p.anonLabel(tokens[0].Value), true
+	} else if isLocalLabel(l.Name) {
+		name, err := p.localLabel(l.Name)
+		if err != nil {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, err.Error())
+		}
+		l.Name, l.Local = name, true
+	}
+	if p.labels[l.Name] {
+		msg := "label " + tokens[0].Value + " is already defined"
+		if len(p.loops) != 0 {
+			msg += ", a label inside FOR needs the loop variable in its name, such as " + tokens[0].Value + "_{i}"
 		}
+		p.Error.MissError("Symbol Error", tokens[0].Cursor, msg)
+	}
+	p.labels[l.Name] = true
+	node := &Node{Value: l}
+	// 标签属于所在的函数或段
+	if lb, ok := p.ThisBlock.Value.(*LabelBlock); ok && !lb.IsFunc {
+		p.Back(1)
 	}
 	if len(tokens) >= 4 && tokens[2].Type == lexer.SEPARATOR && tokens[2].Value == "(" {
 		l.IsFunc = true
-		if p.ThisBlock.Father != nil {
+		p.endScopes()
+		if _, ok := p.ThisBlock.Value.(*LabelBlock); ok {
 			p.Back(1)
 		}
 		tokens = tokens[3:]
@@ -47,7 +69,9 @@ func (l *LabelBlock) Parse(tokens []lexer.Token, p *Parser) {
 			if len(tokens) > 2 && code.Type == lexer.PSEUDO && utils.GetLength(code.Value) != 0 {
 				l.Args = append(l.Args, &ArgBlock{
 					Length: utils.GetLength(code.Value),
+					Offset: l.ArgOffset,
 				})
+				l.ArgOffset += utils.GetLength(code.Value)
 				code = tokens[1]
 				fmt.Println(code)
 				if code.Type == lexer.NAME && !p.isInstructions(code) {
@@ -70,6 +94,86 @@ func (l *LabelBlock) Parse(tokens []lexer.Token, p *Parser) {
 			}
 		}
 	}
+	if !l.Local && (l.IsFunc || p.function() == nil) {
+		// 之后的局部标签属于这个标签
+		p.labelScope = l.Name
+	}
 	p.ThisBlock.AddChild(node)
 	p.ThisBlock = node
 }
+
+// function 当前所在的函数, 不在函数中时为nil
+func (p *Parser) function() *LabelBlock {
+	for n := p.ThisBlock; n != nil; n = n.Father {
+		if lb, ok := n.Value.(*LabelBlock); ok && lb.IsFunc {
+			return lb
+		}
+	}
+	return nil
+}
+
+// 局部标签以.开头, 属于所在的函数, 不在函数中时属于之前最近的非局部标签;
+// 匿名标签是数字, Nb引用之前最近的N:, Nf引用之后最近的N:
+
+func isLocalLabel(name string) bool {
+	return len(name) > 1 && name[0] == '.'
+}
+
+// isAnonRef 是否为匿名标签的引用, 如1b、2f
+func isAnonRef(name string) bool {
+	n := len(name) - 1
+	if n < 1 || name[n] != 'b' && name[n] != 'f' {
+		return false
+	}
+	_, err := strconv.ParseUint(name[:n], 10, 32)
+	return err == nil
+}
+
+// isAnonLabel 是否为匿名标签的定义 N:
+func (p *Parser) isAnonLabel(tokens []lexer.Token) bool {
+	if len(tokens) < 2 || tokens[0].Type != lexer.NUMBER || tokens[1].Value != ":" {
+		return false
+	}
+	_, err := strconv.ParseUint(tokens[0].Value, 10, 32)
+	return err == nil
+}
+
+// localLabel 局部标签的全名 所属标签.name
+func (p *Parser) localLabel(name string) (string, error) {
+	if p.labelScope == "" {
+		return "", fmt.Errorf("local label %s is not inside a label", name)
+	}
+	full := p.labelScope + name
+	p.labelText[full] = name
+	return full, nil
+}
+
+// anonLabel 定义匿名标签, 同一个数字的第k个定义为__anon_N_k
+func (p *Parser) anonLabel(num string) string {
+	p.anonCount[num]++
+	return anonName(num, p.anonCount[num])
+}
+
+func anonName(num string, k int) string {
+	return "__anon_" + num + "_" + strconv.Itoa(k)
+}
+
+// labelRef 把引用的局部标签和匿名标签换成全名, 其余名称不变
+func (p *Parser) labelRef(name string) (string, error) {
+	switch {
+	case isLocalLabel(name):
+		return p.localLabel(name)
+	case isAnonRef(name):
+		num := name[:len(name)-1]
+		k := p.anonCount[num]
+		if strings.HasSuffix(name, "f") {
+			k++
+		} else if k == 0 {
+			return "", fmt.Errorf("no %s: label before %s", num, name)
+		}
+		full := anonName(num, k)
+		p.labelText[full] = name
+		return full, nil
+	}
+	return name, nil
+}
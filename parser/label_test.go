@@ -0,0 +1,65 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// 局部标签属于所在的函数, 不在函数中时属于之前最近的标签, Nb和Nf引用之前和之后最近的N:
+func TestLocalLabels(t *testing.T) {
+	src := `a:
+.loop:
+    jmp .loop
+f:()
+.loop:
+    jmp .loop
+inner:
+.x:
+    jmp .x
+g:()
+.loop:
+    jmp .loop
+1:
+    jmp 1b
+    jmp 1f
+1:
+    jmp 1b
+    jmp 2f
+2:`
+	insts := parseInsts(t, src)
+	want := []string{"a.loop", "f.loop", "f.x", "g.loop", "__anon_1_1", "__anon_1_2", "__anon_1_2", "__anon_2_1"}
+	if len(insts) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(insts), len(want))
+	}
+	for n, name := range want {
+		if got := insts[n].Args[0].String; got != name {
+			t.Errorf("jump %d to %s, want %s", n, got, name)
+		}
+	}
+
+	// 局部标签和匿名标签不导出
+	table := parser.SymbolsOf(parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), x86.NewMode(64)).Parse())
+	for _, s := range table.Symbols {
+		local := s.Name != "f" && s.Name != "g" && s.Name != "a" && s.Name != "inner"
+		if s.Hidden != local {
+			t.Errorf("%s: hidden %v", s.Name, s.Hidden)
+		}
+	}
+}
+
+func TestLocalLabelErrors(t *testing.T) {
+	for _, src := range []string{
+		".x:\nret",
+		"jmp .x",
+		"f:\n.x:\n.x:",
+		"f:\njmp .y",
+		"f:\njmp 1b\n1:",
+		"f:\n1:\njmp 1f",
+		"f:()\n.x:\ng:()\njmp .x",
+		"f:()\n.x:\ninner:\n.x:",
+	} {
+		wantError(t, src)
+	}
+}
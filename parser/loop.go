@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 单个FOR最多展开的次数, 防止写错步长时无限展开
+const maxLoop = 1 << 20
+
+// loopBlock 一层正在展开的FOR
+type loopBlock struct {
+	end   int  // ENDFOR所在行的起始位置
+	conds int  // 进入循环体时未结束的IF层数
+	next  bool // 遇到CONTINUE, 结束本次展开
+}
+
+func (p *Parser) isLoop(token lexer.Token) bool {
+	if token.Type != lexer.PSEUDO {
+		return false
+	}
+	switch token.Value {
+	case "FOR", "ENDFOR", "CONTINUE":
+		return true
+	}
+	return false
+}
+
+// ParseLoop 处理汇编期循环
+// FOR 变量, 起始值, 结束值[, 步长] ... ENDFOR
+// 循环体在解析时按变量的每个取值展开一次, 不包含结束值, CONTINUE跳过本次展开的剩余部分
+func (p *Parser) ParseLoop(tokens []lexer.Token) {
+	switch tokens[0].Value {
+	case "FOR":
+		p.parseFor(tokens)
+	case "ENDFOR":
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDFOR without FOR")
+	case "CONTINUE":
+		if len(p.loops) == 0 {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "CONTINUE outside FOR")
+		}
+		if len(tokens) > 1 {
+			p.Error.MissError("Syntax Error", tokens[1].Cursor, "unexpected "+tokens[1].Value+" after CONTINUE")
+		}
+		p.loops[len(p.loops)-1].next = true
+	}
+}
+
+func (p *Parser) parseFor(tokens []lexer.Token) {
+	args := splitArgs(tokens[1:])
+	if len(args) != 3 && len(args) != 4 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "FOR needs a variable, a start and an end value: FOR i, 0, 8")
+	}
+	if len(args[0]) != 1 || args[0][0].Type != lexer.NAME {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "FOR needs a variable name")
+	}
+	name := args[0][0].Value
+	bounds := []int64{0, 0, 1}
+	for n, arg := range args[1:] {
+		if len(arg) == 0 {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "missing FOR bound")
+		}
+		c, err := p.Eval(p.exprText(arg))
+		if err == nil && c.IsStr {
+			err = fmt.Errorf("FOR bounds must be integers")
+		}
+		if err != nil {
+			p.Error.MissError("Expression Error", tokenStart(arg[0]), err.Error())
+		}
+		bounds[n] = c.Int
+	}
+	start, stop, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		p.Error.MissError("Syntax Error", tokenStart(args[3][0]), "FOR step cannot be 0")
+	}
+
+	body := p.Lexer.Cursor
+	end, after := p.findEndFor(tokens[0])
+	old, had := p.Defines[name]
+	l := &loopBlock{end: end, conds: len(p.conds)}
+	p.loops = append(p.loops, l)
+	count := 0
+	for v := start; step > 0 && v < stop || step < 0 && v > stop; v += step {
+		if count++; count > maxLoop {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "FOR expands more than "+strconv.Itoa(maxLoop)+" times")
+		}
+		p.Defines[name] = Const{Int: v}
+		p.Lexer.Cursor = body
+		p.Lexer.LastSepTmp = ""
+		l.next = false
+		for !l.next && p.Lexer.Cursor < end {
+			p.Line()
+		}
+		if l.next {
+			// CONTINUE时丢弃循环体中没有结束的IF
+			p.conds = p.conds[:l.conds]
+		} else if len(p.conds) > l.conds {
+			p.Error.MissError("Syntax Error", p.conds[len(p.conds)-1].cursor, "IF without ENDIF in FOR body")
+		} else if len(p.conds) < l.conds {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDIF in FOR body closes an IF outside the loop")
+		}
+	}
+	p.loops = p.loops[:len(p.loops)-1]
+	if had {
+		p.Defines[name] = old
+	} else {
+		delete(p.Defines, name)
+	}
+	p.Lexer.Cursor = after
+	p.Lexer.LastSepTmp = ""
+}
+
+// findEndFor 找到与FOR对应的ENDFOR
+// 返回ENDFOR所在行的起始位置和下一行的起始位置
+func (p *Parser) findEndFor(start lexer.Token) (end, after int) {
+	depth := 1
+	for {
+		end = p.Lexer.Cursor
+		tokens, ok := p.readLine()
+		if !ok {
+			p.Error.MissError("Syntax Error", start.Cursor, "FOR without ENDFOR")
+		}
+		if len(tokens) == 0 || tokens[0].Type != lexer.PSEUDO {
+			continue
+		}
+		switch tokens[0].Value {
+		case "FOR":
+			depth++
+		case "ENDFOR":
+			if depth--; depth == 0 {
+				return end, p.Lexer.Cursor
+			}
+		}
+	}
+}
+
+// splitArgs 按逗号切分参数, 括号中的逗号除外
+func splitArgs(tokens []lexer.Token) [][]lexer.Token {
+	args := [][]lexer.Token{}
+	depth, start := 0, 0
+	for n, token := range tokens {
+		if token.Type != lexer.SEPARATOR {
+			continue
+		}
+		switch token.Value {
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case ",":
+			if depth == 0 {
+				args = append(args, tokens[start:n])
+				start = n + 1
+			}
+		}
+	}
+	return append(args, tokens[start:])
+}
+
+// interpolate 把名称中的{表达式}替换为表达式的值, 用于在FOR中生成标签名, 如 round_{i}
+// 表达式中的运算符会把名称拆成多个token, 先合并到右括号为止
+func (p *Parser) interpolate(tokens []lexer.Token) []lexer.Token {
+	res := tokens[:0:0]
+	for n := 0; n < len(tokens); n++ {
+		token := tokens[n]
+		if token.Type != lexer.NAME || !strings.Contains(token.Value, "{") {
+			res = append(res, token)
+			continue
+		}
+		m := n
+		text := p.exprText(tokens[n : m+1])
+		for strings.Count(text, "{") > strings.Count(text, "}") && m+1 < len(tokens) {
+			m++
+			text = p.exprText(tokens[n : m+1])
+		}
+		value, err := p.expand(text)
+		if err != nil {
+			p.Error.MissError("Expression Error", token.Cursor, err.Error())
+		}
+		// 位置仍然指向原文, 表达式按原文解析时再次替换
+		token.Value = value
+		token.EndCursor = tokens[m].EndCursor
+		if lexer.IsDigit(value) {
+			token.Type = lexer.NUMBER
+		}
+		res = append(res, token)
+		n = m
+	}
+	return res
+}
+
+// expand 替换文本中所有的{表达式}
+func (p *Parser) expand(text string) (string, error) {
+	var sb strings.Builder
+	for {
+		l := strings.IndexByte(text, '{')
+		if l == -1 {
+			sb.WriteString(text)
+			return sb.String(), nil
+		}
+		r := strings.IndexByte(text[l:], '}')
+		if r == -1 {
+			return "", fmt.Errorf("need '}'")
+		}
+		c, err := p.Eval(text[l+1 : l+r])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(text[:l])
+		if c.IsStr {
+			sb.WriteString(c.Str)
+		} else {
+			sb.WriteString(strconv.FormatInt(c.Int, 10))
+		}
+		text = text[l+r+1:]
+	}
+}
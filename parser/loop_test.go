@@ -0,0 +1,65 @@
+package parser_test
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []int64
+	}{
+		{"FOR i, 0, 4\nmov %r0, i * 2\nENDFOR", []int64{0, 2, 4, 6}},
+		{"FOR i, 6, 0, -2\nmov %r0, i\nENDFOR", []int64{6, 4, 2}},
+		{"FOR i, 0, 0\nmov %r0, i\nENDFOR\nmov %r0, 9", []int64{9}},
+		{"FOR i, 0, 2\nFOR j, 0, 3\nmov %r0, i * 10 + j\nENDFOR\nENDFOR", []int64{0, 1, 2, 10, 11, 12}},
+		{"FOR i, 0, 5\nIF i % 2\nCONTINUE\nENDIF\nmov %r0, i\nENDFOR", []int64{0, 2, 4}},
+		{"CONST N, 3\nFOR i, 1, N + 1\nmov %r0, (1 << i)\nENDFOR", []int64{2, 4, 8}},
+		// 循环结束后恢复同名的符号
+		{"FOR i, 0, 2\nENDFOR\nIF DEFINED(i)\nmov %r0, 1\nENDIF", nil},
+	}
+	for _, tt := range tests {
+		if got := imms(t, tt.src); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+	if got := imms(t, "FOR i, 0, 2\nENDFOR\nmov %r0, i", "i=7"); !slices.Equal(got, []int64{7}) {
+		t.Errorf("i after FOR = %v, want 7", got)
+	}
+}
+
+// 变量代入偏移和生成的标签名
+func TestForLabels(t *testing.T) {
+	insts := parseInsts(t, "f:\nFOR i, 0, 3\nL_{i}:\nmov %r0, QW[%r1 + i*8]\njmp L_{i}\nENDFOR")
+	if len(insts) != 6 {
+		t.Fatalf("got %d instructions, want 6", len(insts))
+	}
+	for i := 0; i < 3; i++ {
+		mov, jmp := insts[2*i], insts[2*i+1]
+		if mov.Args[1].Addr.Displacement != int64(i*8) {
+			t.Errorf("iteration %d: displacement %d", i, mov.Args[1].Addr.Displacement)
+		}
+		if want := "L_" + string(rune('0'+i)); jmp.Args[0].String != want {
+			t.Errorf("iteration %d: jmp %s, want %s", i, jmp.Args[0].String, want)
+		}
+	}
+}
+
+func TestForErrors(t *testing.T) {
+	for _, src := range []string{
+		"ENDFOR",
+		"CONTINUE",
+		"FOR i, 0, 2\nmov %r0, i",
+		"FOR i, 0, 2, 0\nENDFOR",
+		"FOR i, 0\nENDFOR",
+		"FOR 1, 0, 2\nENDFOR",
+		"FOR i, 0, \"a\"\nENDFOR",
+		"FOR i, 0, 2\nL:\nENDFOR",
+		"FOR i, 0, 2\nIF 1\nENDFOR",
+		"IF 1\nFOR i, 0, 2\nENDIF\nENDFOR",
+		"FOR i, 0, 2\nCONTINUE 1\nENDFOR",
+	} {
+		wantError(t, src)
+	}
+}
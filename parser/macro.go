@@ -0,0 +1,248 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 宏展开的最大嵌套层数, 防止递归的宏没有终止条件
+const maxMacroDepth = 256
+
+// Macro 宏定义
+//
+//	MACRO name(a, b=4, rest...)
+//	    ...
+//	ENDM
+//
+// 参数在宏体中按名称替换为调用时的原文, 字符串中的除外; 带默认值的参数可以省略,
+// 最后一个参数名后加...时接收剩余的全部参数; NARGS替换为实际参数的个数;
+// %%name是每次展开唯一的局部标签
+type Macro struct {
+	Name   string
+	Params []string
+	Values []string // 参数的默认值, 为空时必须传入
+	Vararg bool     // 最后一个参数接收剩余参数
+	Body   string
+	lexer  *lexer.Lexer // 定义所在的文件
+	cursor int          // MACRO所在位置
+	line   int          // 宏体第一行的行号
+}
+
+func (p *Parser) isMacro(token lexer.Token) bool {
+	if token.Type == lexer.PSEUDO {
+		return token.Value == "MACRO" || token.Value == "ENDM"
+	}
+	_, ok := p.macros[token.Value]
+	return ok && token.Type == lexer.NAME
+}
+
+// ParseMacro 处理宏定义和宏调用
+func (p *Parser) ParseMacro(tokens []lexer.Token) {
+	switch tokens[0].Value {
+	case "MACRO":
+		p.defineMacro(tokens)
+	case "ENDM":
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDM without MACRO")
+	default:
+		p.expandMacro(p.macros[tokens[0].Value], tokens)
+	}
+}
+
+// defineMacro 解析宏头部并记录宏体, 宏体在调用时才解析
+func (p *Parser) defineMacro(tokens []lexer.Token) {
+	if len(tokens) < 2 || tokens[1].Type != lexer.NAME {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "MACRO needs a name: MACRO name(args...)")
+	}
+	m := &Macro{Name: tokens[1].Value, lexer: p.Lexer, cursor: tokens[0].Cursor}
+	if len(tokens) > 2 {
+		last := tokens[len(tokens)-1]
+		if tokens[2].Value != "(" || last.Value != ")" {
+			p.Error.MissError("Syntax Error", tokens[2].Cursor, "macro parameters must be enclosed in parentheses")
+		}
+		params := ""
+		if len(tokens) > 4 {
+			params = p.exprText(tokens[3 : len(tokens)-1])
+		}
+		for n, param := range splitOperands(params) {
+			name, value, _ := strings.Cut(param, "=")
+			name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+			if strings.HasSuffix(name, "...") {
+				if n != len(splitOperands(params))-1 {
+					p.Error.MissError("Syntax Error", tokens[2].Cursor, "only the last macro parameter can take the remaining arguments")
+				}
+				name = strings.TrimSuffix(name, "...")
+				m.Vararg = true
+			}
+			if !isIdent(name) {
+				p.Error.MissError("Syntax Error", tokens[2].Cursor, "invalid macro parameter "+param)
+			}
+			m.Params = append(m.Params, name)
+			m.Values = append(m.Values, value)
+		}
+	}
+
+	// 宏体到对应的ENDM为止, 宏体中可以再定义宏
+	body := p.Lexer.Cursor
+	depth := 1
+	for {
+		end := p.Lexer.Cursor
+		line, ok := p.readLine()
+		if !ok {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "MACRO without ENDM")
+		}
+		if len(line) == 0 || line[0].Type != lexer.PSEUDO {
+			continue
+		}
+		switch line[0].Value {
+		case "MACRO":
+			depth++
+		case "ENDM":
+			if depth--; depth == 0 {
+				m.Body = p.Lexer.Text[body:end]
+				m.line = strings.Count(p.Lexer.Text[:body], p.Lexer.LineFeed)
+				if p.macros == nil {
+					p.macros = map[string]*Macro{}
+				}
+				p.macros[m.Name] = m
+				return
+			}
+		}
+	}
+}
+
+// expandMacro 展开宏调用, 调用写作 name(a, b) 或 name a, b
+// 展开的文本按原来的行号单独做词法分析, 出错时同时报告定义和调用的位置
+func (p *Parser) expandMacro(m *Macro, tokens []lexer.Token) {
+	if len(p.expanding) >= maxMacroDepth {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "macro "+m.Name+" is nested too deeply")
+	}
+	args := []string{}
+	if len(tokens) > 1 {
+		rest := tokens[1:]
+		if rest[0].Value == "(" && rest[len(rest)-1].Value == ")" && rest[0].Type == lexer.SEPARATOR {
+			rest = rest[1 : len(rest)-1]
+		}
+		if len(rest) != 0 {
+			args = splitOperands(p.exprText(rest))
+		}
+	}
+	values, err := m.bind(args)
+	if err != nil {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, err.Error())
+	}
+	p.macroCount++
+	body := m.substitute(values, len(args), p.macroCount)
+
+	// 宏体前补齐换行, 使行号与定义处一致
+	lex := lexer.NewLexerText(m.lexer.Filename, strings.Repeat(m.lexer.LineFeed, m.line)+body+m.lexer.LineFeed)
+	lex.LineFeed = m.lexer.LineFeed
+	lex.Error.LineFeed = m.lexer.LineFeed
+	lex.Cursor = m.line * len(m.lexer.LineFeed)
+	lex.Error.Trace = append([]string{
+		fmt.Sprintf("in macro %s (defined at %s) called at %s", m.Name, m.lexer.Error.Position(m.cursor), p.Error.Position(tokens[0].Cursor)),
+	}, p.Error.Trace...)
+
+	oldLexer, oldError, oldLoops := p.Lexer, p.Error, p.loops
+	conds := len(p.conds)
+	p.Lexer, p.Error, p.loops = lex, lex.Error, nil
+	p.expanding = append(p.expanding, m.Name)
+	for p.Line() {
+	}
+	if len(p.conds) != conds {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "unbalanced IF/ENDIF in macro "+m.Name)
+	}
+	p.expanding = p.expanding[:len(p.expanding)-1]
+	p.Lexer, p.Error, p.loops = oldLexer, oldError, oldLoops
+}
+
+// bind 按位置把实参对应到形参, 省略的参数使用默认值
+func (m *Macro) bind(args []string) ([]string, error) {
+	values := make([]string, len(m.Params))
+	fixed := len(m.Params)
+	if m.Vararg {
+		fixed--
+	}
+	if len(args) > fixed && !m.Vararg {
+		return nil, fmt.Errorf("macro %s takes %d arguments, got %d", m.Name, fixed, len(args))
+	}
+	for n := 0; n < fixed; n++ {
+		switch {
+		case n < len(args) && args[n] != "":
+			values[n] = args[n]
+		case m.Values[n] != "":
+			values[n] = m.Values[n]
+		default:
+			return nil, fmt.Errorf("macro %s needs argument %s", m.Name, m.Params[n])
+		}
+	}
+	if m.Vararg {
+		if len(args) > fixed {
+			values[fixed] = strings.Join(args[fixed:], ", ")
+		} else {
+			values[fixed] = m.Values[fixed]
+		}
+	}
+	return values, nil
+}
+
+// substitute 替换宏体中的参数、NARGS和局部标签
+func (m *Macro) substitute(values []string, nargs int, id int) string {
+	var sb strings.Builder
+	text := m.Body
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '"' || c == '\'':
+			// 字符串原样保留
+			_, n := scanQuoted(text[i:])
+			if n == 0 {
+				sb.WriteString(text[i:])
+				return sb.String()
+			}
+			sb.WriteString(text[i : i+n])
+			i += n
+		case c == ';':
+			// 注释原样保留
+			end := strings.IndexAny(text[i:], "\r\n")
+			if end == -1 {
+				end = len(text) - i
+			}
+			sb.WriteString(text[i : i+end])
+			i += end
+		case strings.HasPrefix(text[i:], "%%") && i+2 < len(text) && isNameChar(text[i+2]):
+			j := i + 2
+			for j < len(text) && isNameChar(text[j]) {
+				j++
+			}
+			sb.WriteString("__" + m.Name + "_" + strconv.Itoa(id) + "_" + text[i+2:j])
+			i = j
+		case isNameChar(c) && (i == 0 || !isNameChar(text[i-1]) && text[i-1] != '.' && text[i-1] != '%'):
+			j := i
+			for j < len(text) && isNameChar(text[j]) {
+				j++
+			}
+			word := text[i:j]
+			sb.WriteString(m.lookup(word, values, nargs))
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// lookup 宏体中的名称替换后的文本
+func (m *Macro) lookup(word string, values []string, nargs int) string {
+	if word == "NARGS" {
+		return strconv.Itoa(nargs)
+	}
+	for n, param := range m.Params {
+		if param == word {
+			return values[n]
+		}
+	}
+	return word
+}
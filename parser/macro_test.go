@@ -0,0 +1,97 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const macroSrc = `MACRO addn(r, n=1)
+    add r, n
+ENDM
+MACRO emit(op, rest...)
+    op rest
+ENDM
+MACRO count(args...)
+    mov %r0, NARGS
+ENDM
+MACRO twice(x)
+    addn %r0, x
+    addn(%r0, x)
+ENDM
+addn %r0
+addn(%r0, 7)
+emit mov, %r1, 5
+count 1, 2, 3
+count
+twice 4`
+
+// 默认参数、剩余参数、NARGS和嵌套调用
+func TestMacro(t *testing.T) {
+	if got := imms(t, macroSrc); !slices.Equal(got, []int64{1, 7, 5, 3, 0, 4, 4}) {
+		t.Errorf("got %v", got)
+	}
+	insts := parseInsts(t, macroSrc)
+	if insts[2].Instruction != "MOV" || insts[2].Args[0].Reg.Num != 1 {
+		t.Errorf("emit mov, %%r1, 5 gave %s %+v", insts[2].Instruction, insts[2].Args[0])
+	}
+}
+
+// %%name在每次展开中都是不同的标签, 字符串中的参数名不替换
+func TestMacroLocalLabels(t *testing.T) {
+	insts := parseInsts(t, `MACRO spin(r)
+%%top:
+    sub r, 1
+    jmp %%top
+    mov r, 'r'
+ENDM
+f:
+spin %r0
+spin %r1`)
+	if len(insts) != 6 {
+		t.Fatalf("got %d instructions, want 6", len(insts))
+	}
+	a, b := insts[1].Args[0].String, insts[4].Args[0].String
+	if a == b || !strings.Contains(a, "top") || !strings.Contains(b, "top") {
+		t.Errorf("local labels %q and %q", a, b)
+	}
+	if insts[2].Args[1].Num != 'r' {
+		t.Errorf("'r' became %+v", insts[2].Args[1])
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	for _, src := range []string{
+		"ENDM",
+		"MACRO",
+		"MACRO m(a)\nnop",
+		"MACRO m(a)\nENDM\nm",
+		"MACRO m(a)\nENDM\nm 1, 2",
+		"MACRO m(a..., b)\nENDM",
+		"MACRO m(1)\nENDM",
+		"MACRO m\nm\nENDM\nm",
+		"MACRO m\nIF 1\nENDM\nm",
+	} {
+		wantError(t, src)
+	}
+}
+
+// 宏体中的错误同时报告调用和定义的位置
+func TestMacroTrace(t *testing.T) {
+	p := parser.NewParser(lexer.NewLexerText("test.asm", "MACRO bad(x)\n    bogus x\nENDM\n\nbad %r0\n"), x86.NewMode(64))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want an error")
+		}
+		if len(p.Error.Trace) != 1 || !strings.Contains(p.Error.Trace[0], "in macro bad (defined at test.asm:1:0) called at test.asm:5:0") {
+			t.Errorf("trace %q", p.Error.Trace)
+		}
+		if line, _ := p.Error.LineCol(strings.Index(p.Error.Text, "bogus")); line != 2 {
+			t.Errorf("body reported at line %d, want 2", line)
+		}
+	}()
+	p.Parse()
+}
@@ -21,6 +21,26 @@ type Parser struct {
 	IsInFunc    bool
 	line        int // 添加行号计数器
 	arch        *types.Architecture
+	Defines     map[string]Const // 条件汇编使用的符号
+	conds       []*condBlock     // 未结束的IF
+	equs        map[string]bool  // 依赖标签地址的常量
+	loops       []*loopBlock     // 正在展开的FOR
+	macros      map[string]*Macro
+	expanding   []string // 正在展开的宏
+	macroCount  int      // 宏展开次数, 用于生成局部标签
+	// Go汇编中未遇到GLOBL的DATA和已经生成的数据段
+	plan9Datas   map[string][]plan9Piece
+	plan9Globals []*Node
+	symbolUses   []symbolUse       // 符号的声明和引用
+	IncludeDirs  []string          // INCLUDE的查找目录, 命令行的-I
+	including    []string          // 正在解析的文件, 用于发现循环包含
+	included     map[string]bool   // 已经包含过的文件
+	Deps         []string          // INCLUDE和INCBIN读取的文件
+	labelScope   string            // 局部标签所属的标签
+	anonCount    map[string]int    // 各数字的匿名标签已经定义的个数
+	labelText    map[string]string // 局部标签和匿名标签的全名在源码中的写法, 用于报错
+	labels       map[string]bool   // 已经定义的标签, 用于发现重复定义
+	scopes       []*scopeBlock     // 当前函数中VAR的作用域, 第一个是函数体
 }
 
 func (p *Parser) Next() (finish bool) {
@@ -146,6 +166,16 @@ func NewParser(lexer *lexer.Lexer, Arch *types.Architecture) *Parser {
 	}
 	p.Block = &Node{}
 	p.ThisBlock = p.Block
+	p.included = map[string]bool{}
+	p.anonCount = map[string]int{}
+	p.labelText = map[string]string{}
+	p.labels = map[string]bool{}
+	if isFile(lexer.Filename) {
+		key := includeKey(lexer.Filename)
+		p.including = []string{key}
+		p.included[key] = true
+	}
+	p.Define("ARCH", Arch.Name)
 	return p
 }
 
@@ -155,41 +185,82 @@ func (p *Parser) Parse() *Node {
 			break
 		}
 	}
+	if len(p.conds) != 0 {
+		p.Error.MissError("Syntax Error", p.conds[len(p.conds)-1].cursor, "IF without ENDIF")
+	}
+	p.endScopes()
+	p.resolveSymbols()
 	return p.Block
 }
 
 func (p *Parser) Line() bool {
-	// 等待到行尾
-	tokens := []lexer.Token{}
-	for {
-		token := p.Lexer.Next()
-		if token.IsEmpty() && len(tokens) == 0 {
-			return false
-		}
-		if token.IsEmpty() || ((token.Value == "\n" || token.Value == ";") && token.Type == lexer.SEPARATOR) {
-			p.line++ // 遇到换行符时增加行号
-			break
-		}
-		tokens = append(tokens, token)
+	tokens, ok := p.readLine()
+	if !ok {
+		return false
 	}
 	if len(tokens) == 0 {
 		return true
 	}
+	if p.isCond(tokens[0]) {
+		p.ParseCond(tokens)
+		return true
+	}
+	if p.skipping() {
+		return true
+	}
+	tokens = p.interpolate(tokens)
+	if p.isLoop(tokens[0]) {
+		p.ParseLoop(tokens)
+		return true
+	}
+	if p.isMacro(tokens[0]) && !p.isLabel(tokens) {
+		p.ParseMacro(tokens)
+		return true
+	}
 	if p.isPseudo(tokens[0]) {
 		p.ParsePseudo(tokens)
 		return true
 	}
+	// 标签可能与指令同名, 如loop:
+	if p.isLabel(tokens) {
+		l := &LabelBlock{}
+		l.Parse(tokens, p)
+		if len(tokens) > 2 && (p.isData(tokens[2]) || p.isIncbin(tokens[2])) {
+			// 标签后面的数据
+			p.ParsePseudo(tokens[2:])
+		} else if len(tokens) > 2 && !l.IsFunc {
+			p.Error.MissErrors("Syntax Error", tokens[2].Cursor, tokens[2].EndCursor, "unexpected "+tokens[2].Value+" after label "+tokens[0].Value)
+		}
+		return true
+	}
 	if p.isInstructions(tokens[0]) {
 		i := &Instruction{}
 		i.Parse(tokens, p)
+		return true
 	}
-	if p.isLabel(tokens) {
-		l := &LabelBlock{}
-		l.Parse(tokens, p)
+	if tokens[0].Type == lexer.NAME {
+		// 既不是标签也不是指令
+		p.Error.MissErrors("Syntax Error", tokens[0].Cursor, tokens[0].EndCursor, "unknown instruction "+tokens[0].Value)
 	}
 	return true
 }
 
+// readLine 读取一行的token, 文件结束时ok为假
+func (p *Parser) readLine() (tokens []lexer.Token, ok bool) {
+	// 等待到行尾
+	for {
+		token := p.Lexer.Next()
+		if token.IsEmpty() && len(tokens) == 0 {
+			return nil, false
+		}
+		if token.IsEmpty() || ((token.Value == "\n" || token.Value == ";") && token.Type == lexer.SEPARATOR) {
+			p.line++ // 遇到换行符时增加行号
+			return tokens, true
+		}
+		tokens = append(tokens, token)
+	}
+}
+
 func (p *Parser) isInstructions(token lexer.Token) bool {
 	instruction := types.Instruction(strings.ToUpper(token.Value))
 	_, ok := p.arch.Instructions[instruction]
@@ -218,7 +289,7 @@ func (p *Parser) isLabel(tokens []lexer.Token) bool {
 	if tokens[0].Type == lexer.NAME && tokens[1].Type == lexer.SEPARATOR && tokens[1].Value == ":" {
 		return true
 	}
-	return false
+	return p.isAnonLabel(tokens)
 }
 
 func (p *Parser) isPseudo(token lexer.Token) bool {
@@ -229,14 +300,51 @@ func (p *Parser) isPseudo(token lexer.Token) bool {
 }
 
 func (p *Parser) ParsePseudo(tokens []lexer.Token) {
+	if p.isInclude(tokens[0]) {
+		p.ParseInclude(tokens)
+		return
+	}
+	if p.isIncbin(tokens[0]) {
+		p.ParseIncbin(tokens)
+		return
+	}
+	if p.isStruct(tokens[0]) {
+		p.ParseStruct(tokens)
+		return
+	}
+	if p.isScope(tokens[0]) {
+		p.ParseScope(tokens)
+		return
+	}
+	if p.isAlign(tokens[0]) {
+		a := &AlignBlock{}
+		a.Parse(tokens, p)
+		return
+	}
+	if p.isData(tokens[0]) {
+		d := &DataBlock{}
+		d.Parse(tokens, p)
+		return
+	}
+	if p.isSymbol(tokens[0]) {
+		p.ParseSymbol(tokens)
+		return
+	}
+	if tokens[0].Value == "CONST" {
+		c := &ConstBlock{}
+		c.Parse(tokens, p)
+		return
+	}
+	if tokens[0].Value == "SECTION" {
+		s := &SECTION{}
+		s.ParseTokens(tokens, p)
+		return
+	}
 	instruction := &Instruction{}
 	instruction.ParseInstruction(tokens, p)
 	switch instruction.Instruction {
 	case "VAR":
 		v := &VarBlock{}
 		v.Parse(instruction, p)
-	case "SECTION":
-		//s := &SECTION{}
-		//s.Parse(instruction, p)
 	}
 }
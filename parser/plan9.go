@@ -0,0 +1,656 @@
+package parser
+
+import (
+	"CuteASM/arch/types"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Go汇编(amd64)寄存器的硬件编号
+var plan9Regs = map[string]int{
+	"AX": 0, "CX": 1, "DX": 2, "BX": 3, "SP": 4, "BP": 5, "SI": 6, "DI": 7,
+	"R8": 8, "R9": 9, "R10": 10, "R11": 11, "R12": 12, "R13": 13, "R14": 14, "R15": 15,
+}
+
+// Go汇编(amd64)的8位寄存器, 宽度不由助记符决定, 如MOVBLZX BL, DX
+var plan9ByteRegs = map[string]int{
+	"AL": 0, "CL": 1, "DL": 2, "BL": 3, "SPB": 4, "BPB": 5, "SIB": 6, "DIB": 7,
+	"R8B": 8, "R9B": 9, "R10B": 10, "R11B": 11, "R12B": 12, "R13B": 13, "R14B": 14, "R15B": 15,
+}
+
+// 带宽度后缀的Go助记符对应的CuteASM内置指令
+var plan9Builtin = map[string]types.Instruction{
+	"MOV": "MOV", "ADD": "ADD", "SUB": "SUB", "IMUL": "MUL",
+	"AND": "AND", "OR": "OR", "XOR": "XOR", "NOT": "NOT", "NEG": "NEG",
+	"SHL": "SHIFTL", "SHR": "SHIFTR", "CMP": "CMP", "XCHG": "XCHG",
+	"PUSH": "PUSH", "POP": "POP",
+}
+
+// 不带宽度后缀的Go助记符
+var plan9Plain = map[string]types.Instruction{
+	"JMP": "JMP", "JEQ": "JMPZ", "JE": "JMPZ", "JZ": "JMPZ",
+	"JLT": "JMPN", "JL": "JMPN", "CALL": "CALL", "RET": "RET", "HLT": "HALT",
+}
+
+// 宽度后缀
+var plan9Suffix = map[byte]int{'B': 1, 'W': 2, 'L': 4, 'Q': 8}
+
+// plan9Stmt 一条语句及其在源码中的位置
+type plan9Stmt struct {
+	text   string
+	cursor int
+}
+
+// ParsePlan9 按Go(Plan 9)汇编语法解析amd64源码, 生成与CuteASM语法相同的语法树
+//
+// TEXT 定义函数, 帧大小写入StackRoom; name+off(FP) 引用参数,
+// 首次引用时按偏移和宽度加入函数的参数列表; name-off(SP) 引用局部变量。
+// 能对应内置指令的助记符转换为内置指令, 操作数改为目标在前;
+// 其它指令保留原名和操作数顺序, 与x86编码表中的条目一致。
+// DATA、GLOBL 转换为.data或.rodata中的标签和初始化数据, 放在最后。
+func (p *Parser) ParsePlan9() *Node {
+	for _, stmt := range p.plan9Stmts() {
+		p.plan9Stmt(stmt)
+	}
+	for sym, pieces := range p.plan9Datas {
+		p.Error.MissError("Syntax Error", pieces[0].stmt.cursor, "DATA for "+sym+" without GLOBL")
+	}
+	for _, node := range p.plan9Globals {
+		p.Block.AddChild(node)
+	}
+	p.resolveSymbols()
+	return p.Block
+}
+
+// plan9Stmts 去掉注释, 按换行和分号切分语句
+func (p *Parser) plan9Stmts() []plan9Stmt {
+	text := []byte(p.Lexer.Text)
+	// 注释替换为空格, 保持位置不变
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\'' || text[i] == '"':
+			quote := text[i]
+			for i++; i < len(text) && text[i] != quote && text[i] != '\n'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case text[i] == '/' && i+1 < len(text) && text[i+1] == '/':
+			for ; i < len(text) && text[i] != '\n'; i++ {
+				text[i] = ' '
+			}
+		case text[i] == '/' && i+1 < len(text) && text[i+1] == '*':
+			for ; i < len(text) && !(text[i] == '*' && i+1 < len(text) && text[i+1] == '/'); i++ {
+				if text[i] != '\n' {
+					text[i] = ' '
+				}
+			}
+			if i+1 < len(text) {
+				text[i], text[i+1] = ' ', ' '
+				i++
+			}
+		}
+	}
+	stmts := []plan9Stmt{}
+	start := 0
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && text[i] != '\n' && text[i] != '\r' && text[i] != ';' {
+			continue
+		}
+		line := string(text[start:i])
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			stmts = append(stmts, plan9Stmt{text: trimmed, cursor: start + strings.Index(line, trimmed)})
+		}
+		start = i + 1
+	}
+	return stmts
+}
+
+// plan9Stmt 解析一条语句
+func (p *Parser) plan9Stmt(stmt plan9Stmt) {
+	text := stmt.text
+	// 标签, 后面可以跟指令
+	if n := strings.IndexByte(text, ':'); n > 0 && isIdent(text[:n]) {
+		p.plan9Label(text[:n])
+		rest := strings.TrimSpace(text[n+1:])
+		if rest != "" {
+			p.plan9Stmt(plan9Stmt{text: rest, cursor: stmt.cursor + strings.Index(text, rest)})
+		}
+		return
+	}
+	name, rest := text, ""
+	if n := strings.IndexAny(text, " \t"); n >= 0 {
+		name, rest = text[:n], text[n+1:]
+	}
+	name = strings.ToUpper(name)
+	ops := splitOperands(strings.TrimSpace(rest))
+	switch name {
+	case "TEXT":
+		p.plan9Text(stmt, ops)
+		return
+	case "DATA", "GLOBL":
+		p.plan9Data(stmt, name, ops)
+		return
+	case "PCALIGN", "PCALIGNMAX":
+		p.plan9Align(stmt, name, ops)
+		return
+	case "FUNCDATA", "PCDATA", "NO_LOCAL_POINTERS":
+		// 只对Go运行时有意义
+		return
+	}
+
+	i := &Instruction{Instruction: types.Instruction(name)}
+	var widths []int
+	builtin := false
+	if tmp, ok := plan9Plain[name]; ok {
+		// 跳转目标没有宽度
+		i.Instruction, widths, builtin = tmp, []int{0}, true
+	} else if len(name) > 1 {
+		if tmp, ok := plan9Builtin[name[:len(name)-1]]; ok {
+			if w, ok := plan9Suffix[name[len(name)-1]]; ok {
+				i.Instruction, widths, builtin = tmp, []int{w}, true
+			}
+		}
+	}
+	if !builtin {
+		i.Instruction, widths = p.plan9Intel(name)
+	}
+	for n, op := range ops {
+		i.Args = append(i.Args, p.plan9Operand(stmt, op, widths[min(n, len(widths)-1)]))
+	}
+	if builtin && i.Instruction != "CMP" {
+		// Go汇编的源操作数在前
+		for l, r := 0, len(i.Args)-1; l < r; l, r = l+1, r-1 {
+			i.Args[l], i.Args[r] = i.Args[r], i.Args[l]
+		}
+	}
+	if p.ThisBlock == p.Block {
+		p.Error.MissError("Syntax Error", stmt.cursor, "instruction outside of TEXT")
+	}
+	p.ThisBlock.AddChild(&Node{Value: i})
+}
+
+// plan9Intel 不能对应内置指令的Go助记符换成Intel助记符, 文本汇编直接使用
+// 宽度后缀和条件码都改为Intel的写法, 如LEAQ即lea、JGT即jg、MOVBLZX即movzx;
+// 返回各操作数的宽度, 操作数比宽度多时使用最后一个
+func (p *Parser) plan9Intel(name string) (types.Instruction, []int) {
+	n := len(name)
+	switch {
+	case strings.HasPrefix(name, "J") && types.GoCond[name[1:]] != "":
+		return types.Instruction("J" + types.GoCond[name[1:]]), []int{0}
+	case strings.HasPrefix(name, "SET") && types.GoCond[name[3:]] != "":
+		return types.Instruction("SET" + types.GoCond[name[3:]]), []int{1}
+	case strings.HasPrefix(name, "CMOV") && n > 5 && plan9Suffix[name[4]] != 0 && types.GoCond[name[5:]] != "":
+		return types.Instruction("CMOV" + types.GoCond[name[5:]]), []int{plan9Suffix[name[4]]}
+	case name == "MOVLQSX":
+		return "MOVSXD", []int{4, 8}
+	case name == "MOVLQZX":
+		// 写32位寄存器时高32位清零
+		return "MOV", []int{4}
+	case n == 7 && strings.HasPrefix(name, "MOV") && (strings.HasSuffix(name, "ZX") || strings.HasSuffix(name, "SX")):
+		src, dst := plan9Suffix[name[3]], plan9Suffix[name[4]]
+		if src != 0 && dst != 0 {
+			return types.Instruction("MOV" + name[5:]), []int{src, dst}
+		}
+	case n > 1 && plan9Suffix[name[n-1]] != 0:
+		if _, ok := p.arch.Instructions[types.Instruction(name[:n-1])]; ok {
+			return types.Instruction(name[:n-1]), []int{plan9Suffix[name[n-1]]}
+		}
+	}
+	return types.Instruction(name), []int{8}
+}
+
+// plan9Text TEXT symbol(SB), [flags,] $frame[-args]
+func (p *Parser) plan9Text(stmt plan9Stmt, ops []string) {
+	if len(ops) < 2 {
+		p.Error.MissError("Syntax Error", stmt.cursor, "TEXT needs a symbol and a frame size")
+	}
+	label := &LabelBlock{IsFunc: true, Name: plan9Symbol(ops[0])}
+	if !strings.Contains(ops[0], "<>") {
+		p.symbolUses = append(p.symbolUses, symbolUse{name: label.Name, kind: "GLOBAL", bind: BindGlobal, cursor: stmt.cursor, err: p.Error})
+	}
+	frame := ops[len(ops)-1]
+	if !strings.HasPrefix(frame, "$") {
+		p.Error.MissError("Syntax Error", stmt.cursor, "Invalid frame size "+frame)
+	}
+	size, args, hasArgs := strings.Cut(frame[1:], "-")
+	var err error
+	if label.StackRoom, err = strconv.Atoi(size); err != nil {
+		p.Error.MissError("Syntax Error", stmt.cursor, "Invalid frame size "+frame)
+	}
+	if hasArgs {
+		if label.ArgOffset, err = strconv.Atoi(args); err != nil {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Invalid argument size "+frame)
+		}
+	}
+	p.ThisBlock = p.Block
+	node := &Node{Value: label}
+	p.ThisBlock.AddChild(node)
+	p.ThisBlock = node
+}
+
+// plan9Label 函数内的标签
+func (p *Parser) plan9Label(name string) {
+	fn := p.plan9Func()
+	if fn == nil {
+		fn = p.Block
+	}
+	node := &Node{Value: &LabelBlock{Name: name}}
+	fn.AddChild(node)
+	p.ThisBlock = node
+}
+
+// plan9Func 当前所在的函数
+func (p *Parser) plan9Func() *Node {
+	for node := p.ThisBlock; node != nil; node = node.Father {
+		if lb, ok := node.Value.(*LabelBlock); ok && lb.IsFunc {
+			return node
+		}
+	}
+	return nil
+}
+
+// plan9Align PCALIGN $n 和 PCALIGNMAX $n, $max
+func (p *Parser) plan9Align(stmt plan9Stmt, name string, ops []string) {
+	want := 1
+	if name == "PCALIGNMAX" {
+		want = 2
+	}
+	if len(ops) != want {
+		p.Error.MissError("Syntax Error", stmt.cursor, fmt.Sprintf("%s takes %d operands", name, want))
+	}
+	if p.ThisBlock == p.Block {
+		p.Error.MissError("Syntax Error", stmt.cursor, name+" outside of TEXT")
+	}
+	values := make([]int, len(ops))
+	for n, op := range ops {
+		v, err := strconv.ParseInt(strings.TrimPrefix(op, "$"), 0, 64)
+		if err != nil || !strings.HasPrefix(op, "$") || v < 0 {
+			p.Error.MissError("Syntax Error", stmt.cursor, "invalid "+name+" operand "+op)
+		}
+		values[n] = int(v)
+	}
+	a := &AlignBlock{Align: values[0], Max: -1, Code: true}
+	if a.Align < 1 || a.Align&(a.Align-1) != 0 {
+		p.Error.MissError("Syntax Error", stmt.cursor, fmt.Sprintf("alignment %d is not a power of 2", a.Align))
+	}
+	if want == 2 {
+		a.Max = values[1]
+	}
+	p.ThisBlock.AddChild(&Node{Value: a})
+}
+
+// plan9Data DATA symbol+off(SB)/size, value 和 GLOBL symbol(SB), [flags,] $size
+// DATA按符号收集, GLOBL时生成标签和初始化数据, RODATA的符号放在.rodata中, 其余放在.data中
+func (p *Parser) plan9Data(stmt plan9Stmt, name string, ops []string) {
+	if name == "DATA" {
+		if len(ops) != 2 {
+			p.Error.MissError("Syntax Error", stmt.cursor, "DATA needs a location and a value")
+		}
+		loc, size, ok := strings.Cut(ops[0], "/")
+		width, err := strconv.Atoi(size)
+		if !ok || err != nil || width < 1 || width > 8 {
+			p.Error.MissError("Syntax Error", stmt.cursor, "DATA needs a size, as in sym+0(SB)/8")
+		}
+		if !strings.HasSuffix(loc, "(SB)") {
+			p.Error.MissError("Syntax Error", stmt.cursor, "DATA needs a symbol, as in sym+0(SB)/8")
+		}
+		addr := p.plan9Mem(stmt, loc, width)
+		if p.plan9Datas == nil {
+			p.plan9Datas = map[string][]plan9Piece{}
+		}
+		p.plan9Datas[addr.LabelRef] = append(p.plan9Datas[addr.LabelRef], plan9Piece{
+			stmt: stmt,
+			off:  int(addr.Displacement),
+			item: p.plan9DataItem(stmt, ops[1], width),
+		})
+		return
+	}
+
+	if len(ops) < 2 {
+		p.Error.MissError("Syntax Error", stmt.cursor, "GLOBL needs a symbol and a size")
+	}
+	sym := plan9Symbol(ops[0])
+	size, err := strconv.Atoi(strings.TrimPrefix(ops[len(ops)-1], "$"))
+	if err != nil || size <= 0 || !strings.HasPrefix(ops[len(ops)-1], "$") {
+		p.Error.MissError("Syntax Error", stmt.cursor, "Invalid size "+ops[len(ops)-1])
+	}
+	section := ".data"
+	if len(ops) > 2 && strings.Contains(ops[1], "RODATA") {
+		section = ".rodata"
+	}
+	if !strings.Contains(ops[0], "<>") {
+		// sym<> 只在本文件内可见
+		p.symbolUses = append(p.symbolUses, symbolUse{name: sym, kind: "GLOBAL", bind: BindGlobal, cursor: stmt.cursor, err: p.Error})
+	}
+	pieces := p.plan9Datas[sym]
+	delete(p.plan9Datas, sym)
+	sort.SliceStable(pieces, func(l, r int) bool { return pieces[l].off < pieces[r].off })
+	d := &DataBlock{Size: 1}
+	off := 0
+	for _, piece := range pieces {
+		if piece.off < off || piece.off+piece.item.Len() > size {
+			p.Error.MissError("Syntax Error", piece.stmt.cursor, "DATA overlaps other data or lies outside "+sym)
+		}
+		if piece.off > off {
+			d.Items = append(d.Items, &DataItem{Unit: 1, Data: []byte{0}, Count: piece.off - off})
+		}
+		d.Items = append(d.Items, piece.item)
+		off = piece.off + piece.item.Len()
+	}
+	if off < size {
+		d.Items = append(d.Items, &DataItem{Unit: 1, Data: []byte{0}, Count: size - off})
+	}
+	label := &Node{Value: &LabelBlock{Name: sym}}
+	label.AddChild(&Node{Value: d})
+	node := &Node{Value: &SECTION{Name: section}}
+	node.AddChild(label)
+	p.plan9Globals = append(p.plan9Globals, node)
+}
+
+// plan9Piece 一条DATA
+type plan9Piece struct {
+	stmt plan9Stmt
+	off  int
+	item *DataItem
+}
+
+// plan9DataItem DATA的值: 整数、浮点数、字符串或符号的地址
+func (p *Parser) plan9DataItem(stmt plan9Stmt, op string, width int) *DataItem {
+	item := &DataItem{Unit: width, Count: 1}
+	imm := strings.TrimPrefix(op, "$")
+	if f := strings.TrimSuffix(strings.TrimPrefix(imm, "("), ")"); isFloat(f) {
+		b, err := encodeFloat(f, width)
+		if err != nil {
+			p.Error.MissError("Syntax Error", stmt.cursor, err.Error())
+		}
+		item.Data = b
+		return item
+	}
+	if strings.HasPrefix(op, "$") && strings.HasSuffix(op, "(SB)") {
+		// sym+off(SB) 的地址
+		sym, off := strings.TrimSuffix(imm, "(SB)"), int64(0)
+		if k := strings.LastIndexAny(sym, "+-"); k > 0 {
+			if n, ok := plan9Number(strings.TrimPrefix(sym[k:], "+")); ok {
+				sym, off = sym[:k], n
+			}
+		}
+		item.Expr = &Expr{Sym: plan9Symbol(sym)}
+		if off != 0 {
+			item.Expr = &Expr{Op: "+", X: item.Expr, Y: &Expr{Val: Const{Int: off}}}
+		}
+		return item
+	}
+	v := p.plan9Operand(stmt, op, width)
+	var err error
+	switch v.Type {
+	case NUMBER:
+		item.Data, err = encodeInt(v.Num, width)
+	case STRING:
+		if len(v.String) > width {
+			err = fmt.Errorf("string %q is longer than %d bytes", v.String, width)
+		}
+		item.Unit, item.Data = 0, padString(v.String, width)
+	default:
+		err = fmt.Errorf("invalid DATA value %s", op)
+	}
+	if err != nil {
+		p.Error.MissError("Syntax Error", stmt.cursor, err.Error())
+	}
+	return item
+}
+
+// plan9Operand 解析一个操作数, width为指令的操作宽度
+func (p *Parser) plan9Operand(stmt plan9Stmt, op string, width int) *Value {
+	if strings.HasPrefix(op, "$") {
+		imm := op[1:]
+		if strings.HasSuffix(imm, "(SB)") {
+			// 符号的地址
+			return &Value{Type: LABEL, String: plan9Symbol(imm)}
+		}
+		if strings.HasPrefix(imm, "\"") || strings.HasPrefix(imm, "'") && len(imm) > 3 {
+			s, err := strconv.Unquote(imm)
+			if err != nil {
+				p.Error.MissError("Syntax Error", stmt.cursor, "Invalid string "+imm)
+			}
+			return &Value{Type: STRING, String: s}
+		}
+		if num, ok := plan9Number(imm); ok {
+			return &Value{Type: NUMBER, Num: num}
+		}
+		// 常量表达式, 如$(1<<4)
+		c, err := p.Eval(imm)
+		if err != nil || c.IsStr {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Invalid immediate "+op)
+		}
+		return &Value{Type: NUMBER, Num: c.Int}
+	}
+	if reg, ok := p.plan9Reg(op, width); ok {
+		return &Value{Type: REG, Reg: reg}
+	}
+	if !strings.Contains(op, "(") {
+		// 跳转目标
+		return &Value{Type: LABEL, String: op}
+	}
+	if strings.HasSuffix(op, "(SB)") && width == 0 {
+		return &Value{Type: LABEL, String: plan9Symbol(op)}
+	}
+	return &Value{Type: ADDR, Addr: p.plan9Mem(stmt, op, width)}
+}
+
+// plan9Reg 解析寄存器
+// SP、BP 按名称引用, 其它通用寄存器换成虚拟寄存器编号
+func (p *Parser) plan9Reg(op string, width int) (*Reg, bool) {
+	if strings.HasPrefix(op, "X") || strings.HasPrefix(op, "Y") || strings.HasPrefix(op, "Z") {
+		if num, err := strconv.Atoi(op[1:]); err == nil {
+			regType := map[byte]int{'X': types.RegXMM, 'Y': types.RegYMM, 'Z': types.RegZMM}[op[0]]
+			return &Reg{Num: num, Type: regType}, true
+		}
+	}
+	num, ok := plan9Regs[op]
+	if tmp, byteReg := plan9ByteRegs[op]; byteReg {
+		num, ok, width = tmp, true, 1
+	}
+	if !ok {
+		return nil, false
+	}
+	regType := map[int]int{1: types.Reg8, 2: types.Reg16, 4: types.Reg32}[width]
+	if regType == 0 {
+		regType = types.Reg64
+	}
+	switch num {
+	case 4:
+		return &Reg{Name: "sp", Type: regType}, true
+	case 5:
+		return &Reg{Name: "bp", Type: regType}, true
+	}
+	if p.arch.Registers != nil {
+		for n, reg := range p.arch.Registers.Regs {
+			if reg.Num == num {
+				return &Reg{Num: n, Type: regType}, true
+			}
+		}
+	}
+	return &Reg{Num: num, Type: regType}, true
+}
+
+// plan9Mem 解析内存操作数
+//
+//	name+off(FP)       函数参数
+//	name-off(SP)       局部变量
+//	sym+off(SB)        全局符号
+//	off(REG)(IDX*scale) 寄存器寻址
+func (p *Parser) plan9Mem(stmt plan9Stmt, op string, width int) *MemoryAddr {
+	addr := &MemoryAddr{Scale: 1, Length: width}
+	n := strings.IndexByte(op, '(')
+	prefix, rest := op[:n], op[n:]
+	// 拆出各个括号
+	groups := []string{}
+	for rest != "" {
+		end := strings.IndexByte(rest, ')')
+		if rest[0] != '(' || end < 0 {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Invalid memory operand "+op)
+		}
+		groups = append(groups, rest[1:end])
+		rest = rest[end+1:]
+	}
+	// 前缀为 [name][+-off]
+	name, disp := prefix, ""
+	if k := strings.LastIndexAny(prefix, "+-"); k > 0 {
+		name, disp = prefix[:k], prefix[k:]
+	} else if _, ok := plan9Number(prefix); ok || prefix == "" {
+		name, disp = "", prefix
+	}
+	if disp != "" {
+		num, ok := plan9Number(strings.TrimPrefix(disp, "+"))
+		if !ok {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Invalid displacement "+disp)
+		}
+		addr.Displacement = num
+	}
+	switch {
+	case groups[0] == "FP":
+		p.plan9Arg(stmt, addr, name, width)
+		return addr
+	case groups[0] == "SB":
+		addr.LabelRef = plan9Symbol(name + "(SB)")
+	case groups[0] == "SP" && name != "":
+		// 局部变量相对帧指针
+		addr.Var = name
+		addr.BaseReg = p.frameReg()
+		return addr
+	default:
+		reg, ok := p.plan9Reg(groups[0], 8)
+		if !ok {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Unknown register "+groups[0])
+		}
+		addr.BaseReg = reg
+	}
+	if len(groups) > 1 {
+		index, scale, _ := strings.Cut(groups[1], "*")
+		reg, ok := p.plan9Reg(index, 8)
+		if !ok {
+			p.Error.MissError("Syntax Error", stmt.cursor, "Unknown register "+index)
+		}
+		addr.IndexReg = reg
+		if scale != "" {
+			addr.Scale, _ = strconv.Atoi(scale)
+		}
+	}
+	return addr
+}
+
+// plan9Arg 引用参数或结果, 首次引用时加入函数的参数或结果列表
+// 参数和结果像默认的栈约定一样位于返回地址和旧帧指针之上, 相对帧指针寻址
+func (p *Parser) plan9Arg(stmt plan9Stmt, addr *MemoryAddr, name string, width int) {
+	fn := p.plan9Func()
+	if fn == nil || name == "" {
+		p.Error.MissError("Syntax Error", stmt.cursor, "FP reference needs a name inside TEXT")
+	}
+	label := fn.Value.(*LabelBlock)
+	list := &label.Args
+	if isResult(name) {
+		list = &label.Results
+	}
+	off := int(addr.Displacement)
+	var arg *ArgBlock
+	for _, tmp := range *list {
+		if tmp.Name == name {
+			arg = tmp
+		}
+	}
+	if arg == nil {
+		arg = &ArgBlock{Name: name, Length: width, Offset: off}
+		// 按偏移排序
+		k := len(*list)
+		for k > 0 && (*list)[k-1].Offset > off {
+			k--
+		}
+		*list = append((*list)[:k], append([]*ArgBlock{arg}, (*list)[k:]...)...)
+	}
+	addr.Arg = arg
+	addr.Var = name
+	addr.BaseReg = p.frameReg()
+	addr.Displacement = int64(2*p.arch.WordSize/8 + arg.Offset)
+}
+
+// isResult 按Go的惯例, 未命名的结果在汇编中写作ret、ret1、ret2……
+func isResult(name string) bool {
+	rest, ok := strings.CutPrefix(name, "ret")
+	if !ok {
+		return false
+	}
+	_, err := strconv.Atoi(rest)
+	return rest == "" || err == nil
+}
+
+// plan9Symbol 去掉(SB)和包名前的中点
+// ·name 为本包的符号, pkg·name 转换为 pkg.name
+func plan9Symbol(op string) string {
+	op = strings.TrimSuffix(op, "(SB)")
+	if k := strings.IndexByte(op, '<'); k >= 0 {
+		// 去掉 <ABIInternal> 之类的ABI选择
+		op = op[:k]
+	}
+	op = strings.TrimPrefix(op, "·")
+	return strings.ReplaceAll(op, "·", ".")
+}
+
+// plan9Number 解析整数或字符常量
+func plan9Number(str string) (int64, bool) {
+	if strings.HasPrefix(str, "'") {
+		s, err := strconv.Unquote(str)
+		if err != nil || len([]rune(s)) != 1 {
+			return 0, false
+		}
+		return int64([]rune(s)[0]), true
+	}
+	num, err := strconv.ParseInt(str, 0, 64)
+	if err != nil {
+		unum, err := strconv.ParseUint(str, 0, 64)
+		return int64(unum), err == nil
+	}
+	return num, true
+}
+
+// splitOperands 按逗号切分操作数, 括号和引号中的逗号除外
+func splitOperands(text string) []string {
+	if text == "" {
+		return nil
+	}
+	ops := []string{}
+	depth, start := 0, 0
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			ops = append(ops, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(ops, strings.TrimSpace(text[start:]))
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || r == '.' || r == '·' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
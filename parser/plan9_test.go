@@ -0,0 +1,137 @@
+package parser_test
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+const plan9Src = `#include "textflag.h"
+
+// max(a, b int64) int64
+TEXT ·max(SB), NOSPLIT, $16-24
+	MOVQ a+0(FP), AX
+	MOVQ b+8(FP), CX
+	CMPQ AX, CX
+	JGT done
+	MOVQ CX, AX  /* b更大 */
+done:
+	MOVQ AX, ret+16(FP); MOVBLZX tab<>+2(SB), DX
+	LEAQ 8(SI)(DI*4), BX
+	RET
+
+DATA tab<>+0(SB)/1, $7
+DATA tab<>+2(SB)/1, $9
+GLOBL tab<>(SB), RODATA, $4
+`
+
+// parsePlan9 按Go汇编语法解析, 返回函数和数据的标签
+func parsePlan9(t *testing.T, src string) (fn, data *parser.Node) {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexerText("test.s", src), x86.NewMode(64))
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if lb, ok := n.Value.(*parser.LabelBlock); ok && lb.IsFunc {
+			fn = n
+		} else if ok && len(n.Children) != 0 {
+			if _, ok := n.Children[0].Value.(*parser.DataBlock); ok {
+				data = n
+			}
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.ParsePlan9())
+	return fn, data
+}
+
+// 函数头、FP引用的参数和结果、助记符和操作数顺序、DATA和GLOBL
+func TestParsePlan9(t *testing.T) {
+	fn, data := parsePlan9(t, plan9Src)
+	if fn == nil || data == nil {
+		t.Fatal("missing function or data")
+	}
+	label := fn.Value.(*parser.LabelBlock)
+	if label.Name != "max" || label.StackRoom != 16 || label.ArgOffset != 24 {
+		t.Errorf("TEXT gave %+v", label)
+	}
+	if len(label.Args) != 2 || label.Args[0].Name != "a" || label.Args[1].Name != "b" || label.Args[1].Offset != 8 || label.Args[1].Length != 8 {
+		t.Errorf("arguments %+v", label.Args)
+	}
+	if len(label.Results) != 1 || label.Results[0].Name != "ret" || label.Results[0].Offset != 16 {
+		t.Errorf("results %+v", label.Results)
+	}
+
+	var insts []*parser.Instruction
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			insts = append(insts, i)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(fn)
+	names := []types.Instruction{"MOV", "MOV", "CMP", "JG", "MOV", "MOV", "MOVZX", "LEA", "RET"}
+	if len(insts) != len(names) {
+		t.Fatalf("got %d instructions, want %d", len(insts), len(names))
+	}
+	for n, name := range names {
+		if insts[n].Instruction != name {
+			t.Errorf("instruction %d is %s, want %s", n, insts[n].Instruction, name)
+		}
+	}
+	// 内置指令改为目标在前, CMP和其它指令保持原来的顺序
+	if a := insts[0].Args; a[0].Type != parser.REG || a[0].Reg.Num != 0 || a[1].Addr == nil || a[1].Addr.Arg != label.Args[0] {
+		t.Errorf("MOVQ a+0(FP), AX gave %+v, %+v", a[0], a[1])
+	}
+	if a := insts[2].Args; a[0].Reg.Num != 0 || a[1].Reg.Num != 1 {
+		t.Errorf("CMPQ AX, CX gave %+v, %+v", a[0].Reg, a[1].Reg)
+	}
+	if a := insts[4].Args; a[0].Reg.Num != 0 || a[1].Reg.Num != 1 {
+		t.Errorf("MOVQ CX, AX gave %+v, %+v", a[0].Reg, a[1].Reg)
+	}
+	if a := insts[5].Args; a[0].Addr == nil || a[0].Addr.Arg != label.Results[0] {
+		t.Errorf("MOVQ AX, ret+16(FP) gave %+v", a[0])
+	}
+	if a := insts[6].Args; a[0].Addr == nil || a[0].Addr.LabelRef != "tab" || a[0].Addr.Displacement != 2 || a[0].Addr.Length != 1 || a[1].Reg.Type != types.Reg32 {
+		t.Errorf("MOVBLZX tab<>+2(SB), DX gave %+v, %+v", a[0].Addr, a[1].Reg)
+	}
+	if a := insts[7].Args[0].Addr; a == nil || a.Displacement != 8 || a.BaseReg == nil || a.IndexReg == nil || a.Scale != 4 {
+		t.Errorf("LEAQ 8(SI)(DI*4), BX gave %+v", a)
+	}
+
+	// DATA之间的空隙和GLOBL声明的剩余部分填0
+	if sec, ok := data.Father.Value.(*parser.SECTION); !ok || sec.Name != ".rodata" {
+		t.Errorf("tab is in %+v, want .rodata", data.Father.Value)
+	}
+	got, _, err := data.Children[0].Value.(*parser.DataBlock).Bytes(binary.LittleEndian)
+	if err != nil || !bytes.Equal(got, []byte{7, 0, 9, 0}) {
+		t.Errorf("tab = %v, %v", got, err)
+	}
+}
+
+func TestParsePlan9Errors(t *testing.T) {
+	for _, src := range []string{
+		"MOVQ AX, BX",
+		"TEXT ·f(SB), $0\n\tRET\nDATA tab<>+0(SB)/8, $1",
+		"TEXT ·f(SB), $0\n\tRET\nDATA tab<>+0(SB)/8, $1\nGLOBL tab<>(SB), $4",
+		"TEXT ·f(SB), NOSPLIT",
+		"TEXT ·f(SB), $0\n\tMOVQ 0(FP), AX",
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: want an error", src)
+				}
+			}()
+			parsePlan9(t, src)
+		}()
+	}
+}
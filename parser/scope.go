@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+)
+
+// VAR的作用域
+// 函数体是最外层的作用域, BLOCK … ENDBLOCK 开始一个嵌套的作用域。
+// 内层的VAR遮蔽外层同名的VAR和函数的参数, ENDBLOCK之后其中的变量不可见,
+// 它们占用的栈空间由之后的变量复用, 函数的StackRoom只记录最深处的用量。
+
+type scopeBlock struct {
+	fn     *LabelBlock
+	vars   []*VarBlock
+	offset int             // 进入作用域时函数已经分配的字节数
+	cursor int             // BLOCK的位置, 用于报错
+	gone   map[string]bool // 已经结束的作用域中的变量, 只记录在函数体上
+}
+
+func (p *Parser) isScope(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && (token.Value == "BLOCK" || token.Value == "ENDBLOCK")
+}
+
+// ParseScope 解析 BLOCK 和 ENDBLOCK
+func (p *Parser) ParseScope(tokens []lexer.Token) {
+	if len(tokens) != 1 {
+		p.Error.MissError("Syntax Error", tokens[1].Cursor, tokens[0].Value+" takes no operands")
+	}
+	s := p.scope()
+	if s == nil {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, tokens[0].Value+" outside a function")
+	}
+	if tokens[0].Value == "BLOCK" {
+		p.scopes = append(p.scopes, &scopeBlock{fn: s.fn, offset: s.fn.VarOffset, cursor: tokens[0].Cursor})
+		return
+	}
+	if len(p.scopes) == 1 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDBLOCK without BLOCK")
+	}
+	for _, v := range s.vars {
+		p.scopes[0].gone[v.Name] = true
+	}
+	// 释放这个作用域的栈空间
+	s.fn.VarOffset = s.offset
+	p.scopes = p.scopes[:len(p.scopes)-1]
+}
+
+// scope 当前最内层的作用域, 不在函数中时为nil
+func (p *Parser) scope() *scopeBlock {
+	fn := p.function()
+	if fn == nil {
+		return nil
+	}
+	if len(p.scopes) == 0 || p.scopes[0].fn != fn {
+		p.endScopes()
+		p.scopes = []*scopeBlock{{fn: fn, gone: map[string]bool{}}}
+	}
+	return p.scopes[len(p.scopes)-1]
+}
+
+// endScopes 函数结束时检查未结束的BLOCK
+func (p *Parser) endScopes() {
+	if len(p.scopes) > 1 {
+		p.Error.MissError("Syntax Error", p.scopes[len(p.scopes)-1].cursor, "BLOCK without ENDBLOCK")
+	}
+	p.scopes = nil
+}
+
+// declare 在当前作用域中分配变量, 变量按自身的大小对齐
+func (p *Parser) declare(v *VarBlock, cursor int) {
+	s := p.scope()
+	if s == nil {
+		p.Error.MissError("Syntax Error", cursor, "VAR outside a function")
+	}
+	for _, old := range s.vars {
+		if old.Name == v.Name {
+			p.Error.MissError("Syntax Error", cursor, v.Name+" is already declared in this scope")
+		}
+	}
+	s.vars = append(s.vars, v)
+	align := alignOf(v.Length)
+	if v.Struct != nil {
+		align = v.Struct.Align
+	}
+	fn := s.fn
+	fn.VarOffset = alignUp(fn.VarOffset+v.Length, align)
+	v.Offset = -fn.VarOffset
+	if fn.VarOffset > fn.VarRoom {
+		fn.StackRoom += fn.VarOffset - fn.VarRoom
+		fn.VarRoom = fn.VarOffset
+	}
+}
+
+// lookup 由内向外查找变量, 同一作用域中后声明的优先
+func (p *Parser) lookup(name string) *VarBlock {
+	if p.scope() == nil {
+		return nil
+	}
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		vars := p.scopes[i].vars
+		for k := len(vars) - 1; k >= 0; k-- {
+			if vars[k].Name == name {
+				return vars[k]
+			}
+		}
+	}
+	return nil
+}
+
+// outOfScope 变量是否在已经结束的作用域中声明过
+func (p *Parser) outOfScope(name string) bool {
+	return p.scope() != nil && p.scopes[0].gone[name]
+}
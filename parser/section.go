@@ -10,10 +10,16 @@ type SECTION struct {
 }
 
 func (s *SECTION) Parse(p *Parser) {
-	code := p.Lexer.Next()
-	if code.IsEmpty() || code.Type != lexer.NAME {
+	s.ParseTokens([]lexer.Token{{}, p.Lexer.Next()}, p)
+}
+
+// ParseTokens 解析 SECTION name 一行, 之后的标签都属于这个段
+func (s *SECTION) ParseTokens(tokens []lexer.Token, p *Parser) {
+	if len(tokens) != 2 || tokens[1].IsEmpty() || tokens[1].Type != lexer.NAME {
 		p.Lexer.Error.MissError("Syntax Error", p.Lexer.Cursor, "Need section Name")
 	}
+	p.endScopes()
+	code := tokens[1]
 	if code.Value[0] != '.' {
 		s.Name = "." + code.Value
 	} else {
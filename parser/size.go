@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"CuteASM/arch/types"
+	"CuteASM/utils"
+	"fmt"
+	"strconv"
+)
+
+// 变量的长度检查
+// $name转换为内存操作数时带有变量的长度, 立即数按这个长度编码。
+// 另一个操作数是寄存器时长度必须相同, 立即数必须能用这个长度表示。
+// LOAD可以把变量读入更宽的寄存器, 这时变量需要声明为SIGNED或UNSIGNED。
+// QW($b)这样的强制转换改变访问的长度, 不再检查。
+
+// sizedOps 操作数长度必须一致的指令
+var sizedOps = map[types.Instruction]bool{
+	"MOV": true, "LOAD": true, "STORE": true, "XCHG": true, "CMP": true,
+	"ADD": true, "SUB": true, "AND": true, "OR": true, "XOR": true,
+}
+
+// checkVar 检查变量操作数和其它操作数的长度
+func (i *Instruction) checkVar(p *Parser, v *Value, cursor int) {
+	if !sizedOps[i.Instruction] {
+		return
+	}
+	name := "$" + v.Addr.Var
+	length := v.Addr.Length
+	for _, other := range i.Args {
+		if other == v {
+			continue
+		}
+		switch other.Type {
+		case REG:
+			width := types.RegWidth(other.Reg.Type)
+			if width == 0 || width == length {
+				continue
+			}
+			if i.Instruction == "LOAD" && other == i.Args[0] && width > length {
+				if v.Addr.Sign == 0 {
+					p.Error.MissError("Type Error", cursor, fmt.Sprintf("LOAD widens %s from %s to %s, declare it SIGNED or UNSIGNED", name, sizeName(length), sizeName(width)))
+				}
+				continue
+			}
+			p.Error.MissError("Type Error", cursor, fmt.Sprintf("size mismatch: %s is %s but the register is %s", name, sizeName(length), sizeName(width)))
+		case NUMBER:
+			if !fits(other.Num, length) {
+				p.Error.MissError("Type Error", cursor, fmt.Sprintf("%d does not fit in %s %s", other.Num, sizeName(length), name))
+			}
+		case ADDR:
+			if other.Addr.Var != "" && other.Addr.Length != length {
+				p.Error.MissError("Type Error", cursor, fmt.Sprintf("size mismatch: %s is %s but $%s is %s", name, sizeName(length), other.Addr.Var, sizeName(other.Addr.Length)))
+			}
+		}
+	}
+}
+
+// fits 立即数能否用length字节表示, 有符号和无符号的值都可以
+func fits(n int64, length int) bool {
+	if length >= 8 {
+		return true
+	}
+	bits := uint(length * 8)
+	return n >= -1<<(bits-1) && n < 1<<bits
+}
+
+// sizeName 长度的类型名称, 没有对应的类型时写字节数
+func sizeName(length int) string {
+	if name := utils.GetLengthName(length); name != "" {
+		return name
+	}
+	return strconv.Itoa(length) + " bytes"
+}
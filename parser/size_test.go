@@ -0,0 +1,58 @@
+package parser_test
+
+import (
+	"CuteASM/parser"
+	"testing"
+)
+
+// 变量操作数带有变量的长度, 强制转换改变访问的长度
+func TestVarSize(t *testing.T) {
+	tests := []struct {
+		src    string
+		length int
+		sign   int
+	}{
+		{"mov $d, %e0", 4, 0},
+		{"mov $d, 7", 4, 0},
+		{"mov $d, -1", 4, 0},
+		{"mov $d, 0xffffffff", 4, 0},
+		{"mov $b, 255", 1, 0},
+		{"mov QW($d), %r0", 8, 0},
+		{"mov BB($d), %l0", 1, 0},
+		{"cmp $d, $e", 4, 0},
+		{"load %r0, $s", 2, parser.SIGNED},
+		{"load %e0, $u", 1, parser.UNSIGNED},
+		{"load %r0, $x", 4, parser.SIGNED},
+		{"lea $q, %r0", 8, 0},
+	}
+	for _, tt := range tests {
+		src := "f:()\nVAR $d, DW\nVAR $e, DW\nVAR $b, BB\nVAR $q, QW\nVAR $s, WW, SIGNED\nVAR $u, BB, UNSIGNED\nVAR $x, DW, SIGNED\n" + tt.src
+		var a *parser.MemoryAddr
+		for _, arg := range parseInsts(t, src)[0].Args {
+			if arg.Addr != nil {
+				a = arg.Addr
+				break
+			}
+		}
+		if a == nil || a.Length != tt.length || a.Sign != tt.sign {
+			t.Errorf("%s: got %+v, want length %d sign %d", tt.src, a, tt.length, tt.sign)
+		}
+	}
+}
+
+func TestVarSizeErrors(t *testing.T) {
+	for _, src := range []string{
+		"mov $d, %r0",
+		"mov %l0, $d",
+		"mov $b, 256",
+		"mov $b, -129",
+		"mov $d, 0x100000000",
+		"cmp $d, $q",
+		"add $q, %e0",
+		"load %r0, $d",
+		"load %l0, $s",
+		"VAR $y, DW, FOO",
+	} {
+		wantError(t, "f:()\nVAR $d, DW\nVAR $b, BB\nVAR $q, QW\nVAR $s, WW, SIGNED\n"+src)
+	}
+}
@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"CuteASM/lexer"
+	"CuteASM/utils"
+	"fmt"
+	"strings"
+)
+
+// StructBlock 结构体
+//
+//	STRUCT Point
+//	    x: DW
+//	    y: DW
+//	ENDS
+//	STRUCT Packet, PACKED
+//	    tag:  BB
+//	    pts:  Point[4]
+//	    name: BB[16]
+//	ENDS
+//
+// 字段按自身大小自然对齐, 结构体的大小补齐到最大的字段对齐; PACKED时不对齐。
+// 每个字段定义一个常量 结构体.字段 为它的偏移, 嵌套的字段为 结构体.字段.字段,
+// SIZEOF(名称)为结构体或字段的大小
+type StructBlock struct {
+	Name   string
+	Fields []*Field
+	Size   int
+	Align  int
+	Packed bool
+}
+
+// Field 结构体的字段
+type Field struct {
+	Name   string
+	Offset int
+	Elem   int          // 元素的大小
+	Count  int          // 数组的元素个数, 不是数组时为1
+	Struct *StructBlock // 元素是结构体时不为nil
+}
+
+// Size 字段的大小
+func (f *Field) Size() int {
+	return f.Elem * f.Count
+}
+
+func (f *Field) align(packed bool) int {
+	switch {
+	case packed:
+		return 1
+	case f.Struct != nil:
+		return f.Struct.Align
+	}
+	return alignOf(f.Elem)
+}
+
+// alignOf 标量按不小于自身大小的2的幂对齐, 如TW按16对齐
+func alignOf(size int) int {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return n
+}
+
+func (p *Parser) isStruct(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && (token.Value == "STRUCT" || token.Value == "ENDS")
+}
+
+// ParseStruct 解析结构体定义, 一直读到ENDS
+func (p *Parser) ParseStruct(tokens []lexer.Token) {
+	if tokens[0].Value == "ENDS" {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENDS without STRUCT")
+	}
+	if len(tokens) < 2 || tokens[1].Type != lexer.NAME {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "STRUCT needs a name: STRUCT name[, PACKED]")
+	}
+	s := &StructBlock{Name: tokens[1].Value, Align: 1}
+	switch {
+	case len(tokens) == 4 && tokens[2].Value == "," && strings.ToUpper(tokens[3].Value) == "PACKED":
+		s.Packed = true
+	case len(tokens) != 2:
+		p.Error.MissError("Syntax Error", tokenStart(tokens[2]), "STRUCT takes a name and an optional PACKED")
+	}
+	if p.Types[s.Name] != nil || p.IsDefined(s.Name) {
+		p.Error.MissError("Syntax Error", tokenStart(tokens[1]), s.Name+" is already defined")
+	}
+	names := map[string]bool{}
+	for {
+		line, ok := p.readLine()
+		if !ok {
+			p.Error.MissError("Syntax Error", tokens[0].Cursor, "STRUCT without ENDS")
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if line[0].Type == lexer.PSEUDO && line[0].Value == "ENDS" {
+			break
+		}
+		f := p.parseField(line)
+		if names[f.Name] {
+			p.Error.MissError("Syntax Error", tokenStart(line[0]), "duplicate field "+f.Name)
+		}
+		names[f.Name] = true
+		align := f.align(s.Packed)
+		f.Offset = alignUp(s.Size, align)
+		s.Size = f.Offset + f.Size()
+		s.Align = max(s.Align, align)
+		s.Fields = append(s.Fields, f)
+	}
+	if len(s.Fields) == 0 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "STRUCT "+s.Name+" has no fields")
+	}
+	s.Size = alignUp(s.Size, s.Align)
+	if p.Types == nil {
+		p.Types = map[string]*Node{}
+	}
+	p.Types[s.Name] = &Node{Value: s}
+	p.defineFields(s.Name, s, 0)
+}
+
+// parseField 解析 name: TYPE 或 name: TYPE[count], TYPE为BB…ZW或结构体
+func (p *Parser) parseField(tokens []lexer.Token) *Field {
+	if len(tokens) < 3 || tokens[0].Type != lexer.NAME || tokens[1].Value != ":" {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "a field is written as name: TYPE or name: TYPE[count]")
+	}
+	f := &Field{Name: tokens[0].Value, Count: 1}
+	typ := tokens[2]
+	if f.Elem = utils.GetLength(typ.Value); f.Elem == 0 || typ.Type != lexer.PSEUDO {
+		s := p.structOf(typ.Value)
+		if s == nil {
+			p.Error.MissError("Syntax Error", tokenStart(typ), "unknown field type "+typ.Value)
+		}
+		f.Struct, f.Elem = s, s.Size
+	}
+	rest := tokens[3:]
+	if len(rest) == 0 {
+		return f
+	}
+	if len(rest) < 3 || rest[0].Value != "[" || rest[len(rest)-1].Value != "]" {
+		p.Error.MissError("Syntax Error", tokenStart(rest[0]), "the array length is written as TYPE[count]")
+	}
+	c, err := p.Eval(p.exprText(rest[1 : len(rest)-1]))
+	if err == nil && (c.IsStr || c.Int <= 0) {
+		err = fmt.Errorf("the array length must be a positive integer")
+	}
+	if err != nil {
+		p.Error.MissError("Expression Error", tokenStart(rest[1]), err.Error())
+	}
+	f.Count = int(c.Int)
+	return f
+}
+
+// defineFields 定义 前缀.字段 为字段的偏移, 嵌套的结构体递归定义
+func (p *Parser) defineFields(prefix string, s *StructBlock, base int) {
+	for _, f := range s.Fields {
+		name := prefix + "." + f.Name
+		p.Defines[name] = Const{Int: int64(base + f.Offset)}
+		if f.Struct != nil {
+			p.defineFields(name, f.Struct, base+f.Offset)
+		}
+	}
+}
+
+// structOf 按名称查找结构体
+func (p *Parser) structOf(name string) *StructBlock {
+	if n := p.Types[name]; n != nil {
+		s, _ := n.Value.(*StructBlock)
+		return s
+	}
+	return nil
+}
+
+// sizeOf 结构体、字段路径(结构体.字段...)或BB…ZW的大小
+func (p *Parser) sizeOf(name string) (int, bool) {
+	if n := utils.GetLength(strings.ToUpper(name)); n != 0 {
+		return n, true
+	}
+	path := strings.Split(name, ".")
+	s := p.structOf(path[0])
+	if s == nil {
+		return 0, false
+	}
+	size := s.Size
+	for _, part := range path[1:] {
+		f := s.field(part)
+		if f == nil {
+			return 0, false
+		}
+		s, size = f.Struct, f.Size()
+		if s == nil && part != path[len(path)-1] {
+			return 0, false
+		}
+	}
+	return size, true
+}
+
+// field 按名称查找字段
+func (s *StructBlock) field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Member 按字段路径(x或a.b)查找嵌套的字段, 返回相对结构体开头的偏移和字段
+func (s *StructBlock) Member(path string) (int, *Field) {
+	offset := 0
+	var f *Field
+	for _, part := range strings.Split(path, ".") {
+		if s == nil {
+			return 0, nil
+		}
+		if f = s.field(part); f == nil {
+			return 0, nil
+		}
+		offset += f.Offset
+		s = f.Struct
+	}
+	return offset, f
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) / align * align
+}
@@ -0,0 +1,95 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"slices"
+	"testing"
+)
+
+const structSrc = `STRUCT Point
+    x: DW
+    y: DW
+ENDS
+STRUCT Packet, PACKED
+    tag:  BB
+    pts:  Point[4]
+    name: BB[16]
+ENDS
+STRUCT Mixed
+    a: BB
+    b: QW
+    c: WW
+    t: TW
+ENDS
+STRUCT Outer
+    c: BB
+    p: Point
+ENDS
+`
+
+// 字段按自身大小自然对齐, PACKED时不对齐, 嵌套字段的偏移相对外层结构体
+func TestStruct(t *testing.T) {
+	got := imms(t, structSrc+`mov %r0, Point.y
+mov %r0, SIZEOF(Point)
+mov %r0, Packet.pts
+mov %r0, Packet.name
+mov %r0, SIZEOF(Packet)
+mov %r0, SIZEOF(Packet.pts)
+mov %r0, Mixed.b
+mov %r0, Mixed.c
+mov %r0, Mixed.t
+mov %r0, SIZEOF(Mixed)
+mov %r0, Outer.p
+mov %r0, Outer.p.y
+mov %r0, SIZEOF(Outer)
+mov %r0, SIZEOF Outer.p`)
+	want := []int64{4, 8, 1, 33, 49, 32, 8, 16, 32, 48, 4, 8, 12, 8}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// 字段偏移用作内存操作数的位移, 结构体变量在栈上保留整个结构体
+func TestStructOperands(t *testing.T) {
+	v := operand(t, structSrc+"mov QW[%r1 + Outer.p.y], %r0", 0)
+	if v.Addr == nil || v.Addr.Displacement != 8 || v.Addr.Length != 8 {
+		t.Errorf("memory operand %+v", v.Addr)
+	}
+	root := parser.NewParser(lexer.NewLexerText("test.asm", structSrc+"f:()\nVAR $o, Outer\nVAR $n, DW\nmov $o.p.y, %e0\nmov $o.c, %l0\nmov $n, %e0\n"), x86.NewMode(64)).Parse()
+	fn := root.Children[0]
+	if room := fn.Value.(*parser.LabelBlock).StackRoom; room != 16 {
+		t.Errorf("stack room %d, want 16", room)
+	}
+	var got [][2]int64
+	for _, n := range fn.Children {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			got = append(got, [2]int64{i.Args[0].Addr.Displacement, int64(i.Args[0].Addr.Length)})
+		}
+	}
+	if want := [][2]int64{{-4, 4}, {-12, 1}, {-16, 4}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	for _, src := range []string{
+		"ENDS",
+		"STRUCT\nx: BB\nENDS",
+		"STRUCT S, ALIGNED\nx: BB\nENDS",
+		"STRUCT S\nx: BB",
+		"STRUCT S\nENDS",
+		"STRUCT S\nx: BB\nx: WW\nENDS",
+		"STRUCT S\nx: Nope\nENDS",
+		"STRUCT S\nx: BB[0]\nENDS",
+		"STRUCT S\nx BB\nENDS",
+		"STRUCT S\nx: BB\nENDS\nSTRUCT S\ny: BB\nENDS",
+		"STRUCT S\nx: BB\nENDS\nf:()\nVAR $s, S\nmov $s.y, %l0",
+		"STRUCT S\nx: BB\nENDS\nf:()\nVAR $s, S, SIGNED",
+		"f:()\nVAR $n, DW\nmov $n.x, %e0",
+		"mov %r0, SIZEOF(Nope)",
+	} {
+		wantError(t, src)
+	}
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	errorUtil "CuteASM/error"
+	"CuteASM/lexer"
+	"strings"
+)
+
+// 符号的绑定
+const (
+	BindLocal  = iota // 只在本文件内可见
+	BindGlobal        // 导出
+	BindWeak          // 导出, 可以被其它文件中的定义覆盖
+	BindExtern        // 在其它文件中定义
+)
+
+// 符号的类型
+const (
+	SymNone   = iota // 代码中的标签
+	SymFunc          // 函数
+	SymObject        // 数据
+)
+
+// Symbol 符号表中的一项
+type Symbol struct {
+	Name    string
+	Bind    int
+	Type    int
+	Size    int  // 数据的字节数, 函数的大小由汇编器在函数结束处计算
+	Defined bool // 在本文件中定义
+	Hidden  bool // 局部标签或匿名标签, 只在本文件内使用
+}
+
+// SymbolTable 符号表, 解析结束后存放在根节点中
+type SymbolTable struct {
+	Symbols []*Symbol // 按定义或声明的顺序
+	Entry   string    // ENTRY指定的入口
+	index   map[string]*Symbol
+}
+
+// Lookup 按名称查找符号
+func (t *SymbolTable) Lookup(name string) *Symbol {
+	if t == nil {
+		return nil
+	}
+	return t.index[name]
+}
+
+func (t *SymbolTable) add(s *Symbol) {
+	if t.index == nil {
+		t.index = map[string]*Symbol{}
+	}
+	t.index[s.Name] = s
+	t.Symbols = append(t.Symbols, s)
+}
+
+// SymbolsOf 根节点中的符号表, 没有解析过时为nil
+func SymbolsOf(root *Node) *SymbolTable {
+	t, _ := root.Value.(*SymbolTable)
+	return t
+}
+
+// symbolUse 符号的声明或引用, 记录位置用于报错
+type symbolUse struct {
+	name   string
+	kind   string // GLOBAL、EXTERN、ENTRY, 引用时为空
+	bind   int
+	typ    int
+	cursor int
+	err    *errorUtil.Error
+}
+
+func (p *Parser) isSymbol(token lexer.Token) bool {
+	return token.Type == lexer.PSEUDO && (token.Value == "GLOBAL" || token.Value == "EXTERN" || token.Value == "ENTRY")
+}
+
+// ParseSymbol GLOBAL name[:weak], ...  EXTERN name[:weak|function|object], ...  ENTRY name
+func (p *Parser) ParseSymbol(tokens []lexer.Token) {
+	kind := tokens[0].Value
+	if len(tokens) < 2 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, kind+" needs a symbol name")
+	}
+	names := splitOperands(p.exprText(tokens[1:]))
+	if kind == "ENTRY" && len(names) != 1 {
+		p.Error.MissError("Syntax Error", tokens[0].Cursor, "ENTRY takes one symbol")
+	}
+	for _, text := range names {
+		name, quals, _ := strings.Cut(text, ":")
+		decl := symbolUse{name: strings.TrimSpace(name), kind: kind, bind: BindGlobal, cursor: tokenStart(tokens[1]), err: p.Error}
+		if kind == "EXTERN" {
+			decl.bind = BindExtern
+		}
+		for _, q := range strings.Fields(quals) {
+			switch strings.ToLower(q) {
+			case "weak":
+				if kind == "ENTRY" {
+					p.Error.MissError("Syntax Error", decl.cursor, "the entry point cannot be weak")
+				}
+				decl.bind = BindWeak
+			case "function":
+				decl.typ = SymFunc
+			case "object", "data":
+				decl.typ = SymObject
+			default:
+				p.Error.MissError("Syntax Error", decl.cursor, "unknown symbol attribute "+q)
+			}
+		}
+		if decl.name == "" {
+			p.Error.MissError("Syntax Error", decl.cursor, kind+" needs a symbol name")
+		}
+		p.symbolUses = append(p.symbolUses, decl)
+	}
+}
+
+// reference 记录对标签的引用, 解析结束后检查是否有定义
+func (p *Parser) reference(name string, cursor int) {
+	p.symbolUses = append(p.symbolUses, symbolUse{name: name, cursor: cursor, err: p.Error})
+}
+
+// referenceExpr 记录表达式中引用的标签
+func (p *Parser) referenceExpr(e *Expr, cursor int) {
+	if e == nil {
+		return
+	}
+	if e.Sym != "" && e.Sym != "$" && !e.Equ {
+		p.reference(e.Sym, cursor)
+	}
+	p.referenceExpr(e.X, cursor)
+	p.referenceExpr(e.Y, cursor)
+}
+
+// resolveSymbols 收集标签并应用GLOBAL、EXTERN、ENTRY, 生成符号表
+// 引用了没有定义也没有EXTERN的标签时报错
+func (p *Parser) resolveSymbols() {
+	t := &SymbolTable{}
+	p.collectSymbols(p.Block, t)
+	for _, use := range p.symbolUses {
+		if use.kind == "" {
+			continue
+		}
+		s := t.Lookup(use.name)
+		switch use.kind {
+		case "EXTERN":
+			if s != nil && s.Defined {
+				use.err.MissError("Symbol Error", use.cursor, use.name+" is defined in this file and cannot be EXTERN")
+			}
+			if s == nil {
+				s = &Symbol{Name: use.name}
+				t.add(s)
+			}
+			s.Bind = use.bind
+			if s.Bind == BindGlobal {
+				s.Bind = BindExtern
+			}
+		case "ENTRY":
+			if t.Entry != "" && t.Entry != use.name {
+				use.err.MissError("Symbol Error", use.cursor, "the entry point is already "+t.Entry)
+			}
+			t.Entry = use.name
+			fallthrough
+		default:
+			if s == nil || !s.Defined {
+				use.err.MissError("Symbol Error", use.cursor, use.kind+" "+use.name+" is not defined in this file")
+			}
+			if s.Hidden {
+				use.err.MissError("Symbol Error", use.cursor, use.name+" is a local label and cannot be exported")
+			}
+			if s.Bind == BindLocal || use.bind == BindWeak {
+				s.Bind = use.bind
+			}
+		}
+		if use.typ != SymNone {
+			s.Type = use.typ
+		}
+	}
+	for _, use := range p.symbolUses {
+		if use.kind == "" && t.Lookup(use.name) == nil && !p.IsDefined(use.name) {
+			if text, ok := p.labelText[use.name]; ok {
+				use.err.MissError("Symbol Error", use.cursor, "undefined label "+text)
+			}
+			use.err.MissError("Symbol Error", use.cursor, "undefined symbol "+use.name+", declare it with EXTERN if it is defined elsewhere")
+		}
+	}
+	p.Block.Value = t
+}
+
+// collectSymbols 按定义顺序收集标签, 带数据的标签为数据符号
+func (p *Parser) collectSymbols(node *Node, t *SymbolTable) {
+	for _, n := range node.Children {
+		if label, ok := n.Value.(*LabelBlock); ok && t.Lookup(label.Name) == nil {
+			s := &Symbol{Name: label.Name, Defined: true, Hidden: label.Local}
+			if label.IsFunc {
+				s.Type = SymFunc
+			}
+			if size := DataLen(n); size != 0 && !label.IsFunc {
+				s.Type = SymObject
+				s.Size = size
+			}
+			t.add(s)
+		}
+		p.collectSymbols(n, t)
+	}
+}
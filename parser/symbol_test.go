@@ -0,0 +1,61 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+const symbolSrc = `GLOBAL main, helper:weak
+EXTERN puts:function, errno:object
+ENTRY main
+section .text
+main:()
+    call puts
+    mov %r0, QW[errno]
+    ret
+helper:
+    ret
+section .data
+tab: DW 1, 2, 3
+`
+
+// 绑定、类型、数据的大小和入口
+func TestSymbols(t *testing.T) {
+	root := parser.NewParser(lexer.NewLexerText("test.asm", symbolSrc), x86.NewMode(64)).Parse()
+	table := parser.SymbolsOf(root)
+	if table == nil || table.Entry != "main" {
+		t.Fatalf("table %+v", table)
+	}
+	tests := []parser.Symbol{
+		{Name: "main", Bind: parser.BindGlobal, Type: parser.SymFunc, Defined: true},
+		{Name: "helper", Bind: parser.BindWeak, Defined: true},
+		{Name: "puts", Bind: parser.BindExtern, Type: parser.SymFunc},
+		{Name: "errno", Bind: parser.BindExtern, Type: parser.SymObject},
+		{Name: "tab", Bind: parser.BindLocal, Type: parser.SymObject, Size: 12, Defined: true},
+	}
+	for _, want := range tests {
+		if s := table.Lookup(want.Name); s == nil || *s != want {
+			t.Errorf("%s = %+v, want %+v", want.Name, s, want)
+		}
+	}
+}
+
+func TestSymbolErrors(t *testing.T) {
+	for _, src := range []string{
+		"f:\njmp nowhere",
+		"f:\nmov %r0, QW[nowhere + 8]",
+		"d: QW nowhere",
+		"GLOBAL nowhere",
+		"GLOBAL",
+		"EXTERN f\nf:\nret",
+		"ENTRY f, g\nf:\ng:",
+		"ENTRY f\nENTRY g\nf:\ng:",
+		"ENTRY f:weak\nf:",
+		"GLOBAL f:hidden\nf:",
+		"f:\n.x:\nGLOBAL .x",
+	} {
+		wantError(t, src)
+	}
+}
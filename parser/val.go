@@ -17,16 +17,20 @@ const (
 	PSEUDO            // 伪指令类型
 	REG               // 寄存器类型
 	LABEL             // 标签类型
+	EXPR              // 引用标签的表达式类型
 )
 
 // MemoryAddr 表示汇编指令中的内存地址操作数
 type MemoryAddr struct {
-	BaseReg      *Reg    // 基址寄存器（如rax）
-	IndexReg     *Reg    // 变址寄存器（如rbx）
-	Scale        int     // 比例因子（1/2/4/8）
-	Displacement float64 // 位移值（如0x100）
-	LabelRef     string  // 标签引用（如array_base）
-	Length       int     // 数据长度（1/2/4/8）
+	BaseReg      *Reg      // 基址寄存器（如rax）
+	IndexReg     *Reg      // 变址寄存器（如rbx）
+	Scale        int       // 比例因子（1/2/4/8）
+	Displacement int64     // 位移值（如0x100）
+	LabelRef     string    // 标签引用（如array_base）
+	Length       int       // 数据长度（1/2/4/8）
+	Arg          *ArgBlock // 引用的函数参数, 最终位置由调用约定决定
+	Var          string    // 引用的变量名, 用于输出符号化的偏移
+	Sign         int       // 变量的符号, LOAD读入更宽的寄存器时按它扩展
 }
 
 // Reg 表示寄存器操作数
@@ -43,7 +47,8 @@ type Value struct {
 	Var    *VarBlock   // 变量操作数
 	String string      // 字符串值
 	Pseudo string      // 伪指令名称
-	Num    float64     // 数值
+	Expr   *Expr       // 引用标签的表达式
+	Num    int64       // 数值
 	Type   int         // 操作数类型（使用上述常量定义）
 }
 
@@ -53,21 +58,29 @@ type Value struct {
 //	p: 解析器实例
 //	tokens: 待解析的token序列
 func (v *Value) Parse(p *Parser, tokens []lexer.Token) {
-	if tokens[0].Type == lexer.SEPARATOR && tokens[0].Value == "$" {
+	if len(tokens) == 0 {
+		p.Error.MissError("Syntax Error", p.Lexer.Cursor, "Missing operand")
+	}
+	if isVarRef(tokens) {
 		// 处理变量引用（$开头的标识符）
 		v.ParseVar(p, tokens)
 		v.Type = VAR
+	} else if isCast(tokens) {
+		// 强制转换变量的长度, 如QW($b)
+		v.ParseVar(p, tokens[2:len(tokens)-1])
+		v.Var.Cast = utils.GetLength(tokens[0].Value)
+		v.Type = VAR
 	} else if len(tokens) == 1 && tokens[0].Type == lexer.PSEUDO {
 		// 处理伪指令
 		v.Pseudo = tokens[0].Value
 		v.Type = PSEUDO
-	} else if len(tokens) == 1 && tokens[0].Type == lexer.NUMBER {
-		// 处理数字字面量
-		v.Num, _ = v.parseNumber(tokens[0].Value)
-		v.Type = NUMBER
-	} else if len(tokens) == 1 && (tokens[0].Type == lexer.STRING || tokens[0].Type == lexer.CHAR) {
-		// 处理字符串或字符字面量
-		v.String = tokens[0].Value
+	} else if len(tokens) == 1 && tokens[0].Type == lexer.STRING {
+		// 处理字符串字面量, 字符字面量按整数处理
+		str, err := unescape(tokens[0].Value)
+		if err != nil {
+			p.Error.MissError("Syntax Error", tokenStart(tokens[0]), err.Error())
+		}
+		v.String = str
 		v.Type = STRING
 	} else if v.isMemoryAddress(tokens) {
 		// 处理内存地址表达式（如[BB [rax+0x10]]）
@@ -78,11 +91,55 @@ func (v *Value) Parse(p *Parser, tokens []lexer.Token) {
 		// 处理寄存器操作数
 		v.Reg = v.parseRegister(tokens, p)
 		v.Type = REG
-	} else if isLabel(tokens) {
+	} else if isLabel(tokens) && !p.IsDefined(parseLabel(tokens)) {
 		// 处理标签引用
-		v.String = parseLabel(tokens)
+		name, err := p.labelRef(parseLabel(tokens))
+		if err != nil {
+			p.Error.MissError("Syntax Error", tokenStart(tokens[0]), err.Error())
+		}
+		v.String = name
 		v.Type = LABEL
+	} else {
+		// 处理立即数表达式, 引用标签时保留为符号表达式
+		e, err := p.ParseExpr(p.exprText(tokens))
+		if err != nil {
+			p.Error.MissError("Expression Error", tokenStart(tokens[0]), err.Error())
+		}
+		if e.Val.IsStr {
+			p.Error.MissError("Expression Error", tokenStart(tokens[0]), "string cannot be used as a number")
+		}
+		if e.IsConst() {
+			v.Num = e.Val.Int
+			v.Type = NUMBER
+		} else {
+			v.Expr = e
+			v.Type = EXPR
+		}
 	}
+	switch v.Type {
+	case LABEL:
+		if p.structOf(v.String) == nil {
+			p.reference(v.String, tokenStart(tokens[0]))
+		}
+	case EXPR:
+		p.referenceExpr(v.Expr, tokenStart(tokens[0]))
+	case ADDR:
+		if v.Addr.LabelRef != "" {
+			p.reference(v.Addr.LabelRef, tokenStart(tokens[0]))
+		}
+	}
+}
+
+// isVarRef 判断token序列是否为变量引用, $后紧跟名称, 单独的$表示当前位置
+func isVarRef(tokens []lexer.Token) bool {
+	return len(tokens) >= 2 && tokens[0].Type == lexer.SEPARATOR && tokens[0].Value == "$" &&
+		tokens[1].Type == lexer.NAME && tokenStart(tokens[1]) == tokens[0].EndCursor
+}
+
+// isCast 判断token序列是否是 类型($name)
+func isCast(tokens []lexer.Token) bool {
+	return len(tokens) >= 4 && tokens[0].Type == lexer.PSEUDO && utils.GetLength(tokens[0].Value) != 0 &&
+		tokens[1].Value == "(" && tokens[len(tokens)-1].Value == ")" && isVarRef(tokens[2:len(tokens)-1])
 }
 
 // isDigit 检查字符串是否全由数字组成
@@ -105,124 +162,56 @@ func (v *Value) isMemoryAddress(tokens []lexer.Token) bool {
 }
 
 // parseMemoryAddress 解析内存地址表达式
+// 支持 基址+变址*比例+位移 以及标签引用, 位移可以是常量表达式
 func (v *Value) parseMemoryAddress(p *Parser, tokens []lexer.Token) *MemoryAddr {
 	addr := &MemoryAddr{Scale: 1}
-	// 按运算符分割表达式
-	parts := splitByOperators(tokens, []string{"+", "-", "*"})
-
-	for _, part := range parts {
-		switch {
-		case isLabelRef(part):
-			// 处理标签引用部分
-			addr.LabelRef = strings.TrimSuffix(part[0].Value, ":")
-		case isRegisterPart(part):
-			// 处理寄存器部分
-			v.handleRegisterPart(part, p, addr)
-		default:
-			// 处理位移数值部分
-			v.handleDisplacementPart(part, p, addr)
-		}
+	if len(tokens) == 0 {
+		return addr
 	}
-	return addr
-}
-
-// isLabelRef 判断token序列是否为标签引用
-func isLabelRef(part []lexer.Token) bool {
-	return len(part) == 1 &&
-		part[0].Type == lexer.NAME &&
-		strings.HasSuffix(part[0].Value, ":")
-}
-
-// isRegisterPart 判断token序列是否包含寄存器
-func isRegisterPart(part []lexer.Token) bool {
-	return containsRegister(part)
-}
-
-// handleRegisterPart 处理寄存器表达式部分
-func (v *Value) handleRegisterPart(part []lexer.Token, p *Parser, addr *MemoryAddr) {
-	reg := v.parseRegister(part, p)
-	if reg == nil {
-		return
-	}
-
-	// 根据表达式结构设置基址/变址寄存器
-	switch {
-	case len(part) == 3:
-		if addr.BaseReg == nil {
+	// 寄存器以外的部分组成位移表达式, 寄存器的位置按0计算
+	text := ""
+	last := tokenStart(tokens[0])
+	for e := 0; e < len(tokens); e++ {
+		if !containsRegister(tokens[e:]) {
+			continue
+		}
+		text += p.Lexer.Text[last:tokenStart(tokens[e])] + "0"
+		reg := v.parseRegister(tokens[e:], p)
+		e++
+		if e+2 < len(tokens) && tokens[e+1].Value == "*" {
+			// 变址寄存器*比例
+			scale, err := p.Eval(tokens[e+2].Value)
+			if err != nil || scale.IsStr {
+				p.Error.MissError("Syntax Error", tokenStart(tokens[e+2]), "Invalid scale "+tokens[e+2].Value)
+			}
+			addr.IndexReg = reg
+			addr.Scale = int(scale.Int)
+			e += 2
+		} else if addr.BaseReg == nil {
 			addr.BaseReg = reg
 		} else {
 			addr.IndexReg = reg
 		}
-	case len(part) == 5 && part[1].Value == "*":
-		addr.IndexReg = reg
-		scale, _ := strconv.Atoi(part[2].Value)
-		addr.Scale = scale
+		last = tokens[e].EndCursor
 	}
-}
-
-// handleDisplacementPart 处理数值位移部分
-func (v *Value) handleDisplacementPart(part []lexer.Token, p *Parser, addr *MemoryAddr) {
-	if len(part) == 0 {
-		return
+	text += p.Lexer.Text[last:tokens[len(tokens)-1].EndCursor]
+	if strings.TrimSpace(text) == "" {
+		return addr
 	}
-
-	num, err := v.parseNumber(part[0].Value)
+	disp, err := p.ParseExpr(text)
 	if err != nil {
-		p.Error.MissError("", p.Lexer.Cursor, "")
-		return
+		p.Error.MissError("Expression Error", tokenStart(tokens[0]), err.Error())
 	}
-	addr.Displacement = num
-}
-
-// parseNumber 解析不同进制的数值字符串
-func (v *Value) parseNumber(str string) (num float64, err error) {
-	// 处理十六进制
-	if strings.HasPrefix(str, "0x") {
-		tmp, errTmp := strconv.ParseInt(str[2:], 16, 64)
-		num = float64(tmp)
-		err = errTmp
-		// 处理二进制
-	} else if strings.HasPrefix(str, "0b") {
-		tmp, errTmp := strconv.ParseInt(str[2:], 2, 64)
-		num = float64(tmp)
-		err = errTmp
-		// 处理十进制
-	} else if v.isDigit(str) {
-		num, err = strconv.ParseFloat(str, 64)
-	}
-	return
-}
-
-// splitByOperators 按指定运算符分割token序列
-func splitByOperators(tokens []lexer.Token, ops []string) [][]lexer.Token {
-	var parts [][]lexer.Token
-	var current []lexer.Token
-
-	// 遍历token进行分割
-	for _, token := range tokens {
-		if contains(ops, token.Value) {
-			if len(current) > 0 {
-				parts = append(parts, current)
-				current = nil
-			}
-		} else {
-			current = append(current, token)
-		}
-	}
-	if len(current) > 0 {
-		parts = append(parts, current)
-	}
-	return parts
-}
-
-// contains 检查字符串是否在列表中
-func contains(list []string, target string) bool {
-	for _, item := range list {
-		if item == target {
-			return true
-		}
+	if disp.IsConst() {
+		addr.Displacement = disp.Val.Int
+	} else if sym, off, ok := disp.Offset(); ok {
+		// 标签引用
+		addr.LabelRef = strings.TrimSuffix(sym, ":")
+		addr.Displacement = off
+	} else {
+		p.Error.MissError("Expression Error", tokenStart(tokens[0]), "displacement must be a constant or label+constant: "+disp.String())
 	}
-	return false
+	return addr
 }
 
 // parseRegister 解析寄存器token序列
@@ -284,26 +273,39 @@ func containsRegister(tokens []lexer.Token) bool {
 }
 
 // isLabel 判断token序列是否构成标签
+// 只有一个名称, 后面可以有调用语法的空括号; 带运算符或括号时是表达式
 func isLabel(tokens []lexer.Token) bool {
-	for _, token := range tokens {
-		if token.Type != lexer.NAME && token.Type != lexer.SEPARATOR {
-			return false
-		}
+	if len(tokens) == 3 && tokens[1].Value == "(" && tokens[2].Value == ")" {
+		tokens = tokens[:1]
 	}
-	return true
+	if len(tokens) != 1 || tokens[0].Type != lexer.NAME || isBuiltin(tokens[0].Value) {
+		return false
+	}
+	// 标签名可以带@等修饰, 如GetStdHandle@1
+	return !strings.ContainsAny(tokens[0].Value, exprOpChars)
+}
+
+// isBuiltin 表达式中的内置函数, 如 SIZEOF(Point) 不是标签
+func isBuiltin(name string) bool {
+	switch strings.ToUpper(name) {
+	case "DEFINED", "SIZEOF":
+		return true
+	}
+	return false
 }
 
 // parseLabel 从token序列构建标签字符串
+// 调用语法 name() 中的空括号不属于标签名
 func parseLabel(tokens []lexer.Token) (label string) {
 	for _, token := range tokens {
 		label += token.Value
 	}
-	return
+	return strings.TrimSuffix(label, "()")
 }
 
 // ParseVar 解析变量引用操作数
 func (v *Value) ParseVar(p *Parser, tokens []lexer.Token) {
-	v.Var = &VarBlock{}
+	v.Var = &VarBlock{cursor: tokens[0].Cursor}
 	v.Var.Name += "$"
 	tokens = tokens[1:]
 	// 拼接变量名各部分
@@ -316,11 +318,25 @@ func (v *Value) ParseVar(p *Parser, tokens []lexer.Token) {
 	v.Type = ADDR
 }
 
-func valueToMemoryAddr(arg *Value) {
-	arg.Addr = &MemoryAddr{}
+func valueToMemoryAddr(arg *Value, p *Parser) {
+	arg.Addr = &MemoryAddr{BaseReg: p.frameReg()}
 	arg.Addr.Length = arg.Var.Length
+	if arg.Var.Cast != 0 {
+		arg.Addr.Length = arg.Var.Cast
+	}
+	arg.Addr.Sign = arg.Var.Sign
 	// 获取变量的偏移
-	arg.Addr.Displacement = float64(arg.Var.Offset)
+	arg.Addr.Displacement = int64(arg.Var.Offset)
+	arg.Addr.Arg = arg.Var.Arg
+	arg.Addr.Var = strings.TrimPrefix(arg.Var.Name, "$")
 	arg.Var = nil
 	arg.Type = ADDR
 }
+
+// frameReg 帧指针, 变量和参数都相对它寻址, 宽度为目标的字长
+func (p *Parser) frameReg() *Reg {
+	if p.arch.WordSize == 64 {
+		return &Reg{Name: "bp", Type: types.Reg64}
+	}
+	return &Reg{Name: "bp", Type: types.Reg32}
+}
@@ -0,0 +1,95 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"testing"
+)
+
+// parseInsts 解析一段源码, 返回其中的指令
+func parseInsts(t *testing.T, src string) []*parser.Instruction {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexerText("test.asm", src+"\n"), x86.NewMode(64))
+	var insts []*parser.Instruction
+	var walk func(n *parser.Node)
+	walk = func(n *parser.Node) {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			insts = append(insts, i)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(p.Parse())
+	return insts
+}
+
+// operand 最后一条指令的第n个操作数
+func operand(t *testing.T, src string, n int) *parser.Value {
+	t.Helper()
+	insts := parseInsts(t, src)
+	if len(insts) == 0 || len(insts[len(insts)-1].Args) <= n {
+		t.Fatalf("%q: no operand %d", src, n)
+	}
+	return insts[len(insts)-1].Args[n]
+}
+
+// 一元运算符和括号开头的操作数是表达式, 不是标签
+func TestUnaryOperand(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int64
+	}{
+		{"mov %r0, ~0", -1},
+		{"mov %r0, !0", 1},
+		{"mov %r0, !5", 0},
+		{"mov %r0, -1", -1},
+		{"mov %r0, (~0)", -1},
+		{"mov %r0, (2 + 3) * 4", 20},
+		{"mov %r0, 0 + ~1", -2},
+		{"CONST A, 5\nmov %r0, (A)", 5},
+		{"CONST A, 5\nmov %r0, ~A", -6},
+		{"CONST A, 5\nmov %r0, -A", -5},
+		{"CONST A, 5\nmov %r0, !A", 0},
+		{"CONST A, 5\nmov %r0, (A + 1)", 6},
+		{"CONST A, 5\nmov %r0, -(A)", -5},
+	}
+	for _, tt := range tests {
+		v := operand(t, tt.src, 1)
+		if v.Type != parser.NUMBER || v.Num != tt.want {
+			t.Errorf("%q: type %d num %d, want the number %d", tt.src, v.Type, v.Num, tt.want)
+		}
+	}
+}
+
+// 只有单独的名称和 name() 是标签, 括号中的标签是引用标签的表达式
+func TestLabelOperand(t *testing.T) {
+	tests := []struct {
+		src  string
+		n    int
+		typ  int
+		want string
+	}{
+		{"L:\njmp L", 0, parser.LABEL, "L"},
+		{"f:()\ncall f()", 0, parser.LABEL, "f"},
+		{"a.b:\njmp a.b", 0, parser.LABEL, "a.b"},
+		{"extern F@1\ncall F@1", 0, parser.LABEL, "F@1"},
+		{"L:\nmov %r0, (L)", 1, parser.EXPR, "L"},
+		{"L:\nmov %r0, (L + 4)", 1, parser.EXPR, "L"},
+		{"L:\nmov %r0, L - 1", 1, parser.EXPR, "L"},
+	}
+	for _, tt := range tests {
+		v := operand(t, tt.src, tt.n)
+		switch {
+		case v.Type != tt.typ:
+			t.Errorf("%q: type %d, want %d", tt.src, v.Type, tt.typ)
+		case v.Type == parser.LABEL && v.String != tt.want:
+			t.Errorf("%q: label %q, want %q", tt.src, v.String, tt.want)
+		case v.Type == parser.EXPR:
+			if sym, _, ok := v.Expr.Offset(); ok && sym != tt.want {
+				t.Errorf("%q: refers to %q, want %q", tt.src, sym, tt.want)
+			}
+		}
+	}
+}
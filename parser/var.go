@@ -3,16 +3,28 @@ package parser
 import (
 	"CuteASM/utils"
 	"fmt"
+	"strings"
 )
 
 type VarBlock struct {
 	Name   string
 	Offset int
 	Length int
+	Arg    *ArgBlock    // 引用的是函数参数
+	Struct *StructBlock // 结构体类型的变量, 用 $name.字段 访问字段
+	Sign   int          // SIGNED或UNSIGNED, 0为未指定
+	Cast   int          // 引用时强制转换的长度, 如QW($b)
+	cursor int          // $name在源码中的位置, 用于报错
 }
 
+// 变量的符号, 决定LOAD把它读入更宽的寄存器时做符号扩展还是零扩展
+const (
+	SIGNED = iota + 1
+	UNSIGNED
+)
+
 func (v *VarBlock) Parse(instruction *Instruction, p *Parser) {
-	if len(instruction.Args) == 2 {
+	if len(instruction.Args) >= 2 {
 		if len(instruction.Args[0].Var.Name) > 2 && instruction.Args[0].Var.Name[1] == '$' {
 			switch instruction.Args[0].Var.Name[2:] {
 			case "stackRoom":
@@ -39,54 +51,87 @@ func (v *VarBlock) Parse(instruction *Instruction, p *Parser) {
 			return
 		} else {
 			v.Name = instruction.Args[0].Var.Name
+			v.cursor = instruction.Args[0].Var.cursor
 			v.Length = utils.GetLength(instruction.Args[1].Pseudo)
+			if s := p.structOf(instruction.Args[1].String); s != nil && instruction.Args[1].Type == LABEL {
+				v.Length, v.Struct = s.Size, s
+			}
 			if v.Length == 0 {
 				p.Error.MissError("", p.Lexer.Cursor, "")
 			}
-		}
-	}
-	oldThisBlock := p.ThisBlock
-	for {
-		if p.ThisBlock.Father == nil {
-			p.Error.MissError("", p.Lexer.Cursor, "")
-		}
-		switch p.ThisBlock.Value.(type) {
-		case *LabelBlock:
-			lb := p.ThisBlock.Value.(*LabelBlock)
-			if lb.IsFunc {
-				lb.VarOffset += v.Length
-				v.Offset = -lb.VarOffset
-				lb.StackRoom += v.Length
-				goto end
+			if len(instruction.Args) == 3 {
+				// VAR $x, DW, SIGNED
+				switch instruction.Args[2].Pseudo {
+				case "SIGNED":
+					v.Sign = SIGNED
+				case "UNSIGNED":
+					v.Sign = UNSIGNED
+				}
+				if v.Sign == 0 || v.Struct != nil {
+					p.Error.MissError("Syntax Error", v.cursor, "VAR kind must be SIGNED or UNSIGNED after a scalar type")
+				}
 			}
 		}
-		p.Back(1)
 	}
-end:
-	p.ThisBlock = oldThisBlock
+	p.declare(v, v.cursor)
 	node := &Node{
 		Value: v,
 	}
 	p.ThisBlock.AddChild(node)
 }
 
+// FindDefind 查找变量的定义, VAR遮蔽同名的参数
 func (v *VarBlock) FindDefind(p *Parser) {
-	oldThisBlock := p.ThisBlock
-	for {
-		if p.ThisBlock.Father == nil {
-			p.Error.MissError("", p.Lexer.Cursor, "")
-		}
-		for i := len(p.ThisBlock.Children) - 1; i > 0; i-- {
-			switch p.ThisBlock.Children[i].Value.(type) {
-			case *VarBlock:
-				varBlock := p.ThisBlock.Children[i].Value.(*VarBlock)
-				v.Offset = varBlock.Offset
-				v.Length = varBlock.Length
-				goto end
+	name, _, _ := strings.Cut(v.Name, ".")
+	if def := p.lookup(name); def != nil {
+		v.Offset = def.Offset
+		v.Length = def.Length
+		v.Sign = def.Sign
+		v.member(def, p)
+		return
+	}
+	if arg := v.findArg(p); arg != nil {
+		// 默认参数全部通过栈传递, 位于返回地址和旧帧指针之上
+		// 选择调用约定后由abi重新计算位置
+		v.Arg = arg
+		v.Offset = 2*p.arch.WordSize/8 + arg.Offset
+		v.Length = arg.Length
+		return
+	}
+	if p.outOfScope(name) {
+		p.Error.MissError("Syntax Error", v.cursor, name+" is out of scope")
+	}
+	p.Error.MissError("Syntax Error", v.cursor, "undefined variable "+name)
+}
+
+// member $name.字段 访问结构体变量的字段, 偏移加上字段的偏移, 长度为字段元素的长度
+func (v *VarBlock) member(def *VarBlock, p *Parser) {
+	_, path, ok := strings.Cut(v.Name, ".")
+	if !ok {
+		return
+	}
+	if def.Struct == nil {
+		p.Error.MissError("Syntax Error", v.cursor, def.Name+" is not a struct")
+	}
+	offset, f := def.Struct.Member(path)
+	if f == nil {
+		p.Error.MissError("Syntax Error", v.cursor, def.Struct.Name+" has no field "+path)
+	}
+	v.Offset += offset
+	v.Length = f.Elem
+}
+
+// findArg 在所在函数的参数中查找同名参数
+func (v *VarBlock) findArg(p *Parser) *ArgBlock {
+	for node := p.ThisBlock; node != nil; node = node.Father {
+		if lb, ok := node.Value.(*LabelBlock); ok && lb.IsFunc {
+			for _, arg := range lb.Args {
+				if "$"+arg.Name == v.Name {
+					return arg
+				}
 			}
+			return nil
 		}
-		p.Back(1)
 	}
-end:
-	p.ThisBlock = oldThisBlock
+	return nil
 }
@@ -0,0 +1,73 @@
+package parser_test
+
+import (
+	"CuteASM/arch/x86"
+	"CuteASM/lexer"
+	"CuteASM/parser"
+	"slices"
+	"testing"
+)
+
+// VAR遮蔽同名的参数, ENDBLOCK之后重新引用参数
+func TestVarShadowsArg(t *testing.T) {
+	tests := []struct {
+		src    string
+		length int
+		arg    bool
+	}{
+		{"mov $b, %e0", 4, true},
+		{"var $b, qw\nmov $b, %r0", 8, false},
+		{"BLOCK\nvar $b, qw\nmov $b, %r0\nENDBLOCK\nmov $b, %e0", 4, true},
+		{"var $b, bb\nBLOCK\nmov $b, %l0\nENDBLOCK", 1, false},
+	}
+	for _, tt := range tests {
+		v := operand(t, "f:(dw b)\n"+tt.src, 0)
+		if v.Addr == nil || v.Addr.Length != tt.length || (v.Addr.Arg != nil) != tt.arg {
+			t.Errorf("%q: got %+v, want length %d arg %v", tt.src, v.Addr, tt.length, tt.arg)
+		}
+	}
+}
+
+// 变量按自身大小对齐, ENDBLOCK之后的变量复用内层的栈空间, StackRoom为最深处的用量
+func TestVarScopes(t *testing.T) {
+	src := `f:()
+VAR $a, BB
+BLOCK
+VAR $b, QW
+VAR $a, WW
+mov $b, 1
+mov $a, 1
+ENDBLOCK
+VAR $c, DW
+mov $a, 1
+mov $c, 1
+`
+	root := parser.NewParser(lexer.NewLexerText("test.asm", src), x86.NewMode(64)).Parse()
+	fn := root.Children[0]
+	if room := fn.Value.(*parser.LabelBlock).StackRoom; room != 18 {
+		t.Errorf("stack room %d, want 18", room)
+	}
+	var got [][2]int64
+	for _, n := range fn.Children {
+		if i, ok := n.Value.(*parser.Instruction); ok {
+			got = append(got, [2]int64{i.Args[0].Addr.Displacement, int64(i.Args[0].Addr.Length)})
+		}
+	}
+	if want := [][2]int64{{-16, 8}, {-18, 2}, {-1, 1}, {-8, 4}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestVarScopeErrors(t *testing.T) {
+	for _, src := range []string{
+		"BLOCK",
+		"VAR $a, DW",
+		"f:()\nENDBLOCK",
+		"f:()\nBLOCK 1\nENDBLOCK",
+		"f:()\nBLOCK\ng:()\nret",
+		"f:()\nVAR $a, DW\nVAR $a, BB",
+		"f:()\nBLOCK\nVAR $a, DW\nENDBLOCK\nmov $a, 1",
+	} {
+		wantError(t, src)
+	}
+}
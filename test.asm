@@ -1,5 +1,5 @@
 section .data
-;    message db 'Hello, World!', 0
+message: BB 'Hello, World!', 0
 ;    messageLen equ $ - message
 
 section .text
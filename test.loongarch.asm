@@ -1,130 +1,173 @@
-; ==============================
-; Assembly Code Generated By CuteASM
-; Time: 2025-07-22 12:59:48
-; Architecture: loongarch
-; OS: linux
-; ==============================
+# ==============================
+# Assembly Code Generated By CuteASM
+# Time: 2026-10-19 13:21:44
+# Architecture: loongarch
+# OS: linux
+# ==============================
 
-section .data; 
-section .text; 
-; ==============================
-; Function:test.hiMyLang2
+.type message, @object
+.size message, 14
+.type test.hiMyLang2, @function
+.type test.hiFn2, @function
+.type test.print0, @function
+.type test.main0, @function
+.type main, @function
+.extern GetStdHandle@1
+.extern WriteFile
+.section .data
+message:
+    .ascii "Hello, World!"
+    .byte 0
+.section .text
+# ==============================
+# Function:test.hiMyLang2
 test.hiMyLang2:
-    PUSH EBP
-    MOV EBP, ESP
-    SUB ESP, 8
-    MOV ECX, 
-    ADD ECX, 3
-    MOV EAX, ECX
-    CMP EAX, 6666
+    ld.w $a1, $fp, 12
+    addi.w $a1, $a1, 3
+    move $a0, $a1
+    lu12i.w $t6, 1
+    ori $t6, $t6, 2570
+    bge $a0, $t6, end_if_1
+    move $t5, $a0
+    lu12i.w $t6, 1
+    ori $t6, $t6, 2570
     if_1:
-        ADD sp, 16
-        POP bp
-        RET
+        addi.d $sp, $sp, 16
+        ld.d $fp, $sp, 0
+        addi.d $sp, $sp, 8
+        jr $ra
     end_if_1:
-        MOV DWORD[ebp-8], 123
-        CMP 123, EAX
+        addi.d $t8, $zero, 123
+        st.w $t8, $fp, -8
+        addi.d $t5, $zero, 123
+        bge $t5, $a0, else_if_2
+        addi.d $t5, $zero, 123
+        move $t6, $a0
     if_2:
-        MOV DWORD[ebp-8], 9
+        addi.d $t8, $zero, 9
+        st.w $t8, $fp, -8
     else_if_2:
-        MOV DWORD[ebp-8], 10
+        addi.d $t8, $zero, 10
+        st.w $t8, $fp, -8
     end_if_2:
-        ADD sp, 16
-        POP bp
-        RET
+        addi.d $sp, $sp, 16
+        ld.d $fp, $sp, 0
+        addi.d $sp, $sp, 8
+        jr $ra
+.size test.hiMyLang2, .-test.hiMyLang2
 
-; Function End:test.hiMyLang2
-; ==============================
+# Function End:test.hiMyLang2
+# ==============================
 
-; ==============================
-; Function:test.hiFn2
+# ==============================
+# Function:test.hiFn2
 test.hiFn2:
-    PUSH EBP
-    MOV EBP, ESP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 16
-    MOV , 9
-    MOV , 78
-    CALL test.hiMyLang2
-    MOV , 5
-    MOV , 6
-    MOV else_if_3, 1
+    addi.d $sp, $sp, -8
+    st.d $fp, $sp, 0
+    move $fp, $sp
+    addi.d $sp, $sp, -16
+    addi.d $t8, $zero, 9
+    st.w $t8, $sp, 8
+    addi.d $t8, $zero, 78
+    st.w $t8, $sp, 4
+    bl test.hiMyLang2
+    addi.d $t8, $zero, 5
+    st.w $t8, $fp, -4
+    addi.d $t8, $zero, 6
+    st.w $t8, $fp, -8
     if_3:
-        MOV , 0
+        st.w $zero, $fp, -8
     else_if_3:
-        MOV , 10
+        addi.d $t8, $zero, 10
+        st.w $t8, $fp, -8
     end_if_3:
-        CMP EAX, 0
+        bge $a0, $zero, else_if_4
+        move $t5, $a0
+        move $t6, $zero
     if_4:
-        MOV , 9
+        addi.d $t8, $zero, 9
+        st.w $t8, $fp, -8
     else_if_4:
-        ADD sp, 16
-        POP bp
-        RET
+        addi.d $sp, $sp, 16
+        ld.d $fp, $sp, 0
+        addi.d $sp, $sp, 8
+        jr $ra
     end_if_4:
-        CMP EAX, 0
+        bge $a0, $zero, end_if_5
+        move $t5, $a0
+        move $t6, $zero
     if_5:
-        MOV , 9
+        addi.d $t8, $zero, 9
+        st.w $t8, $fp, -8
     end_if_5:
-        ADD sp, 16
-        POP bp
-        RET
+        addi.d $sp, $sp, 16
+        ld.d $fp, $sp, 0
+        addi.d $sp, $sp, 8
+        jr $ra
+.size test.hiFn2, .-test.hiFn2
 
-; Function End:test.hiFn2
-; ==============================
+# Function End:test.hiFn2
+# ==============================
 
-; ==============================
-; Function:test.print0
+# ==============================
+# Function:test.print0
 test.print0:
-    PUSH EBP
-    MOV EBP, ESP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 4
-    PUSH 
-    CALL GetStdHandle@1
-    PUSH 0
-    PUSH 0
-    PUSH messageLen
-    PUSH message
-    PUSH EAX
-    CALL WriteFile
-    XOR EAX, EAX
-    ADD sp, 4
-    POP bp
-    RET
+    addi.d $sp, $sp, -8
+    st.d $fp, $sp, 0
+    move $fp, $sp
+    addi.d $sp, $sp, -4
+    addi.d $t8, $zero, -11
+    addi.d $sp, $sp, -8
+    st.d $t8, $sp, 0
+    pcaddu12i $ra, %pcadd_hi20(GetStdHandle@1)
+    jirl $ra, $ra, %pcadd_lo12(GetStdHandle@1)
+    addi.d $sp, $sp, -8
+    st.d $zero, $sp, 0
+    addi.d $sp, $sp, -8
+    st.d $zero, $sp, 0
+    addi.d $sp, $sp, -8
+    st.d $a0, $sp, 0
+    pcaddu12i $ra, %pcadd_hi20(WriteFile)
+    jirl $ra, $ra, %pcadd_lo12(WriteFile)
+    xor $a0, $a0, $a0
+    addi.d $sp, $sp, 4
+    ld.d $fp, $sp, 0
+    addi.d $sp, $sp, 8
+    jr $ra
+.size test.print0, .-test.print0
 
-; Function End:test.print0
-; ==============================
+# Function End:test.print0
+# ==============================
 
-; ==============================
-; Function:test.main0
+# ==============================
+# Function:test.main0
 test.main0:
-    PUSH EBP
-    MOV EBP, ESP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 12
-    MOV , 1
-    MOV , 100
-    CALL test.hiFn2
-    CALL test.print0
-    ADD sp, 12
-    POP bp
-    RET
+    addi.d $sp, $sp, -8
+    st.d $fp, $sp, 0
+    move $fp, $sp
+    addi.d $sp, $sp, -12
+    addi.d $t8, $zero, 1
+    st.w $t8, $sp, 12
+    addi.d $t8, $zero, 100
+    st.w $t8, $sp, 8
+    bl test.hiFn2
+    bl test.print0
+    addi.d $sp, $sp, 12
+    ld.d $fp, $sp, 0
+    addi.d $sp, $sp, 8
+    jr $ra
+.size test.main0, .-test.main0
 
-; Function End:test.main0
-; ==============================
+# Function End:test.main0
+# ==============================
 
-; ==============================
-; Function:main
+# ==============================
+# Function:main
 main:
-    PUSH EBP
-    MOV EBP, ESP
-    CALL test.main0()
-    RET
+    bl test.main0
+    jr $ra
+.size main, .-main
 
-; Function End:main
-; ==============================
+# Function End:main
+# ==============================
 
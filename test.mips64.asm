@@ -0,0 +1,185 @@
+# ==============================
+# Assembly Code Generated By CuteASM
+# Time: 2026-10-19 13:21:44
+# Architecture: mips64
+# OS: linux
+# ==============================
+
+.set noreorder
+.set noat
+.type message, @object
+.size message, 14
+.type test.hiMyLang2, @function
+.type test.hiFn2, @function
+.type test.print0, @function
+.type test.main0, @function
+.type main, @function
+.extern GetStdHandle@1
+.extern WriteFile
+.section .data
+message:
+    .ascii "Hello, World!"
+    .byte 0
+.section .text
+# ==============================
+# Function:test.hiMyLang2
+test.hiMyLang2:
+    lw $v1, 12($fp)
+    addiu $v1, $v1, 3
+    move $v0, $v1
+    slti $at, $v0, 6666
+    beq $at, $zero, end_if_1
+    nop
+    addiu $at, $zero, 6666
+    slt $t8, $v0, $at
+    slt $at, $at, $v0
+    subu $t8, $at, $t8
+    if_1:
+        daddiu $sp, $sp, 16
+        ld $fp, 0($sp)
+        jr $ra
+        daddiu $sp, $sp, 8
+    end_if_1:
+        addiu $t9, $zero, 123
+        sw $t9, -8($fp)
+        addiu $t9, $zero, 123
+        slt $at, $t9, $v0
+        beq $at, $zero, else_if_2
+        nop
+        addiu $t9, $zero, 123
+        slt $t8, $t9, $v0
+        slt $at, $v0, $t9
+        subu $t8, $at, $t8
+    if_2:
+        addiu $t9, $zero, 9
+        sw $t9, -8($fp)
+    else_if_2:
+        addiu $t9, $zero, 10
+        sw $t9, -8($fp)
+    end_if_2:
+        daddiu $sp, $sp, 16
+        ld $fp, 0($sp)
+        jr $ra
+        daddiu $sp, $sp, 8
+.size test.hiMyLang2, .-test.hiMyLang2
+
+# Function End:test.hiMyLang2
+# ==============================
+
+# ==============================
+# Function:test.hiFn2
+test.hiFn2:
+    daddiu $sp, $sp, -8
+    sd $fp, 0($sp)
+    move $fp, $sp
+    daddiu $sp, $sp, -16
+    addiu $t9, $zero, 9
+    sw $t9, 8($sp)
+    addiu $t9, $zero, 78
+    jal test.hiMyLang2
+    sw $t9, 4($sp)
+    addiu $t9, $zero, 5
+    sw $t9, -4($fp)
+    addiu $t9, $zero, 6
+    sw $t9, -8($fp)
+    if_3:
+        sw $zero, -8($fp)
+    else_if_3:
+        addiu $t9, $zero, 10
+        sw $t9, -8($fp)
+    end_if_3:
+        bgez $v0, else_if_4
+        nop
+        slt $t8, $v0, $zero
+        slt $at, $zero, $v0
+        subu $t8, $at, $t8
+    if_4:
+        addiu $t9, $zero, 9
+        sw $t9, -8($fp)
+    else_if_4:
+        daddiu $sp, $sp, 16
+        ld $fp, 0($sp)
+        jr $ra
+        daddiu $sp, $sp, 8
+    end_if_4:
+        bgez $v0, end_if_5
+        nop
+        slt $t8, $v0, $zero
+        slt $at, $zero, $v0
+        subu $t8, $at, $t8
+    if_5:
+        addiu $t9, $zero, 9
+        sw $t9, -8($fp)
+    end_if_5:
+        daddiu $sp, $sp, 16
+        ld $fp, 0($sp)
+        jr $ra
+        daddiu $sp, $sp, 8
+.size test.hiFn2, .-test.hiFn2
+
+# Function End:test.hiFn2
+# ==============================
+
+# ==============================
+# Function:test.print0
+test.print0:
+    daddiu $sp, $sp, -8
+    sd $fp, 0($sp)
+    move $fp, $sp
+    daddiu $sp, $sp, -4
+    addiu $t9, $zero, -11
+    daddiu $sp, $sp, -8
+    jal GetStdHandle@1
+    sd $t9, 0($sp)
+    daddiu $sp, $sp, -8
+    sd $zero, 0($sp)
+    daddiu $sp, $sp, -8
+    sd $zero, 0($sp)
+    daddiu $sp, $sp, -8
+    jal WriteFile
+    sd $v0, 0($sp)
+    xor $v0, $v0, $v0
+    daddiu $sp, $sp, 4
+    ld $fp, 0($sp)
+    jr $ra
+    daddiu $sp, $sp, 8
+.size test.print0, .-test.print0
+
+# Function End:test.print0
+# ==============================
+
+# ==============================
+# Function:test.main0
+test.main0:
+    daddiu $sp, $sp, -8
+    sd $fp, 0($sp)
+    move $fp, $sp
+    daddiu $sp, $sp, -12
+    addiu $t9, $zero, 1
+    sw $t9, 12($sp)
+    addiu $t9, $zero, 100
+    jal test.hiFn2
+    sw $t9, 8($sp)
+    jal test.print0
+    nop
+    daddiu $sp, $sp, 12
+    ld $fp, 0($sp)
+    jr $ra
+    daddiu $sp, $sp, 8
+.size test.main0, .-test.main0
+
+# Function End:test.main0
+# ==============================
+
+# ==============================
+# Function:main
+main:
+    jal test.main0
+    nop
+    jr $ra
+    nop
+.size main, .-main
+
+# Function End:main
+# ==============================
+
@@ -1,129 +1,179 @@
-; ==============================
-; Assembly Code Generated By CuteASM
-; Time: 2025-07-22 12:59:48
-; Architecture: riscv
-; OS: linux
-; ==============================
+# ==============================
+# Assembly Code Generated By CuteASM
+# Time: 2026-10-19 13:21:44
+# Architecture: riscv
+# OS: linux
+# ==============================
 
-section .data; 
-section .text; 
-; ==============================
-; Function:test.hiMyLang2
+.type message, @object
+.size message, 14
+.type test.hiMyLang2, @function
+.type test.hiFn2, @function
+.type test.print0, @function
+.type test.main0, @function
+.type main, @function
+.extern GetStdHandle@1
+.extern WriteFile
+.section .data
+message:
+    .ascii "Hello, World!"
+    .byte 0
+.section .text
+# ==============================
+# Function:test.hiMyLang2
 test.hiMyLang2:
-    addi sp, sp, -8
-    sw ra, 4(sp)
-    MOV x1, 
-    ADD x1, 3
-    MOV x0, x1
-    CMP x0, 6666
+    lw a1, 12(s0)
+    addiw a1, a1, 3
+    mv a0, a1
+    lui t5, 2
+    addiw t5, t5, -1526
+    bge a0, t5, end_if_1
+    lui t5, 2
+    addiw t5, t5, -1526
+    slt t4, a0, t5
+    slt t5, t5, a0
+    sub t4, t5, t4
     if_1:
-        ADD sp, 16
-        POP bp
-        RET
+        addi sp, sp, 16
+        ld s0, 0(sp)
+        addi sp, sp, 8
+        ret
     end_if_1:
-        MOV 4[ebp-8], 123
-        CMP 123, x0
+        addi t6, zero, 123
+        sw t6, -8(s0)
+        addi t6, zero, 123
+        bge t6, a0, else_if_2
+        addi t6, zero, 123
+        slt t4, t6, a0
+        slt t5, a0, t6
+        sub t4, t5, t4
     if_2:
-        MOV 4[ebp-8], 9
+        addi t6, zero, 9
+        sw t6, -8(s0)
     else_if_2:
-        MOV 4[ebp-8], 10
+        addi t6, zero, 10
+        sw t6, -8(s0)
     end_if_2:
-        ADD sp, 16
-        POP bp
-        RET
+        addi sp, sp, 16
+        ld s0, 0(sp)
+        addi sp, sp, 8
+        ret
+.size test.hiMyLang2, .-test.hiMyLang2
 
-; Function End:test.hiMyLang2
-; ==============================
+# Function End:test.hiMyLang2
+# ==============================
 
-; ==============================
-; Function:test.hiFn2
+# ==============================
+# Function:test.hiFn2
 test.hiFn2:
-    addi sp, sp, -0
-    sw ra, -4(sp)
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 16
-    MOV , 9
-    MOV , 78
-    CALL test.hiMyLang2
-    MOV , 5
-    MOV , 6
-    MOV else_if_3, 1
+    addi sp, sp, -8
+    sd s0, 0(sp)
+    mv s0, sp
+    addi sp, sp, -16
+    addi t6, zero, 9
+    sw t6, 8(sp)
+    addi t6, zero, 78
+    sw t6, 4(sp)
+    jal ra, test.hiMyLang2
+    addi t6, zero, 5
+    sw t6, -4(s0)
+    addi t6, zero, 6
+    sw t6, -8(s0)
     if_3:
-        MOV , 0
+        sw zero, -8(s0)
     else_if_3:
-        MOV , 10
+        addi t6, zero, 10
+        sw t6, -8(s0)
     end_if_3:
-        CMP x0, 0
+        bge a0, zero, else_if_4
+        slt t4, a0, zero
+        slt t5, zero, a0
+        sub t4, t5, t4
     if_4:
-        MOV , 9
+        addi t6, zero, 9
+        sw t6, -8(s0)
     else_if_4:
-        ADD sp, 16
-        POP bp
-        RET
+        addi sp, sp, 16
+        ld s0, 0(sp)
+        addi sp, sp, 8
+        ret
     end_if_4:
-        CMP x0, 0
+        bge a0, zero, end_if_5
+        slt t4, a0, zero
+        slt t5, zero, a0
+        sub t4, t5, t4
     if_5:
-        MOV , 9
+        addi t6, zero, 9
+        sw t6, -8(s0)
     end_if_5:
-        ADD sp, 16
-        POP bp
-        RET
+        addi sp, sp, 16
+        ld s0, 0(sp)
+        addi sp, sp, 8
+        ret
+.size test.hiFn2, .-test.hiFn2
 
-; Function End:test.hiFn2
-; ==============================
+# Function End:test.hiFn2
+# ==============================
 
-; ==============================
-; Function:test.print0
+# ==============================
+# Function:test.print0
 test.print0:
-    addi sp, sp, -0
-    sw ra, -4(sp)
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 4
-    PUSH 
-    CALL GetStdHandle@1
-    PUSH 0
-    PUSH 0
-    PUSH messageLen
-    PUSH message
-    PUSH x0
-    CALL WriteFile
-    XOR x0, x0
-    ADD sp, 4
-    POP bp
-    RET
+    addi sp, sp, -8
+    sd s0, 0(sp)
+    mv s0, sp
+    addi sp, sp, -4
+    addi t6, zero, -11
+    addi sp, sp, -8
+    sd t6, 0(sp)
+    1: auipc ra, %pcrel_hi(GetStdHandle@1)
+    jalr ra, %pcrel_lo(1b)(ra)
+    addi sp, sp, -8
+    sd zero, 0(sp)
+    addi sp, sp, -8
+    sd zero, 0(sp)
+    addi sp, sp, -8
+    sd a0, 0(sp)
+    1: auipc ra, %pcrel_hi(WriteFile)
+    jalr ra, %pcrel_lo(1b)(ra)
+    xor a0, a0, a0
+    addi sp, sp, 4
+    ld s0, 0(sp)
+    addi sp, sp, 8
+    ret
+.size test.print0, .-test.print0
 
-; Function End:test.print0
-; ==============================
+# Function End:test.print0
+# ==============================
 
-; ==============================
-; Function:test.main0
+# ==============================
+# Function:test.main0
 test.main0:
-    addi sp, sp, -0
-    sw ra, -4(sp)
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 12
-    MOV , 1
-    MOV , 100
-    CALL test.hiFn2
-    CALL test.print0
-    ADD sp, 12
-    POP bp
-    RET
+    addi sp, sp, -8
+    sd s0, 0(sp)
+    mv s0, sp
+    addi sp, sp, -12
+    addi t6, zero, 1
+    sw t6, 12(sp)
+    addi t6, zero, 100
+    sw t6, 8(sp)
+    jal ra, test.hiFn2
+    jal ra, test.print0
+    addi sp, sp, 12
+    ld s0, 0(sp)
+    addi sp, sp, 8
+    ret
+.size test.main0, .-test.main0
 
-; Function End:test.main0
-; ==============================
+# Function End:test.main0
+# ==============================
 
-; ==============================
-; Function:main
+# ==============================
+# Function:main
 main:
-    addi sp, sp, -0
-    sw ra, -4(sp)
-    CALL test.main0()
-    RET
+    jal ra, test.main0
+    ret
+.size main, .-main
 
-; Function End:main
-; ==============================
+# Function End:main
+# ==============================
 
@@ -1,37 +1,46 @@
 ; ==============================
 ; Assembly Code Generated By CuteASM
-; Time: 2025-07-22 12:59:48
+; Time: 2026-10-19 13:21:44
 ; Architecture: x86_64
 ; OS: linux
 ; ==============================
 
-section .data; 
-section .text; 
+bits 64
+default rel
+extern GetStdHandle@1
+extern WriteFile
+section .data
+message:
+    db "Hello, World!"
+    db 0
+section .text
 ; ==============================
 ; Function:test.hiMyLang2
 test.hiMyLang2:
-    PUSH RBP
-    MOV RBP, RSP
-    SUB RSP, 8
-    MOV RBX, 
-    ADD RBX, 3
-    MOV RAX, RBX
-    CMP RAX, 6666
+    mov ecx, dword [rbp+12]
+    add ecx, 3
+    mov eax, ecx
+    cmp eax, 6666
+    jnl end_if_1
     if_1:
-        ADD sp, 16
-        POP bp
-        RET
+        add rsp, 16
+        pop rbp
+        ret
     end_if_1:
-        MOV DWORD[ebp-8], 123
-        CMP 123, RAX
+        mov dword [rbp-8], 123
+        push rcx
+        mov ecx, 123
+        cmp ecx, eax
+        pop rcx
+        jnl else_if_2
     if_2:
-        MOV DWORD[ebp-8], 9
+        mov dword [rbp-8], 9
     else_if_2:
-        MOV DWORD[ebp-8], 10
+        mov dword [rbp-8], 10
     end_if_2:
-        ADD sp, 16
-        POP bp
-        RET
+        add rsp, 16
+        pop rbp
+        ret
 
 ; Function End:test.hiMyLang2
 ; ==============================
@@ -39,37 +48,36 @@ test.hiMyLang2:
 ; ==============================
 ; Function:test.hiFn2
 test.hiFn2:
-    PUSH RBP
-    MOV RBP, RSP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 16
-    MOV , 9
-    MOV , 78
-    CALL test.hiMyLang2
-    MOV , 5
-    MOV , 6
-    MOV else_if_3, 1
+    push rbp
+    mov rbp, rsp
+    sub rsp, 16
+    mov dword [rsp+8], 9
+    mov dword [rsp+4], 78
+    call test.hiMyLang2
+    mov dword [rbp-4], 5
+    mov dword [rbp-8], 6
     if_3:
-        MOV , 0
+        mov dword [rbp-8], 0
     else_if_3:
-        MOV , 10
+        mov dword [rbp-8], 10
     end_if_3:
-        CMP RAX, 0
+        cmp eax, 0
+        jnl else_if_4
     if_4:
-        MOV , 9
+        mov dword [rbp-8], 9
     else_if_4:
-        ADD sp, 16
-        POP bp
-        RET
+        add rsp, 16
+        pop rbp
+        ret
     end_if_4:
-        CMP RAX, 0
+        cmp eax, 0
+        jnl end_if_5
     if_5:
-        MOV , 9
+        mov dword [rbp-8], 9
     end_if_5:
-        ADD sp, 16
-        POP bp
-        RET
+        add rsp, 16
+        pop rbp
+        ret
 
 ; Function End:test.hiFn2
 ; ==============================
@@ -77,23 +85,19 @@ test.hiFn2:
 ; ==============================
 ; Function:test.print0
 test.print0:
-    PUSH RBP
-    MOV RBP, RSP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 4
-    PUSH 
-    CALL GetStdHandle@1
-    PUSH 0
-    PUSH 0
-    PUSH messageLen
-    PUSH message
-    PUSH RAX
-    CALL WriteFile
-    XOR RAX, RAX
-    ADD sp, 4
-    POP bp
-    RET
+    push rbp
+    mov rbp, rsp
+    sub rsp, 4
+    push -11
+    call GetStdHandle@1
+    push 0
+    push 0
+    push rax
+    call WriteFile
+    xor eax, eax
+    add rsp, 4
+    pop rbp
+    ret
 
 ; Function End:test.print0
 ; ==============================
@@ -101,18 +105,16 @@ test.print0:
 ; ==============================
 ; Function:test.main0
 test.main0:
-    PUSH RBP
-    MOV RBP, RSP
-    PUSH bp
-    MOV bp, sp
-    SUB sp, 12
-    MOV , 1
-    MOV , 100
-    CALL test.hiFn2
-    CALL test.print0
-    ADD sp, 12
-    POP bp
-    RET
+    push rbp
+    mov rbp, rsp
+    sub rsp, 12
+    mov dword [rsp+12], 1
+    mov dword [rsp+8], 100
+    call test.hiFn2
+    call test.print0
+    add rsp, 12
+    pop rbp
+    ret
 
 ; Function End:test.main0
 ; ==============================
@@ -120,10 +122,8 @@ test.main0:
 ; ==============================
 ; Function:main
 main:
-    PUSH RBP
-    MOV RBP, RSP
-    CALL test.main0()
-    RET
+    call test.main0
+    ret
 
 ; Function End:main
 ; ==============================
@@ -21,3 +21,13 @@ func GetLength(name string) int {
 	}
 	return 0
 }
+
+// GetLengthName 长度对应的类型名称, 如4为DW
+func GetLengthName(length int) string {
+	for _, name := range []string{"BB", "WW", "DW", "QW", "TW", "OW", "YW", "ZW"} {
+		if GetLength(name) == length {
+			return name
+		}
+	}
+	return ""
+}